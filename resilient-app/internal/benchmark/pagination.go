@@ -0,0 +1,144 @@
+// Package benchmark measures read paths against the live database, so claims
+// about behavior under load can be checked at realistic data sizes (see the
+// seeding endpoint for producing that data).
+package benchmark
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/demo/resilient-app/internal/database"
+)
+
+// Pagination strategies compared by the report
+const (
+	StrategyOffset = "offset"
+	StrategyKeyset = "keyset"
+)
+
+// depths are the positions in the table, as shares of its rows, at which
+// pages are read
+var depths = []float64{0, 0.01, 0.1, 0.5, 0.9}
+
+// Options for a pagination benchmark
+type Options struct {
+	PageSize int
+	// Samples is the number of timed reads per strategy and depth
+	Samples int
+}
+
+// Report of a pagination benchmark
+type Report struct {
+	Rows       int              `json:"rows"`
+	PageSize   int              `json:"page_size"`
+	Samples    int              `json:"samples"`
+	Strategies []StrategyResult `json:"strategies"`
+	StartedAt  time.Time        `json:"started_at"`
+	DurationMS float64          `json:"duration_ms"`
+}
+
+// StrategyResult lists the read latency of one strategy at every depth
+type StrategyResult struct {
+	Strategy string        `json:"strategy"`
+	Depths   []DepthResult `json:"depths"`
+}
+
+// DepthResult is the latency of reading a page that starts Offset rows in
+type DepthResult struct {
+	Offset int     `json:"offset"`
+	P50MS  float64 `json:"p50_ms"`
+	P95MS  float64 `json:"p95_ms"`
+	MaxMS  float64 `json:"max_ms"`
+}
+
+// ErrNoData is returned when there are no users to page through
+var ErrNoData = errors.New("no users to paginate; seed some first")
+
+// Pagination times reading a page at several depths of the users table with
+// LIMIT/OFFSET and with keyset pagination. Offset reads get slower the deeper
+// the page, keyset reads should not.
+func Pagination(ctx context.Context, db *database.DB, opts Options) (*Report, error) {
+	report := &Report{PageSize: opts.PageSize, Samples: opts.Samples, StartedAt: time.Now()}
+
+	rows, err := db.CountUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if rows == 0 {
+		return nil, ErrNoData
+	}
+	report.Rows = rows
+
+	offsetResult := StrategyResult{Strategy: StrategyOffset}
+	keysetResult := StrategyResult{Strategy: StrategyKeyset}
+	for _, depth := range depths {
+		offset := int(depth * float64(rows))
+
+		// The key at this depth is looked up once, outside the timings
+		first, err := db.GetUsersPageByOffset(ctx, offset, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(first) == 0 {
+			continue
+		}
+		afterID := first[0].ID - 1
+
+		latencies, err := sample(ctx, opts.Samples, func() error {
+			_, err := db.GetUsersPageByOffset(ctx, offset, opts.PageSize)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		offsetResult.Depths = append(offsetResult.Depths, summarize(offset, latencies))
+
+		latencies, err = sample(ctx, opts.Samples, func() error {
+			_, err := db.GetUsersPageAfter(ctx, afterID, opts.PageSize)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		keysetResult.Depths = append(keysetResult.Depths, summarize(offset, latencies))
+	}
+
+	report.Strategies = []StrategyResult{offsetResult, keysetResult}
+	report.DurationMS = milliseconds(time.Since(report.StartedAt))
+	return report, nil
+}
+
+func sample(ctx context.Context, n int, read func() error) ([]time.Duration, error) {
+	latencies := make([]time.Duration, 0, n)
+	for i := 0; i < n; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		if err := read(); err != nil {
+			return nil, err
+		}
+		latencies = append(latencies, time.Since(start))
+	}
+	return latencies, nil
+}
+
+func summarize(offset int, latencies []time.Duration) DepthResult {
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	percentile := func(p float64) time.Duration {
+		return latencies[int(math.Ceil(p*float64(len(latencies))))-1]
+	}
+	return DepthResult{
+		Offset: offset,
+		P50MS:  milliseconds(percentile(0.5)),
+		P95MS:  milliseconds(percentile(0.95)),
+		MaxMS:  milliseconds(latencies[len(latencies)-1]),
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Microsecond)) / 1000
+}
@@ -0,0 +1,210 @@
+// Package cache is an in-memory LRU split into shards, each behind its own
+// lock. Every request that reads the database also writes the cache, so with
+// a single lock the load generator's concurrency would queue on it and show
+// up in p99; keys spread over shards only contend with keys in the same one.
+package cache
+
+import (
+	"container/list"
+	"hash/maphash"
+	"sync"
+	"time"
+
+	"github.com/demo/resilient-app/internal/metrics"
+)
+
+// Reasons reported in cache_evictions_total
+const (
+	EvictedCapacity = "capacity"
+	EvictedExpired  = "expired"
+)
+
+var (
+	requestsTotal = metrics.NewCounterVec(
+		metrics.Opts{
+			Name: "cache_requests_total",
+			Help: "Total number of cache lookups, by result",
+		},
+		[]string{"cache", "result"},
+	)
+	evictionsTotal = metrics.NewCounterVec(
+		metrics.Opts{
+			Name: "cache_evictions_total",
+			Help: "Total number of entries evicted, by reason",
+		},
+		[]string{"cache", "reason"},
+	)
+	entriesGauge = metrics.NewGaugeVec(
+		metrics.Opts{
+			Name: "cache_entries",
+			Help: "Number of entries held",
+		},
+		[]string{"cache"},
+	)
+)
+
+// Cache holds up to a fixed number of entries for up to a TTL. Each shard
+// evicts its own least recently used entry, so the bound is approximate when
+// keys are unevenly spread.
+type Cache[V any] struct {
+	name   string
+	ttl    time.Duration
+	seed   maphash.Seed
+	shards []*shard[V]
+}
+
+type shard[V any] struct {
+	capacity int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type entry[V any] struct {
+	key      string
+	value    V
+	storedAt time.Time
+}
+
+// New creates a cache of maxEntries split over shards, rounded up to a power
+// of two
+func New[V any](name string, maxEntries, shards int, ttl time.Duration) *Cache[V] {
+	n := 1
+	for n < shards {
+		n <<= 1
+	}
+	capacity := (maxEntries + n - 1) / n
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	c := &Cache[V]{
+		name:   name,
+		ttl:    ttl,
+		seed:   maphash.MakeSeed(),
+		shards: make([]*shard[V], n),
+	}
+	for i := range c.shards {
+		c.shards[i] = &shard[V]{
+			capacity: capacity,
+			order:    list.New(),
+			entries:  make(map[string]*list.Element),
+		}
+	}
+	entriesGauge.WithLabelValues(name).Set(0)
+	return c
+}
+
+func (c *Cache[V]) shard(key string) *shard[V] {
+	return c.shards[maphash.String(c.seed, key)&uint64(len(c.shards)-1)]
+}
+
+// Get returns the value stored under key unless it has expired
+func (c *Cache[V]) Get(key string) (V, bool) {
+	s := c.shard(key)
+	now := time.Now()
+
+	s.mu.Lock()
+	element, ok := s.entries[key]
+	expired := ok && now.Sub(element.Value.(*entry[V]).storedAt) >= c.ttl
+	var value V
+	switch {
+	case expired:
+		s.remove(element)
+		ok = false
+	case ok:
+		s.order.MoveToFront(element)
+		value = element.Value.(*entry[V]).value
+	}
+	s.mu.Unlock()
+
+	if expired {
+		c.evicted(EvictedExpired, 1)
+	}
+	result := "miss"
+	if ok {
+		result = "hit"
+	}
+	requestsTotal.WithLabelValues(c.name, result).Inc()
+	return value, ok
+}
+
+// Set stores value under key, evicting the shard's least recently used entry
+// when it is full
+func (c *Cache[V]) Set(key string, value V) {
+	s := c.shard(key)
+	now := time.Now()
+
+	s.mu.Lock()
+	if element, ok := s.entries[key]; ok {
+		e := element.Value.(*entry[V])
+		e.value, e.storedAt = value, now
+		s.order.MoveToFront(element)
+		s.mu.Unlock()
+		return
+	}
+	s.entries[key] = s.order.PushFront(&entry[V]{key: key, value: value, storedAt: now})
+	evicted := 0
+	for s.order.Len() > s.capacity {
+		s.remove(s.order.Back())
+		evicted++
+	}
+	s.mu.Unlock()
+
+	entriesGauge.WithLabelValues(c.name).Inc()
+	c.evicted(EvictedCapacity, evicted)
+}
+
+// Delete removes the value stored under key, if any
+func (c *Cache[V]) Delete(key string) {
+	s := c.shard(key)
+
+	s.mu.Lock()
+	element, ok := s.entries[key]
+	if ok {
+		s.remove(element)
+	}
+	s.mu.Unlock()
+
+	if ok {
+		entriesGauge.WithLabelValues(c.name).Dec()
+	}
+}
+
+// Values returns every unexpired value, in no particular order. It locks one
+// shard at a time, so it is not a consistent snapshot.
+func (c *Cache[V]) Values() []V {
+	now := time.Now()
+	var values []V
+	for _, s := range c.shards {
+		expired := 0
+		s.mu.Lock()
+		for element := s.order.Front(); element != nil; {
+			next := element.Next()
+			if e := element.Value.(*entry[V]); now.Sub(e.storedAt) < c.ttl {
+				values = append(values, e.value)
+			} else {
+				s.remove(element)
+				expired++
+			}
+			element = next
+		}
+		s.mu.Unlock()
+		c.evicted(EvictedExpired, expired)
+	}
+	return values
+}
+
+func (c *Cache[V]) evicted(reason string, n int) {
+	if n == 0 {
+		return
+	}
+	evictionsTotal.WithLabelValues(c.name, reason).Add(float64(n))
+	entriesGauge.WithLabelValues(c.name).Add(-float64(n))
+}
+
+func (s *shard[V]) remove(element *list.Element) {
+	s.order.Remove(element)
+	delete(s.entries, element.Value.(*entry[V]).key)
+}
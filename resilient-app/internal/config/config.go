@@ -0,0 +1,676 @@
+// Package config loads the application configuration from the environment,
+// an optional config file and the profile's defaults into a typed Config that
+// is handed to every subsystem, and reloads it from a mounted ConfigMap or on
+// SIGHUP (see Reloader).
+// Values are validated with the configcheck rules, so a misconfigured pod
+// fails at startup with every problem listed instead of silently running
+// with defaults.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/demo/resilient-app/internal/configcheck"
+	"github.com/demo/resilient-app/internal/profile"
+	"github.com/demo/resilient-app/internal/shutdown"
+)
+
+const (
+	DefaultPort    = "8080"
+	DefaultVersion = "1.0.0"
+
+	// DefaultFeatures apply when FEATURE_FLAGS is unset
+	DefaultFeatures = "graceful_degradation,circuit_breaker"
+
+	// DefaultDedupRoutes apply when DEDUP_ROUTES is unset
+	DefaultDedupRoutes = "POST /api/users,POST /api/orders"
+
+	// DefaultRouteTimeouts apply when ROUTE_TIMEOUTS is unset; other routes
+	// get REQUEST_TIMEOUT
+	DefaultRouteTimeouts = "GET /api/status=5s,GET /api/sagas=5s,GET /api/downstream=5s"
+
+	// DefaultRedactFields apply when RESPONSE_REDACT_FIELDS is unset
+	DefaultRedactFields = "email=pii:read"
+	// DefaultRedactScope is the scope a field listed without one requires
+	DefaultRedactScope = "pii:read"
+)
+
+// Config is the fully resolved configuration of the process
+type Config struct {
+	Profile string
+	// ProfileDefaults are the keys no other source set, taken from the profile
+	ProfileDefaults []string
+	Version         string
+	Features        []string
+	Cluster         Cluster
+
+	Server     Server
+	Shutdown   Shutdown
+	Logging    Logging
+	Metrics    Metrics
+	Database   Database
+	Health     Health
+	Admin      Admin
+	Redaction  Redaction
+	Resilience Resilience
+	Policy     Policy
+	Downstream Downstream
+	SelfProbe  SelfProbe
+	// Affinity applies when the session_affinity feature is enabled
+	Affinity Affinity
+	// RouteBreaker applies when the route_breaker feature is enabled
+	RouteBreaker RouteBreaker
+	// Dedup applies when the request_dedup feature is enabled
+	Dedup    Dedup
+	Timeouts Timeouts
+	Workers  Workers
+	Memory   Memory
+	Reload   Reload
+	Journal  Journal
+	Dump     Dump
+
+	OpenAPIValidateResponses bool
+	ChaosEndpoints           bool
+
+	lookup configcheck.Lookup
+}
+
+// Cluster names the cluster and region the pod runs in, so multi-cluster
+// failover shows where a request was served; both are optional and read at
+// startup
+type Cluster struct {
+	Name   string
+	Region string
+}
+
+type Server struct {
+	Port              string
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+}
+
+type Shutdown struct {
+	Timeout time.Duration
+	Budget  shutdown.Budget
+}
+
+type Logging struct {
+	Level      string
+	Format     string
+	RedactKeys []string
+	// PIIMode is how personal data is written, one of the logging.PII modes
+	PIIMode string
+}
+
+type Metrics struct {
+	Backend        string
+	StatsDAddr     string
+	StatsDPrefix   string
+	StatsDTags     []string
+	PushgatewayURL string
+	PushgatewayJob string
+	FlushTimeout   time.Duration
+}
+
+// Database holds the connection and pool settings; Password is never logged
+type Database struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	Name     string
+	SSLMode  string
+	// Paths to the CA that verifies the server and to the client certificate
+	// and key, e.g. in a mounted Secret; read on every new connection
+	SSLRootCert string
+	SSLCert     string
+	SSLKey      string
+	// URL is DATABASE_URL, whose parts take precedence over the DB_* keys
+	URL string
+
+	// Replicas serve reads from DB_REPLICA_URLS, each health checked every
+	// ReplicaCheckInterval
+	Replicas             []Replica
+	ReplicaCheckInterval time.Duration
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// StatementCacheSize is how many prepared statements each connection
+	// keeps; 0 sends every query unprepared, e.g. behind PgBouncer in
+	// transaction mode
+	StatementCacheSize int
+	// QueryTimeout bounds each operation other than streams and bulk loads,
+	// unless OperationTimeouts lists it by name ("get_users")
+	QueryTimeout      time.Duration
+	OperationTimeouts map[string]time.Duration
+	// SlowQueryThreshold logs operations taking at least this long by name,
+	// without their SQL or arguments; 0 disables
+	SlowQueryThreshold time.Duration
+	// ProbeInterval is how often the primary is probed on a connection of
+	// its own, outside the pool
+	ProbeInterval time.Duration
+	// ReconnectAfter is how long calls on the primary fail before its pool
+	// is reset and its breakers closed once it pings again; 0 disables
+	ReconnectAfter time.Duration
+	// SchemaPhase is where the migration renaming users.name to full_name
+	// stands: old, dual_write, dual_read or new
+	SchemaPhase string
+	// At most MaxConcurrentQueries operations run on the primary at once,
+	// 0 for no limit, with up to BulkheadQueue more waiting for a slot.
+	// Health check pings aren't limited.
+	MaxConcurrentQueries int
+	BulkheadQueue        int
+
+	// The breaker trips once BreakerMinRequests requests in its interval
+	// failed at BreakerFailureRatio or more, or succeeded slower than
+	// BreakerSlowCall at BreakerSlowCallRate or more (0 disables)
+	BreakerMinRequests  uint32
+	BreakerFailureRatio float64
+	BreakerSlowCall     time.Duration
+	BreakerSlowCallRate float64
+	// BreakerHalfOpen picks the trial calls of a half-open breaker: "probe"
+	// sends only the background prober's queries, "trickle" lets up to
+	// BreakerHalfOpenRequests requests through. The request count is read at
+	// startup.
+	BreakerHalfOpen         string
+	BreakerHalfOpenRequests uint32
+
+	// Transient failures are retried up to RetryAttempts attempts in all,
+	// waiting a random delay up to RetryBaseDelay doubled per attempt and
+	// capped at RetryMaxDelay
+	RetryAttempts  int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+}
+
+// Replica is a read replica. Parts its URL leaves out, and its TLS settings,
+// are the primary's.
+type Replica struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	Name     string
+}
+
+type Health struct {
+	CheckInterval       time.Duration
+	ReadinessTimeout    time.Duration
+	BreakerOpenDegraded time.Duration
+	// A database ping slower than DBSlowPing is degraded; one that fails or
+	// takes DBPingTimeout is unhealthy
+	DBSlowPing    time.Duration
+	DBPingTimeout time.Duration
+	// Token, when set, is required in X-Health-Token for the full /health
+	// report; other callers get the status alone
+	Token string
+}
+
+type Admin struct {
+	Token string
+	Auth  string
+}
+
+// Redaction hides fields of JSON responses from callers whose claims lack the
+// scope each requires
+type Redaction struct {
+	// Fields maps a JSON field name, at any depth, to the scope required to
+	// see its value; empty when RESPONSE_REDACT_FIELDS is "none"
+	Fields map[string]string
+}
+
+// Memory tunes the garbage collector; GOGC and GOMEMLIMIT in the environment
+// take precedence
+type Memory struct {
+	// GCPercent of 0 keeps the runtime default of 100
+	GCPercent int
+	// LimitRatio is the share of the container memory limit used as the soft
+	// memory limit; GOMEMLIMIT=off runs without one
+	LimitRatio float64
+	BallastMB  int
+}
+
+// Workers sizes the pool running handler-spawned background tasks
+type Workers struct {
+	Size        int
+	QueueSize   int
+	TaskTimeout time.Duration
+}
+
+type Resilience struct {
+	RateLimitRequests     int
+	RateLimitWindow       time.Duration
+	LookupMissLimit       int
+	LookupMissWindow      time.Duration
+	LookupMinResponseTime time.Duration
+	ErrorVerbosity        string
+
+	// Users read from the database are kept for degraded responses, up to
+	// FallbackCacheEntries spread over FallbackCacheShards, for FallbackCacheTTL
+	FallbackCacheEntries int
+	FallbackCacheShards  int
+	FallbackCacheTTL     time.Duration
+}
+
+type Policy struct {
+	URL      string
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// SelfProbe requests the app's own public URLs, through the Service or the
+// ingress, every Interval; no URLs disables it. Read at startup.
+type SelfProbe struct {
+	URLs     []string
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// Affinity issues a signed cookie naming the pod that served a client, so the
+// demo can show which requests a sticky load balancer kept on one pod. Secret
+// signs the cookie and must be shared by every pod for them to verify each
+// other's cookies; without one each pod signs with a random key. Read at
+// startup.
+type Affinity struct {
+	CookieName string
+	Secret     string
+	MaxAge     time.Duration
+}
+
+// Downstream configures the resilient client; zero OutlierFailures and
+// EjectionTime leave the client's own defaults in place
+type Downstream struct {
+	URLs            []string
+	Timeout         time.Duration
+	OutlierFailures int
+	EjectionTime    time.Duration
+	CacheEntries    int
+	StaleIfError    time.Duration
+	RateLimit       float64
+	RateBurst       int
+	RateMaxWait     time.Duration
+	DNSTTL          time.Duration
+	DNSStale        time.Duration
+}
+
+// RouteBreaker trips a route once ErrorRate of at least MinRequests requests
+// in Window failed; requests slower than SlowCall count as failed (0 disables)
+type RouteBreaker struct {
+	ErrorRate   float64
+	MinRequests int
+	Window      time.Duration
+	SlowCall    time.Duration
+	Cooldown    time.Duration
+}
+
+// Dedup lists the routes ("POST /api/users") whose identical requests are
+// coalesced, each with the window in which a repeat counts as a duplicate
+type Dedup struct {
+	Routes map[string]time.Duration
+}
+
+// Timeouts bound how long a request's work may take, per route ("GET
+// /api/users/{id}") with Default for the others; 0 means no timeout
+type Timeouts struct {
+	Default time.Duration
+	Routes  map[string]time.Duration
+}
+
+// Route returns the timeout for a route
+func (t Timeouts) Route(route string) time.Duration {
+	if timeout, ok := t.Routes[route]; ok {
+		return timeout
+	}
+	return t.Default
+}
+
+// Journal keeps the last Entries requests in a ring file at Path for the
+// post-mortem subcommand; no path disables it. Read at startup.
+type Journal struct {
+	Path    string
+	Entries int
+}
+
+// Dump writes profile dumps to Dir on SIGUSR2 or POST /admin/dump, keeping
+// the latest Keep; no directory disables them. MutexFraction samples one in
+// that many mutex contention events, 0 for none. Read at startup.
+type Dump struct {
+	Dir           string
+	Keep          int
+	MutexFraction int
+}
+
+// Reload controls how often a mounted ConfigMap is checked for changes
+type Reload struct {
+	PollInterval time.Duration
+}
+
+// Load validates the configuration visible through lookup and resolves it.
+// The error lists every invalid key; warnings don't prevent loading.
+func Load(lookup configcheck.Lookup) (*Config, error) {
+	result := configcheck.Validate(lookup)
+	if !result.Valid {
+		var errs []error
+		for _, issue := range result.Issues {
+			if issue.Severity != configcheck.SeverityError {
+				continue
+			}
+			if issue.Value != "" {
+				errs = append(errs, fmt.Errorf("%s=%q: %s", issue.Key, issue.Value, issue.Message))
+			} else {
+				errs = append(errs, fmt.Errorf("%s: %s", issue.Key, issue.Message))
+			}
+		}
+		return nil, fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+
+	// DATABASE_URL stands in for the connection keys it sets
+	if dsn, _ := lookup("DATABASE_URL"); dsn != "" {
+		values, err := configcheck.ParseDatabaseURL(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid configuration: DATABASE_URL: %w", err)
+		}
+		lookup = configcheck.Overlay(lookup, values)
+	}
+
+	e := env(lookup)
+	statsdHost := e.str("DD_AGENT_HOST", "127.0.0.1")
+
+	return &Config{
+		Profile:  e.str("PROFILE", profile.Default),
+		Version:  e.str("APP_VERSION", DefaultVersion),
+		Features: e.list("FEATURE_FLAGS", DefaultFeatures),
+		Cluster: Cluster{
+			Name:   e.str("CLUSTER_NAME", ""),
+			Region: e.str("REGION", ""),
+		},
+
+		Server: Server{
+			Port:              e.str("PORT", DefaultPort),
+			ReadTimeout:       e.duration("SERVER_READ_TIMEOUT", 10*time.Second),
+			WriteTimeout:      e.duration("SERVER_WRITE_TIMEOUT", 10*time.Second),
+			IdleTimeout:       e.duration("SERVER_IDLE_TIMEOUT", 60*time.Second),
+			ReadHeaderTimeout: e.duration("SERVER_READ_HEADER_TIMEOUT", 5*time.Second),
+		},
+		Shutdown: Shutdown{
+			Timeout: e.duration("GRACEFUL_SHUTDOWN_TIMEOUT", 30*time.Second),
+			Budget: shutdown.Budget{
+				Drain: e.float("SHUTDOWN_DRAIN_SHARE", shutdown.DefaultBudget.Drain),
+				Hooks: e.float("SHUTDOWN_HOOKS_SHARE", shutdown.DefaultBudget.Hooks),
+				Close: e.float("SHUTDOWN_CLOSE_SHARE", shutdown.DefaultBudget.Close),
+			},
+		},
+		Logging: Logging{
+			Level:      e.str("LOG_LEVEL", "info"),
+			Format:     e.str("LOG_FORMAT", "json"),
+			RedactKeys: e.list("LOG_REDACT_KEYS", ""),
+			PIIMode:    e.str("LOG_PII_MODE", "hash"),
+		},
+		Metrics: Metrics{
+			Backend:        e.str("METRICS_BACKEND", "prometheus"),
+			StatsDAddr:     e.str("STATSD_ADDR", statsdHost+":8125"),
+			StatsDPrefix:   e.str("STATSD_PREFIX", "resilient_app."),
+			StatsDTags:     e.list("STATSD_TAGS", ""),
+			PushgatewayURL: e.str("PUSHGATEWAY_URL", ""),
+			PushgatewayJob: e.str("PUSHGATEWAY_JOB", "resilient-app"),
+			FlushTimeout:   e.duration("METRICS_FLUSH_TIMEOUT", 2*time.Second),
+		},
+		Database: Database{
+			Host:               e.str("DB_HOST", "postgres"),
+			Port:               e.str("DB_PORT", "5432"),
+			User:               e.str("DB_USER", "postgres"),
+			Password:           e.str("DB_PASSWORD", "postgres"),
+			Name:               e.str("DB_NAME", "resilient_db"),
+			SSLMode:            e.str("DB_SSLMODE", "disable"),
+			SSLRootCert:        e.str("DB_SSL_ROOT_CERT", ""),
+			SSLCert:            e.str("DB_SSL_CERT", ""),
+			SSLKey:             e.str("DB_SSL_KEY", ""),
+			URL:                e.str("DATABASE_URL", ""),
+			Replicas:           e.replicas("DB_REPLICA_URLS"),
+			MaxOpenConns:       e.int("DB_MAX_OPEN_CONNS", 25),
+			MaxIdleConns:       e.int("DB_MAX_IDLE_CONNS", 5),
+			ConnMaxLifetime:    e.duration("DB_CONN_MAX_LIFETIME", 5*time.Minute),
+			ConnMaxIdleTime:    e.duration("DB_CONN_MAX_IDLE_TIME", time.Minute),
+			StatementCacheSize: e.int("DB_STATEMENT_CACHE_SIZE", 512),
+			QueryTimeout:       e.duration("DB_QUERY_TIMEOUT", 5*time.Second),
+			OperationTimeouts:  e.routeWindows("DB_OPERATION_TIMEOUTS", "", 0),
+			SlowQueryThreshold: e.duration("DB_SLOW_QUERY_THRESHOLD", time.Second),
+			ProbeInterval:      e.duration("DB_PROBE_INTERVAL", 5*time.Second),
+			ReconnectAfter:     e.duration("DB_RECONNECT_AFTER", 30*time.Second),
+			SchemaPhase:        e.str("DB_SCHEMA_PHASE", "old"),
+
+			MaxConcurrentQueries: e.int("DB_MAX_CONCURRENT_QUERIES", 20),
+			BulkheadQueue:        e.int("DB_BULKHEAD_QUEUE", 50),
+
+			BreakerMinRequests:      uint32(e.int("CIRCUIT_BREAKER_THRESHOLD", 2)),
+			BreakerFailureRatio:     e.float("CIRCUIT_BREAKER_FAILURE_RATIO", 0.5),
+			BreakerSlowCall:         e.duration("CIRCUIT_BREAKER_SLOW_CALL", 2*time.Second),
+			BreakerSlowCallRate:     e.float("CIRCUIT_BREAKER_SLOW_CALL_RATE", 0.5),
+			BreakerHalfOpen:         e.str("CIRCUIT_BREAKER_HALF_OPEN", "probe"),
+			BreakerHalfOpenRequests: uint32(e.int("CIRCUIT_BREAKER_HALF_OPEN_REQUESTS", 3)),
+
+			RetryAttempts:  e.int("DB_RETRY_ATTEMPTS", 3),
+			RetryBaseDelay: e.duration("DB_RETRY_BASE_DELAY", 50*time.Millisecond),
+			RetryMaxDelay:  e.duration("DB_RETRY_MAX_DELAY", time.Second),
+
+			ReplicaCheckInterval: e.duration("DB_REPLICA_CHECK_INTERVAL", 5*time.Second),
+		},
+		Health: Health{
+			CheckInterval:       e.duration("HEALTH_CHECK_INTERVAL", 30*time.Second),
+			ReadinessTimeout:    e.duration("READINESS_CHECK_TIMEOUT", 5*time.Second),
+			BreakerOpenDegraded: e.duration("BREAKER_OPEN_DEGRADED_AFTER", 60*time.Second),
+			DBSlowPing:          e.duration("HEALTH_DB_SLOW_PING", time.Second),
+			DBPingTimeout:       e.duration("HEALTH_DB_PING_TIMEOUT", 5*time.Second),
+			Token:               e.str("HEALTH_TOKEN", ""),
+		},
+		Admin: Admin{
+			Token: e.str("ADMIN_TOKEN", ""),
+			Auth:  e.str("ADMIN_AUTH", "required"),
+		},
+		Redaction: Redaction{
+			Fields: e.fieldScopes("RESPONSE_REDACT_FIELDS", DefaultRedactFields),
+		},
+		Resilience: Resilience{
+			RateLimitRequests:     e.int("RATE_LIMIT_REQUESTS", 600),
+			RateLimitWindow:       e.duration("RATE_LIMIT_WINDOW", time.Minute),
+			LookupMissLimit:       e.int("LOOKUP_MISS_LIMIT", 20),
+			LookupMissWindow:      e.duration("LOOKUP_MISS_WINDOW", time.Minute),
+			LookupMinResponseTime: e.duration("LOOKUP_MIN_RESPONSE_TIME", 50*time.Millisecond),
+			ErrorVerbosity:        e.str("ERROR_VERBOSITY", "terse"),
+
+			FallbackCacheEntries: e.int("FALLBACK_CACHE_ENTRIES", 10000),
+			FallbackCacheShards:  e.int("FALLBACK_CACHE_SHARDS", 32),
+			FallbackCacheTTL:     e.duration("FALLBACK_CACHE_TTL", 10*time.Minute),
+		},
+		Policy: Policy{
+			URL:      e.str("POLICY_URL", ""),
+			Interval: e.duration("POLICY_INTERVAL", 5*time.Second),
+			Timeout:  e.duration("POLICY_TIMEOUT", time.Second),
+		},
+		Downstream: Downstream{
+			URLs:            e.list("DOWNSTREAM_URL", ""),
+			Timeout:         e.duration("DOWNSTREAM_TIMEOUT", 2*time.Second),
+			OutlierFailures: e.int("DOWNSTREAM_OUTLIER_FAILURES", 0),
+			EjectionTime:    e.duration("DOWNSTREAM_EJECTION_TIME", 0),
+			CacheEntries:    e.int("DOWNSTREAM_CACHE_ENTRIES", 256),
+			StaleIfError:    e.duration("DOWNSTREAM_STALE_IF_ERROR", 5*time.Minute),
+			RateLimit:       e.float("DOWNSTREAM_RATE_LIMIT", 0),
+			RateBurst:       e.int("DOWNSTREAM_RATE_BURST", 10),
+			RateMaxWait:     e.duration("DOWNSTREAM_RATE_MAX_WAIT", 250*time.Millisecond),
+			DNSTTL:          e.duration("DOWNSTREAM_DNS_TTL", 30*time.Second),
+			DNSStale:        e.duration("DOWNSTREAM_DNS_STALE", 5*time.Minute),
+		},
+		SelfProbe: SelfProbe{
+			URLs:     e.list("SELF_PROBE_URL", ""),
+			Interval: e.duration("SELF_PROBE_INTERVAL", 15*time.Second),
+			Timeout:  e.duration("SELF_PROBE_TIMEOUT", 5*time.Second),
+		},
+		Affinity: Affinity{
+			CookieName: e.str("AFFINITY_COOKIE_NAME", "resilient_pod"),
+			Secret:     e.str("AFFINITY_COOKIE_SECRET", ""),
+			MaxAge:     e.duration("AFFINITY_COOKIE_MAX_AGE", time.Hour),
+		},
+		RouteBreaker: RouteBreaker{
+			ErrorRate:   e.float("ROUTE_BREAKER_ERROR_RATE", 0.5),
+			MinRequests: e.int("ROUTE_BREAKER_MIN_REQUESTS", 20),
+			Window:      e.duration("ROUTE_BREAKER_WINDOW", 30*time.Second),
+			SlowCall:    e.duration("ROUTE_BREAKER_SLOW_CALL", 5*time.Second),
+			Cooldown:    e.duration("ROUTE_BREAKER_COOLDOWN", 15*time.Second),
+		},
+		Dedup: Dedup{
+			Routes: e.routeWindows("DEDUP_ROUTES", DefaultDedupRoutes,
+				e.duration("DEDUP_WINDOW", 2*time.Second)),
+		},
+		Timeouts: Timeouts{
+			Default: e.duration("REQUEST_TIMEOUT", 10*time.Second),
+			Routes:  e.routeWindows("ROUTE_TIMEOUTS", DefaultRouteTimeouts, 0),
+		},
+		Workers: Workers{
+			Size:        e.int("WORKER_POOL_SIZE", 4),
+			QueueSize:   e.int("WORKER_QUEUE_SIZE", 100),
+			TaskTimeout: e.duration("WORKER_TASK_TIMEOUT", 30*time.Second),
+		},
+		Memory: Memory{
+			GCPercent:  e.int("GC_PERCENT", 0),
+			LimitRatio: e.float("MEMORY_LIMIT_RATIO", 0.9),
+			BallastMB:  e.int("MEMORY_BALLAST_MB", 0),
+		},
+		Reload: Reload{
+			PollInterval: e.duration("CONFIG_POLL_INTERVAL", 10*time.Second),
+		},
+		Journal: Journal{
+			Path:    e.str("REQUEST_JOURNAL_PATH", ""),
+			Entries: e.int("REQUEST_JOURNAL_ENTRIES", 1000),
+		},
+		Dump: Dump{
+			Dir:           e.str("DUMP_DIR", ""),
+			Keep:          e.int("DUMP_KEEP", 5),
+			MutexFraction: e.int("DUMP_MUTEX_FRACTION", 100),
+		},
+
+		OpenAPIValidateResponses: e.str("OPENAPI_VALIDATE_RESPONSES", "false") == "true",
+		ChaosEndpoints:           e.str("CHAOS_ENDPOINTS", "false") == "true",
+
+		lookup: lookup,
+	}, nil
+}
+
+// Lookup resolves keys from the same sources the configuration was loaded from
+func (c *Config) Lookup() configcheck.Lookup {
+	return c.lookup
+}
+
+// FeatureEnabled reports whether FEATURE_FLAGS switches on the named feature
+func (c *Config) FeatureEnabled(name string) bool {
+	for _, feature := range c.Features {
+		if feature == name {
+			return true
+		}
+	}
+	return false
+}
+
+// env reads typed values; Load validates them first, so a value that fails to
+// parse can only be one no rule covers, and the default is used
+type env configcheck.Lookup
+
+func (e env) str(key, defaultValue string) string {
+	if value, ok := e(key); ok && value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func (e env) int(key string, defaultValue int) int {
+	if n, err := strconv.Atoi(e.str(key, "")); err == nil {
+		return n
+	}
+	return defaultValue
+}
+
+func (e env) float(key string, defaultValue float64) float64 {
+	if f, err := strconv.ParseFloat(e.str(key, ""), 64); err == nil {
+		return f
+	}
+	return defaultValue
+}
+
+func (e env) duration(key string, defaultValue time.Duration) time.Duration {
+	if d, err := time.ParseDuration(e.str(key, "")); err == nil {
+		return d
+	}
+	return defaultValue
+}
+
+// list splits a comma-separated value, dropping empty items
+func (e env) list(key, defaultValue string) []string {
+	items := []string{}
+	for _, item := range strings.Split(e.str(key, defaultValue), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// replicas parses a list of database URLs
+func (e env) replicas(key string) []Replica {
+	var replicas []Replica
+	for _, item := range e.list(key, "") {
+		values, err := configcheck.ParseDatabaseURL(item)
+		if err != nil {
+			continue
+		}
+		replicas = append(replicas, Replica{
+			Host:     values["DB_HOST"],
+			Port:     values["DB_PORT"],
+			User:     values["DB_USER"],
+			Password: values["DB_PASSWORD"],
+			Name:     values["DB_NAME"],
+		})
+	}
+	return replicas
+}
+
+// fieldScopes parses a list of fields, each optionally followed by
+// "=scope"; fields without one require DefaultRedactScope. "none" is the
+// empty list.
+func (e env) fieldScopes(key, defaultValue string) map[string]string {
+	fields := make(map[string]string)
+	if e.str(key, defaultValue) == "none" {
+		return fields
+	}
+	for _, item := range e.list(key, defaultValue) {
+		field, scope, found := strings.Cut(item, "=")
+		if !found || strings.TrimSpace(scope) == "" {
+			scope = DefaultRedactScope
+		}
+		fields[strings.TrimSpace(field)] = strings.TrimSpace(scope)
+	}
+	return fields
+}
+
+// routeWindows parses a list of routes, each optionally followed by
+// "=duration"; routes without one use defaultWindow
+func (e env) routeWindows(key, defaultValue string, defaultWindow time.Duration) map[string]time.Duration {
+	routes := make(map[string]time.Duration)
+	for _, item := range e.list(key, defaultValue) {
+		route, value, found := strings.Cut(item, "=")
+		window := defaultWindow
+		if found {
+			if d, err := time.ParseDuration(strings.TrimSpace(value)); err == nil {
+				window = d
+			}
+		}
+		routes[strings.TrimSpace(route)] = window
+	}
+	return routes
+}
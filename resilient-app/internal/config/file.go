@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ReadFile reads a YAML or JSON config file mapping configuration keys to
+// values, e.g.
+//
+//	DB_MAX_OPEN_CONNS: 50
+//	FEATURE_FLAGS: [graceful_degradation, circuit_breaker]
+//
+// Keys are the environment variable names, matched case-insensitively. Lists
+// become comma-separated values. An empty path reads nothing.
+func ReadFile(path string) (map[string]string, error) {
+	values := make(map[string]string)
+	if path == "" {
+		return values, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// YAML is a superset of JSON, so one decoder reads both
+	var document map[string]interface{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for key, value := range document {
+		s, err := fileValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, key, err)
+		}
+		values[strings.ToUpper(key)] = s
+	}
+	return values, nil
+}
+
+func fileValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := fileValue(item)
+			if err != nil {
+				return "", err
+			}
+			if _, nested := item.([]interface{}); nested {
+				return "", fmt.Errorf("lists can't be nested")
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	case map[string]interface{}:
+		return "", fmt.Errorf("must be a value or a list, not a mapping")
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
@@ -0,0 +1,295 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/demo/resilient-app/internal/configcheck"
+	"github.com/demo/resilient-app/internal/events"
+	"github.com/demo/resilient-app/internal/profile"
+	"go.uber.org/zap"
+)
+
+// Reload triggers reported in events.ConfigReloaded
+const (
+	TriggerSignal    = "sighup"
+	TriggerConfigMap = "configmap"
+)
+
+// Sources locate the configuration besides the environment
+type Sources struct {
+	// File is a YAML or JSON config file (see ReadFile)
+	File string
+	// Dir is a mounted ConfigMap directory (see ReadDir)
+	Dir string
+	// Overrides take precedence over every other source, e.g. command-line
+	// flags; they never change on reload
+	Overrides map[string]string
+}
+
+// Reloader keeps the current configuration and reloads it on SIGHUP and,
+// when a file, directory or secret file is configured, whenever its contents
+// change.
+//
+// Each key is resolved from the first layer that sets it: the overrides, the
+// mounted ConfigMap, the environment, the config file, then the defaults of the
+// profile. A key none of them sets is read from the file its _FILE variant
+// names (see readSecretFiles). Mounted values take precedence over the
+// environment, which Kubernetes never updates in a running pod. A reload that
+// fails validation is logged and the previous configuration stays in effect.
+type Reloader struct {
+	sources Sources
+
+	mu          sync.Mutex
+	current     *Config
+	snapshot    snapshot
+	subscribers []func(*Config)
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewReloader loads the initial configuration from the environment and the
+// given sources; zero Sources read the environment only
+func NewReloader(sources Sources) (*Reloader, error) {
+	snap, err := sources.read()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := sources.load(snap)
+	if err != nil {
+		return nil, err
+	}
+	return &Reloader{
+		sources:  sources,
+		current:  cfg,
+		snapshot: snap,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// Current returns the configuration in effect
+func (r *Reloader) Current() *Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// Subscribe registers fn to receive every configuration that is reloaded
+func (r *Reloader) Subscribe(fn func(*Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subscribers = append(r.subscribers, fn)
+}
+
+// Start watches for SIGHUP and polls the config file, mounted ConfigMap and
+// secret files until Stop
+func (r *Reloader) Start(logger *zap.Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		defer close(r.done)
+		defer signal.Stop(hup)
+
+		var poll <-chan time.Time
+		if r.sources.File != "" || r.sources.Dir != "" || len(r.snapshot.secrets) > 0 {
+			ticker := time.NewTicker(r.Current().Reload.PollInterval)
+			defer ticker.Stop()
+			poll = ticker.C
+		}
+
+		for {
+			var trigger string
+			select {
+			case <-r.stop:
+				return
+			case <-hup:
+				trigger = TriggerSignal
+			case <-poll:
+				trigger = TriggerConfigMap
+			}
+
+			changed, err := r.Reload(trigger)
+			switch {
+			case err != nil:
+				logger.Error("Configuration reload rejected, keeping the current configuration",
+					zap.String("trigger", trigger), zap.Error(err))
+			case changed != nil:
+				logger.Info("Configuration reloaded",
+					zap.String("trigger", trigger), zap.Strings("changed", changed))
+			}
+		}
+	}()
+}
+
+// Reload re-reads the configuration and applies it when valid. A poll only
+// reloads when a file, mounted or secret value changed; a signal always does.
+// It returns the changed keys, or nil when nothing was reloaded.
+func (r *Reloader) Reload(trigger string) ([]string, error) {
+	snap, err := r.sources.read()
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	changed := snap.changedSince(r.snapshot)
+	if len(changed) == 0 && trigger != TriggerSignal {
+		r.mu.Unlock()
+		return nil, nil
+	}
+	// Remember rejected values too, so they are reported once rather than on
+	// every poll
+	r.snapshot = snap
+	cfg, err := r.sources.load(snap)
+	if err != nil {
+		r.mu.Unlock()
+		return nil, err
+	}
+	r.current = cfg
+	subscribers := append([]func(*Config){}, r.subscribers...)
+	r.mu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(cfg)
+	}
+	events.Publish(events.ConfigReloaded{Trigger: trigger, Changed: changed, At: time.Now()})
+	return changed, nil
+}
+
+// Stop ends watching for changes
+func (r *Reloader) Stop(ctx context.Context) error {
+	close(r.stop)
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// snapshot holds the contents of every source that can change at runtime
+type snapshot struct {
+	file    map[string]string
+	dir     map[string]string
+	secrets map[string]string
+}
+
+func (s Sources) read() (snapshot, error) {
+	var snap snapshot
+	var err error
+	if snap.file, err = ReadFile(s.File); err != nil {
+		return snapshot{}, err
+	}
+	if snap.dir, err = ReadDir(s.Dir); err != nil {
+		return snapshot{}, err
+	}
+	if snap.secrets, err = readSecretFiles(s.lookup(snap), s.keys(snap)); err != nil {
+		return snapshot{}, err
+	}
+	return snap, nil
+}
+
+// lookup layers the overrides, mounted ConfigMap, environment and config file
+func (s Sources) lookup(snap snapshot) configcheck.Lookup {
+	lookup := configcheck.Fallback(os.LookupEnv, snap.file)
+	return configcheck.Overlay(configcheck.Overlay(lookup, snap.dir), s.Overrides)
+}
+
+// changedSince lists the keys whose values differ from an earlier snapshot
+func (snap snapshot) changedSince(before snapshot) []string {
+	return changedKeys(before.file, snap.file, before.dir, snap.dir, before.secrets, snap.secrets)
+}
+
+// load resolves the configuration from its layers. The profile is selected
+// first, since its defaults form the bottom layer.
+func (s Sources) load(snap snapshot) (*Config, error) {
+	lookup := configcheck.Fallback(s.lookup(snap), snap.secrets)
+
+	name, _ := lookup("PROFILE")
+	if name == "" {
+		name = profile.Default
+	}
+	defaults, err := profile.Defaults(name)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := Load(configcheck.Fallback(lookup, defaults))
+	if err != nil {
+		return nil, err
+	}
+	for key := range defaults {
+		if _, ok := lookup(key); !ok {
+			cfg.ProfileDefaults = append(cfg.ProfileDefaults, key)
+		}
+	}
+	sort.Strings(cfg.ProfileDefaults)
+	return cfg, nil
+}
+
+// ReadDir reads a ConfigMap mounted as a volume, where every key is a file
+// holding its value. Kubernetes' own ..data entries are skipped.
+func ReadDir(dir string) (map[string]string, error) {
+	values := make(map[string]string)
+	if dir == "" {
+		return values, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		values[entry.Name()] = strings.TrimRight(string(data), "\n")
+	}
+	return values, nil
+}
+
+// changedKeys lists the keys added, removed or modified between two loads,
+// given as before and after pairs of value maps
+func changedKeys(pairs ...map[string]string) []string {
+	seen := make(map[string]bool)
+	changed := []string{}
+	mark := func(key string) {
+		if !seen[key] {
+			seen[key] = true
+			changed = append(changed, key)
+		}
+	}
+
+	for i := 0; i+1 < len(pairs); i += 2 {
+		before, after := pairs[i], pairs[i+1]
+		for key, value := range after {
+			if previous, ok := before[key]; !ok || previous != value {
+				mark(key)
+			}
+		}
+		for key := range before {
+			if _, ok := after[key]; !ok {
+				mark(key)
+			}
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/demo/resilient-app/internal/configcheck"
+)
+
+// fileSuffix marks a key whose value is read from the file it names, e.g.
+// DB_PASSWORD_FILE=/etc/resilient-app/secrets/DB_PASSWORD for a mounted
+// Kubernetes Secret
+const fileSuffix = "_FILE"
+
+// readSecretFiles resolves every KEY_FILE set in any layer into the contents
+// of the file it names. Kubernetes updates a mounted Secret in place, so the
+// files are re-read on every reload and a rotated value shows up as a change
+// of KEY. Setting both KEY and KEY_FILE is an error.
+func readSecretFiles(lookup configcheck.Lookup, keys []string) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, key := range keys {
+		// CONFIG_FILE names the config file itself
+		if !strings.HasSuffix(key, fileSuffix) || key == "CONFIG_FILE" {
+			continue
+		}
+		path, _ := lookup(key)
+		if path == "" {
+			continue
+		}
+		base := strings.TrimSuffix(key, fileSuffix)
+		if value, _ := lookup(base); value != "" {
+			return nil, fmt.Errorf("set either %s or %s, not both", base, key)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		values[base] = strings.TrimRight(string(data), "\r\n")
+	}
+	return values, nil
+}
+
+// keys lists every key set in any layer
+func (s Sources) keys(snap snapshot) []string {
+	var keys []string
+	for _, entry := range os.Environ() {
+		if key, _, ok := strings.Cut(entry, "="); ok {
+			keys = append(keys, key)
+		}
+	}
+	for _, values := range []map[string]string{snap.file, snap.dir, s.Overrides} {
+		for key := range values {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,588 @@
+package configcheck
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+
+	minAdminTokenLength = 16
+)
+
+// KnownFeatures are the values FEATURE_FLAGS may contain
+var KnownFeatures = []string{
+	"graceful_degradation",
+	"circuit_breaker",
+	"metrics",
+	"graphql",
+	"openapi_validation",
+	"route_breaker",
+	"request_dedup",
+	"session_affinity",
+}
+
+// secretKeys are never echoed back in issues
+var secretKeys = map[string]bool{
+	"DB_PASSWORD":     true,
+	"DATABASE_URL":    true,
+	"DB_REPLICA_URLS": true,
+	"ADMIN_TOKEN":     true,
+
+	"AFFINITY_COOKIE_SECRET": true,
+	"HEALTH_TOKEN":           true,
+}
+
+// Issue is a single machine-readable validation finding
+type Issue struct {
+	Key      string `json:"key"`
+	Value    string `json:"value,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// Result of validating a configuration; warnings don't make it invalid
+type Result struct {
+	Valid  bool    `json:"valid"`
+	Issues []Issue `json:"issues"`
+}
+
+// Lookup resolves a configuration key, like os.LookupEnv
+type Lookup func(key string) (string, bool)
+
+type rule struct {
+	key   string
+	check func(value string) (severity, message string)
+}
+
+var rules = []rule{
+	{"PORT", portNumber},
+	{"CLUSTER_NAME", identifier},
+	{"REGION", identifier},
+	{"DB_PORT", portNumber},
+	{"DB_SSLMODE", oneOf(SSLModes...)},
+	{"DATABASE_URL", databaseURL},
+	{"DB_MAX_OPEN_CONNS", positiveInt},
+	{"DB_MAX_IDLE_CONNS", nonNegativeInt},
+	{"DB_CONN_MAX_LIFETIME", positiveDuration},
+	{"DB_CONN_MAX_IDLE_TIME", positiveDuration},
+	{"DB_STATEMENT_CACHE_SIZE", nonNegativeInt},
+	{"DB_QUERY_TIMEOUT", positiveDuration},
+	{"DB_OPERATION_TIMEOUTS", operationTimeouts},
+	{"DB_SLOW_QUERY_THRESHOLD", nonNegativeDuration},
+	{"DB_PROBE_INTERVAL", positiveDuration},
+	{"DB_RECONNECT_AFTER", nonNegativeDuration},
+	{"DB_SCHEMA_PHASE", oneOf("old", "dual_write", "dual_read", "new")},
+	{"DB_MAX_CONCURRENT_QUERIES", nonNegativeInt},
+	{"DB_BULKHEAD_QUEUE", nonNegativeInt},
+	{"DB_RETRY_ATTEMPTS", positiveInt},
+	{"DB_RETRY_BASE_DELAY", positiveDuration},
+	{"DB_RETRY_MAX_DELAY", positiveDuration},
+	{"DB_REPLICA_URLS", replicaURLs},
+	{"DB_REPLICA_CHECK_INTERVAL", positiveDuration},
+	{"RATE_LIMIT_REQUESTS", positiveInt},
+	{"RATE_LIMIT_WINDOW", positiveDuration},
+	{"LOOKUP_MISS_LIMIT", positiveInt},
+	{"LOOKUP_MISS_WINDOW", positiveDuration},
+	{"LOOKUP_MIN_RESPONSE_TIME", nonNegativeDuration},
+	{"CIRCUIT_BREAKER_THRESHOLD", positiveInt},
+	{"CIRCUIT_BREAKER_FAILURE_RATIO", fraction},
+	{"CIRCUIT_BREAKER_SLOW_CALL", nonNegativeDuration},
+	{"CIRCUIT_BREAKER_SLOW_CALL_RATE", fraction},
+	{"CIRCUIT_BREAKER_HALF_OPEN", oneOf("probe", "trickle")},
+	{"CIRCUIT_BREAKER_HALF_OPEN_REQUESTS", positiveInt},
+	{"GRACEFUL_SHUTDOWN_TIMEOUT", positiveDuration},
+	{"SHUTDOWN_DRAIN_SHARE", fraction},
+	{"SHUTDOWN_HOOKS_SHARE", fraction},
+	{"SHUTDOWN_CLOSE_SHARE", fraction},
+	{"HEALTH_CHECK_INTERVAL", positiveDuration},
+	{"READINESS_CHECK_TIMEOUT", positiveDuration},
+	{"BREAKER_OPEN_DEGRADED_AFTER", positiveDuration},
+	{"HEALTH_DB_SLOW_PING", positiveDuration},
+	{"HEALTH_DB_PING_TIMEOUT", positiveDuration},
+	{"HEALTH_TOKEN", adminToken},
+	{"ERROR_VERBOSITY", oneOf("terse", "negotiate", "debug")},
+	{"FALLBACK_CACHE_ENTRIES", positiveInt},
+	{"FALLBACK_CACHE_SHARDS", positiveInt},
+	{"FALLBACK_CACHE_TTL", positiveDuration},
+	{"OPENAPI_VALIDATE_RESPONSES", oneOf("true", "false")},
+	{"FEATURE_FLAGS", featureFlags},
+	{"ADMIN_TOKEN", adminToken},
+	{"LOG_REDACT_KEYS", nonEmptyList},
+	{"RESPONSE_REDACT_FIELDS", redactFields},
+	{"PROFILE", oneOf("dev", "demo", "prod")},
+	{"LOG_LEVEL", oneOf("debug", "info", "warn", "error")},
+	{"LOG_FORMAT", oneOf("json", "console")},
+	{"LOG_PII_MODE", oneOf("hash", "truncate", "redact", "plain")},
+	{"ADMIN_AUTH", oneOf("required", "none")},
+	{"CHAOS_ENDPOINTS", oneOf("true", "false")},
+	{"SERVER_READ_TIMEOUT", positiveDuration},
+	{"SERVER_WRITE_TIMEOUT", positiveDuration},
+	{"SERVER_IDLE_TIMEOUT", positiveDuration},
+	{"SERVER_READ_HEADER_TIMEOUT", positiveDuration},
+	{"METRICS_BACKEND", oneOf("prometheus", "statsd", "both")},
+	{"STATSD_ADDR", hostPort},
+	{"POLICY_URL", httpURL},
+	{"POLICY_INTERVAL", positiveDuration},
+	{"POLICY_TIMEOUT", positiveDuration},
+	{"SELF_PROBE_URL", httpURLList},
+	{"SELF_PROBE_INTERVAL", positiveDuration},
+	{"SELF_PROBE_TIMEOUT", positiveDuration},
+	{"AFFINITY_COOKIE_NAME", identifier},
+	{"AFFINITY_COOKIE_SECRET", adminToken},
+	{"AFFINITY_COOKIE_MAX_AGE", positiveDuration},
+	{"PUSHGATEWAY_URL", httpURL},
+	{"METRICS_FLUSH_TIMEOUT", positiveDuration},
+	{"DOWNSTREAM_URL", httpURLList},
+	{"DOWNSTREAM_TIMEOUT", positiveDuration},
+	{"DOWNSTREAM_OUTLIER_FAILURES", positiveInt},
+	{"DOWNSTREAM_EJECTION_TIME", positiveDuration},
+	{"DOWNSTREAM_CACHE_ENTRIES", nonNegativeInt},
+	{"DOWNSTREAM_STALE_IF_ERROR", nonNegativeDuration},
+	{"DOWNSTREAM_RATE_LIMIT", nonNegativeFloat},
+	{"DOWNSTREAM_RATE_BURST", positiveInt},
+	{"DOWNSTREAM_RATE_MAX_WAIT", nonNegativeDuration},
+	{"DOWNSTREAM_DNS_TTL", nonNegativeDuration},
+	{"DOWNSTREAM_DNS_STALE", nonNegativeDuration},
+	{"ROUTE_BREAKER_ERROR_RATE", fraction},
+	{"ROUTE_BREAKER_MIN_REQUESTS", positiveInt},
+	{"ROUTE_BREAKER_WINDOW", positiveDuration},
+	{"ROUTE_BREAKER_SLOW_CALL", nonNegativeDuration},
+	{"ROUTE_BREAKER_COOLDOWN", positiveDuration},
+	{"CONFIG_POLL_INTERVAL", positiveDuration},
+	{"REQUEST_JOURNAL_ENTRIES", positiveInt},
+	{"DUMP_KEEP", positiveInt},
+	{"DUMP_MUTEX_FRACTION", nonNegativeInt},
+	{"DEDUP_WINDOW", positiveDuration},
+	{"DEDUP_ROUTES", dedupRoutes},
+	{"REQUEST_TIMEOUT", positiveDuration},
+	{"ROUTE_TIMEOUTS", routeTimeouts},
+	{"WORKER_POOL_SIZE", positiveInt},
+	{"WORKER_QUEUE_SIZE", positiveInt},
+	{"WORKER_TASK_TIMEOUT", positiveDuration},
+	{"GC_PERCENT", positiveInt},
+	{"MEMORY_LIMIT_RATIO", fraction},
+	{"MEMORY_BALLAST_MB", nonNegativeInt},
+}
+
+// Validate checks every known key that is set. Unset keys fall back to
+// defaults and are always valid.
+func Validate(lookup Lookup) Result {
+	result := Result{Valid: true, Issues: []Issue{}}
+
+	for _, rule := range rules {
+		value, ok := lookup(rule.key)
+		if !ok || value == "" {
+			continue
+		}
+
+		severity, message := rule.check(value)
+		if severity == "" {
+			continue
+		}
+
+		issue := Issue{Key: rule.key, Value: value, Severity: severity, Message: message}
+		if secretKeys[rule.key] {
+			issue.Value = ""
+		}
+		if severity == SeverityError {
+			result.Valid = false
+		}
+		result.Issues = append(result.Issues, issue)
+	}
+
+	for _, issue := range prodSafety(lookup) {
+		result.Valid = false
+		result.Issues = append(result.Issues, issue)
+	}
+
+	if url, _ := lookup("PUSHGATEWAY_URL"); url != "" {
+		if backend, _ := lookup("METRICS_BACKEND"); backend == "statsd" {
+			result.Issues = append(result.Issues, Issue{Key: "PUSHGATEWAY_URL", Value: url,
+				Severity: SeverityWarning, Message: "ignored unless METRICS_BACKEND includes prometheus"})
+		}
+	}
+
+	if dsn, _ := lookup("DATABASE_URL"); dsn != "" {
+		values, _ := ParseDatabaseURL(dsn)
+		for _, key := range databaseKeys {
+			if value, _ := lookup(key); value != "" && values[key] != "" {
+				issue := Issue{Key: key, Value: value, Severity: SeverityWarning, Message: "overridden by DATABASE_URL"}
+				if secretKeys[key] {
+					issue.Value = ""
+				}
+				result.Issues = append(result.Issues, issue)
+			}
+		}
+	}
+
+	for _, issue := range databaseTLS(lookup) {
+		if issue.Severity == SeverityError {
+			result.Valid = false
+		}
+		result.Issues = append(result.Issues, issue)
+	}
+
+	if idle, _ := lookup("DB_MAX_IDLE_CONNS"); idle != "" {
+		open, _ := lookup("DB_MAX_OPEN_CONNS")
+		idleConns, err1 := strconv.Atoi(idle)
+		openConns, err2 := strconv.Atoi(open)
+		if err1 == nil && err2 == nil && idleConns > openConns {
+			result.Issues = append(result.Issues, Issue{Key: "DB_MAX_IDLE_CONNS", Value: idle,
+				Severity: SeverityWarning, Message: "reduced to DB_MAX_OPEN_CONNS"})
+		}
+	}
+
+	if limit, _ := lookup("DB_MAX_CONCURRENT_QUERIES"); limit != "" {
+		open, _ := lookup("DB_MAX_OPEN_CONNS")
+		queries, err1 := strconv.Atoi(limit)
+		openConns, err2 := strconv.Atoi(open)
+		if err1 == nil && err2 == nil && queries >= openConns {
+			result.Issues = append(result.Issues, Issue{Key: "DB_MAX_CONCURRENT_QUERIES", Value: limit,
+				Severity: SeverityWarning, Message: "not below DB_MAX_OPEN_CONNS, so queries can take every connection from the health checks"})
+		}
+	}
+
+	return result
+}
+
+// prodSafety rejects explicit overrides that undo the prod profile's guarantees
+func prodSafety(lookup Lookup) []Issue {
+	if value, _ := lookup("PROFILE"); value != "prod" {
+		return nil
+	}
+
+	unsafe := []struct{ key, value, message string }{
+		{"ADMIN_AUTH", "none", "admin authentication cannot be disabled in the prod profile"},
+		{"ERROR_VERBOSITY", "debug", "debug error details cannot be forced on in the prod profile"},
+		{"CHAOS_ENDPOINTS", "true", "chaos endpoints cannot be enabled in the prod profile"},
+		{"RESPONSE_REDACT_FIELDS", "none", "response redaction cannot be turned off in the prod profile"},
+		{"LOG_PII_MODE", "plain", "personal data cannot be logged in clear text in the prod profile"},
+	}
+
+	var issues []Issue
+	for _, u := range unsafe {
+		if value, _ := lookup(u.key); value == u.value {
+			issues = append(issues, Issue{Key: u.key, Value: value, Severity: SeverityError, Message: u.message})
+		}
+	}
+	return issues
+}
+
+// databaseTLS checks the client certificate settings against each other and
+// the sslmode, as resolved after DATABASE_URL
+func databaseTLS(lookup Lookup) []Issue {
+	if dsn, _ := lookup("DATABASE_URL"); dsn != "" {
+		if values, err := ParseDatabaseURL(dsn); err == nil {
+			lookup = Overlay(lookup, values)
+		}
+	}
+
+	var issues []Issue
+	cert, _ := lookup("DB_SSL_CERT")
+	key, _ := lookup("DB_SSL_KEY")
+	if (cert == "") != (key == "") {
+		issues = append(issues, Issue{Key: "DB_SSL_CERT", Value: cert, Severity: SeverityError,
+			Message: "DB_SSL_CERT and DB_SSL_KEY must be set together"})
+	}
+
+	if mode, _ := lookup("DB_SSLMODE"); mode == "" || mode == "disable" {
+		for _, k := range []string{"DB_SSL_ROOT_CERT", "DB_SSL_CERT", "DB_SSL_KEY"} {
+			if value, _ := lookup(k); value != "" {
+				issues = append(issues, Issue{Key: k, Value: value, Severity: SeverityWarning,
+					Message: "ignored while DB_SSLMODE is disable"})
+			}
+		}
+	}
+	return issues
+}
+
+// Overlay resolves keys from overrides first and then from base
+func Overlay(base Lookup, overrides map[string]string) Lookup {
+	return func(key string) (string, bool) {
+		if value, ok := overrides[key]; ok {
+			return value, true
+		}
+		return base(key)
+	}
+}
+
+// Fallback resolves keys from base first and then from fallback; a key base
+// sets to an empty value counts as unset, like everywhere else
+func Fallback(base Lookup, fallback map[string]string) Lookup {
+	return func(key string) (string, bool) {
+		if value, ok := base(key); ok && value != "" {
+			return value, true
+		}
+		value, ok := fallback[key]
+		return value, ok
+	}
+}
+
+// ParseEnvFile reads KEY=VALUE lines as used by docker --env-file and
+// kubectl create configmap --from-env-file. Blank lines and # comments are skipped.
+func ParseEnvFile(r io.Reader) (map[string]string, error) {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineNo)
+		}
+
+		value = strings.TrimSpace(value)
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = value[1 : len(value)-1]
+		}
+		values[key] = value
+	}
+
+	return values, scanner.Err()
+}
+
+// identifier accepts names that are safe as header values, metric labels and
+// cookie names
+func identifier(value string) (string, string) {
+	const message = "must be at most 63 letters, digits, '.', '_' or '-'"
+	if len(value) > 63 {
+		return SeverityError, message
+	}
+	for _, c := range value {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-') {
+			return SeverityError, message
+		}
+	}
+	return "", ""
+}
+
+func portNumber(value string) (string, string) {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return SeverityError, "must be a port number between 1 and 65535"
+	}
+	return "", ""
+}
+
+func positiveInt(value string) (string, string) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return SeverityError, "must be an integer"
+	}
+	if n <= 0 {
+		return SeverityError, "must be greater than zero"
+	}
+	return "", ""
+}
+
+func nonNegativeInt(value string) (string, string) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return SeverityError, "must be an integer"
+	}
+	if n < 0 {
+		return SeverityError, "must not be negative"
+	}
+	return "", ""
+}
+
+func nonNegativeFloat(value string) (string, string) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 {
+		return SeverityError, "must be a non-negative number"
+	}
+	return "", ""
+}
+
+func fraction(value string) (string, string) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f <= 0 || f > 1 {
+		return SeverityError, "must be a fraction greater than 0 and at most 1"
+	}
+	return "", ""
+}
+
+func positiveDuration(value string) (string, string) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return SeverityError, "must be a duration such as 30s or 1m"
+	}
+	if d <= 0 {
+		return SeverityError, "must be greater than zero"
+	}
+	return "", ""
+}
+
+func nonNegativeDuration(value string) (string, string) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return SeverityError, "must be a duration such as 50ms"
+	}
+	if d < 0 {
+		return SeverityError, "must not be negative"
+	}
+	return "", ""
+}
+
+func oneOf(allowed ...string) func(string) (string, string) {
+	return func(value string) (string, string) {
+		for _, a := range allowed {
+			if value == a {
+				return "", ""
+			}
+		}
+		return SeverityError, "must be one of " + strings.Join(allowed, ", ")
+	}
+}
+
+func featureFlags(value string) (string, string) {
+	var unknown []string
+	for _, feature := range strings.Split(value, ",") {
+		feature = strings.TrimSpace(feature)
+		if feature == "" {
+			continue
+		}
+		known := false
+		for _, k := range KnownFeatures {
+			if feature == k {
+				known = true
+				break
+			}
+		}
+		if !known {
+			unknown = append(unknown, feature)
+		}
+	}
+	if len(unknown) > 0 {
+		return SeverityWarning, "unknown features are ignored: " + strings.Join(unknown, ", ")
+	}
+	return "", ""
+}
+
+func httpURL(value string) (string, string) {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return SeverityError, "must be an absolute http(s) URL"
+	}
+	return "", ""
+}
+
+func httpURLList(value string) (string, string) {
+	for _, item := range strings.Split(value, ",") {
+		if severity, _ := httpURL(strings.TrimSpace(item)); severity != "" {
+			return SeverityError, "must be a comma-separated list of absolute http(s) URLs"
+		}
+	}
+	return "", ""
+}
+
+// dedupRoutes checks "METHOD /path[=duration]" entries; only mutating methods
+// are coalesced
+func dedupRoutes(value string) (string, string) {
+	const format = `must be a comma-separated list of "METHOD /path" with an optional "=duration"`
+	for _, item := range strings.Split(value, ",") {
+		route, window, found := strings.Cut(strings.TrimSpace(item), "=")
+		method, path, ok := strings.Cut(strings.TrimSpace(route), " ")
+		if !ok || !strings.HasPrefix(path, "/") {
+			return SeverityError, format
+		}
+		switch method {
+		case "POST", "PUT", "PATCH", "DELETE":
+		default:
+			return SeverityError, "only POST, PUT, PATCH and DELETE routes can be deduplicated"
+		}
+		if found {
+			if severity, _ := positiveDuration(strings.TrimSpace(window)); severity != "" {
+				return SeverityError, format
+			}
+		}
+	}
+	return "", ""
+}
+
+func routeTimeouts(value string) (string, string) {
+	const format = `must be a comma-separated list of "METHOD /path=duration"`
+	for _, item := range strings.Split(value, ",") {
+		route, timeout, found := strings.Cut(strings.TrimSpace(item), "=")
+		_, path, ok := strings.Cut(strings.TrimSpace(route), " ")
+		if !ok || !strings.HasPrefix(path, "/") || !found {
+			return SeverityError, format
+		}
+		if severity, _ := nonNegativeDuration(strings.TrimSpace(timeout)); severity != "" {
+			return SeverityError, format
+		}
+	}
+	return "", ""
+}
+
+func operationTimeouts(value string) (string, string) {
+	const format = `must be a comma-separated list of "operation=duration"`
+	for _, item := range strings.Split(value, ",") {
+		op, timeout, found := strings.Cut(strings.TrimSpace(item), "=")
+		if !found || strings.TrimSpace(op) == "" || strings.ContainsAny(strings.TrimSpace(op), " /") {
+			return SeverityError, format
+		}
+		if severity, _ := positiveDuration(strings.TrimSpace(timeout)); severity != "" {
+			return SeverityError, format
+		}
+	}
+	return "", ""
+}
+
+func redactFields(value string) (string, string) {
+	const format = `must be "none" or a comma-separated list of "field" or "field=scope"`
+	if value == "none" {
+		return "", ""
+	}
+	for _, item := range strings.Split(value, ",") {
+		field, scope, found := strings.Cut(strings.TrimSpace(item), "=")
+		if strings.TrimSpace(field) == "" || strings.ContainsAny(strings.TrimSpace(field), ` "`) {
+			return SeverityError, format
+		}
+		if found && strings.TrimSpace(scope) == "" {
+			return SeverityError, format
+		}
+	}
+	return "", ""
+}
+
+func hostPort(value string) (string, string) {
+	host, port, err := net.SplitHostPort(value)
+	if err != nil || host == "" {
+		return SeverityError, "must be host:port"
+	}
+	return portNumber(port)
+}
+
+func nonEmptyList(value string) (string, string) {
+	for _, item := range strings.Split(value, ",") {
+		if strings.TrimSpace(item) == "" {
+			return SeverityWarning, "contains empty entries"
+		}
+	}
+	return "", ""
+}
+
+func adminToken(value string) (string, string) {
+	if len(value) < minAdminTokenLength {
+		return SeverityWarning, fmt.Sprintf("shorter than %d characters", minAdminTokenLength)
+	}
+	return "", ""
+}
@@ -0,0 +1,73 @@
+// Package ctxkeys declares the values carried in request contexts. Each key
+// is typed, so a value is always read back as the type it was stored with,
+// and named in a registry, so two packages can't claim the same value. Keys
+// shared across packages are declared here; a key private to one package is
+// declared there with New.
+package ctxkeys
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Key stores and reads one value of type T in a context. Keys compare by
+// identity, so a Key can only be read by code that can reach it.
+type Key[T any] struct {
+	name string
+}
+
+var (
+	mu    sync.Mutex
+	names = make(map[string]bool)
+)
+
+// New declares a key. Like plugin.Register it panics on a duplicate name,
+// since two keys for the same value are a programming error. Keys are
+// declared in package-level vars, so a clash stops the binary at startup.
+func New[T any](name string) *Key[T] {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if names[name] {
+		panic(fmt.Sprintf("ctxkeys: New called twice for %q", name))
+	}
+	names[name] = true
+	return &Key[T]{name: name}
+}
+
+// With returns a copy of ctx carrying value
+func (k *Key[T]) With(ctx context.Context, value T) context.Context {
+	return context.WithValue(ctx, k, value)
+}
+
+// Lookup returns the value in ctx and whether there is one
+func (k *Key[T]) Lookup(ctx context.Context) (T, bool) {
+	value, ok := ctx.Value(k).(T)
+	return value, ok
+}
+
+// Value returns the value in ctx, or T's zero value without one
+func (k *Key[T]) Value(ctx context.Context) T {
+	value, _ := k.Lookup(ctx)
+	return value
+}
+
+// String names the key in formatted contexts
+func (k *Key[T]) String() string {
+	return "ctxkeys." + k.name
+}
+
+// Names lists the declared keys
+func Names() []string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	list := make([]string, 0, len(names))
+	for name := range names {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
@@ -0,0 +1,47 @@
+package ctxkeys
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Values set by the request middleware, in the order they are added
+var (
+	// RequestID is the request's X-Request-ID, received or generated
+	RequestID = New[string]("request_id")
+	// Tenant is the caller's X-Tenant-ID, when valid
+	Tenant = New[string]("tenant")
+	// Logger is the request-scoped logger carrying the correlation fields
+	Logger = New[*zap.Logger]("logger")
+	// Deadline describes the timeout applied to the request
+	Deadline = New[DeadlineInfo]("deadline")
+	// Claims identify who the request was authenticated as
+	Claims = New[ClaimSet]("claims")
+)
+
+// DeadlineInfo records where a request's deadline came from; the deadline
+// itself is the context's
+type DeadlineInfo struct {
+	Route   string
+	Timeout time.Duration
+	// Source is "route" for a ROUTE_TIMEOUTS entry, "default" for
+	// REQUEST_TIMEOUT
+	Source string
+}
+
+// ClaimSet is what authentication established about the caller
+type ClaimSet struct {
+	Subject string
+	Scopes  []string
+}
+
+// Has reports whether the claims grant scope
+func (c ClaimSet) Has(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// UserRecord is the full persisted state of a user, as exported in backups
+type UserRecord struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	Email      string    `json:"email"`
+	Verified   bool      `json:"verified"`
+	OrderQuota int       `json:"order_quota"`
+	CreatedAt  time.Time `json:"created_at"`
+	// DeletedAt is set for a soft-deleted user
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// ConflictPolicy decides what a restore does with rows that already exist
+type ConflictPolicy string
+
+const (
+	ConflictSkip      ConflictPolicy = "skip"
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	ConflictFail      ConflictPolicy = "fail"
+)
+
+func (p ConflictPolicy) Valid() bool {
+	return p == ConflictSkip || p == ConflictOverwrite || p == ConflictFail
+}
+
+// ExportUsers streams every user in ID order, soft-deleted ones included
+func (db *DB) ExportUsers(ctx context.Context, fn func(UserRecord) error) error {
+	query := `SELECT id, ` + db.userSchema().name() + `, email, verified, order_quota, created_at, deleted_at FROM users ORDER BY id`
+
+	return db.stream(ctx, "export_users", query, func(rows pgx.Rows) error {
+		var user UserRecord
+		err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Verified, &user.OrderQuota, &user.CreatedAt, &user.DeletedAt)
+		if err != nil {
+			return err
+		}
+		return consumerError(fn(user))
+	})
+}
+
+// ExportOrders streams every order in ID order
+func (db *DB) ExportOrders(ctx context.Context, fn func(Order) error) error {
+	query := `SELECT id, user_id, product, quantity, created_at FROM orders ORDER BY id`
+
+	return db.stream(ctx, "export_orders", query, func(rows pgx.Rows) error {
+		var order Order
+		err := rows.Scan(&order.ID, &order.UserID, &order.Product, &order.Quantity, &order.CreatedAt)
+		if err != nil {
+			return err
+		}
+		return consumerError(fn(order))
+	})
+}
+
+// RestoreTx applies restored rows inside a single transaction
+type RestoreTx struct {
+	ctx    context.Context
+	tx     pgx.Tx
+	policy ConflictPolicy
+	schema userSchema
+}
+
+// Restore runs fn in a transaction through the circuit breaker. Nothing is
+// persisted unless fn succeeds, so a failed or interrupted restore leaves the
+// database untouched. Sequences are advanced past restored IDs before commit.
+func (db *DB) Restore(ctx context.Context, policy ConflictPolicy, fn func(*RestoreTx) error) error {
+	_, err := db.executeUnbounded(ctx, "restore", func(ctx context.Context) (interface{}, error) {
+		tx, err := db.pool().Begin(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback(ctx)
+
+		if err := fn(&RestoreTx{ctx: ctx, tx: tx, policy: policy, schema: db.userSchema()}); err != nil {
+			return nil, err
+		}
+
+		for _, table := range []string{"users", "orders"} {
+			if err := advanceSequence(ctx, tx, table); err != nil {
+				return nil, err
+			}
+		}
+
+		return nil, tx.Commit(ctx)
+	})
+	return translateError(err)
+}
+
+// advanceSequence moves a table's ID sequence past the rows written with
+// explicit IDs, so later inserts don't collide with them
+func advanceSequence(ctx context.Context, tx pgx.Tx, table string) error {
+	query := fmt.Sprintf(
+		`SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), GREATEST((SELECT COALESCE(MAX(id), 0) FROM %[1]s), 1))`,
+		table)
+	_, err := tx.Exec(ctx, query)
+	return err
+}
+
+// PutUser writes a user according to the conflict policy and reports whether
+// the row was written
+func (rt *RestoreTx) PutUser(user UserRecord) (bool, error) {
+	query := `INSERT INTO users (id, name, full_name, email, verified, order_quota, created_at, deleted_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	query += rt.onConflict(`name = EXCLUDED.name, full_name = EXCLUDED.full_name, email = EXCLUDED.email,
+		verified = EXCLUDED.verified, order_quota = EXCLUDED.order_quota, created_at = EXCLUDED.created_at,
+		deleted_at = EXCLUDED.deleted_at`)
+
+	legacyName, fullName := rt.schema.names(user.Name)
+	return rt.exec(query, user.ID, legacyName, fullName, user.Email, user.Verified, user.OrderQuota, user.CreatedAt, user.DeletedAt)
+}
+
+// PutOrder writes an order according to the conflict policy and reports
+// whether the row was written
+func (rt *RestoreTx) PutOrder(order Order) (bool, error) {
+	query := `INSERT INTO orders (id, user_id, product, quantity, created_at) VALUES ($1, $2, $3, $4, $5)`
+	query += rt.onConflict(`user_id = EXCLUDED.user_id, product = EXCLUDED.product,
+		quantity = EXCLUDED.quantity, created_at = EXCLUDED.created_at`)
+
+	return rt.exec(query, order.ID, order.UserID, order.Product, order.Quantity, order.CreatedAt)
+}
+
+func (rt *RestoreTx) onConflict(update string) string {
+	switch rt.policy {
+	case ConflictSkip:
+		return ` ON CONFLICT (id) DO NOTHING`
+	case ConflictOverwrite:
+		return ` ON CONFLICT (id) DO UPDATE SET ` + update
+	}
+	return ""
+}
+
+func (rt *RestoreTx) exec(query string, args ...interface{}) (bool, error) {
+	tag, err := rt.tx.Exec(rt.ctx, query, args...)
+	if err != nil {
+		return false, translateError(err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
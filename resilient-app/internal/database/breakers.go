@@ -0,0 +1,281 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/demo/resilient-app/internal/dependency"
+	"github.com/sony/gobreaker"
+)
+
+// The primary has a breaker for reads and one for writes, which trip
+// independently: a storm of failing writes (a full disk, lock contention, a
+// primary demoted to read-only) leaves reads served, and the other way round
+const (
+	BreakerReads  = "reads"
+	BreakerWrites = "writes"
+	// BreakerInit guards schema migrations and seeds, so a failing seed
+	// can't trip the breaker serving requests, nor requests the seed's
+	BreakerInit = "init"
+)
+
+// readPrefixes name the operations that only read; every other operation
+// goes through the write breaker
+var readPrefixes = []string{"get_", "count_", "page_", "stream_", "export_"}
+
+// initPrefixes name the operations that go through the init breaker
+var initPrefixes = []string{"migrate", "seed_"}
+
+// primaryBreaker is one of the primary's breakers with its slow-call window.
+// An operator can override it (see Force): held open it rejects every call,
+// forced half-open it admits trial calls that close it or hold it open again.
+type primaryBreaker struct {
+	db       *DB
+	settings gobreaker.Settings
+	// cb is replaced by a fresh breaker when an operator closes it
+	cb   atomic.Pointer[gobreaker.CircuitBreaker]
+	slow slowCalls
+
+	// forced is the state an operator put the breaker in, noForce if none
+	forced atomic.Int32
+	mu     sync.Mutex
+	// trials counts the calls of a forced half-open state
+	trials gobreaker.Counts
+}
+
+const noForce = -1
+
+func (db *DB) newPrimaryBreaker(name string) *primaryBreaker {
+	b := &primaryBreaker{db: db}
+	b.settings = db.breakerSettings(name, &b.slow)
+	b.cb.Store(gobreaker.NewCircuitBreaker(b.settings))
+	b.forced.Store(noForce)
+	return b
+}
+
+func (b *primaryBreaker) Name() string {
+	return b.settings.Name
+}
+
+// State returns the state an operator forced, or the breaker's own
+func (b *primaryBreaker) State() gobreaker.State {
+	if forced := b.forced.Load(); forced != noForce {
+		return gobreaker.State(forced)
+	}
+	return b.cb.Load().State()
+}
+
+// Counts returns the counts of a forced half-open state's trials, or the
+// breaker's own
+func (b *primaryBreaker) Counts() gobreaker.Counts {
+	if b.forced.Load() == int32(gobreaker.StateHalfOpen) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return b.trials
+	}
+	return b.cb.Load().Counts()
+}
+
+// Execute runs fn through the breaker, or rejects it while the breaker is
+// held open
+func (b *primaryBreaker) Execute(fn func() (interface{}, error)) (interface{}, error) {
+	switch gobreaker.State(b.forced.Load()) {
+	case gobreaker.StateOpen:
+		return nil, gobreaker.ErrOpenState
+	case gobreaker.StateHalfOpen:
+		return b.trial(fn)
+	}
+	return b.cb.Load().Execute(fn)
+}
+
+// trial runs fn as a trial call of a forced half-open state. Like gobreaker,
+// up to MaxRequests trials run; once that many succeed the breaker closes,
+// and the first failure holds it open again for the operator to decide.
+func (b *primaryBreaker) trial(fn func() (interface{}, error)) (interface{}, error) {
+	maxRequests := max(b.db.Settings().Breaker.MaxRequests, 1)
+
+	b.mu.Lock()
+	if b.forced.Load() != int32(gobreaker.StateHalfOpen) {
+		b.mu.Unlock()
+		return b.Execute(fn)
+	}
+	if b.trials.Requests >= maxRequests {
+		b.mu.Unlock()
+		return nil, gobreaker.ErrTooManyRequests
+	}
+	b.trials.Requests++
+	b.mu.Unlock()
+
+	value, err := fn()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.forced.Load() != int32(gobreaker.StateHalfOpen) {
+		return value, err
+	}
+	if !b.settings.IsSuccessful(err) {
+		b.trials.TotalFailures++
+		b.forceLocked(gobreaker.StateOpen)
+		return value, err
+	}
+	b.trials.TotalSuccesses++
+	b.trials.ConsecutiveSuccesses++
+	if b.trials.ConsecutiveSuccesses >= maxRequests {
+		b.forceLocked(gobreaker.StateClosed)
+	}
+	return value, err
+}
+
+// Force puts the breaker in state: open holds it open until the next Force,
+// half-open admits trial calls right away, and closed resets it
+func (b *primaryBreaker) Force(state gobreaker.State) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.forceLocked(state)
+}
+
+func (b *primaryBreaker) forceLocked(state gobreaker.State) {
+	from := b.State()
+	switch state {
+	case gobreaker.StateClosed:
+		b.cb.Store(gobreaker.NewCircuitBreaker(b.settings))
+		b.forced.Store(noForce)
+	case gobreaker.StateHalfOpen:
+		b.trials = gobreaker.Counts{}
+		b.forced.Store(int32(state))
+	default:
+		b.forced.Store(int32(state))
+	}
+	if from != state {
+		b.settings.OnStateChange(b.Name(), from, state)
+	}
+}
+
+// manual reports whether an operator forced the breaker's state
+func (b *primaryBreaker) manual() bool {
+	return b.forced.Load() != noForce
+}
+
+// breakerFor returns the breaker op runs through on the primary. Pings are
+// reads, so a write storm doesn't fail the health check.
+func (db *DB) breakerFor(op string) *primaryBreaker {
+	if op == "ping" {
+		return db.reads
+	}
+	for _, prefix := range initPrefixes {
+		if strings.HasPrefix(op, prefix) {
+			return db.init
+		}
+	}
+	for _, prefix := range readPrefixes {
+		if strings.HasPrefix(op, prefix) {
+			return db.reads
+		}
+	}
+	return db.writes
+}
+
+// primaryBreakers returns the read breaker and the write breaker
+func (db *DB) primaryBreakers() []*primaryBreaker {
+	return []*primaryBreaker{db.reads, db.writes}
+}
+
+// BreakerStats is the state of one of the primary's breakers and the counts
+// in its current interval
+type BreakerStats struct {
+	Name           string `json:"name"`
+	State          string `json:"state"`
+	Requests       uint32 `json:"requests"`
+	TotalSuccesses uint32 `json:"total_successes"`
+	TotalFailures  uint32 `json:"total_failures"`
+	// Manual is set while the state is one an operator forced
+	Manual bool `json:"manual,omitempty"`
+}
+
+// Breakers reports the primary's breakers by kind, BreakerReads,
+// BreakerWrites and BreakerInit
+func (db *DB) Breakers() map[string]BreakerStats {
+	stats := func(b *primaryBreaker) BreakerStats {
+		counts := b.Counts()
+		return BreakerStats{
+			Name:           b.Name(),
+			State:          b.State().String(),
+			Requests:       counts.Requests,
+			TotalSuccesses: counts.TotalSuccesses,
+			TotalFailures:  counts.TotalFailures,
+			Manual:         b.manual(),
+		}
+	}
+	return map[string]BreakerStats{
+		BreakerReads:  stats(db.reads),
+		BreakerWrites: stats(db.writes),
+		BreakerInit:   stats(db.init),
+	}
+}
+
+// GetStats returns the counts of the read and write breakers added up
+func (db *DB) GetStats() gobreaker.Counts {
+	var total gobreaker.Counts
+	for _, b := range db.primaryBreakers() {
+		counts := b.Counts()
+		total.Requests += counts.Requests
+		total.TotalSuccesses += counts.TotalSuccesses
+		total.TotalFailures += counts.TotalFailures
+		total.ConsecutiveSuccesses = max(total.ConsecutiveSuccesses, counts.ConsecutiveSuccesses)
+		total.ConsecutiveFailures = max(total.ConsecutiveFailures, counts.ConsecutiveFailures)
+	}
+	return total
+}
+
+// GetState returns the worse of the read and write breakers' states: open if
+// either is open, half-open if either is half-open, closed otherwise
+func (db *DB) GetState() gobreaker.State {
+	state := gobreaker.StateClosed
+	for _, b := range db.primaryBreakers() {
+		switch b.State() {
+		case gobreaker.StateOpen:
+			return gobreaker.StateOpen
+		case gobreaker.StateHalfOpen:
+			state = gobreaker.StateHalfOpen
+		}
+	}
+	return state
+}
+
+// breakerStatuses lists the primary's breakers for the dependency registry,
+// the init breaker included
+func (db *DB) breakerStatuses() []dependency.BreakerStatus {
+	var statuses []dependency.BreakerStatus
+	for _, b := range []*primaryBreaker{db.reads, db.writes, db.init} {
+		statuses = append(statuses, dependency.BreakerStatus{Name: b.Name(), State: b.State().String()})
+	}
+	return statuses
+}
+
+// ForceBreaker puts the primary's breaker of kind, BreakerReads,
+// BreakerWrites or BreakerInit, or reads and writes when kind is empty, in
+// state, so operators can shed
+// load from a struggling primary or put a recovered one back into service
+// without waiting for the breaker. The state holds until the next
+// ForceBreaker; a forced half-open state is decided by its trial calls.
+func (db *DB) ForceBreaker(kind string, state gobreaker.State) error {
+	var breakers []*primaryBreaker
+	switch kind {
+	case "":
+		breakers = db.primaryBreakers()
+	case BreakerReads:
+		breakers = []*primaryBreaker{db.reads}
+	case BreakerWrites:
+		breakers = []*primaryBreaker{db.writes}
+	case BreakerInit:
+		breakers = []*primaryBreaker{db.init}
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownBreaker, kind)
+	}
+	for _, b := range breakers {
+		b.Force(state)
+	}
+	return nil
+}
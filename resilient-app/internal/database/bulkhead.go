@@ -0,0 +1,155 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/demo/resilient-app/internal/metrics"
+)
+
+var (
+	bulkheadInUse = metrics.NewGaugeVec(
+		metrics.Opts{
+			Name: "database_bulkhead_in_use",
+			Help: "Operations holding a slot of the database bulkhead",
+		},
+		[]string{},
+	)
+	bulkheadQueued = metrics.NewGaugeVec(
+		metrics.Opts{
+			Name: "database_bulkhead_queued",
+			Help: "Operations waiting for a slot of the database bulkhead",
+		},
+		[]string{},
+	)
+	bulkheadRejectedTotal = metrics.NewCounterVec(
+		metrics.Opts{
+			Name: "database_bulkhead_rejected_total",
+			Help: "Total number of operations the database bulkhead turned away, by reason (queue_full or wait_timeout)",
+		},
+		[]string{"reason"},
+	)
+)
+
+// bulkhead bounds the operations running on the primary at once, so a surge
+// of slow queries holds at most MaxConcurrent pool connections and the health
+// checks, which bypass it, always find one. Operations over the limit wait
+// their turn in a bounded queue, first come first served. The limits are read
+// from the live settings, so a reload applies them to the next operation.
+type bulkhead struct {
+	settings func() BulkheadSettings
+
+	mu      sync.Mutex
+	active  int
+	waiters []chan struct{}
+}
+
+// BulkheadStats is a snapshot of the bulkhead
+type BulkheadStats struct {
+	MaxConcurrent int `json:"max_concurrent"`
+	QueueSize     int `json:"queue_size"`
+	InUse         int `json:"in_use"`
+	Queued        int `json:"queued"`
+}
+
+// Free returns how many more operations the bulkhead takes, running or
+// queued, before it rejects them
+func (s BulkheadStats) Free() int {
+	return max(s.MaxConcurrent-s.InUse, 0) + max(s.QueueSize-s.Queued, 0)
+}
+
+// acquire takes a slot, waiting up to wait for one, and returns the function
+// that gives it back. It fails with ErrBulkheadFull when the queue is full or
+// the wait runs out, and with the context's error when it is done first.
+func (b *bulkhead) acquire(ctx context.Context, wait time.Duration) (func(), error) {
+	settings := b.settings()
+	if settings.MaxConcurrent <= 0 {
+		return func() {}, nil
+	}
+
+	b.mu.Lock()
+	b.grantLocked(settings.MaxConcurrent)
+	if b.active < settings.MaxConcurrent && len(b.waiters) == 0 {
+		b.active++
+		b.exportLocked()
+		b.mu.Unlock()
+		return b.release, nil
+	}
+	if len(b.waiters) >= settings.QueueSize {
+		b.mu.Unlock()
+		bulkheadRejectedTotal.WithLabelValues("queue_full").Inc()
+		return nil, ErrBulkheadFull
+	}
+	granted := make(chan struct{})
+	b.waiters = append(b.waiters, granted)
+	b.exportLocked()
+	b.mu.Unlock()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-granted:
+		return b.release, nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timer.C:
+		err = ErrBulkheadFull
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, waiter := range b.waiters {
+		if waiter == granted {
+			b.waiters = append(b.waiters[:i], b.waiters[i+1:]...)
+			b.exportLocked()
+			if err == ErrBulkheadFull {
+				bulkheadRejectedTotal.WithLabelValues("wait_timeout").Inc()
+			}
+			return nil, err
+		}
+	}
+	// The slot was granted as the wait ended; the caller still gets it
+	return b.release, nil
+}
+
+func (b *bulkhead) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.active--
+	b.grantLocked(b.settings().MaxConcurrent)
+	b.exportLocked()
+}
+
+// grantLocked hands free slots to the longest waiting operations. A lowered
+// limit takes effect as running operations finish.
+func (b *bulkhead) grantLocked(limit int) {
+	for len(b.waiters) > 0 && (limit <= 0 || b.active < limit) {
+		close(b.waiters[0])
+		b.waiters = b.waiters[1:]
+		b.active++
+	}
+}
+
+func (b *bulkhead) exportLocked() {
+	bulkheadInUse.WithLabelValues().Set(float64(b.active))
+	bulkheadQueued.WithLabelValues().Set(float64(len(b.waiters)))
+}
+
+func (b *bulkhead) stats() BulkheadStats {
+	settings := b.settings()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return BulkheadStats{
+		MaxConcurrent: settings.MaxConcurrent,
+		QueueSize:     settings.QueueSize,
+		InUse:         b.active,
+		Queued:        len(b.waiters),
+	}
+}
+
+// BulkheadStats returns a snapshot of the bulkhead on the primary
+func (db *DB) BulkheadStats() BulkheadStats {
+	return db.bulkhead.stats()
+}
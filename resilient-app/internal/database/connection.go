@@ -2,119 +2,198 @@ package database
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
-	"os"
-	"strconv"
+	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/demo/resilient-app/internal/config"
+	"github.com/demo/resilient-app/internal/dependency"
+	"github.com/demo/resilient-app/internal/events"
+	"github.com/demo/resilient-app/internal/plugin"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/sony/gobreaker"
 	"go.uber.org/zap"
 )
 
 type DB struct {
-	conn          *sql.DB
-	circuitBreaker *gobreaker.CircuitBreaker
-	logger        *zap.Logger
+	// primary is swapped for a new pool when the pool settings change
+	primary atomic.Pointer[pgxpool.Pool]
+	// reads and writes on the primary trip separate breakers; see breakers.go
+	reads  *primaryBreaker
+	writes *primaryBreaker
+	// init guards migrations and seeds on the primary; see BreakerInit
+	init *primaryBreaker
+	// bulkhead bounds the operations on the primary; see bulkhead.go
+	bulkhead bulkhead
+	// connected is closed once the primary was reached and the schema is
+	// up to date; see startup.go
+	connected chan struct{}
+	// outage tracks failing calls on the primary; see supervisor.go
+	outage       outage
+	logger       *zap.Logger
+	interceptors []plugin.QueryInterceptor
+	dependency   *dependency.Dependency
+	// lastProbe is the latest background probe of the primary; see prober.go
+	lastProbe atomic.Pointer[Probe]
+	// statementTimeouts tracks each pooled connection's statement_timeout;
+	// see statementtimeout.go
+	statementTimeouts statementTimeouts
+
+	// replicas serve reads; see replicas.go
+	replicas          []*replica
+	nextReplica       atomic.Uint64
+	replicaDependency *dependency.Dependency
+
+	// stop ends the background loops: replica checks, pool sampling and
+	// probing
+	stop       chan struct{}
+	background sync.WaitGroup
+	closeOnce  sync.Once
+
+	// settingsMu guards settings and password, which a configuration reload
+	// updates
+	settingsMu sync.RWMutex
+	settings   Settings
+	password   string
 }
 
 type User struct {
 	ID        int       `json:"id"`
 	Name      string    `json:"name"`
 	Email     string    `json:"email"`
+	Verified  bool      `json:"verified"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
-func NewConnection(ctx context.Context, logger *zap.Logger) (*DB, error) {
-	// Get database configuration from environment
-	dbHost := getEnvOrDefault("DB_HOST", "postgres")
-	dbPort := getEnvOrDefault("DB_PORT", "5432")
-	dbUser := getEnvOrDefault("DB_USER", "postgres")
-	dbPassword := getEnvOrDefault("DB_PASSWORD", "postgres")
-	dbName := getEnvOrDefault("DB_NAME", "resilient_db")
-
-	// Build connection string
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbHost, dbPort, dbUser, dbPassword, dbName)
+// NewConnection configures the pools and breakers and connects to the
+// primary. Postgres often isn't up yet when a cluster is brought up, so an
+// unreachable database isn't an error: the connection is retried in the
+// background, and Connected is closed once it succeeds. Only invalid settings
+// and a canceled ctx fail it.
+func NewConnection(ctx context.Context, logger *zap.Logger, cfg config.Database) (*DB, error) {
+	db := &DB{
+		logger:       logger,
+		settings:     newSettings(cfg),
+		password:     cfg.Password,
+		interceptors: plugin.QueryInterceptors(),
+		stop:         make(chan struct{}),
+		connected:    make(chan struct{}),
+	}
+	settings := db.settings
+	recordSchemaPhase(settings.SchemaPhase)
 
-	// Open database connection
-	conn, err := sql.Open("postgres", connStr)
+	// Open the connection pool; the connector reads the current password.
+	// Connections are made as they are needed.
+	pool, err := newPool(connector{db: db}, settings.Pool)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database connection: %w", err)
+		return nil, fmt.Errorf("failed to configure database pool: %w", err)
+	}
+	db.primary.Store(pool)
+
+	// Configure the read, write and init breakers; their trip thresholds
+	// follow configuration reloads
+	db.reads = db.newPrimaryBreaker("database-reads")
+	db.writes = db.newPrimaryBreaker("database-writes")
+	db.init = db.newPrimaryBreaker("database-init")
+	db.bulkhead.settings = func() BulkheadSettings { return db.Settings().Bulkhead }
+	db.dependency = &dependency.Dependency{
+		Name:        "database",
+		Type:        "postgres",
+		Endpoint:    net.JoinHostPort(settings.Host, settings.Port),
+		Criticality: dependency.Degradable,
+		Breaker:     func() string { return db.GetState().String() },
+		Breakers:    db.breakerStatuses,
 	}
 
-	// Configure connection pool
-	conn.SetMaxOpenConns(25)
-	conn.SetMaxIdleConns(5)
-	conn.SetConnMaxLifetime(5 * time.Minute)
-	conn.SetConnMaxIdleTime(1 * time.Minute)
-
-	// Test connection with timeout
-	pingCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-
-	if err := conn.PingContext(pingCtx); err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+	if err := db.openReplicas(cfg.Replicas); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to configure replica pools: %w", err)
+	}
+	dependency.Register(db.dependency)
+	db.background.Add(3)
+	go db.samplePools()
+	go db.probe()
+	go db.supervise()
+
+	if err := db.connect(ctx); err != nil {
+		if ctx.Err() != nil {
+			db.Close()
+			return nil, err
+		}
+		logger.Warn("Database unavailable, retrying in the background", zap.Error(err))
+		db.background.Add(1)
+		go db.reconnect()
 	}
+	return db, nil
+}
 
-	// Configure circuit breaker
-	cbSettings := gobreaker.Settings{
-		Name:        "database",
-		MaxRequests: 3,
-		Interval:    30 * time.Second, // Reset interval
-		Timeout:     10 * time.Second, // Reduced timeout for quicker demo
+// breakerSettings configures a breaker whose trip thresholds follow
+// configuration reloads. It trips on failures, or on slow calls recorded in
+// calls; see judgeLatency.
+func (db *DB) breakerSettings(name string, calls *slowCalls) gobreaker.Settings {
+	settings := db.Settings().Breaker
+	return gobreaker.Settings{
+		Name:        name,
+		MaxRequests: settings.MaxRequests,
+		Interval:    settings.Interval.Duration,
+		Timeout:     settings.Timeout.Duration,
 		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			breaker := db.Settings().Breaker
 			failureRatio := float64(counts.TotalFailures) / float64(counts.Requests)
-			return counts.Requests >= 2 && failureRatio >= 0.5 // Trip faster
+			return counts.Requests >= breaker.MinRequests && failureRatio >= breaker.FailureRatio ||
+				calls.tooSlow(time.Now(), breaker)
+		},
+		IsSuccessful: func(err error) bool {
+			// Misses and constraint violations are client errors, not database failures
+			return err == nil || isClientError(err)
 		},
 		OnStateChange: func(name string, from gobreaker.State, to gobreaker.State) {
-			logger.Info("Circuit breaker state changed",
-				zap.String("name", name),
-				zap.String("from", from.String()),
-				zap.String("to", to.String()),
-			)
+			// A closed breaker starts judging latency afresh
+			if to == gobreaker.StateClosed {
+				calls.reset()
+			}
+			now := time.Now()
+			dependency.BreakerChanged(name, now)
+			events.Publish(events.BreakerStateChanged{
+				Breaker: name,
+				From:    from.String(),
+				To:      to.String(),
+				At:      now,
+			})
 		},
 	}
-
-	cb := gobreaker.NewCircuitBreaker(cbSettings)
-
-	db := &DB{
-		conn:           conn,
-		circuitBreaker: cb,
-		logger:         logger,
-	}
-
-	// Initialize database schema
-	if err := db.initSchema(ctx); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to initialize database schema: %w", err)
-	}
-
-	logger.Info("Database connection established successfully")
-	return db, nil
 }
 
+// Close stops the background loops and closes the pools, waiting for
+// connections in use to be released. Later calls do nothing.
 func (db *DB) Close() error {
-	if db.conn != nil {
-		return db.conn.Close()
-	}
+	db.closeOnce.Do(func() {
+		close(db.stop)
+		db.background.Wait()
+		for _, r := range db.replicas {
+			r.pool.Load().Close()
+		}
+		db.pool().Close()
+	})
 	return nil
 }
 
+// Ping checks connectivity; the outcome is recorded as the dependency's last check
 func (db *DB) Ping(ctx context.Context) error {
-	_, err := db.circuitBreaker.Execute(func() (interface{}, error) {
-		return nil, db.conn.PingContext(ctx)
+	_, err := db.execute(ctx, "ping", func(ctx context.Context) (interface{}, error) {
+		return nil, db.pool().Ping(ctx)
 	})
+	db.dependency.RecordCheck(err)
 	return err
 }
 
 func (db *DB) GetUsers(ctx context.Context) ([]User, error) {
-	result, err := db.circuitBreaker.Execute(func() (interface{}, error) {
-		query := `SELECT id, name, email, created_at FROM users ORDER BY created_at DESC LIMIT 100`
+	result, err := db.read(ctx, "get_users", func(ctx context.Context, q reader) (interface{}, error) {
+		query := `SELECT id, ` + db.userSchema().name() + `, email, verified, created_at FROM users WHERE deleted_at IS NULL ORDER BY created_at DESC LIMIT 100`
 		
-		rows, err := db.conn.QueryContext(ctx, query)
+		rows, err := q.Query(ctx, query)
 		if err != nil {
 			return nil, err
 		}
@@ -123,7 +202,7 @@ func (db *DB) GetUsers(ctx context.Context) ([]User, error) {
 		var users []User
 		for rows.Next() {
 			var user User
-			err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.CreatedAt)
+			err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Verified, &user.CreatedAt)
 			if err != nil {
 				return nil, err
 			}
@@ -141,12 +220,12 @@ func (db *DB) GetUsers(ctx context.Context) ([]User, error) {
 }
 
 func (db *DB) GetUser(ctx context.Context, id int) (*User, error) {
-	result, err := db.circuitBreaker.Execute(func() (interface{}, error) {
-		query := `SELECT id, name, email, created_at FROM users WHERE id = $1`
+	result, err := db.read(ctx, "get_user", func(ctx context.Context, q reader) (interface{}, error) {
+		query := `SELECT id, ` + db.userSchema().name() + `, email, verified, created_at FROM users WHERE id = $1 AND deleted_at IS NULL`
 		
 		var user User
-		err := db.conn.QueryRowContext(ctx, query, id).Scan(
-			&user.ID, &user.Name, &user.Email, &user.CreatedAt)
+		err := q.QueryRow(ctx, query, id).Scan(
+			&user.ID, &user.Name, &user.Email, &user.Verified, &user.CreatedAt)
 		
 		if err != nil {
 			return nil, err
@@ -156,87 +235,152 @@ func (db *DB) GetUser(ctx context.Context, id int) (*User, error) {
 	})
 
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 
 	return result.(*User), nil
 }
 
+// GetUsersByIDs loads several users in one query, used for batched lookups
+func (db *DB) GetUsersByIDs(ctx context.Context, ids []int) ([]User, error) {
+	result, err := db.execute(ctx, "get_users_by_ids", func(ctx context.Context) (interface{}, error) {
+		query := `SELECT id, ` + db.userSchema().name() + `, email, verified, created_at FROM users WHERE id = ANY($1) AND deleted_at IS NULL`
+
+		rows, err := db.pool().Query(ctx, query, ids)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var users []User
+		for rows.Next() {
+			var user User
+			err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Verified, &user.CreatedAt)
+			if err != nil {
+				return nil, err
+			}
+			users = append(users, user)
+		}
+
+		return users, rows.Err()
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result.([]User), nil
+}
+
 func (db *DB) CreateUser(ctx context.Context, name, email string) (*User, error) {
-	result, err := db.circuitBreaker.Execute(func() (interface{}, error) {
-		query := `INSERT INTO users (name, email, created_at) VALUES ($1, $2, $3) RETURNING id, name, email, created_at`
+	result, err := db.execute(ctx, "create_user", db.retry("create_user", false, func(ctx context.Context) (interface{}, error) {
+		schema := db.userSchema()
+		query := `INSERT INTO users (name, full_name, email, verified, created_at) VALUES ($1, $2, $3, FALSE, $4)
+			RETURNING id, ` + schema.name() + `, email, verified, created_at`
+		legacy, current := schema.names(name)
 		
 		var user User
-		err := db.conn.QueryRowContext(ctx, query, name, email, time.Now()).Scan(
-			&user.ID, &user.Name, &user.Email, &user.CreatedAt)
+		err := db.mutate(ctx, func(q querier) error {
+			return q.QueryRow(ctx, query, legacy, current, email, time.Now()).Scan(
+				&user.ID, &user.Name, &user.Email, &user.Verified, &user.CreatedAt)
+		})
 		
 		if err != nil {
 			return nil, err
 		}
 
 		return &user, nil
-	})
+	}))
 
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 
 	return result.(*User), nil
 }
 
-func (db *DB) GetStats() gobreaker.Counts {
-	return db.circuitBreaker.Counts()
-}
+// UpdateUser changes the user's name and email, leaving an empty one as it
+// is. A new email has to be verified again: the user is marked unverified and
+// the tokens sent to the old address are revoked, so the verification
+// sweeper sends a new one.
+func (db *DB) UpdateUser(ctx context.Context, id int, name, email string) (*User, error) {
+	var user User
+	err := db.transaction(ctx, "update_user", func(ctx context.Context, tx Tx) error {
+		var current string
+		err := tx.QueryRow(ctx,
+			`SELECT email FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, id).Scan(&current)
+		if err != nil {
+			return err
+		}
+		changed := email != "" && email != current
+
+		schema := db.userSchema()
+		legacyName, fullName := schema.names(name)
+		err = tx.QueryRow(ctx,
+			`UPDATE users SET name = COALESCE(NULLIF($2, ''), name), full_name = COALESCE(NULLIF($5, ''), full_name),
+				email = COALESCE(NULLIF($3, ''), email), verified = verified AND NOT $4
+			WHERE id = $1
+			RETURNING id, `+schema.name()+`, email, verified, created_at`, id, legacyName, email, changed, fullName).Scan(
+			&user.ID, &user.Name, &user.Email, &user.Verified, &user.CreatedAt)
+		if err != nil || !changed {
+			return err
+		}
 
-func (db *DB) GetState() gobreaker.State {
-	return db.circuitBreaker.State()
-}
+		_, err = tx.Exec(ctx, `DELETE FROM verification_tokens WHERE user_id = $1 AND used_at IS NULL`, id)
+		return err
+	})
 
-func (db *DB) initSchema(ctx context.Context) error {
-	schema := `
-		CREATE TABLE IF NOT EXISTS users (
-			id SERIAL PRIMARY KEY,
-			name VARCHAR(255) NOT NULL,
-			email VARCHAR(255) UNIQUE NOT NULL,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
-		);
-
-		-- Insert some sample data if table is empty
-		INSERT INTO users (name, email) 
-		SELECT 'John Doe', 'john@example.com'
-		WHERE NOT EXISTS (SELECT 1 FROM users);
-		
-		INSERT INTO users (name, email) 
-		SELECT 'Jane Smith', 'jane@example.com'
-		WHERE NOT EXISTS (SELECT 1 FROM users WHERE email = 'jane@example.com');
-	`
+	if err != nil {
+		return nil, translateError(err)
+	}
 
-	_, err := db.conn.ExecContext(ctx, schema)
-	return err
+	return &user, nil
 }
 
-// SimulateFailure forces the circuit breaker to fail for testing
-func (db *DB) SimulateFailure() {
-	// Execute a few failing operations to trip the circuit breaker
-	for i := 0; i < 5; i++ {
-		db.circuitBreaker.Execute(func() (interface{}, error) {
-			return nil, fmt.Errorf("simulated database failure")
+// DeleteUser soft-deletes the user: the row stays, for the orders that
+// reference it, but no read returns it and its email can be registered again
+func (db *DB) DeleteUser(ctx context.Context, id int) error {
+	_, err := db.execute(ctx, "delete_user", db.retry("delete_user", false, func(ctx context.Context) (interface{}, error) {
+		query := `UPDATE users SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`
+
+		return nil, db.mutate(ctx, func(q querier) error {
+			tag, err := q.Exec(ctx, query, id)
+			if err != nil {
+				return err
+			}
+			if tag.RowsAffected() == 0 {
+				return ErrNotFound
+			}
+			return nil
 		})
-	}
+	}))
+	return translateError(err)
 }
 
-func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
+// migrateSchema applies pending migrations on a pooled connection through
+// the init breaker; connect retries it with backoff until it succeeds. With
+// the migrate init container they have already run, and this finds nothing
+// to do.
+func (db *DB) migrateSchema(ctx context.Context) error {
+	_, err := db.init.Execute(func() (interface{}, error) {
+		conn, err := db.pool().Acquire(withStatementTimeout(ctx, 0))
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Release()
+		return nil, migrate(ctx, db.logger, conn.Conn(), LatestVersion)
+	})
+	return err
 }
 
-func getEnvOrDefaultInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
+// SimulateFailure forces the circuit breakers to fail for testing
+func (db *DB) SimulateFailure() {
+	// Execute a few failing operations to trip the read and write breakers
+	for _, b := range db.primaryBreakers() {
+		for i := 0; i < 5; i++ {
+			b.Execute(func() (interface{}, error) {
+				return nil, fmt.Errorf("simulated database failure")
+			})
 		}
 	}
-	return defaultValue
-} 
\ No newline at end of file
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/demo/resilient-app/internal/config"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgconn/ctxwatch"
+)
+
+// cancelDeadlineDelay is how long a canceled query waits for Postgres to act
+// on the cancel request before its connection is closed instead
+const cancelDeadlineDelay = time.Second
+
+// connector opens pool connections with the password in effect at the time,
+// so a rotated password is picked up by new connections without a restart.
+// Open connections keep the password they authenticated with until they
+// reach DB_CONN_MAX_LIFETIME.
+type connector struct {
+	db *DB
+	// replica is set for a replica's pool; the parts it leaves out are the
+	// primary's
+	replica *config.Replica
+}
+
+func (c connector) dsn() string {
+	c.db.settingsMu.RLock()
+	settings, password := c.db.settings, c.db.password
+	c.db.settingsMu.RUnlock()
+
+	if r := c.replica; r != nil {
+		settings.Host = r.Host
+		if r.Port != "" {
+			settings.Port = r.Port
+		}
+		if r.User != "" {
+			settings.User = r.User
+		}
+		if r.Password != "" {
+			password = r.Password
+		}
+		if r.Name != "" {
+			settings.Name = r.Name
+		}
+	}
+
+	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		dsnValue(settings.Host), dsnValue(settings.Port), dsnValue(settings.User),
+		dsnValue(password), dsnValue(settings.Name), dsnValue(settings.SSLMode))
+	for param, path := range map[string]string{
+		"sslrootcert": settings.TLS.RootCert,
+		"sslcert":     settings.TLS.Cert,
+		"sslkey":      settings.TLS.Key,
+	} {
+		if path != "" {
+			dsn += " " + param + "=" + dsnValue(path)
+		}
+	}
+	return dsn
+}
+
+// beforeConnect replaces the pool's connection parameters with current ones.
+// Parsing loads the certificate files, so renewed ones are used too.
+func (c connector) beforeConnect(ctx context.Context, cc *pgx.ConnConfig) error {
+	parsed, err := pgconn.ParseConfig(c.dsn())
+	if err != nil {
+		return err
+	}
+	cc.Config = *parsed
+	// A done context asks Postgres to cancel the statement and keeps the
+	// connection, rather than closing it mid-query
+	cc.BuildContextWatcherHandler = func(conn *pgconn.PgConn) ctxwatch.Handler {
+		return &pgconn.CancelRequestContextWatcherHandler{Conn: conn, DeadlineDelay: cancelDeadlineDelay}
+	}
+	return nil
+}
+
+// connect opens a single connection outside the pools
+func (c connector) connect(ctx context.Context) (*pgx.Conn, error) {
+	connConfig, err := pgx.ParseConfig(c.dsn())
+	if err != nil {
+		return nil, err
+	}
+	if err := c.beforeConnect(ctx, connConfig); err != nil {
+		return nil, err
+	}
+	return pgx.ConnectConfig(ctx, connConfig)
+}
+
+// dsnValue quotes a connection string value, which may contain spaces or
+// quotes when it comes from a generated secret
+func dsnValue(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
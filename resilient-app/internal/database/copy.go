@@ -0,0 +1,145 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CopyRows streams rows into table through the COPY protocol in a single
+// transaction: either every row is loaded or, on any error, none is. next
+// returns the values of the following row, or io.EOF after the last one; its
+// errors are the caller's input problems and don't count against the circuit
+// breaker. The import holds one pooled connection for its whole duration.
+// A name copied into users goes to the columns DB_SCHEMA_PHASE writes.
+func (db *DB) CopyRows(ctx context.Context, table string, columns []string, next func() ([]interface{}, error), progress func(rows int)) (int, error) {
+	rows := 0
+	_, err := db.executeUnbounded(ctx, "copy_"+table, func(ctx context.Context) (interface{}, error) {
+		tx, err := db.pool().Begin(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback(ctx)
+
+		rows, err = db.copyInto(ctx, tx, table, columns, next, progress)
+		if err != nil {
+			return nil, err
+		}
+		return nil, tx.Commit(ctx)
+	})
+	if err != nil {
+		return 0, translateError(err)
+	}
+	return rows, nil
+}
+
+// copyInto streams the rows returned by next into table within tx and
+// returns the number copied. Errors from next come back wrapped by
+// consumerError.
+func (db *DB) copyInto(ctx context.Context, tx pgx.Tx, table string, columns []string, next func() ([]interface{}, error), progress func(rows int)) (int, error) {
+	if table == "users" {
+		columns, next = db.userSchema().copyColumns(columns, next)
+	}
+
+	// Rows are sent in the text format, so values are converted by
+	// Postgres as they would be in a statement
+	source := &copySource{next: next, progress: progress}
+	query := fmt.Sprintf("COPY %s (%s) FROM STDIN", pgx.Identifier{table}.Sanitize(), identifiers(columns))
+	_, err := tx.Conn().PgConn().CopyFrom(ctx, source, query)
+	if source.err != nil {
+		return source.rows, consumerError(source.err)
+	}
+	if err != nil {
+		return source.rows, err
+	}
+
+	for _, column := range columns {
+		if column == "id" {
+			if err := advanceSequence(ctx, tx, table); err != nil {
+				return source.rows, err
+			}
+		}
+	}
+	return source.rows, nil
+}
+
+func identifiers(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = pgx.Identifier{name}.Sanitize()
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// copyText escapes the characters that delimit values and rows in the COPY
+// text format
+var copyText = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// copySource renders the rows returned by next as COPY text, one row per Read.
+// An error from next ends the copy; it is kept in err so it isn't mistaken
+// for a database failure.
+type copySource struct {
+	next     func() ([]interface{}, error)
+	progress func(rows int)
+	rows     int
+	err      error
+	buf      []byte
+	pending  []byte
+}
+
+func (s *copySource) Read(p []byte) (int, error) {
+	for len(s.pending) == 0 {
+		values, err := s.next()
+		if errors.Is(err, io.EOF) {
+			return 0, io.EOF
+		}
+		if err != nil {
+			s.err = err
+			return 0, err
+		}
+		s.buf = appendCopyRow(s.buf[:0], values)
+		s.pending = s.buf
+		s.rows++
+		if s.progress != nil {
+			s.progress(s.rows)
+		}
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+func appendCopyRow(buf []byte, values []interface{}) []byte {
+	for i, value := range values {
+		if i > 0 {
+			buf = append(buf, '\t')
+		}
+		switch v := value.(type) {
+		case nil:
+			buf = append(buf, `\N`...)
+		case string:
+			buf = append(buf, copyText.Replace(v)...)
+		case bool:
+			if v {
+				buf = append(buf, 't')
+			} else {
+				buf = append(buf, 'f')
+			}
+		case int:
+			buf = strconv.AppendInt(buf, int64(v), 10)
+		case int64:
+			buf = strconv.AppendInt(buf, v, 10)
+		case time.Time:
+			buf = v.AppendFormat(buf, time.RFC3339Nano)
+		default:
+			buf = append(buf, copyText.Replace(fmt.Sprint(v))...)
+		}
+	}
+	return append(buf, '\n')
+}
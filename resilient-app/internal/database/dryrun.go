@@ -0,0 +1,36 @@
+package database
+
+import (
+	"context"
+
+	"github.com/demo/resilient-app/internal/ctxkeys"
+)
+
+var dryRunKey = ctxkeys.New[bool]("dry_run")
+
+// WithDryRun marks ctx so mutating operations run inside a transaction that is
+// always rolled back: constraints and triggers are exercised and the would-be
+// result is returned, but nothing is persisted. Sequence values consumed by a
+// dry run are not returned to the sequence.
+func WithDryRun(ctx context.Context) context.Context {
+	return dryRunKey.With(ctx, true)
+}
+
+func IsDryRun(ctx context.Context) bool {
+	return dryRunKey.Value(ctx)
+}
+
+// mutate runs fn against the pool, or in a rolled-back transaction for dry runs
+func (db *DB) mutate(ctx context.Context, fn func(q querier) error) error {
+	if !IsDryRun(ctx) {
+		return fn(db.pool())
+	}
+
+	tx, err := db.pool().Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	return fn(tx)
+}
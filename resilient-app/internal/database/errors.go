@@ -0,0 +1,83 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	// ErrNotFound is returned when the requested entity does not exist
+	ErrNotFound = errors.New("entity not found")
+	// ErrConflict is returned when a write violates a uniqueness constraint
+	ErrConflict = errors.New("entity already exists")
+	// ErrInvalidReference is returned when a write references a missing entity
+	ErrInvalidReference = errors.New("referenced entity does not exist")
+	// ErrQuotaExceeded is returned when a user has no order quota left
+	ErrQuotaExceeded = errors.New("order quota exceeded")
+	// ErrInvalidData is returned when a value is malformed or breaks a
+	// NOT NULL or CHECK constraint
+	ErrInvalidData = errors.New("invalid data")
+	// ErrUnknownBreaker is returned for a breaker kind other than
+	// BreakerReads, BreakerWrites and BreakerInit
+	ErrUnknownBreaker = errors.New("unknown circuit breaker")
+	// ErrBulkheadFull is returned when an operation found the bulkhead's
+	// queue full, or waited its query timeout for a slot
+	ErrBulkheadFull = errors.New("too many concurrent database operations")
+	// ErrNotConnected is returned until the database was first reached at
+	// startup
+	ErrNotConnected = errors.New("database not connected yet")
+)
+
+// translateError maps driver-level errors onto the package's sentinel errors
+// so callers don't need to know about Postgres error codes
+func translateError(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23505": // unique_violation
+			return ErrConflict
+		case "23503": // foreign_key_violation
+			return ErrInvalidReference
+		case "23502", "23514": // not_null_violation, check_violation
+			return fmt.Errorf("%w: %s", ErrInvalidData, pgErr.Message)
+		}
+		if errorClass(pgErr) == "22" { // data_exception, e.g. a malformed number
+			return fmt.Errorf("%w: %s", ErrInvalidData, pgErr.Message)
+		}
+	}
+
+	return err
+}
+
+// errorClass returns the first two characters of the SQLSTATE, which name
+// its class
+func errorClass(err *pgconn.PgError) string {
+	if len(err.Code) < 2 {
+		return ""
+	}
+	return err.Code[:2]
+}
+
+// isClientError reports whether err was caused by the request rather than by
+// the database, in which case it must not count against the circuit breaker
+func isClientError(err error) bool {
+	var consumerErr *errConsumer
+	if errors.As(err, &consumerErr) || errors.Is(err, context.Canceled) {
+		return true
+	}
+
+	err = translateError(err)
+	return errors.Is(err, ErrNotFound) ||
+		errors.Is(err, ErrConflict) ||
+		errors.Is(err, ErrInvalidReference) ||
+		errors.Is(err, ErrInvalidData) ||
+		errors.Is(err, ErrQuotaExceeded)
+}
@@ -0,0 +1,128 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/demo/resilient-app/internal/dependency"
+	"github.com/demo/resilient-app/internal/disconnect"
+	"github.com/sony/gobreaker"
+)
+
+// execute runs a database operation through the circuit breaker, wrapped by
+// the registered query interceptors and bounded by its timeout. op names the
+// operation for interceptors and DB_OPERATION_TIMEOUTS.
+func (db *DB) execute(ctx context.Context, op string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	return db.intercepted(ctx, op, true, db.bounded(op, fn))
+}
+
+// executeUnbounded is execute without the query timeout, for streams, backups
+// and bulk loads, whose duration grows with the data; the caller's context
+// bounds them. Their duration says nothing about the database's health, so
+// they never count as slow calls.
+func (db *DB) executeUnbounded(ctx context.Context, op string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	return db.intercepted(ctx, op, false, func(ctx context.Context) (interface{}, error) {
+		return fn(withStatementTimeout(ctx, 0))
+	})
+}
+
+func (db *DB) intercepted(ctx context.Context, op string, timed bool, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	var result interface{}
+	err := db.intercept(ctx, op, func(ctx context.Context) error {
+		var err error
+		result, err = db.onPrimary(ctx, op, timed, fn)
+		return err
+	})
+	return result, err
+}
+
+// onPrimary runs fn against the primary through the bulkhead and op's read or
+// write breaker. A timed call that succeeds slowly counts toward slow-call
+// tripping.
+func (db *DB) onPrimary(ctx context.Context, op string, timed bool, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	// Until the schema is up to date no query can succeed, and failing them
+	// here keeps the breaker closed for when the database arrives
+	if !db.isConnected() {
+		return nil, ErrNotConnected
+	}
+
+	breaker := db.breakerFor(op)
+
+	// A half-open breaker is tried by the prober's queries, or lets a few
+	// requests through once the prober reaches the primary; either way no
+	// request is spent on a primary known to be down. The prober doesn't try
+	// the init breaker, whose own calls do.
+	if breaker != db.init && breaker.State() == gobreaker.StateHalfOpen &&
+		(db.Settings().Breaker.HalfOpen == HalfOpenProbe || db.probeDown()) {
+		dependency.BreakerRejected(breaker.Name())
+		return nil, gobreaker.ErrOpenState
+	}
+
+	// The bulkhead turns calls away before the breaker sees them, so a full
+	// bulkhead doesn't trip it. Health checks bypass it, so a surge of slow
+	// queries can't starve them of a connection.
+	if op != "ping" {
+		release, err := db.bulkhead.acquire(ctx, db.Settings().queryTimeout(op))
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
+	value, err := breaker.Execute(func() (interface{}, error) {
+		// Only calls that reach the database count toward its latency stats
+		start := time.Now()
+		value, err := fn(ctx)
+		elapsed := time.Since(start)
+		// A canceled caller isn't a database failure; pgx has already asked
+		// Postgres to cancel the statement. An overrun query timeout is one.
+		err = disconnect.Canceled(ctx, disconnect.KindDatabase, op, err)
+		failed := err != nil && !isClientError(err)
+		db.dependency.ObserveCall(elapsed, failed)
+		db.outage.record(failed)
+		db.observeQuery(ctx, op, "primary", breaker, timed, elapsed, err)
+		if err == nil && timed {
+			err = db.judgeLatency(breaker, &breaker.slow, elapsed)
+		}
+		return value, err
+	})
+	// The breaker has counted a slow call; the caller still gets its result
+	if errors.Is(err, errSlowCalls) {
+		return value, nil
+	}
+	if rejected(err) {
+		dependency.BreakerRejected(breaker.Name())
+	}
+	return value, err
+}
+
+// rejected reports whether a breaker turned the call away without making it
+func rejected(err error) bool {
+	return errors.Is(err, gobreaker.ErrOpenState) || errors.Is(err, gobreaker.ErrTooManyRequests)
+}
+
+// bounded applies op's timeout to each call of fn, as the deadline of its
+// context and as the statement_timeout of the connections it uses. Retries
+// run within a single call, so they share its deadline.
+func (db *DB) bounded(op string, fn func(ctx context.Context) (interface{}, error)) func(ctx context.Context) (interface{}, error) {
+	return func(ctx context.Context) (interface{}, error) {
+		timeout := db.Settings().queryTimeout(op)
+		ctx, cancel := context.WithTimeout(withStatementTimeout(ctx, timeout), timeout)
+		defer cancel()
+		return fn(ctx)
+	}
+}
+
+// intercept runs call wrapped by the registered query interceptors
+func (db *DB) intercept(ctx context.Context, op string, call func(ctx context.Context) error) error {
+	// The first registered interceptor is the outermost
+	for i := len(db.interceptors) - 1; i >= 0; i-- {
+		interceptor, next := db.interceptors[i], call
+		call = func(ctx context.Context) error {
+			return interceptor.InterceptQuery(ctx, op, next)
+		}
+	}
+
+	return call(ctx)
+}
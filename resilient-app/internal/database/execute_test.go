@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/demo/resilient-app/internal/config"
+	"github.com/demo/resilient-app/internal/dependency"
+	"github.com/demo/resilient-app/internal/disconnect"
+	"github.com/sony/gobreaker"
+	"go.uber.org/zap"
+)
+
+// newTestDB returns a DB with the default settings that is connected as far
+// as execute is concerned, for running operations that never reach Postgres
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	cfg, err := config.Load(func(string) (string, bool) { return "", false })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := &DB{
+		logger:    zap.NewNop(),
+		settings:  newSettings(cfg.Database),
+		stop:      make(chan struct{}),
+		connected: make(chan struct{}),
+	}
+	close(db.connected)
+	db.reads = db.newPrimaryBreaker(t.Name() + "-reads")
+	db.writes = db.newPrimaryBreaker(t.Name() + "-writes")
+	db.init = db.newPrimaryBreaker(t.Name() + "-init")
+	db.bulkhead.settings = func() BulkheadSettings { return db.Settings().Bulkhead }
+	db.dependency = &dependency.Dependency{Name: t.Name()}
+	return db
+}
+
+// blockingQuery stands in for a pgx query: it runs until its context is done
+// and fails with the context's error, as pgx does once it has asked Postgres
+// to cancel the statement
+func blockingQuery(started chan<- struct{}, queryCtx *context.Context) func(ctx context.Context) (interface{}, error) {
+	return func(ctx context.Context) (interface{}, error) {
+		*queryCtx = ctx
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+}
+
+func TestExecuteClientGone(t *testing.T) {
+	tests := []struct {
+		name string
+		// cause is why the request ends mid-query
+		cause  error
+		failed bool
+	}{
+		{
+			name:   "client disconnects",
+			cause:  disconnect.ErrClientGone,
+			failed: false,
+		},
+		{
+			name:   "request deadline passes",
+			cause:  context.DeadlineExceeded,
+			failed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+
+			parent, disconnectClient := context.WithCancel(context.Background())
+			defer disconnectClient()
+			ctx, stop := disconnect.Context(parent)
+			defer stop()
+			// Request deadlines apply below the disconnect watch, as with
+			// TimeoutMiddleware
+			if tt.cause == context.DeadlineExceeded {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, 20*time.Millisecond)
+				defer cancel()
+			}
+
+			started := make(chan struct{})
+			var queryCtx context.Context
+			go func() {
+				<-started
+				if tt.cause == disconnect.ErrClientGone {
+					disconnectClient()
+				}
+			}()
+
+			_, err := db.execute(ctx, "get_user", blockingQuery(started, &queryCtx))
+			if !errors.Is(err, tt.cause) {
+				t.Fatalf("execute returned %v, want %v", err, tt.cause)
+			}
+			if queryCtx.Err() == nil {
+				t.Fatal("the query's context wasn't canceled")
+			}
+			if cause := context.Cause(queryCtx); !errors.Is(cause, tt.cause) {
+				t.Errorf("query canceled by %v, want %v", cause, tt.cause)
+			}
+
+			counts := db.reads.Counts()
+			if counts.Requests != 1 {
+				t.Errorf("breaker saw %d requests, want 1", counts.Requests)
+			}
+			if failed := counts.TotalFailures > 0; failed != tt.failed {
+				t.Errorf("breaker recorded %d failures, want failure %v", counts.TotalFailures, tt.failed)
+			}
+			if failed := db.dependency.Status().Failures > 0; failed != tt.failed {
+				t.Errorf("dependency recorded %d failures, want failure %v", db.dependency.Status().Failures, tt.failed)
+			}
+			if state := db.reads.State(); state != gobreaker.StateClosed {
+				t.Errorf("breaker is %s, want closed", state)
+			}
+		})
+	}
+}
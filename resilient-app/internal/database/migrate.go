@@ -0,0 +1,257 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/demo/resilient-app/internal/config"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// LatestVersion migrates to the newest embedded migration
+const LatestVersion = -1
+
+// migrationLock is the advisory lock held while migrating, so pods starting
+// together apply each migration once
+const migrationLock = 7_362_481_101
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migration is a versioned schema change, read from
+// migrations/<version>_<name>.up.sql and its .down.sql counterpart. Migrations
+// are written to be safe on a schema that already has their changes, so a
+// database created before migrations were tracked adopts them in place.
+type Migration struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	up      string
+	down    string
+}
+
+// Migrations returns the embedded migrations in version order
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		file := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(file, ".sql"), ".")
+		prefix, name, found := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || !found || err != nil || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s: name must be <version>_<name>.up.sql or .down.sql", file)
+		}
+		sql, err := migrationFiles.ReadFile(path.Join("migrations", file))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.up = string(sql)
+		} else {
+			m.down = string(sql)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrate connects with cfg and migrates the schema up or down to version, or
+// to the newest migration for LatestVersion. It is the --migrate-only mode,
+// run from an init container before the app starts, so it waits for Postgres
+// rather than failing the pod: connecting and taking the migration lock are
+// retried with the same backoff as the app's reconnects until ctx is done.
+func Migrate(ctx context.Context, logger *zap.Logger, cfg config.Database, version int) error {
+	db := &DB{logger: logger, settings: newSettings(cfg), password: cfg.Password}
+	for attempt := 1; ; attempt++ {
+		conn, err := lockedConnection(ctx, db)
+		if err == nil {
+			defer conn.Close(context.Background())
+			defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLock)
+			return applyMigrations(ctx, logger, conn, version)
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("database unavailable: %w (last error: %v)", ctx.Err(), err)
+		}
+		logger.Warn("Database unavailable for migrations, retrying",
+			zap.Int("attempt", attempt), zap.Error(err))
+
+		timer := time.NewTimer(backoff(connectRetry, attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("database unavailable: %w (last error: %v)", ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+}
+
+// lockedConnection connects on its own and takes the migration lock
+func lockedConnection(ctx context.Context, db *DB) (*pgx.Conn, error) {
+	conn, err := connector{db: db}.connect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	if err := lockMigrations(ctx, conn); err != nil {
+		conn.Close(context.Background())
+		return nil, err
+	}
+	return conn, nil
+}
+
+// lockMigrations waits for the migration lock on conn
+func lockMigrations(ctx context.Context, conn *pgx.Conn) error {
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLock); err != nil {
+		return fmt.Errorf("failed to take the migration lock: %w", err)
+	}
+	return nil
+}
+
+// migrate takes the migration lock on conn and applies migrations through
+// version
+func migrate(ctx context.Context, logger *zap.Logger, conn *pgx.Conn, version int) error {
+	if err := lockMigrations(ctx, conn); err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLock)
+
+	return applyMigrations(ctx, logger, conn, version)
+}
+
+// applyMigrations applies the pending up migrations through version, or
+// reverts the applied ones above it newest first, with the migration lock
+// held. Each migration runs in a transaction with its bookkeeping, so a failed
+// one leaves the schema at the previous version.
+func applyMigrations(ctx context.Context, logger *zap.Logger, conn *pgx.Conn, version int) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	if version == LatestVersion && len(migrations) > 0 {
+		version = migrations[len(migrations)-1].Version
+	}
+
+	_, err = conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	known := make(map[int]bool, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = true
+	}
+	for v := range applied {
+		if v > version && !known[v] {
+			return fmt.Errorf("migration %d is applied but unknown to this build, so it can't be reverted", v)
+		}
+	}
+
+	for _, m := range migrations {
+		if m.Version > version || applied[m.Version] {
+			continue
+		}
+		start := time.Now()
+		err := run(ctx, conn, m.up, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name)
+		if err != nil {
+			return fmt.Errorf("migration %d_%s up: %w", m.Version, m.Name, err)
+		}
+		logger.Info("Applied migration",
+			zap.Int("version", m.Version),
+			zap.String("name", m.Name),
+			zap.Duration("duration", time.Since(start)),
+		)
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version <= version || !applied[m.Version] {
+			continue
+		}
+		start := time.Now()
+		err := run(ctx, conn, m.down, `DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+		if err != nil {
+			return fmt.Errorf("migration %d_%s down: %w", m.Version, m.Name, err)
+		}
+		logger.Info("Reverted migration",
+			zap.Int("version", m.Version),
+			zap.String("name", m.Name),
+			zap.Duration("duration", time.Since(start)),
+		)
+	}
+
+	logger.Info("Database schema is up to date", zap.Int("version", version))
+	return nil
+}
+
+func appliedVersions(ctx context.Context, conn *pgx.Conn) (map[int]bool, error) {
+	rows, err := conn.Query(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// run executes a migration's SQL and records it in one transaction
+func run(ctx context.Context, conn *pgx.Conn, sql, record string, args ...interface{}) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/demo/resilient-app/internal/config"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestMigrateWaitsForDatabase(t *testing.T) {
+	retry := connectRetry
+	connectRetry = RetrySettings{BaseDelay: Duration{10 * time.Millisecond}, MaxDelay: Duration{20 * time.Millisecond}}
+	defer func() { connectRetry = retry }()
+
+	cfg, err := config.Load(func(key string) (string, bool) {
+		switch key {
+		case "DB_HOST":
+			return "127.0.0.1", true
+		case "DB_PORT":
+			return "1", true
+		}
+		return "", false
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	core, logs := observer.New(zapcore.WarnLevel)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	err = Migrate(ctx, zap.New(core), cfg.Database, LatestVersion)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Migrate = %v, want it to retry until the context's deadline", err)
+	}
+	if retries := logs.FilterMessage("Database unavailable for migrations, retrying").Len(); retries < 2 {
+		t.Errorf("Migrate retried %d times against a refused address, want it to keep retrying", retries)
+	}
+}
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS users (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	email VARCHAR(255) UNIQUE NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Insert some sample data if table is empty
+INSERT INTO users (name, email)
+SELECT 'John Doe', 'john@example.com'
+WHERE NOT EXISTS (SELECT 1 FROM users);
+
+INSERT INTO users (name, email)
+SELECT 'Jane Smith', 'jane@example.com'
+WHERE NOT EXISTS (SELECT 1 FROM users WHERE email = 'jane@example.com');
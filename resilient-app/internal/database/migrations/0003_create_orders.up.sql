@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS orders (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	product VARCHAR(255) NOT NULL,
+	quantity INTEGER NOT NULL CHECK (quantity > 0),
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
@@ -0,0 +1,2 @@
+-- Order quota consumed by the order placement saga
+ALTER TABLE users ADD COLUMN IF NOT EXISTS order_quota INTEGER NOT NULL DEFAULT 10;
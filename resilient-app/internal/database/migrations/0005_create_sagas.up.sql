@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS sagas (
+	id VARCHAR(64) PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	status VARCHAR(32) NOT NULL,
+	step VARCHAR(255) NOT NULL DEFAULT '',
+	error TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
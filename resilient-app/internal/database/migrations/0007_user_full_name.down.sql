@@ -0,0 +1,5 @@
+-- full_name is the newer of the two wherever it was written
+UPDATE users SET name = full_name WHERE full_name IS NOT NULL AND name IS DISTINCT FROM full_name;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_name_present;
+ALTER TABLE users ALTER COLUMN name SET NOT NULL;
+ALTER TABLE users DROP COLUMN IF EXISTS full_name;
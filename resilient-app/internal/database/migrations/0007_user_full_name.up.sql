@@ -0,0 +1,8 @@
+-- Expand step of renaming users.name to full_name: the new column sits next
+-- to the old one, which may stay empty once DB_SCHEMA_PHASE=new stops
+-- writing it. Existing rows all have a name, so the check isn't run over
+-- them, which would lock the table while it scans.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS full_name VARCHAR(255);
+ALTER TABLE users ALTER COLUMN name DROP NOT NULL;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_name_present;
+ALTER TABLE users ADD CONSTRAINT users_name_present CHECK (name IS NOT NULL OR full_name IS NOT NULL) NOT VALID;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS seed_batches;
+DROP TABLE IF EXISTS seeds;
@@ -0,0 +1,18 @@
+-- Seeds by name, and the rows of each already loaded. Every batch is recorded
+-- in the transaction that loads it, so a seed interrupted by a restart is
+-- resumed where it stopped, never loading a row twice.
+CREATE TABLE IF NOT EXISTS seeds (
+	name VARCHAR(64) PRIMARY KEY,
+	count INTEGER NOT NULL,
+	batch_size INTEGER NOT NULL,
+	started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	completed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS seed_batches (
+	seed VARCHAR(64) NOT NULL REFERENCES seeds (name),
+	first_row INTEGER NOT NULL,
+	rows INTEGER NOT NULL,
+	applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (seed, first_row)
+);
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+type Order struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Product   string    `json:"product"`
+	Quantity  int       `json:"quantity"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (db *DB) GetOrders(ctx context.Context) ([]Order, error) {
+	result, err := db.execute(ctx, "get_orders", func(ctx context.Context) (interface{}, error) {
+		query := `SELECT id, user_id, product, quantity, created_at FROM orders ORDER BY created_at DESC LIMIT 100`
+
+		rows, err := db.pool().Query(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var orders []Order
+		for rows.Next() {
+			var order Order
+			err := rows.Scan(&order.ID, &order.UserID, &order.Product, &order.Quantity, &order.CreatedAt)
+			if err != nil {
+				return nil, err
+			}
+			orders = append(orders, order)
+		}
+
+		return orders, rows.Err()
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result.([]Order), nil
+}
+
+func (db *DB) GetOrder(ctx context.Context, id int) (*Order, error) {
+	result, err := db.execute(ctx, "get_order", func(ctx context.Context) (interface{}, error) {
+		query := `SELECT id, user_id, product, quantity, created_at FROM orders WHERE id = $1`
+
+		var order Order
+		err := db.pool().QueryRow(ctx, query, id).Scan(
+			&order.ID, &order.UserID, &order.Product, &order.Quantity, &order.CreatedAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &order, nil
+	})
+
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return result.(*Order), nil
+}
+
+func (db *DB) CreateOrder(ctx context.Context, userID int, product string, quantity int) (*Order, error) {
+	result, err := db.execute(ctx, "create_order", func(ctx context.Context) (interface{}, error) {
+		query := `INSERT INTO orders (user_id, product, quantity, created_at) VALUES ($1, $2, $3, $4) RETURNING id, user_id, product, quantity, created_at`
+
+		var order Order
+		err := db.mutate(ctx, func(q querier) error {
+			return q.QueryRow(ctx, query, userID, product, quantity, time.Now()).Scan(
+				&order.ID, &order.UserID, &order.Product, &order.Quantity, &order.CreatedAt)
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &order, nil
+	})
+
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return result.(*Order), nil
+}
+
+func (db *DB) DeleteOrder(ctx context.Context, id int) error {
+	_, err := db.execute(ctx, "delete_order", func(ctx context.Context) (interface{}, error) {
+		return nil, db.mutate(ctx, func(q querier) error {
+			_, err := q.Exec(ctx, `DELETE FROM orders WHERE id = $1`, id)
+			return err
+		})
+	})
+	return err
+}
+
+// ConsumeOrderQuota atomically reserves quantity units of the user's order quota
+func (db *DB) ConsumeOrderQuota(ctx context.Context, userID, quantity int) error {
+	_, err := db.execute(ctx, "consume_order_quota", func(ctx context.Context) (interface{}, error) {
+		query := `UPDATE users SET order_quota = order_quota - $2 WHERE id = $1 AND deleted_at IS NULL AND order_quota >= $2`
+
+		return nil, db.mutate(ctx, func(q querier) error {
+			tag, err := q.Exec(ctx, query, userID, quantity)
+			if err != nil {
+				return err
+			}
+
+			if tag.RowsAffected() == 0 {
+				return ErrQuotaExceeded
+			}
+			return nil
+		})
+	})
+	return err
+}
+
+func (db *DB) RestoreOrderQuota(ctx context.Context, userID, quantity int) error {
+	_, err := db.execute(ctx, "restore_order_quota", func(ctx context.Context) (interface{}, error) {
+		query := `UPDATE users SET order_quota = order_quota + $2 WHERE id = $1`
+
+		return nil, db.mutate(ctx, func(q querier) error {
+			_, err := q.Exec(ctx, query, userID, quantity)
+			return err
+		})
+	})
+	return err
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CountUsers returns the exact number of users
+func (db *DB) CountUsers(ctx context.Context) (int, error) {
+	result, err := db.execute(ctx, "count_users", func(ctx context.Context) (interface{}, error) {
+		var count int
+		err := db.pool().QueryRow(ctx, `SELECT COUNT(*) FROM users`).Scan(&count)
+		return count, err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.(int), nil
+}
+
+// GetUsersPageByOffset reads limit users in ID order after skipping offset
+// of them; the database still walks every skipped row
+func (db *DB) GetUsersPageByOffset(ctx context.Context, offset, limit int) ([]User, error) {
+	query := `SELECT id, ` + db.userSchema().name() + `, email, verified, created_at FROM users ORDER BY id LIMIT $1 OFFSET $2`
+	return db.usersPage(ctx, "page_users_offset", query, limit, offset)
+}
+
+// GetUsersPageAfter reads limit users in ID order following afterID (keyset
+// pagination), which seeks straight to the page through the primary key
+func (db *DB) GetUsersPageAfter(ctx context.Context, afterID, limit int) ([]User, error) {
+	query := `SELECT id, ` + db.userSchema().name() + `, email, verified, created_at FROM users WHERE id > $2 ORDER BY id LIMIT $1`
+	return db.usersPage(ctx, "page_users_keyset", query, limit, afterID)
+}
+
+func (db *DB) usersPage(ctx context.Context, op, query string, args ...interface{}) ([]User, error) {
+	var users []User
+	_, err := db.execute(ctx, op, db.scanRows(query, func(rows pgx.Rows) error {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Verified, &user.CreatedAt); err != nil {
+			return err
+		}
+		users = append(users, user)
+		return nil
+	}, args...))
+	return users, err
+}
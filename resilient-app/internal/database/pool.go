@@ -0,0 +1,227 @@
+package database
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/demo/resilient-app/internal/metrics"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// poolSampleInterval is how often pool statistics are exported as metrics
+const poolSampleInterval = 10 * time.Second
+
+var (
+	poolConnections = metrics.NewGaugeVec(
+		metrics.Opts{
+			Name: "database_pool_connections",
+			Help: "Connections in each pool, by state (acquired, idle or constructing)",
+		},
+		[]string{"pool", "state"},
+	)
+	poolMaxConnections = metrics.NewGaugeVec(
+		metrics.Opts{
+			Name: "database_pool_max_connections",
+			Help: "Maximum number of connections in each pool",
+		},
+		[]string{"pool"},
+	)
+	poolAcquiresTotal = metrics.NewCounterVec(
+		metrics.Opts{
+			Name: "database_pool_acquires_total",
+			Help: "Total number of connection acquires, by whether they had to wait or were canceled while waiting",
+		},
+		[]string{"pool", "result"},
+	)
+	poolAcquireSeconds = metrics.NewCounterVec(
+		metrics.Opts{
+			Name: "database_pool_acquire_seconds_total",
+			Help: "Total time spent acquiring connections",
+		},
+		[]string{"pool"},
+	)
+	poolConnectionsOpened = metrics.NewCounterVec(
+		metrics.Opts{
+			Name: "database_pool_connections_opened_total",
+			Help: "Total number of connections opened",
+		},
+		[]string{"pool"},
+	)
+	poolConnectionsClosed = metrics.NewCounterVec(
+		metrics.Opts{
+			Name: "database_pool_connections_closed_total",
+			Help: "Total number of connections closed for reaching DB_CONN_MAX_LIFETIME or DB_CONN_MAX_IDLE_TIME",
+		},
+		[]string{"pool", "reason"},
+	)
+)
+
+// reader is the subset of a pool used by read queries
+type reader interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// querier is the subset of a pool and a transaction used by mutating operations
+type querier interface {
+	reader
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// PoolStats is a snapshot of a connection pool. The counts are since the pool
+// was created, which a change of pool settings resets.
+type PoolStats struct {
+	Pool              string   `json:"pool"`
+	MaxConns          int32    `json:"max_conns"`
+	TotalConns        int32    `json:"total_conns"`
+	AcquiredConns     int32    `json:"acquired_conns"`
+	IdleConns         int32    `json:"idle_conns"`
+	ConstructingConns int32    `json:"constructing_conns"`
+	Acquires          int64    `json:"acquires"`
+	WaitedAcquires    int64    `json:"waited_acquires"`
+	CanceledAcquires  int64    `json:"canceled_acquires"`
+	AcquireTime       Duration `json:"acquire_time"`
+	OpenedConns       int64    `json:"opened_conns"`
+	MaxLifetimeClosed int64    `json:"max_lifetime_closed"`
+	MaxIdleClosed     int64    `json:"max_idle_closed"`
+}
+
+// newPool creates a pool whose connections are made by c. Connections are
+// made on demand, MinConns of them in the background straight away.
+//
+// Each connection prepares a query the first time it runs it and keeps the
+// statement for the next call, so a repeated query skips parsing and
+// planning in Postgres and the round trip that describes it. The cache goes
+// with the connection, so it's dropped when the pool replaces or closes it.
+// With no cache, queries are sent unprepared in one round trip each, which
+// poolers that reassign connections between transactions require.
+func newPool(c connector, settings PoolSettings) (*pgxpool.Pool, error) {
+	cfg, err := pgxpool.ParseConfig(c.dsn())
+	if err != nil {
+		return nil, err
+	}
+	cfg.MaxConns = settings.MaxConns
+	cfg.MinConns = settings.MinConns
+	cfg.MaxConnLifetime = settings.ConnMaxLifetime.Duration
+	cfg.MaxConnIdleTime = settings.ConnMaxIdleTime.Duration
+	cfg.BeforeConnect = c.beforeConnect
+	cfg.BeforeAcquire = c.db.applyStatementTimeout
+	cfg.BeforeClose = c.db.forgetStatementTimeout
+	if settings.StatementCache > 0 {
+		cfg.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeCacheStatement
+		cfg.ConnConfig.StatementCacheCapacity = settings.StatementCache
+	} else {
+		cfg.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeExec
+		cfg.ConnConfig.StatementCacheCapacity = 0
+		cfg.ConnConfig.DescriptionCacheCapacity = 0
+	}
+	return pgxpool.NewWithConfig(context.Background(), cfg)
+}
+
+// pool returns the primary's current pool
+func (db *DB) pool() *pgxpool.Pool {
+	return db.primary.Load()
+}
+
+// swapPool replaces the pool in p with one using settings. Queries in flight
+// finish on the old pool, which closes once its last connection is released.
+// If the new pool can't be created the old one stays.
+func (db *DB) swapPool(p *atomic.Pointer[pgxpool.Pool], name string, settings PoolSettings, c connector) {
+	pool, err := newPool(c, settings)
+	if err != nil {
+		db.logger.Error("Failed to replace database pool", zap.String("pool", name), zap.Error(err))
+		return
+	}
+	go p.Swap(pool).Close()
+}
+
+// namedPool is a pool with the name its statistics are reported under
+type namedPool struct {
+	name string
+	pool *pgxpool.Pool
+}
+
+// pools returns the primary's current pool followed by each replica's
+func (db *DB) pools() []namedPool {
+	pools := []namedPool{{"primary", db.pool()}}
+	for _, r := range db.replicas {
+		pools = append(pools, namedPool{r.endpoint, r.pool.Load()})
+	}
+	return pools
+}
+
+// PoolStats returns a snapshot of every connection pool, the primary's first
+func (db *DB) PoolStats() []PoolStats {
+	var stats []PoolStats
+	for _, p := range db.pools() {
+		stats = append(stats, poolStats(p.name, p.pool))
+	}
+	return stats
+}
+
+func poolStats(name string, pool *pgxpool.Pool) PoolStats {
+	stat := pool.Stat()
+	return PoolStats{
+		Pool:              name,
+		MaxConns:          stat.MaxConns(),
+		TotalConns:        stat.TotalConns(),
+		AcquiredConns:     stat.AcquiredConns(),
+		IdleConns:         stat.IdleConns(),
+		ConstructingConns: stat.ConstructingConns(),
+		Acquires:          stat.AcquireCount(),
+		WaitedAcquires:    stat.EmptyAcquireCount(),
+		CanceledAcquires:  stat.CanceledAcquireCount(),
+		AcquireTime:       Duration{stat.AcquireDuration()},
+		OpenedConns:       stat.NewConnsCount(),
+		MaxLifetimeClosed: stat.MaxLifetimeDestroyCount(),
+		MaxIdleClosed:     stat.MaxIdleDestroyCount(),
+	}
+}
+
+// samplePools exports pool statistics every poolSampleInterval. The pool
+// counts are cumulative, so the counters are advanced by their change since
+// the previous sample.
+func (db *DB) samplePools() {
+	defer db.background.Done()
+
+	// A replaced pool starts from zero, so samples are kept per pool
+	previous := make(map[*pgxpool.Pool]PoolStats)
+	ticker := time.NewTicker(poolSampleInterval)
+	defer ticker.Stop()
+	for {
+		current := make(map[*pgxpool.Pool]PoolStats)
+		for _, p := range db.pools() {
+			stats := poolStats(p.name, p.pool)
+			exportPoolStats(stats, previous[p.pool])
+			current[p.pool] = stats
+		}
+		previous = current
+
+		select {
+		case <-db.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func exportPoolStats(stats, last PoolStats) {
+	pool := stats.Pool
+	poolConnections.WithLabelValues(pool, "acquired").Set(float64(stats.AcquiredConns))
+	poolConnections.WithLabelValues(pool, "idle").Set(float64(stats.IdleConns))
+	poolConnections.WithLabelValues(pool, "constructing").Set(float64(stats.ConstructingConns))
+	poolMaxConnections.WithLabelValues(pool).Set(float64(stats.MaxConns))
+
+	immediate := (stats.Acquires - stats.WaitedAcquires) - (last.Acquires - last.WaitedAcquires)
+	poolAcquiresTotal.WithLabelValues(pool, "immediate").Add(float64(immediate))
+	poolAcquiresTotal.WithLabelValues(pool, "waited").Add(float64(stats.WaitedAcquires - last.WaitedAcquires))
+	poolAcquiresTotal.WithLabelValues(pool, "canceled").Add(float64(stats.CanceledAcquires - last.CanceledAcquires))
+	poolAcquireSeconds.WithLabelValues(pool).Add((stats.AcquireTime.Duration - last.AcquireTime.Duration).Seconds())
+	poolConnectionsOpened.WithLabelValues(pool).Add(float64(stats.OpenedConns - last.OpenedConns))
+	poolConnectionsClosed.WithLabelValues(pool, "max_lifetime").Add(float64(stats.MaxLifetimeClosed - last.MaxLifetimeClosed))
+	poolConnectionsClosed.WithLabelValues(pool, "max_idle").Add(float64(stats.MaxIdleClosed - last.MaxIdleClosed))
+}
@@ -0,0 +1,174 @@
+package database
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// userErasures is the channel EraseUser notifies with the erased user's ID,
+// so every pod can forget the user
+const userErasures = "user_erasures"
+
+// UserData is everything stored about one user, as returned by a data export
+type UserData struct {
+	User               UserRecord          `json:"user"`
+	Orders             []Order             `json:"orders"`
+	VerificationTokens []VerificationToken `json:"verification_tokens"`
+	ExportedAt         time.Time           `json:"exported_at"`
+}
+
+// VerificationToken describes a verification token without its value, which
+// is a credential
+type VerificationToken struct {
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	SentAt    *time.Time `json:"sent_at,omitempty"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+}
+
+// ExportUserData returns everything stored about the user, a soft-deleted one
+// included, read in one transaction so the parts are consistent
+func (db *DB) ExportUserData(ctx context.Context, id int) (*UserData, error) {
+	var data *UserData
+	err := db.transaction(ctx, "export_user_data", func(ctx context.Context, tx Tx) error {
+		data = &UserData{Orders: []Order{}, VerificationTokens: []VerificationToken{}, ExportedAt: time.Now()}
+
+		user := &data.User
+		err := tx.QueryRow(ctx,
+			`SELECT id, `+db.userSchema().name()+`, email, verified, order_quota, created_at, deleted_at FROM users WHERE id = $1`, id).Scan(
+			&user.ID, &user.Name, &user.Email, &user.Verified, &user.OrderQuota, &user.CreatedAt, &user.DeletedAt)
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(ctx,
+			`SELECT id, user_id, product, quantity, created_at FROM orders WHERE user_id = $1 ORDER BY id`, id)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var order Order
+			if err := rows.Scan(&order.ID, &order.UserID, &order.Product, &order.Quantity, &order.CreatedAt); err != nil {
+				rows.Close()
+				return err
+			}
+			data.Orders = append(data.Orders, order)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		rows, err = tx.Query(ctx,
+			`SELECT created_at, expires_at, sent_at, used_at FROM verification_tokens WHERE user_id = $1 ORDER BY created_at`, id)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var token VerificationToken
+			if err := rows.Scan(&token.CreatedAt, &token.ExpiresAt, &token.SentAt, &token.UsedAt); err != nil {
+				return err
+			}
+			data.VerificationTokens = append(data.VerificationTokens, token)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return data, nil
+}
+
+// EraseUser deletes the user and every row referencing it in one
+// transaction, a soft-deleted user included, and returns the number of rows
+// deleted. Unlike DeleteUser nothing is kept. Listeners of
+// ListenUserErasures hear of it once the transaction commits.
+func (db *DB) EraseUser(ctx context.Context, id int) (int, error) {
+	var deleted int
+	err := db.transaction(ctx, "erase_user", func(ctx context.Context, tx Tx) error {
+		deleted = 0
+		for _, query := range []string{
+			`DELETE FROM verification_tokens WHERE user_id = $1`,
+			`DELETE FROM orders WHERE user_id = $1`,
+		} {
+			tag, err := tx.Exec(ctx, query, id)
+			if err != nil {
+				return err
+			}
+			deleted += int(tag.RowsAffected())
+		}
+
+		tag, err := tx.Exec(ctx, `DELETE FROM users WHERE id = $1`, id)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrNotFound
+		}
+		deleted += int(tag.RowsAffected())
+
+		// Delivered on commit only
+		_, err = tx.Exec(ctx, `SELECT pg_notify($1, $2)`, userErasures, strconv.Itoa(id))
+		return err
+	})
+	if err != nil {
+		return 0, translateError(err)
+	}
+	return deleted, nil
+}
+
+// ListenUserErasures calls fn with the ID of every user erased, by any pod,
+// until ctx is done. It listens on a connection of its own, so it never takes
+// one from the pool, and reconnects with backoff when it drops. Erasures
+// committed while it is reconnecting are missed.
+func (db *DB) ListenUserErasures(ctx context.Context, fn func(id int)) {
+	for attempt := 1; ; attempt++ {
+		listened, err := db.listen(ctx, userErasures, func(payload string) {
+			if id, err := strconv.Atoi(payload); err == nil {
+				fn(id)
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if listened {
+			attempt = 1
+		}
+		db.logger.Warn("User erasure listener disconnected, reconnecting",
+			zap.Int("attempt", attempt), zap.Error(err))
+
+		timer := time.NewTimer(backoff(connectRetry, attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// listen calls fn with the payload of each notification on channel until the
+// connection fails or ctx is done, and reports whether it got to listen
+func (db *DB) listen(ctx context.Context, channel string, fn func(payload string)) (bool, error) {
+	conn, err := connector{db: db}.connect(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return false, err
+	}
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return true, err
+		}
+		fn(notification.Payload)
+	}
+}
@@ -0,0 +1,173 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/demo/resilient-app/internal/metrics"
+	"github.com/jackc/pgx/v5"
+	"github.com/sony/gobreaker"
+	"go.uber.org/zap"
+)
+
+var (
+	probeDuration = metrics.NewHistogramVec(
+		metrics.Opts{
+			Name:    "database_probe_duration_seconds",
+			Help:    "Latency measured by the background prober, by phase (connect or query)",
+			Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		},
+		[]string{"phase"},
+	)
+	probeFailuresTotal = metrics.NewCounterVec(
+		metrics.Opts{
+			Name: "database_probe_failures_total",
+			Help: "Total number of background probes that failed, by phase (connect or query)",
+		},
+		[]string{"phase"},
+	)
+)
+
+// Probe is the outcome of one background probe of the primary. Connect is
+// zero when the probe reused its connection.
+type Probe struct {
+	At      time.Time `json:"at"`
+	Connect Duration  `json:"connect"`
+	Query   Duration  `json:"query"`
+	Error   string    `json:"error,omitempty"`
+	// TimedOut is set when the probe ran into DB_PROBE_INTERVAL
+	TimedOut bool `json:"timed_out,omitempty"`
+	// Trial is set when the probe was a half-open breaker's trial call
+	Trial bool `json:"trial,omitempty"`
+}
+
+// OK reports whether the probe reached the database and ran its query
+func (p Probe) OK() bool {
+	return p.Error == ""
+}
+
+// LastProbe returns the most recent probe, unless the prober hasn't finished
+// one within the last few intervals, e.g. because it has just started
+func (db *DB) LastProbe() (Probe, bool) {
+	probe := db.lastProbe.Load()
+	if probe == nil || time.Since(probe.At) > 3*db.Settings().ProbeInterval.Duration {
+		return Probe{}, false
+	}
+	return *probe, true
+}
+
+// probeDown reports whether the latest probe found the primary unreachable
+func (db *DB) probeDown() bool {
+	probe, ok := db.LastProbe()
+	return ok && !probe.OK()
+}
+
+// probe measures the primary every DB_PROBE_INTERVAL on a connection of its
+// own, so its latencies aren't skewed by requests queueing for the pool and
+// it needs no pool slot when the pool is exhausted. The connection is kept
+// between probes and remade after a failure, which measures connecting too.
+func (db *DB) probe() {
+	defer db.background.Done()
+
+	var conn *pgx.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close(context.Background())
+		}
+	}()
+
+	for {
+		interval := db.Settings().ProbeInterval.Duration
+		var trial bool
+		conn, trial = db.probeOnce(conn, interval)
+
+		// A half-open breaker closes after MaxRequests trials succeed in a
+		// row; they run back to back so requests aren't held off longer
+		// than it takes
+		if trial && db.GetState() == gobreaker.StateHalfOpen {
+			select {
+			case <-db.stop:
+				return
+			default:
+				continue
+			}
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-db.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// probeOnce connects if conn is nil and runs a trivial query, within timeout.
+// While the read or write breaker is half-open with HalfOpenProbe the probe
+// is a trial call of each one that is, and trial is set. It returns the
+// connection to reuse, or nil when it should be remade.
+func (db *DB) probeOnce(conn *pgx.Conn, timeout time.Duration) (*pgx.Conn, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	probe := Probe{At: time.Now()}
+	phase := "connect"
+	measure := func() error {
+		var err error
+		if conn == nil {
+			start := time.Now()
+			conn, err = connector{db: db}.connect(ctx)
+			probe.Connect = Duration{time.Since(start)}
+			probeDuration.WithLabelValues("connect").Observe(probe.Connect.Seconds())
+			if err != nil {
+				return err
+			}
+		}
+		phase = "query"
+		start := time.Now()
+		_, err = conn.Exec(ctx, "SELECT 1")
+		probe.Query = Duration{time.Since(start)}
+		probeDuration.WithLabelValues("query").Observe(probe.Query.Seconds())
+		if err != nil {
+			conn.Close(context.Background())
+			conn = nil
+		}
+		return err
+	}
+
+	var trials []*primaryBreaker
+	if db.Settings().Breaker.HalfOpen == HalfOpenProbe {
+		for _, b := range db.primaryBreakers() {
+			if b.State() == gobreaker.StateHalfOpen {
+				trials = append(trials, b)
+			}
+		}
+	}
+
+	err := measure()
+	// The one measurement is the trial call of every half-open breaker
+	for _, b := range trials {
+		b.Execute(func() (interface{}, error) {
+			probe.Trial = true
+			if err != nil {
+				return nil, err
+			}
+			return nil, db.judgeLatency(b, &b.slow, probe.Query.Duration)
+		})
+	}
+
+	if err != nil {
+		probe.Error = err.Error()
+		probe.TimedOut = ctx.Err() == context.DeadlineExceeded
+		probeFailuresTotal.WithLabelValues(phase).Inc()
+		if previous := db.lastProbe.Load(); previous == nil || previous.OK() {
+			db.logger.Warn("Database probe failed", zap.String("phase", phase), zap.Error(err))
+		}
+	} else if previous := db.lastProbe.Load(); previous != nil && !previous.OK() {
+		db.logger.Info("Database probe succeeded again")
+	}
+	db.lastProbe.Store(&probe)
+	db.dependency.RecordCheck(err)
+	return conn, probe.Trial
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/demo/resilient-app/internal/logging"
+	"github.com/demo/resilient-app/internal/metrics"
+	"go.uber.org/zap"
+)
+
+var (
+	queryDuration = metrics.NewHistogramVec(
+		metrics.Opts{
+			Name:    "database_query_duration_seconds",
+			Help:    "Duration of database operations that reached a pool, by operation and pool",
+			Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		},
+		[]string{"operation", "pool"},
+	)
+	slowQueriesTotal = metrics.NewCounterVec(
+		metrics.Opts{
+			Name: "database_slow_queries_total",
+			Help: "Total number of database operations that took DB_SLOW_QUERY_THRESHOLD or longer, by operation",
+		},
+		[]string{"operation"},
+	)
+)
+
+// observeQuery records how long op took on pool through breaker b. A timed
+// operation that took the slow query threshold or longer is logged with the
+// request's logger, so it carries the request ID, whether it failed or not:
+// queries that run into their timeout are what trip the breaker. Only the
+// operation's name is logged, never its SQL or arguments.
+func (db *DB) observeQuery(ctx context.Context, op, pool string, b breaker, timed bool, elapsed time.Duration, err error) {
+	queryDuration.WithLabelValues(op, pool).Observe(elapsed.Seconds())
+
+	threshold := db.Settings().SlowQuery.Duration
+	if !timed || threshold <= 0 || elapsed < threshold {
+		return
+	}
+	slowQueriesTotal.WithLabelValues(op).Inc()
+
+	fields := []zap.Field{
+		zap.String("operation", op),
+		zap.String("pool", pool),
+		zap.Duration("duration", elapsed),
+		zap.Duration("threshold", threshold),
+		zap.Duration("timeout", db.Settings().queryTimeout(op)),
+		zap.String("breaker", b.Name()),
+		zap.Stringer("breaker_state", b.State()),
+	}
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	}
+	logging.FromContext(ctx, db.logger).Warn("Slow database query", fields...)
+}
@@ -0,0 +1,230 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/demo/resilient-app/internal/config"
+	"github.com/demo/resilient-app/internal/dependency"
+	"github.com/demo/resilient-app/internal/disconnect"
+	"github.com/demo/resilient-app/internal/metrics"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sony/gobreaker"
+	"go.uber.org/zap"
+)
+
+// Where reads were served, reported in database_reads_total. A fallback read
+// went to the primary after the replica it was sent to failed or missed.
+const (
+	ReadReplica  = "replica"
+	ReadPrimary  = "primary"
+	ReadFallback = "fallback"
+)
+
+var readsTotal = metrics.NewCounterVec(
+	metrics.Opts{
+		Name: "database_reads_total",
+		Help: "Total number of routed read queries, by where they were served",
+	},
+	[]string{"operation", "source"},
+)
+
+// replica is a read replica with its own pool and breaker. Failed reads and
+// health checks open its breaker, which takes it out of rotation; it rejoins
+// once a health check in the half-open state passes.
+type replica struct {
+	endpoint string
+	target   config.Replica
+	pool     atomic.Pointer[pgxpool.Pool]
+	breaker  *gobreaker.CircuitBreaker
+	slow     slowCalls
+}
+
+func replicaEndpoints(cfg config.Database) []string {
+	endpoints := make([]string, 0, len(cfg.Replicas))
+	for _, r := range cfg.Replicas {
+		port := r.Port
+		if port == "" {
+			port = cfg.Port
+		}
+		endpoints = append(endpoints, net.JoinHostPort(r.Host, port))
+	}
+	return endpoints
+}
+
+// openReplicas opens a pool per replica. Replicas aren't pinged first: one
+// that is down only costs its reads a fallback to the primary, so it doesn't
+// hold up startup.
+func (db *DB) openReplicas(targets []config.Replica) error {
+	if len(targets) == 0 {
+		return nil
+	}
+
+	settings := db.Settings()
+	for i, target := range targets {
+		r := &replica{
+			endpoint: settings.Replicas.Endpoints[i],
+			target:   target,
+		}
+		pool, err := newPool(connector{db: db, replica: &r.target}, settings.Pool)
+		if err != nil {
+			return fmt.Errorf("replica %s: %w", r.endpoint, err)
+		}
+		r.pool.Store(pool)
+		r.breaker = gobreaker.NewCircuitBreaker(db.breakerSettings("database-replica-"+r.endpoint, &r.slow))
+		db.replicas = append(db.replicas, r)
+	}
+
+	db.replicaDependency = dependency.Register(&dependency.Dependency{
+		Name:        "database-replicas",
+		Type:        "postgres",
+		Endpoint:    strings.Join(settings.Replicas.Endpoints, ","),
+		Criticality: dependency.Degradable,
+		Endpoints:   db.replicaStatuses,
+	})
+
+	db.background.Add(1)
+	go db.checkReplicas()
+	return nil
+}
+
+// read runs a read-only query on the next replica in rotation, or on the
+// primary when every replica is out of rotation. A replica that fails falls
+// back to the primary within the same call, so callers only see the
+// primary's errors. A miss is confirmed on the primary as well, because a
+// row written moments ago may not have replicated yet.
+func (db *DB) read(ctx context.Context, op string, fn func(ctx context.Context, q reader) (interface{}, error)) (interface{}, error) {
+	var result interface{}
+	err := db.intercept(ctx, op, func(ctx context.Context) error {
+		source := ReadPrimary
+		if r := db.pickReplica(); r != nil {
+			value, err := db.onReplica(ctx, op, r, fn)
+			if err == nil {
+				readsTotal.WithLabelValues(op, ReadReplica).Inc()
+				result = value
+				return nil
+			}
+			if ctx.Err() != nil || (isClientError(err) && !errors.Is(translateError(err), ErrNotFound)) {
+				return err
+			}
+			db.logger.Debug("Replica read failed; falling back to the primary",
+				zap.String("operation", op),
+				zap.String("replica", r.endpoint),
+				zap.Error(err),
+			)
+			source = ReadFallback
+		}
+
+		readsTotal.WithLabelValues(op, source).Inc()
+		var err error
+		result, err = db.onPrimary(ctx, op, true, db.bounded(op, db.retry(op, true, func(ctx context.Context) (interface{}, error) {
+			return fn(ctx, db.pool())
+		})))
+		return err
+	})
+	return result, err
+}
+
+// pickReplica returns the next replica in rotation, round robin, or nil when
+// there is none. A replica whose breaker is open is out of rotation, and so
+// is a half-open one with HalfOpenProbe: the replica checks are its trials.
+func (db *DB) pickReplica() *replica {
+	probeOnly := db.Settings().Breaker.HalfOpen == HalfOpenProbe
+	n := uint64(len(db.replicas))
+	start := db.nextReplica.Add(1)
+	for i := uint64(0); i < n; i++ {
+		r := db.replicas[(start+i)%n]
+		switch r.breaker.State() {
+		case gobreaker.StateOpen:
+			continue
+		case gobreaker.StateHalfOpen:
+			if probeOnly {
+				continue
+			}
+		}
+		return r
+	}
+	return nil
+}
+
+// onReplica runs fn against a replica through its breaker, under its own
+// query timeout so a slow replica leaves the primary a full one. It isn't
+// retried: the primary is the retry. Slow calls take a lagging replica out of
+// rotation like failing ones.
+func (db *DB) onReplica(ctx context.Context, op string, r *replica, fn func(ctx context.Context, q reader) (interface{}, error)) (interface{}, error) {
+	value, err := r.breaker.Execute(func() (interface{}, error) {
+		start := time.Now()
+		value, err := db.bounded(op, func(ctx context.Context) (interface{}, error) {
+			return fn(ctx, r.pool.Load())
+		})(ctx)
+		elapsed := time.Since(start)
+		err = disconnect.Canceled(ctx, disconnect.KindDatabase, op, err)
+		db.replicaDependency.ObserveCall(elapsed, err != nil && !isClientError(err))
+		db.observeQuery(ctx, op, r.endpoint, r.breaker, true, elapsed, err)
+		if err == nil {
+			err = db.judgeLatency(r.breaker, &r.slow, elapsed)
+		}
+		return value, err
+	})
+	if errors.Is(err, errSlowCalls) {
+		return value, nil
+	}
+	if rejected(err) {
+		dependency.BreakerRejected(r.breaker.Name())
+	}
+	return value, err
+}
+
+// checkReplicas pings every replica each DB_REPLICA_CHECK_INTERVAL, so a
+// replica that goes down leaves rotation before reads pay for finding out,
+// and one that recovers rejoins without waiting for traffic
+func (db *DB) checkReplicas() {
+	defer db.background.Done()
+
+	for {
+		interval := db.Settings().Replicas.CheckInterval.Duration
+		db.pingReplicas(interval)
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-db.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// pingReplicas checks each replica through its breaker; the outcome is
+// recorded as the dependency's last check
+func (db *DB) pingReplicas(timeout time.Duration) {
+	var errs []error
+	for _, r := range db.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		_, err := r.breaker.Execute(func() (interface{}, error) {
+			return nil, r.pool.Load().Ping(ctx)
+		})
+		cancel()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.endpoint, err))
+		}
+	}
+	db.replicaDependency.RecordCheck(errors.Join(errs...))
+}
+
+func (db *DB) replicaStatuses() []dependency.EndpointStatus {
+	statuses := make([]dependency.EndpointStatus, 0, len(db.replicas))
+	for _, r := range db.replicas {
+		statuses = append(statuses, dependency.EndpointStatus{
+			URL:          r.endpoint,
+			Breaker:      r.breaker.Name(),
+			BreakerState: r.breaker.State().String(),
+		})
+	}
+	return statuses
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/demo/resilient-app/internal/metrics"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+// Outcomes of retried operations reported in database_retries_total
+const (
+	RetryRecovered = "recovered"
+	RetryExhausted = "exhausted"
+	RetryFailed    = "failed"
+)
+
+var retriesTotal = metrics.NewCounterVec(
+	metrics.Opts{
+		Name: "database_retries_total",
+		Help: "Total number of database operations retried after a transient error, by outcome",
+	},
+	[]string{"operation", "outcome"},
+)
+
+// RetrySettings bound the attempts at an operation. The wait before each
+// retry is drawn at random up to BaseDelay doubled per attempt, capped at
+// MaxDelay, so pods retrying the same hiccup don't retry in lockstep.
+type RetrySettings struct {
+	MaxAttempts int      `json:"max_attempts"`
+	BaseDelay   Duration `json:"base_delay"`
+	MaxDelay    Duration `json:"max_delay"`
+}
+
+// Postgres errors raised before a statement runs, so even a write can be
+// retried after them
+var notExecutedCodes = map[string]bool{
+	"08001": true, // sqlclient_unable_to_establish_sqlconnection
+	"08004": true, // sqlserver_rejected_establishment_of_sqlconnection
+	"53300": true, // too_many_connections
+	"57P03": true, // cannot_connect_now, e.g. during a failover
+	"40001": true, // serialization_failure, rolled back
+	"40P01": true, // deadlock_detected, rolled back
+}
+
+// retryable reports whether err is a transient failure worth another
+// attempt. A connection lost mid-statement leaves unknown whether a write
+// committed, so only idempotent operations are retried after one.
+func retryable(err error, idempotent bool) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || isClientError(err) {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		if notExecutedCodes[pgErr.Code] {
+			return true
+		}
+		// connection_exception and admin_shutdown
+		return idempotent && (errorClass(pgErr) == "08" || pgErr.Code == "57P01")
+	}
+
+	// pgx marks errors raised before anything was sent, and a connection that
+	// couldn't be made never ran the statement
+	var connectErr *pgconn.ConnectError
+	if pgconn.SafeToRetry(err) || errors.As(err, &connectErr) {
+		return true
+	}
+
+	var netErr net.Error
+	return idempotent && (errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF))
+}
+
+// retry wraps fn so transient failures are retried with backoff. It runs
+// inside the circuit breaker: the retries of one call count as one outcome,
+// and an open breaker fails fast without any attempt.
+func (db *DB) retry(op string, idempotent bool, fn func(ctx context.Context) (interface{}, error)) func(ctx context.Context) (interface{}, error) {
+	return func(ctx context.Context) (interface{}, error) {
+		settings := db.Settings().Retry
+
+		for attempt := 1; ; attempt++ {
+			value, err := fn(ctx)
+			if err == nil {
+				if attempt > 1 {
+					retriesTotal.WithLabelValues(op, RetryRecovered).Inc()
+				}
+				return value, nil
+			}
+			if !retryable(err, idempotent) {
+				if attempt > 1 {
+					retriesTotal.WithLabelValues(op, RetryFailed).Inc()
+				}
+				return nil, err
+			}
+			if attempt >= settings.MaxAttempts {
+				if attempt > 1 {
+					retriesTotal.WithLabelValues(op, RetryExhausted).Inc()
+				}
+				return nil, err
+			}
+
+			delay := backoff(settings, attempt)
+			db.logger.Debug("Retrying database operation after transient error",
+				zap.String("operation", op),
+				zap.Int("attempt", attempt),
+				zap.Duration("delay", delay),
+				zap.Error(err),
+			)
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				retriesTotal.WithLabelValues(op, RetryFailed).Inc()
+				return nil, err
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+// backoff returns the wait before the retry following attempt, with full jitter
+func backoff(settings RetrySettings, attempt int) time.Duration {
+	ceiling := settings.MaxDelay.Duration
+	if shift := attempt - 1; shift < 20 && settings.BaseDelay.Duration<<shift < ceiling {
+		ceiling = settings.BaseDelay.Duration << shift
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
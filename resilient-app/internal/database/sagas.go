@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+
+	"github.com/demo/resilient-app/internal/saga"
+)
+
+func (db *DB) SaveSagaState(ctx context.Context, state saga.State) error {
+	_, err := db.execute(ctx, "save_saga_state", func(ctx context.Context) (interface{}, error) {
+		query := `
+			INSERT INTO sagas (id, name, status, step, error, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (id) DO UPDATE SET
+				status = EXCLUDED.status,
+				step = EXCLUDED.step,
+				error = EXCLUDED.error,
+				updated_at = EXCLUDED.updated_at`
+
+		return nil, db.mutate(ctx, func(q querier) error {
+			_, err := q.Exec(ctx, query,
+				state.ID, state.Name, state.Status, state.Step, state.Error, state.UpdatedAt)
+			return err
+		})
+	})
+	return err
+}
+
+// GetSagaStates returns the most recently updated sagas, optionally filtered by status
+func (db *DB) GetSagaStates(ctx context.Context, status string) ([]saga.State, error) {
+	result, err := db.execute(ctx, "get_saga_states", func(ctx context.Context) (interface{}, error) {
+		query := `
+			SELECT id, name, status, step, error, updated_at FROM sagas
+			WHERE $1 = '' OR status = $1
+			ORDER BY updated_at DESC LIMIT 100`
+
+		rows, err := db.pool().Query(ctx, query, status)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		states := []saga.State{}
+		for rows.Next() {
+			var state saga.State
+			err := rows.Scan(&state.ID, &state.Name, &state.Status, &state.Step, &state.Error, &state.UpdatedAt)
+			if err != nil {
+				return nil, err
+			}
+			states = append(states, state)
+		}
+
+		return states, rows.Err()
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result.([]saga.State), nil
+}
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"context"
+
+	"github.com/demo/resilient-app/internal/metrics"
+)
+
+// Phases of the expand/contract migration renaming users.name to full_name
+// (migration 0007), set by DB_SCHEMA_PHASE. Each phase works alongside pods
+// still in the one before it, so the phase can move one step at a time while
+// the app serves traffic.
+const (
+	// SchemaOld reads and writes name only
+	SchemaOld = "old"
+	// SchemaDualWrite writes name and full_name, and reads name
+	SchemaDualWrite = "dual_write"
+	// SchemaDualRead writes both, and reads full_name, falling back to name
+	// for rows the backfill hasn't reached
+	SchemaDualRead = "dual_read"
+	// SchemaNew writes full_name only, and reads it like dual_read. name is
+	// still read as the fallback and named in writes, so it must not be
+	// dropped while any pod runs this or an earlier phase
+	SchemaNew = "new"
+)
+
+// SchemaPhases lists the phases in the order they are moved through
+var SchemaPhases = []string{SchemaOld, SchemaDualWrite, SchemaDualRead, SchemaNew}
+
+var (
+	schemaPhase = metrics.NewGaugeVec(
+		metrics.Opts{
+			Name: "database_schema_phase",
+			Help: "1 for the DB_SCHEMA_PHASE in effect, 0 for the others",
+		},
+		[]string{"phase"},
+	)
+	backfilledRowsTotal = metrics.NewCounterVec(
+		metrics.Opts{
+			Name: "database_backfilled_rows_total",
+			Help: "Total number of users whose full_name was backfilled from name",
+		},
+		[]string{},
+	)
+)
+
+// userSchema is the schema phase a statement is built for. A statement and
+// its arguments take the phase from one snapshot, so a reload between the two
+// can't mix phases.
+type userSchema string
+
+func (db *DB) userSchema() userSchema {
+	return userSchema(db.Settings().SchemaPhase)
+}
+
+// name is the expression reads select the user's name with
+func (s userSchema) name() string {
+	switch s {
+	case SchemaDualRead, SchemaNew:
+		return "COALESCE(full_name, name)"
+	}
+	return "name"
+}
+
+// names returns what a write sets name and full_name to; nil leaves the
+// column alone, or empty in an insert
+func (s userSchema) names(name string) (legacy, current any) {
+	switch s {
+	case SchemaDualWrite, SchemaDualRead:
+		return name, name
+	case SchemaNew:
+		return nil, name
+	}
+	return name, nil
+}
+
+// copyColumns maps the columns of a copy into users onto those the phase
+// writes, repeating the name when both are written
+func (s userSchema) copyColumns(columns []string, next func() ([]interface{}, error)) ([]string, func() ([]interface{}, error)) {
+	index := -1
+	for i, column := range columns {
+		if column == "name" {
+			index = i
+		}
+	}
+	if index < 0 || s == SchemaOld || s == "" {
+		return columns, next
+	}
+
+	mapped := append([]string(nil), columns...)
+	if s == SchemaNew {
+		mapped[index] = "full_name"
+		return mapped, next
+	}
+	mapped = append(mapped, "full_name")
+	return mapped, func() ([]interface{}, error) {
+		values, err := next()
+		if err != nil || index >= len(values) {
+			return values, err
+		}
+		row := make([]interface{}, 0, len(values)+1)
+		return append(append(row, values...), values[index]), nil
+	}
+}
+
+// recordSchemaPhase reports phase as the one in effect
+func recordSchemaPhase(phase string) {
+	for _, p := range SchemaPhases {
+		value := 0.0
+		if p == phase {
+			value = 1
+		}
+		schemaPhase.WithLabelValues(p).Set(value)
+	}
+}
+
+// BackfillUserNames copies name into full_name where they differ, e.g. for
+// users written before dual_write or while rolled back to old. Only run it in
+// dual_write, where every write sets both; in later phases name may be stale.
+// It walks the table in ID order, batchSize rows per statement, each
+// through the circuit breaker and committed on its own, so the backfill never
+// holds long locks under load. It returns the number of users backfilled.
+func (db *DB) BackfillUserNames(ctx context.Context, batchSize int, progress func(rows int)) (int, error) {
+	query := `
+		WITH batch AS (
+			SELECT id FROM users WHERE id > $2 ORDER BY id LIMIT $1
+		), updated AS (
+			UPDATE users SET full_name = users.name FROM batch
+			WHERE users.id = batch.id AND users.name IS NOT NULL
+				AND users.full_name IS DISTINCT FROM users.name
+			RETURNING 1
+		)
+		SELECT (SELECT MAX(id) FROM batch), (SELECT COUNT(*) FROM updated)`
+
+	backfilled, after := 0, 0
+	for {
+		var last *int
+		var rows int
+		_, err := db.execute(ctx, "backfill_user_names", db.retry("backfill_user_names", true, func(ctx context.Context) (interface{}, error) {
+			return nil, db.pool().QueryRow(ctx, query, batchSize, after).Scan(&last, &rows)
+		}))
+		if err != nil {
+			return backfilled, err
+		}
+		if last == nil {
+			return backfilled, nil
+		}
+
+		after = *last
+		backfilled += rows
+		backfilledRowsTotal.WithLabelValues().Add(float64(rows))
+		if progress != nil {
+			progress(backfilled)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// seedLock namespaces the advisory locks taken per seed, keyed by the hash of
+// its name, apart from migrationLock
+const seedLock = 7_362_481
+
+// Seed is a named run of synthetic users, recorded in the seeds table so it
+// can be resumed after an interruption
+type Seed struct {
+	Name      string    `json:"name"`
+	Count     int       `json:"count"`
+	BatchSize int       `json:"batch_size"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// StartSeed records seed, or returns the one already recorded under its name
+// for it to be resumed. It fails with ErrConflict when that one has a
+// different count. The batch size of a resumed seed may change.
+func (db *DB) StartSeed(ctx context.Context, seed Seed) (*Seed, error) {
+	result, err := db.execute(ctx, "seed_start", db.retry("seed_start", true, func(ctx context.Context) (interface{}, error) {
+		stored := seed
+		err := db.pool().QueryRow(ctx,
+			`INSERT INTO seeds (name, count, batch_size) VALUES ($1, $2, $3)
+			ON CONFLICT (name) DO UPDATE SET batch_size = EXCLUDED.batch_size
+			RETURNING count, started_at`, seed.Name, seed.Count, seed.BatchSize).Scan(&stored.Count, &stored.StartedAt)
+		return &stored, err
+	}))
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	stored := result.(*Seed)
+	if stored.Count != seed.Count {
+		return nil, fmt.Errorf("%w: seed %q was started with %d users", ErrConflict, seed.Name, stored.Count)
+	}
+	return stored, nil
+}
+
+// PendingSeeds returns the seeds started but not completed, oldest first,
+// e.g. those whose pod restarted while seeding
+func (db *DB) PendingSeeds(ctx context.Context) ([]Seed, error) {
+	query := `SELECT name, count, batch_size, started_at FROM seeds WHERE completed_at IS NULL ORDER BY started_at`
+
+	seeds := []Seed{}
+	_, err := db.execute(ctx, "seed_pending", db.retry("seed_pending", true, func(ctx context.Context) (interface{}, error) {
+		seeds = seeds[:0]
+		rows, err := db.pool().Query(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var seed Seed
+			if err := rows.Scan(&seed.Name, &seed.Count, &seed.BatchSize, &seed.StartedAt); err != nil {
+				return nil, err
+			}
+			seeds = append(seeds, seed)
+		}
+		return nil, rows.Err()
+	}))
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return seeds, nil
+}
+
+// SeedUsers bulk-loads the users of a seed recorded by StartSeed through the
+// COPY protocol. Every batch is copied and recorded in the seed's ledger in
+// its own transaction, through the init breaker and retried with backoff.
+// Each batch starts where the ledger says the seed stopped, so running a seed
+// again, after a failure or on another pod at the same time, loads every row
+// once. Emails are made unique by the seed's name, and created_at steps back
+// one second per user from when the seed started, so listings ordered by
+// creation see realistic data. It returns the number of users loaded.
+func (db *DB) SeedUsers(ctx context.Context, seed Seed, progress func(rows int)) (int, error) {
+	columns := []string{"name", "email", "verified", "created_at"}
+	loaded := 0
+
+	for loaded < seed.Count {
+		_, err := db.executeUnbounded(ctx, "seed_users", db.retry("seed_users", true, func(ctx context.Context) (interface{}, error) {
+			tx, err := db.pool().Begin(ctx)
+			if err != nil {
+				return nil, err
+			}
+			defer tx.Rollback(ctx)
+
+			// Pods seeding under the same name take turns per batch
+			if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1, hashtext($2))`, seedLock, seed.Name); err != nil {
+				return nil, err
+			}
+			var first int
+			err = tx.QueryRow(ctx,
+				`SELECT COALESCE(MAX(first_row + rows), 0) FROM seed_batches WHERE seed = $1`, seed.Name).Scan(&first)
+			if err != nil {
+				return nil, err
+			}
+			end := min(first+seed.BatchSize, seed.Count)
+			if first >= end {
+				loaded = seed.Count
+				return nil, nil
+			}
+
+			i := first
+			next := func() ([]interface{}, error) {
+				if i == end {
+					return nil, io.EOF
+				}
+				values := []interface{}{
+					fmt.Sprintf("Seed User %d", i),
+					fmt.Sprintf("%s-%d@seed.invalid", seed.Name, i),
+					true,
+					seed.StartedAt.Add(-time.Duration(i) * time.Second),
+				}
+				i++
+				return values, nil
+			}
+			if _, err := db.copyInto(ctx, tx, "users", columns, next, nil); err != nil {
+				return nil, err
+			}
+			_, err = tx.Exec(ctx,
+				`INSERT INTO seed_batches (seed, first_row, rows) VALUES ($1, $2, $3)`, seed.Name, first, end-first)
+			if err != nil {
+				return nil, err
+			}
+			if err := tx.Commit(ctx); err != nil {
+				return nil, err
+			}
+			loaded = end
+			return nil, nil
+		}))
+		if err != nil {
+			return loaded, translateError(err)
+		}
+
+		if progress != nil {
+			progress(loaded)
+		}
+	}
+
+	_, err := db.execute(ctx, "seed_complete", db.retry("seed_complete", true, func(ctx context.Context) (interface{}, error) {
+		_, err := db.pool().Exec(ctx,
+			`UPDATE seeds SET completed_at = NOW() WHERE name = $1 AND completed_at IS NULL`, seed.Name)
+		return nil, err
+	}))
+	if err != nil {
+		return loaded, translateError(err)
+	}
+	return loaded, nil
+}
@@ -0,0 +1,220 @@
+package database
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/demo/resilient-app/internal/config"
+	"go.uber.org/zap"
+)
+
+// Settings is the resolved connection, pool and circuit breaker configuration.
+// It never contains the database password.
+type Settings struct {
+	Host    string          `json:"host"`
+	Port    string          `json:"port"`
+	User    string          `json:"user"`
+	Name    string          `json:"name"`
+	SSLMode string          `json:"sslmode"`
+	TLS     TLSSettings     `json:"tls"`
+	Pool    PoolSettings    `json:"pool"`
+	Breaker BreakerSettings `json:"circuit_breaker"`
+	Retry   RetrySettings   `json:"retry"`
+	// Bulkhead bounds the operations running on the primary at once
+	Bulkhead BulkheadSettings `json:"bulkhead"`
+	// QueryTimeout bounds each operation other than streams and bulk loads,
+	// unless OperationTimeouts has one for it
+	QueryTimeout      Duration            `json:"query_timeout"`
+	OperationTimeouts map[string]Duration `json:"operation_timeouts,omitempty"`
+	// Operations taking SlowQuery or longer are logged; 0 disables
+	SlowQuery Duration `json:"slow_query"`
+	// ProbeInterval spaces the background probes of the primary
+	ProbeInterval Duration `json:"probe_interval"`
+	// The primary's pool is reset once its calls have failed for
+	// ReconnectAfter; 0 disables
+	ReconnectAfter Duration `json:"reconnect_after"`
+	// SchemaPhase decides which of users.name and full_name are read and
+	// written, one of SchemaPhases
+	SchemaPhase string `json:"schema_phase"`
+	// Replicas are never shown with credentials
+	Replicas ReplicaSettings `json:"replicas"`
+}
+
+// ReplicaSettings list the read replicas as host:port
+type ReplicaSettings struct {
+	Endpoints     []string `json:"endpoints"`
+	CheckInterval Duration `json:"check_interval"`
+}
+
+// TLSSettings are the certificate files; they are read on every new
+// connection, so renewed certificates are picked up without a restart
+type TLSSettings struct {
+	RootCert string `json:"root_cert,omitempty"`
+	Cert     string `json:"cert,omitempty"`
+	Key      string `json:"key,omitempty"`
+}
+
+// PoolSettings size each pgx pool. MinConns are kept open even when idle, so
+// a burst after a quiet spell doesn't wait for connections to be made.
+type PoolSettings struct {
+	MaxConns        int32    `json:"max_conns"`
+	MinConns        int32    `json:"min_conns"`
+	ConnMaxLifetime Duration `json:"conn_max_lifetime"`
+	ConnMaxIdleTime Duration `json:"conn_max_idle_time"`
+	// StatementCache is the number of prepared statements kept per
+	// connection, 0 for none
+	StatementCache int `json:"statement_cache"`
+}
+
+// BulkheadSettings limit the operations on the primary to MaxConcurrent at a
+// time, 0 for no limit, with up to QueueSize more waiting for a slot
+type BulkheadSettings struct {
+	MaxConcurrent int `json:"max_concurrent"`
+	QueueSize     int `json:"queue_size"`
+}
+
+type BreakerSettings struct {
+	MaxRequests  uint32   `json:"max_requests"`
+	Interval     Duration `json:"interval"`
+	Timeout      Duration `json:"timeout"`
+	MinRequests  uint32   `json:"min_requests"`
+	FailureRatio float64  `json:"failure_ratio"`
+	// Successful calls slower than SlowCall trip the breaker too, once they
+	// reach SlowCallRate of at least MinRequests calls; 0 disables
+	SlowCall     Duration `json:"slow_call"`
+	SlowCallRate float64  `json:"slow_call_rate"`
+	// HalfOpen is HalfOpenProbe or HalfOpenTrickle
+	HalfOpen string `json:"half_open"`
+}
+
+// How a half-open breaker on the primary picks its trial calls
+const (
+	// HalfOpenProbe turns requests away and tries the prober's queries
+	HalfOpenProbe = "probe"
+	// HalfOpenTrickle lets the first MaxRequests requests through
+	HalfOpenTrickle = "trickle"
+)
+
+// Duration marshals as a human-readable string such as "30s"
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func newSettings(cfg config.Database) Settings {
+	return Settings{
+		Host:    cfg.Host,
+		Port:    cfg.Port,
+		User:    cfg.User,
+		Name:    cfg.Name,
+		SSLMode: cfg.SSLMode,
+		TLS: TLSSettings{
+			RootCert: cfg.SSLRootCert,
+			Cert:     cfg.SSLCert,
+			Key:      cfg.SSLKey,
+		},
+		Pool: PoolSettings{
+			MaxConns:        int32(cfg.MaxOpenConns),
+			MinConns:        int32(min(cfg.MaxIdleConns, cfg.MaxOpenConns)),
+			ConnMaxLifetime: Duration{cfg.ConnMaxLifetime},
+			ConnMaxIdleTime: Duration{cfg.ConnMaxIdleTime},
+			StatementCache:  cfg.StatementCacheSize,
+		},
+		QueryTimeout:      Duration{cfg.QueryTimeout},
+		OperationTimeouts: operationTimeouts(cfg.OperationTimeouts),
+		SlowQuery:         Duration{cfg.SlowQueryThreshold},
+		ProbeInterval:     Duration{cfg.ProbeInterval},
+		ReconnectAfter:    Duration{cfg.ReconnectAfter},
+		SchemaPhase:       cfg.SchemaPhase,
+		Breaker: BreakerSettings{
+			MaxRequests:  cfg.BreakerHalfOpenRequests,
+			Interval:     Duration{30 * time.Second}, // Reset interval
+			Timeout:      Duration{10 * time.Second}, // Reduced timeout for quicker demo
+			MinRequests:  cfg.BreakerMinRequests,
+			FailureRatio: cfg.BreakerFailureRatio,
+			SlowCall:     Duration{cfg.BreakerSlowCall},
+			SlowCallRate: cfg.BreakerSlowCallRate,
+			HalfOpen:     cfg.BreakerHalfOpen,
+		},
+		Retry: RetrySettings{
+			MaxAttempts: cfg.RetryAttempts,
+			BaseDelay:   Duration{cfg.RetryBaseDelay},
+			MaxDelay:    Duration{cfg.RetryMaxDelay},
+		},
+		Bulkhead: BulkheadSettings{
+			MaxConcurrent: cfg.MaxConcurrentQueries,
+			QueueSize:     cfg.BulkheadQueue,
+		},
+		Replicas: ReplicaSettings{
+			Endpoints:     replicaEndpoints(cfg),
+			CheckInterval: Duration{cfg.ReplicaCheckInterval},
+		},
+	}
+}
+
+func operationTimeouts(timeouts map[string]time.Duration) map[string]Duration {
+	if len(timeouts) == 0 {
+		return nil
+	}
+	durations := make(map[string]Duration, len(timeouts))
+	for op, timeout := range timeouts {
+		durations[op] = Duration{timeout}
+	}
+	return durations
+}
+
+// queryTimeout returns the timeout of the named operation
+func (s Settings) queryTimeout(op string) time.Duration {
+	if timeout, ok := s.OperationTimeouts[op]; ok {
+		return timeout.Duration
+	}
+	return s.QueryTimeout.Duration
+}
+
+// Settings returns the configuration currently in effect
+func (db *DB) Settings() Settings {
+	db.settingsMu.RLock()
+	defer db.settingsMu.RUnlock()
+	return db.settings
+}
+
+// ApplyConfig adopts the pool settings, query timeout, breaker thresholds,
+// retry policy, replica check interval, schema phase and password of a
+// reloaded configuration. A rotated password is used by new connections; the other
+// connection parameters and the replicas only change with a restart.
+func (db *DB) ApplyConfig(cfg config.Database) {
+	updated := newSettings(cfg)
+
+	db.settingsMu.Lock()
+	updated.Host, updated.Port, updated.User, updated.Name, updated.SSLMode, updated.TLS =
+		db.settings.Host, db.settings.Port, db.settings.User, db.settings.Name, db.settings.SSLMode, db.settings.TLS
+	updated.Replicas.Endpoints = db.settings.Replicas.Endpoints
+	resized := updated.Pool != db.settings.Pool
+	previousPhase := db.settings.SchemaPhase
+	db.settings = updated
+	rotated := cfg.Password != db.password
+	db.password = cfg.Password
+	db.settingsMu.Unlock()
+
+	if rotated {
+		db.logger.Info("Database password rotated; new connections use the new password")
+	}
+	if updated.SchemaPhase != previousPhase {
+		recordSchemaPhase(updated.SchemaPhase)
+		db.logger.Info("Schema phase changed",
+			zap.String("from", previousPhase), zap.String("to", updated.SchemaPhase))
+	}
+
+	if !resized {
+		return
+	}
+	// A pgx pool can't be resized, so new pools replace the current ones
+	db.logger.Info("Database pool settings changed; replacing the connection pools")
+	db.swapPool(&db.primary, "primary", updated.Pool, connector{db: db})
+	for _, r := range db.replicas {
+		db.swapPool(&r.pool, r.endpoint, updated.Pool, connector{db: db, replica: &r.target})
+	}
+}
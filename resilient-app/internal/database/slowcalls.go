@@ -0,0 +1,122 @@
+package database
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/demo/resilient-app/internal/metrics"
+	"github.com/sony/gobreaker"
+	"go.uber.org/zap"
+)
+
+// slowCallCapacity is how many recent calls a breaker's slow-call window
+// remembers; older calls in the interval are dropped first
+const slowCallCapacity = 100
+
+var slowCallsTotal = metrics.NewCounterVec(
+	metrics.Opts{
+		Name: "database_slow_calls_total",
+		Help: "Total number of database calls that succeeded but took longer than CIRCUIT_BREAKER_SLOW_CALL",
+	},
+	[]string{"breaker"},
+)
+
+// errSlowCalls is reported to a breaker for a call that succeeded but was
+// slow, when slow calls are what should open it. The caller still gets the
+// call's result.
+var errSlowCalls = errors.New("database calls are too slow")
+
+// breaker is a circuit breaker whose calls are judged by latency
+type breaker interface {
+	Name() string
+	State() gobreaker.State
+}
+
+type timedCall struct {
+	at   time.Time
+	slow bool
+}
+
+// slowCalls is a breaker's record of its recent calls and whether each was
+// slow. gobreaker only counts successes and failures, so slow-call tripping
+// keeps its own window alongside.
+type slowCalls struct {
+	mu    sync.Mutex
+	calls [slowCallCapacity]timedCall
+	next  int
+}
+
+func (s *slowCalls) record(now time.Time, slow bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[s.next] = timedCall{at: now, slow: slow}
+	s.next = (s.next + 1) % slowCallCapacity
+}
+
+// counts returns the calls made in the interval before now and how many of
+// them were slow
+func (s *slowCalls) counts(now time.Time, interval time.Duration) (calls, slow uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.calls {
+		if c.at.IsZero() || now.Sub(c.at) >= interval {
+			continue
+		}
+		calls++
+		if c.slow {
+			slow++
+		}
+	}
+	return calls, slow
+}
+
+// tooSlow reports whether at least MinRequests calls in the breaker's
+// interval were made and SlowCallRate of them were slow
+func (s *slowCalls) tooSlow(now time.Time, settings BreakerSettings) bool {
+	if settings.SlowCall.Duration <= 0 {
+		return false
+	}
+	calls, slow := s.counts(now, settings.Interval.Duration)
+	return calls >= settings.MinRequests && float64(slow)/float64(calls) >= settings.SlowCallRate
+}
+
+func (s *slowCalls) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = [slowCallCapacity]timedCall{}
+	s.next = 0
+}
+
+// judgeLatency records a successful call that took elapsed. It returns
+// errSlowCalls when the breaker should count the call as failed: a slow call
+// while half-open, or one that brings slow calls to CIRCUIT_BREAKER_SLOW_CALL_RATE.
+// A database that answers every query just under the query timeout never
+// fails, yet holds each request for seconds; this opens the breaker on it.
+func (db *DB) judgeLatency(cb breaker, calls *slowCalls, elapsed time.Duration) error {
+	settings := db.Settings().Breaker
+	if settings.SlowCall.Duration <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	slow := elapsed > settings.SlowCall.Duration
+	calls.record(now, slow)
+	if !slow {
+		return nil
+	}
+	slowCallsTotal.WithLabelValues(cb.Name()).Inc()
+
+	if cb.State() == gobreaker.StateHalfOpen {
+		return errSlowCalls
+	}
+	if calls.tooSlow(now, settings) {
+		db.logger.Warn("Database calls are too slow; opening the circuit breaker",
+			zap.String("breaker", cb.Name()),
+			zap.Duration("elapsed", elapsed),
+			zap.Duration("slow_call", settings.SlowCall.Duration),
+		)
+		return errSlowCalls
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// connectTimeout bounds each attempt to reach the primary at startup
+	connectTimeout = 10 * time.Second
+)
+
+// connectRetry spaces the background attempts to reach the primary, with
+// full jitter so pods started together don't retry in lockstep
+var connectRetry = RetrySettings{
+	BaseDelay: Duration{time.Second},
+	MaxDelay:  Duration{30 * time.Second},
+}
+
+// Connected returns a channel that is closed once the primary was reached and
+// the schema brought up to date; until then every operation fails with
+// ErrNotConnected
+func (db *DB) Connected() <-chan struct{} {
+	return db.connected
+}
+
+func (db *DB) isConnected() bool {
+	select {
+	case <-db.connected:
+		return true
+	default:
+		return false
+	}
+}
+
+// connect pings the primary and brings the schema up to date
+func (db *DB) connect(ctx context.Context) error {
+	pingCtx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+	if err := db.pool().Ping(pingCtx); err != nil {
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	if err := db.migrateSchema(ctx); err != nil {
+		return fmt.Errorf("failed to initialize database schema: %w", err)
+	}
+
+	close(db.connected)
+	db.logger.Info("Database connection established successfully", zap.Int("replicas", len(db.replicas)))
+	return nil
+}
+
+// reconnect retries connect with backoff until it succeeds or the database
+// is closed
+func (db *DB) reconnect() {
+	defer db.background.Done()
+
+	ctx, cancel := db.stopContext()
+	defer cancel()
+
+	for attempt := 1; ; attempt++ {
+		timer := time.NewTimer(backoff(connectRetry, attempt))
+		select {
+		case <-db.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		err := db.connect(ctx)
+		if err == nil {
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		db.logger.Warn("Database still unavailable", zap.Int("attempt", attempt+1), zap.Error(err))
+	}
+}
+
+// stopContext returns a context that is canceled when the database is closed
+func (db *DB) stopContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-db.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
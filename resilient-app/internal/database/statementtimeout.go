@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/demo/resilient-app/internal/ctxkeys"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// statementTimeoutKey carries the statement_timeout an operation's
+// connection should have; 0 disables it
+var statementTimeoutKey = ctxkeys.New[time.Duration]("statement_timeout")
+
+// withStatementTimeout marks ctx so the connection acquired for it runs
+// statements with timeout, 0 for none
+func withStatementTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return statementTimeoutKey.With(ctx, timeout)
+}
+
+// statementTimeouts remembers the statement_timeout set on each pooled
+// connection, so it is only set again when an operation needs another one
+type statementTimeouts struct {
+	mu    sync.Mutex
+	conns map[*pgx.Conn]time.Duration
+}
+
+// applyStatementTimeout is the pools' BeforeAcquire hook. Postgres then
+// aborts a statement that overruns its operation's timeout by itself, even
+// when the cancel request pgx sends at the deadline is lost, so a runaway
+// query never holds its connection past the budget. Acquires without a
+// timeout in ctx, such as health pings, take the connection as it is.
+func (db *DB) applyStatementTimeout(ctx context.Context, conn *pgx.Conn) bool {
+	timeout, ok := statementTimeoutKey.Lookup(ctx)
+	if !ok {
+		return true
+	}
+
+	db.statementTimeouts.mu.Lock()
+	current, known := db.statementTimeouts.conns[conn]
+	db.statementTimeouts.mu.Unlock()
+	if known && current == timeout {
+		return true
+	}
+
+	// Rounded up, since a statement_timeout of 0 means none
+	millis := timeout.Milliseconds()
+	if timeout > 0 && time.Duration(millis)*time.Millisecond < timeout {
+		millis++
+	}
+	if _, err := conn.Exec(ctx, "SELECT set_config('statement_timeout', $1, false)", strconv.FormatInt(millis, 10)); err != nil {
+		// The pool discards the connection and acquires another
+		db.logger.Debug("Failed to set statement timeout", zap.Error(err))
+		return false
+	}
+
+	db.statementTimeouts.mu.Lock()
+	if db.statementTimeouts.conns == nil {
+		db.statementTimeouts.conns = make(map[*pgx.Conn]time.Duration)
+	}
+	db.statementTimeouts.conns[conn] = timeout
+	db.statementTimeouts.mu.Unlock()
+	return true
+}
+
+// forgetStatementTimeout is the pools' BeforeClose hook
+func (db *DB) forgetStatementTimeout(conn *pgx.Conn) {
+	db.statementTimeouts.mu.Lock()
+	delete(db.statementTimeouts.conns, conn)
+	db.statementTimeouts.mu.Unlock()
+}
@@ -0,0 +1,30 @@
+package database
+
+import "context"
+
+// UserStore is the set of user operations the API serves. DB implements it
+// with Postgres behind its breakers, retries and replicas; a fake or another
+// backend (in memory, Redis) can stand in for it without the handlers
+// changing. Implementations report misses, deleted users included, as
+// ErrNotFound, duplicate emails as ErrConflict and unknown or expired
+// verification tokens as ErrInvalidToken.
+type UserStore interface {
+	// GetUsers returns the 100 newest users, newest first
+	GetUsers(ctx context.Context) ([]User, error)
+	GetUser(ctx context.Context, id int) (*User, error)
+	// GetUsersByIDs returns the users that exist among ids, in no particular
+	// order
+	GetUsersByIDs(ctx context.Context, ids []int) ([]User, error)
+	CreateUser(ctx context.Context, name, email string) (*User, error)
+	// UpdateUser sets the user's name and email, leaving empty ones as they
+	// are; a new email marks the user unverified
+	UpdateUser(ctx context.Context, id int, name, email string) (*User, error)
+	// DeleteUser soft-deletes the user; no other method returns it after
+	DeleteUser(ctx context.Context, id int) error
+	// StreamUsers calls fn for up to limit users, newest first, stopping at
+	// its first error
+	StreamUsers(ctx context.Context, limit int, fn func(User) error) error
+	VerifyEmail(ctx context.Context, token string) (*User, error)
+}
+
+var _ UserStore = (*DB)(nil)
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// StreamUsers calls fn for each user without materializing the result set. The
+// cursor is closed, and its pooled connection released, as soon as ctx is done
+// (e.g. the client disconnected) or fn returns an error.
+func (db *DB) StreamUsers(ctx context.Context, limit int, fn func(User) error) error {
+	query := `SELECT id, ` + db.userSchema().name() + `, email, verified, created_at FROM users WHERE deleted_at IS NULL ORDER BY created_at DESC LIMIT $1`
+
+	return db.stream(ctx, "stream_users", query, func(rows pgx.Rows) error {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Verified, &user.CreatedAt); err != nil {
+			return err
+		}
+		return consumerError(fn(user))
+	}, limit)
+}
+
+// StreamOrders is the streaming counterpart of GetOrders
+func (db *DB) StreamOrders(ctx context.Context, limit int, fn func(Order) error) error {
+	query := `SELECT id, user_id, product, quantity, created_at FROM orders ORDER BY created_at DESC LIMIT $1`
+
+	return db.stream(ctx, "stream_orders", query, func(rows pgx.Rows) error {
+		var order Order
+		if err := rows.Scan(&order.ID, &order.UserID, &order.Product, &order.Quantity, &order.CreatedAt); err != nil {
+			return err
+		}
+		return consumerError(fn(order))
+	}, limit)
+}
+
+// stream runs query without the query timeout, since how long it takes
+// depends on the consumer
+func (db *DB) stream(ctx context.Context, op string, query string, scan func(pgx.Rows) error, args ...interface{}) error {
+	_, err := db.executeUnbounded(ctx, op, db.scanRows(query, scan, args...))
+	return err
+}
+
+// scanRows returns an operation calling scan for each row of query
+func (db *DB) scanRows(query string, scan func(pgx.Rows) error, args ...interface{}) func(ctx context.Context) (interface{}, error) {
+	return func(ctx context.Context) (interface{}, error) {
+		rows, err := db.pool().Query(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			if err := scan(rows); err != nil {
+				return nil, err
+			}
+		}
+
+		return nil, rows.Err()
+	}
+}
+
+// errConsumer marks errors raised by a stream consumer (typically a failed
+// write to a departed client) so they don't count against the circuit breaker
+type errConsumer struct {
+	err error
+}
+
+func (e *errConsumer) Error() string { return e.err.Error() }
+func (e *errConsumer) Unwrap() error { return e.err }
+
+func consumerError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &errConsumer{err: err}
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/demo/resilient-app/internal/metrics"
+	"github.com/sony/gobreaker"
+	"go.uber.org/zap"
+)
+
+var reconnectsTotal = metrics.NewCounterVec(
+	metrics.Opts{
+		Name: "database_reconnects_total",
+		Help: "Total number of times the primary's pool was reset after sustained failures, by result (success or failure)",
+	},
+	[]string{"result"},
+)
+
+// outage tracks the primary's failing calls: first is when the calls started
+// failing without a success in between, last the latest failure, both in
+// Unix nanoseconds, first 0 while calls succeed
+type outage struct {
+	first atomic.Int64
+	last  atomic.Int64
+}
+
+// record notes whether a call on the primary failed
+func (o *outage) record(failed bool) {
+	if !failed {
+		o.first.Store(0)
+		return
+	}
+	now := time.Now().UnixNano()
+	o.first.CompareAndSwap(0, now)
+	o.last.Store(now)
+}
+
+// since returns when the calls started failing, zero if they aren't
+func (o *outage) since() time.Time {
+	first := o.first.Load()
+	if first == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, first)
+}
+
+// sustained reports whether calls have failed for at least after and still
+// do, or the breaker they tripped is still open
+func (o *outage) sustained(after time.Duration, open bool) bool {
+	since := o.since()
+	if since.IsZero() || time.Since(since) < after {
+		return false
+	}
+	return open || time.Since(time.Unix(0, o.last.Load())) < after
+}
+
+// supervise resets the primary's pool once its calls have failed for
+// DB_RECONNECT_AFTER. When Postgres comes back on a new address the pooled
+// connections keep failing, and a half-open breaker closed by the prober's
+// fresh connection trips again on them. A pool that pings is put back into
+// service right away, its breakers closed; one that doesn't is replaced
+// again with backoff.
+func (db *DB) supervise() {
+	defer db.background.Done()
+
+	attempt := 0
+	for {
+		wait := db.Settings().ProbeInterval.Duration
+		if attempt > 0 {
+			wait = backoff(connectRetry, attempt)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-db.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		after := db.Settings().ReconnectAfter.Duration
+		if after <= 0 || !db.isConnected() || !db.outage.sustained(after, db.GetState() != gobreaker.StateClosed) {
+			attempt = 0
+			continue
+		}
+		attempt++
+		if db.resetPrimary(attempt) {
+			attempt = 0
+		}
+	}
+}
+
+// resetPrimary replaces the primary's pool, whose connections are made
+// afresh and resolve the host again, and pings it. Once it pings, the
+// breakers are closed, except those an operator forced.
+func (db *DB) resetPrimary(attempt int) bool {
+	db.logger.Warn("Database failing; resetting the connection pool",
+		zap.Time("failing_since", db.outage.since()),
+		zap.Int("attempt", attempt))
+	db.swapPool(&db.primary, "primary", db.Settings().Pool, connector{db: db})
+
+	ctx, cancel := db.stopContext()
+	defer cancel()
+	ctx, cancelPing := context.WithTimeout(ctx, connectTimeout)
+	defer cancelPing()
+	if err := db.pool().Ping(ctx); err != nil {
+		reconnectsTotal.WithLabelValues("failure").Inc()
+		db.logger.Warn("Database still unreachable after resetting the pool", zap.Int("attempt", attempt), zap.Error(err))
+		return false
+	}
+
+	db.outage.record(false)
+	for _, b := range db.primaryBreakers() {
+		if !b.manual() && b.State() != gobreaker.StateClosed {
+			b.Force(gobreaker.StateClosed)
+		}
+	}
+	db.dependency.RecordCheck(nil)
+	reconnectsTotal.WithLabelValues("success").Inc()
+	db.logger.Info("Database reachable again; circuit breakers closed", zap.Int("attempt", attempt))
+	return true
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Tx runs the statements of a transaction started by WithTx. It can't commit
+// or roll back: WithTx does, depending on the outcome of its function.
+type Tx interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// WithTx runs fn in a serializable transaction through the circuit breaker,
+// bounded by DB_QUERY_TIMEOUT, and commits it when fn succeeds. Postgres
+// rolls back a transaction that conflicts with a concurrent one or deadlocks;
+// the whole transaction is then retried with backoff, as a transient error
+// would be (DB_RETRY_ATTEMPTS), so fn must be safe to run more than once.
+// Errors fn returns that didn't come from the database don't count against
+// the breaker and aren't retried. In a dry run the transaction is rolled back
+// instead of committed.
+func (db *DB) WithTx(ctx context.Context, fn func(ctx context.Context, tx Tx) error) error {
+	return translateError(db.transaction(ctx, "transaction", fn))
+}
+
+// transaction is WithTx with the operation named op for interceptors and
+// retry metrics
+func (db *DB) transaction(ctx context.Context, op string, fn func(ctx context.Context, tx Tx) error) error {
+	// A commit lost with its connection may have gone through, so only
+	// errors raised before the statement ran are retried
+	_, err := db.execute(ctx, op, db.retry(op, false, func(ctx context.Context) (interface{}, error) {
+		tx, err := db.pool().BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.Serializable})
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback(ctx)
+
+		if err := fn(ctx, tx); err != nil {
+			if !databaseError(err) {
+				err = consumerError(err)
+			}
+			return nil, err
+		}
+		if IsDryRun(ctx) {
+			return nil, nil
+		}
+		return nil, tx.Commit(ctx)
+	}))
+	return err
+}
+
+// databaseError reports whether err came from the database or the connection
+// to it, rather than from the caller's own logic
+func databaseError(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) ||
+		errors.Is(err, pgx.ErrNoRows) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		retryable(err, true)
+}
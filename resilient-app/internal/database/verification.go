@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrInvalidToken is returned when a verification token is unknown, expired or already used
+var ErrInvalidToken = errors.New("invalid or expired verification token")
+
+// CreateVerificationToken stores a token for the user; ErrInvalidReference
+// means the user was erased
+func (db *DB) CreateVerificationToken(ctx context.Context, userID int, token string, ttl time.Duration) error {
+	_, err := db.execute(ctx, "create_verification_token", func(ctx context.Context) (interface{}, error) {
+		query := `INSERT INTO verification_tokens (token, user_id, created_at, expires_at) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (token) DO NOTHING`
+
+		now := time.Now()
+		_, err := db.pool().Exec(ctx, query, token, userID, now, now.Add(ttl))
+		return nil, err
+	})
+	return translateError(err)
+}
+
+func (db *DB) MarkVerificationSent(ctx context.Context, token string) error {
+	_, err := db.execute(ctx, "mark_verification_sent", func(ctx context.Context) (interface{}, error) {
+		query := `UPDATE verification_tokens SET sent_at = $2 WHERE token = $1`
+
+		_, err := db.pool().Exec(ctx, query, token, time.Now())
+		return nil, err
+	})
+	return err
+}
+
+// GetPendingVerifications returns unverified users that have no live token,
+// so users whose verification job was lost (e.g. pod restart) are picked up again
+func (db *DB) GetPendingVerifications(ctx context.Context, limit int) ([]int, error) {
+	result, err := db.execute(ctx, "get_pending_verifications", func(ctx context.Context) (interface{}, error) {
+		query := `
+			SELECT u.id FROM users u
+			WHERE u.verified = FALSE AND u.deleted_at IS NULL
+			AND NOT EXISTS (
+				SELECT 1 FROM verification_tokens t
+				WHERE t.user_id = u.id AND t.used_at IS NULL AND t.expires_at > NOW()
+			)
+			ORDER BY u.id
+			LIMIT $1`
+
+		rows, err := db.pool().Query(ctx, query, limit)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var ids []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+
+		return ids, rows.Err()
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result.([]int), nil
+}
+
+// VerifyEmail consumes the token and marks its user as verified in a single
+// transaction, retried if it collides with a concurrent one
+func (db *DB) VerifyEmail(ctx context.Context, token string) (*User, error) {
+	var user User
+	err := db.transaction(ctx, "verify_email", func(ctx context.Context, tx Tx) error {
+		var userID int
+		err := tx.QueryRow(ctx,
+			`UPDATE verification_tokens SET used_at = NOW()
+			WHERE token = $1 AND used_at IS NULL AND expires_at > NOW()
+			RETURNING user_id`, token).Scan(&userID)
+		if err != nil {
+			return err
+		}
+
+		return tx.QueryRow(ctx,
+			`UPDATE users SET verified = TRUE WHERE id = $1 AND deleted_at IS NULL
+			RETURNING id, `+db.userSchema().name()+`, email, verified, created_at`, userID).Scan(
+			&user.ID, &user.Name, &user.Email, &user.Verified, &user.CreatedAt)
+	})
+
+	if errors.Is(translateError(err), ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
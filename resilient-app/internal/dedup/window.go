@@ -0,0 +1,104 @@
+// Package dedup coalesces identical requests that arrive within a short
+// window. The first request with a given fingerprint runs; duplicates that
+// arrive while it is in flight, or shortly after it finished, wait for it and
+// receive the same response instead of repeating its side effects.
+package dedup
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// sweepInterval bounds how often expired entries are dropped
+const sweepInterval = time.Second
+
+// Response is a finished request's response, replayed to its duplicates
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Call is one fingerprint's request, shared by the request that runs it and
+// the duplicates waiting for it
+type Call struct {
+	done     chan struct{}
+	response *Response
+	expires  time.Time
+}
+
+// Wait blocks until the call finished and returns its response, or nil when
+// the response may not be replayed and the duplicate has to run itself
+func (c *Call) Wait(ctx context.Context) (*Response, error) {
+	select {
+	case <-c.done:
+		return c.response, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Window tracks the calls of recent fingerprints
+type Window struct {
+	mu        sync.Mutex
+	calls     map[string]*Call
+	lastSweep time.Time
+}
+
+func New() *Window {
+	return &Window{calls: make(map[string]*Call)}
+}
+
+// Join returns the call for key. When leader is true the caller runs the
+// request and must Finish the call; otherwise it is a duplicate and waits.
+// A call stays joinable while in flight and until window after it started.
+func (w *Window) Join(key string, window time.Duration) (c *Call, leader bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := time.Now()
+	w.sweep(now)
+
+	if c := w.calls[key]; c != nil && (!c.finished() || now.Before(c.expires)) {
+		return c, false
+	}
+	c = &Call{done: make(chan struct{}), expires: now.Add(window)}
+	w.calls[key] = c
+	return c, true
+}
+
+// Finish completes the call with its response. A nil response releases the
+// waiting duplicates to run themselves and forgets the fingerprint.
+func (w *Window) Finish(key string, c *Call, response *Response) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	c.response = response
+	close(c.done)
+	if response == nil && w.calls[key] == c {
+		delete(w.calls, key)
+	}
+}
+
+func (c *Call) finished() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *Window) sweep(now time.Time) {
+	if now.Sub(w.lastSweep) < sweepInterval {
+		return
+	}
+	w.lastSweep = now
+	for key, c := range w.calls {
+		if c.finished() && !now.Before(c.expires) {
+			delete(w.calls, key)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package dependency
+
+import (
+	"sort"
+	"time"
+)
+
+// Breaker is one circuit breaker, whether it guards a dependency or not, and
+// when it entered its state
+type Breaker struct {
+	Name  string
+	State string
+	Since time.Time
+}
+
+// BreakerChanged records that breaker entered a new state at at. Breakers
+// that don't track this themselves (gobreaker) report it from their state
+// change callback; unlike the event bus, nothing here is ever dropped.
+func (r *Registry) BreakerChanged(breaker string, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.breakerSince[breaker] = at
+}
+
+// RegisterBreakers adds breakers that guard no dependency, e.g. the per-route
+// ones, to those Breakers returns. source reports their state as it is when
+// called.
+func (r *Registry) RegisterBreakers(source func() []Breaker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.breakerSources = append(r.breakerSources, source)
+}
+
+// Breakers returns every breaker, of the registered dependencies and breaker
+// sources, in its current state and sorted by name. A breaker that never
+// changed state has been in it since the registry was created.
+func (r *Registry) Breakers() []Breaker {
+	r.mu.RLock()
+	dependencies := make([]*Dependency, 0, len(r.dependencies))
+	for _, d := range r.dependencies {
+		dependencies = append(dependencies, d)
+	}
+	sources := r.breakerSources
+	r.mu.RUnlock()
+
+	// States are read without the lock held, since reading one may take the
+	// breaker's own lock, under which BreakerChanged is called
+	var breakers []Breaker
+	add := func(name, state string) {
+		breakers = append(breakers, Breaker{Name: name, State: state})
+	}
+	for _, d := range dependencies {
+		switch {
+		case d.Endpoints != nil:
+			for _, ep := range d.Endpoints() {
+				add(ep.Breaker, ep.BreakerState)
+			}
+		case d.Breakers != nil:
+			for _, b := range d.Breakers() {
+				add(b.Name, b.State)
+			}
+		case d.Breaker != nil:
+			add(d.Name, d.Breaker())
+		}
+	}
+
+	r.mu.RLock()
+	for i := range breakers {
+		since, changed := r.breakerSince[breakers[i].Name]
+		if !changed {
+			since = r.created
+		}
+		breakers[i].Since = since
+	}
+	r.mu.RUnlock()
+
+	for _, source := range sources {
+		breakers = append(breakers, source()...)
+	}
+	sort.Slice(breakers, func(i, j int) bool { return breakers[i].Name < breakers[j].Name })
+	return breakers
+}
+
+// BreakerChanged records a state change on the Default registry
+func BreakerChanged(breaker string, at time.Time) {
+	Default.BreakerChanged(breaker, at)
+}
@@ -0,0 +1,178 @@
+// Package dependency keeps a registry of the downstream systems the app relies
+// on, with their breaker state, last health check and call latency, so
+// operators can see the blast radius of each failure.
+package dependency
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Criticality says what happens to the app when a dependency fails
+type Criticality string
+
+const (
+	// Critical dependencies take the app down with them
+	Critical Criticality = "critical"
+	// Degradable dependencies have a fallback (e.g. cached or placeholder data)
+	Degradable Criticality = "degradable"
+	// Optional dependencies only cost a feature
+	Optional Criticality = "optional"
+)
+
+// latencyWindowSize is how many recent calls the latency stats cover
+const latencyWindowSize = 256
+
+// Dependency describes one downstream system. Components register theirs and
+// report calls and checks on it.
+type Dependency struct {
+	Name        string
+	Type        string
+	Endpoint    string
+	Criticality Criticality
+	// Breaker returns the state of the dependency's circuit breaker, if it has one
+	Breaker func() string
+	// Breakers lists the dependency's breakers when it has several, e.g. one
+	// for reads and one for writes
+	Breakers func() []BreakerStatus
+	// Endpoints lists the instances of a client-side load-balanced dependency
+	Endpoints func() []EndpointStatus
+
+	mu        sync.Mutex
+	lastCheck *CheckResult
+	latencies [latencyWindowSize]time.Duration
+	next      int
+	calls     int64
+	failures  int64
+}
+
+// CheckResult is the outcome of the most recent health check
+type CheckResult struct {
+	At    time.Time `json:"at"`
+	OK    bool      `json:"ok"`
+	Error string    `json:"error,omitempty"`
+}
+
+// EndpointStatus is one instance of a load-balanced dependency. EjectedUntil
+// is set while the instance is out of rotation as an outlier.
+type EndpointStatus struct {
+	URL          string     `json:"url"`
+	Breaker      string     `json:"breaker"`
+	BreakerState string     `json:"breaker_state"`
+	EjectedUntil *time.Time `json:"ejected_until,omitempty"`
+}
+
+// BreakerStatus is one of several breakers guarding a dependency
+type BreakerStatus struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+// LatencyStats summarize recent calls, in milliseconds
+type LatencyStats struct {
+	Samples int     `json:"samples"`
+	AvgMs   float64 `json:"avg_ms"`
+	P50Ms   float64 `json:"p50_ms"`
+	P95Ms   float64 `json:"p95_ms"`
+	P99Ms   float64 `json:"p99_ms"`
+	MaxMs   float64 `json:"max_ms"`
+}
+
+// Status is the serializable view of a dependency
+type Status struct {
+	Name         string           `json:"name"`
+	Type         string           `json:"type"`
+	Endpoint     string           `json:"endpoint"`
+	Criticality  Criticality      `json:"criticality"`
+	BreakerState string           `json:"breaker_state,omitempty"`
+	Breakers     []BreakerStatus  `json:"breakers,omitempty"`
+	Endpoints    []EndpointStatus `json:"endpoints,omitempty"`
+	LastCheck    *CheckResult     `json:"last_check,omitempty"`
+	Calls        int64            `json:"calls"`
+	Failures     int64            `json:"failures"`
+	Latency      LatencyStats     `json:"latency"`
+}
+
+// ObserveCall records the latency of a call that reached the dependency
+func (d *Dependency) ObserveCall(duration time.Duration, failed bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.latencies[d.next%latencyWindowSize] = duration
+	d.next++
+	d.calls++
+	if failed {
+		d.failures++
+	}
+}
+
+// RecordCheck records the outcome of a health check
+func (d *Dependency) RecordCheck(err error) {
+	result := &CheckResult{At: time.Now(), OK: err == nil}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lastCheck = result
+}
+
+// Status returns a snapshot of the dependency
+func (d *Dependency) Status() Status {
+	status := Status{
+		Name:        d.Name,
+		Type:        d.Type,
+		Endpoint:    d.Endpoint,
+		Criticality: d.Criticality,
+	}
+	if d.Breaker != nil {
+		status.BreakerState = d.Breaker()
+	}
+	if d.Breakers != nil {
+		status.Breakers = d.Breakers()
+	}
+	if d.Endpoints != nil {
+		status.Endpoints = d.Endpoints()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	status.LastCheck = d.lastCheck
+	status.Calls = d.calls
+	status.Failures = d.failures
+	status.Latency = latencyStats(d.latencies[:min(d.next, latencyWindowSize)])
+	return status
+}
+
+func latencyStats(window []time.Duration) LatencyStats {
+	if len(window) == 0 {
+		return LatencyStats{}
+	}
+
+	sorted := append([]time.Duration(nil), window...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	percentile := func(p float64) float64 {
+		return millis(sorted[int(p*float64(len(sorted)-1))])
+	}
+
+	return LatencyStats{
+		Samples: len(sorted),
+		AvgMs:   millis(total / time.Duration(len(sorted))),
+		P50Ms:   percentile(0.50),
+		P95Ms:   percentile(0.95),
+		P99Ms:   percentile(0.99),
+		MaxMs:   millis(sorted[len(sorted)-1]),
+	}
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,18 @@
+package dependency
+
+import "github.com/demo/resilient-app/internal/metrics"
+
+var breakerRejectedTotal = metrics.NewCounterVec(
+	metrics.Opts{
+		Name: "circuit_breaker_rejected_total",
+		Help: "Total number of calls a circuit breaker turned away without making them, while open or with its half-open trials in flight",
+	},
+	[]string{"breaker"},
+)
+
+// BreakerRejected counts a call the named breaker turned away. Together with
+// the transitions the health checker follows, it shows what an open breaker
+// cost while it was open.
+func BreakerRejected(breaker string) {
+	breakerRejectedTotal.WithLabelValues(breaker).Inc()
+}
@@ -0,0 +1,61 @@
+package dependency
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Registry holds the dependencies of the app by name, and the breakers
+// guarding them and the app; see breakers.go
+type Registry struct {
+	mu           sync.RWMutex
+	dependencies map[string]*Dependency
+
+	breakerSources []func() []Breaker
+	breakerSince   map[string]time.Time
+	created        time.Time
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		dependencies: make(map[string]*Dependency),
+		breakerSince: make(map[string]time.Time),
+		created:      time.Now(),
+	}
+}
+
+// Default is the registry components register their dependencies with
+var Default = NewRegistry()
+
+// Register adds a dependency and returns it for reporting calls and checks.
+// It panics on a duplicate name, which is a wiring mistake.
+func (r *Registry) Register(d *Dependency) *Dependency {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.dependencies[d.Name]; exists {
+		panic(fmt.Sprintf("dependency: %q registered twice", d.Name))
+	}
+	r.dependencies[d.Name] = d
+	return d
+}
+
+// Statuses returns a snapshot of every dependency sorted by name
+func (r *Registry) Statuses() []Status {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	statuses := make([]Status, 0, len(r.dependencies))
+	for _, d := range r.dependencies {
+		statuses = append(statuses, d.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// Register adds a dependency to the Default registry
+func Register(d *Dependency) *Dependency {
+	return Default.Register(d)
+}
@@ -0,0 +1,72 @@
+// Package disconnect tells work canceled because its client went away apart
+// from work canceled for other reasons, such as a timeout or shutdown, and
+// counts it. The request context is canceled with ErrClientGone as its cause;
+// database queries and downstream calls made with it stop at once, and pgx asks
+// Postgres to cancel the running statement, so nothing keeps working for a
+// client that is no longer there.
+package disconnect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/demo/resilient-app/internal/metrics"
+)
+
+// Kinds of abandoned work
+const (
+	KindRequest    = "request"
+	KindDatabase   = "database"
+	KindDownstream = "downstream"
+)
+
+// ErrClientGone is the cause of a context canceled because the client
+// disconnected. It wraps context.Canceled.
+var ErrClientGone = fmt.Errorf("client disconnected: %w", context.Canceled)
+
+var abandonedTotal = metrics.NewCounterVec(
+	metrics.Opts{
+		Name: "client_abandoned_work_total",
+		Help: "Total number of requests, database queries and downstream calls canceled because the client disconnected",
+	},
+	[]string{"kind", "operation"},
+)
+
+// Context returns a context canceled with ErrClientGone when parent, the
+// request context net/http cancels on disconnect, is done. stop releases it
+// once the request has been served.
+func Context(parent context.Context) (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancelCause(context.WithoutCancel(parent))
+	stopWatching := context.AfterFunc(parent, func() { cancel(ErrClientGone) })
+	return ctx, func() {
+		stopWatching()
+		cancel(context.Canceled)
+	}
+}
+
+// Abandoned reports whether ctx was canceled because the client disconnected
+func Abandoned(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrClientGone)
+}
+
+// Canceled returns the reason ctx was canceled in place of err, the error the
+// canceled work ended with, and counts the work when its client disconnected.
+// It returns err unchanged while ctx is live or past its deadline, since a
+// timeout is the dependency's failure rather than the caller's choice.
+func Canceled(ctx context.Context, kind, operation string, err error) error {
+	if err == nil || !errors.Is(ctx.Err(), context.Canceled) {
+		return err
+	}
+	if Abandoned(ctx) {
+		abandonedTotal.WithLabelValues(kind, operation).Inc()
+	}
+	return fmt.Errorf("%w (%v)", context.Cause(ctx), err)
+}
+
+// Record counts an abandoned request
+func Record(ctx context.Context, operation string) {
+	if Abandoned(ctx) {
+		abandonedTotal.WithLabelValues(KindRequest, operation).Inc()
+	}
+}
@@ -0,0 +1,218 @@
+// Package dump writes heap, goroutine and mutex profiles to a directory on
+// SIGUSR2 or on request, so a stuck pod can be diagnosed from the files it
+// left before Kubernetes recycles it
+package dump
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/demo/resilient-app/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// Triggers of a dump
+const (
+	TriggerSignal = "signal"
+	TriggerAdmin  = "admin"
+)
+
+// timeFormat starts every file of a dump, so a dump's files sort together
+// and dumps sort by age
+const timeFormat = "20060102T150405.000Z"
+
+// profiles are written in this order; the goroutine profile is the full text
+// stacks (debug=2), which say where every goroutine is stuck and for how long
+var profiles = []struct {
+	name  string
+	file  string
+	debug int
+}{
+	{"goroutine", "goroutine.txt", 2},
+	{"heap", "heap.pprof", 0},
+	{"mutex", "mutex.pprof", 0},
+}
+
+var dumpsTotal = metrics.NewCounterVec(
+	metrics.Opts{
+		Name: "diagnostic_dumps_total",
+		Help: "Total number of profile dumps by trigger (signal or admin) and result (success or error)",
+	},
+	[]string{"trigger", "result"},
+)
+
+// Dump is one set of profile files
+type Dump struct {
+	Time    time.Time `json:"time"`
+	Trigger string    `json:"trigger,omitempty"`
+	Files   []string  `json:"files"`
+}
+
+// Dumper writes dumps to a directory and keeps the latest few
+type Dumper struct {
+	logger *zap.Logger
+	dir    string
+	keep   int
+
+	// mu serializes dumps, so two triggers can't interleave their files
+	mu sync.Mutex
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// New writes dumps to dir, keeping the latest keep of them. mutexFraction
+// samples one in that many mutex contention events for the mutex profile; 0
+// leaves mutex profiling off, and the mutex profile empty.
+func New(logger *zap.Logger, dir string, keep, mutexFraction int) *Dumper {
+	runtime.SetMutexProfileFraction(mutexFraction)
+	return &Dumper{
+		logger: logger,
+		dir:    dir,
+		keep:   keep,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Start dumps on every SIGUSR2 until Stop
+func (d *Dumper) Start() {
+	usr2 := make(chan os.Signal, 1)
+	signal.Notify(usr2, syscall.SIGUSR2)
+
+	go func() {
+		defer close(d.done)
+		defer signal.Stop(usr2)
+		for {
+			select {
+			case <-d.stop:
+				return
+			case <-usr2:
+				d.Dump(TriggerSignal)
+			}
+		}
+	}()
+}
+
+func (d *Dumper) Stop(ctx context.Context) error {
+	d.once.Do(func() { close(d.stop) })
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Dump writes every profile, then removes the dumps beyond the latest keep
+func (d *Dumper) Dump(trigger string) (Dump, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	dump, err := d.write(time.Now().UTC(), trigger)
+	if err != nil {
+		dumpsTotal.WithLabelValues(trigger, "error").Inc()
+		d.logger.Error("Profile dump failed", zap.String("trigger", trigger), zap.Error(err))
+		return dump, err
+	}
+	dumpsTotal.WithLabelValues(trigger, "success").Inc()
+	d.logger.Warn("Profiles dumped", zap.String("trigger", trigger), zap.Strings("files", dump.Files))
+
+	if err := d.prune(); err != nil {
+		d.logger.Warn("Failed to remove old profile dumps", zap.Error(err))
+	}
+	return dump, nil
+}
+
+func (d *Dumper) write(now time.Time, trigger string) (Dump, error) {
+	if err := os.MkdirAll(d.dir, 0o750); err != nil {
+		return Dump{}, err
+	}
+	// Heap profiles show the state as of the last GC
+	runtime.GC()
+
+	dump := Dump{Time: now, Trigger: trigger}
+	prefix := now.Format(timeFormat)
+	for _, p := range profiles {
+		path := filepath.Join(d.dir, prefix+"-"+p.file)
+		if err := writeProfile(path, p.name, p.debug); err != nil {
+			return dump, fmt.Errorf("writing %s profile: %w", p.name, err)
+		}
+		dump.Files = append(dump.Files, path)
+	}
+	return dump, nil
+}
+
+func writeProfile(path, name string, debug int) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o640)
+	if err != nil {
+		return err
+	}
+	err = pprof.Lookup(name).WriteTo(f, debug)
+	return errors.Join(err, f.Close())
+}
+
+// List returns the dumps in the directory, newest first
+func (d *Dumper) List() ([]Dump, error) {
+	entries, err := os.ReadDir(d.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Dump{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	byPrefix := make(map[string]*Dump)
+	var dumps []*Dump
+	for _, entry := range entries {
+		prefix, _, ok := strings.Cut(entry.Name(), "-")
+		if !ok {
+			continue
+		}
+		taken, err := time.Parse(timeFormat, prefix)
+		if err != nil {
+			continue
+		}
+		dump, ok := byPrefix[prefix]
+		if !ok {
+			dump = &Dump{Time: taken}
+			byPrefix[prefix] = dump
+			dumps = append(dumps, dump)
+		}
+		dump.Files = append(dump.Files, filepath.Join(d.dir, entry.Name()))
+	}
+	sort.Slice(dumps, func(i, j int) bool { return dumps[i].Time.After(dumps[j].Time) })
+
+	list := make([]Dump, len(dumps))
+	for i, dump := range dumps {
+		list[i] = *dump
+	}
+	return list, nil
+}
+
+// prune removes the files of every dump but the latest keep
+func (d *Dumper) prune() error {
+	dumps, err := d.List()
+	if err != nil || len(dumps) <= d.keep {
+		return err
+	}
+	var errs []error
+	for _, dump := range dumps[d.keep:] {
+		for _, file := range dump.Files {
+			errs = append(errs, os.Remove(file))
+		}
+	}
+	return errors.Join(errs...)
+}
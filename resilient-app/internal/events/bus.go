@@ -0,0 +1,113 @@
+package events
+
+import (
+	"sync"
+
+	"github.com/demo/resilient-app/internal/metrics"
+)
+
+const defaultSubscriberBuffer = 64
+
+var (
+	eventsPublishedTotal = metrics.NewCounterVec(
+		metrics.Opts{
+			Name: "events_published_total",
+			Help: "Total number of internal component events published",
+		},
+		[]string{"event"},
+	)
+
+	eventsDroppedTotal = metrics.NewCounterVec(
+		metrics.Opts{
+			Name: "events_dropped_total",
+			Help: "Total number of events dropped because a subscriber was too slow",
+		},
+		[]string{"event"},
+	)
+)
+
+// Bus is an in-process pub/sub for component signals. Publish never blocks:
+// publishers include the circuit breaker callback, which runs under the
+// breaker's lock, so a slow subscriber loses events instead of stalling it.
+type Bus struct {
+	mu     sync.RWMutex
+	nextID int
+	subs   map[int]*Subscription
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: make(map[int]*Subscription)}
+}
+
+// Default is the process-wide bus components publish to
+var Default = NewBus()
+
+// Publish delivers e to every subscriber interested in it
+func Publish(e Event) {
+	Default.Publish(e)
+}
+
+// Subscription receives events on C until it is closed
+type Subscription struct {
+	C <-chan Event
+
+	bus   *Bus
+	id    int
+	ch    chan Event
+	names map[string]bool
+	once  sync.Once
+}
+
+func (b *Bus) Publish(e Event) {
+	eventsPublishedTotal.WithLabelValues(e.Name()).Inc()
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, sub := range b.subs {
+		if len(sub.names) > 0 && !sub.names[e.Name()] {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			eventsDroppedTotal.WithLabelValues(e.Name()).Inc()
+		}
+	}
+}
+
+// Subscribe to the named event types, or to everything when none are given
+func (b *Bus) Subscribe(names ...string) *Subscription {
+	ch := make(chan Event, defaultSubscriberBuffer)
+	sub := &Subscription{C: ch, bus: b, ch: ch, names: make(map[string]bool)}
+	for _, name := range names {
+		sub.names[name] = true
+	}
+
+	b.mu.Lock()
+	b.nextID++
+	sub.id = b.nextID
+	b.subs[sub.id] = sub
+	b.mu.Unlock()
+
+	return sub
+}
+
+// Close unsubscribes and closes C
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subs, s.id)
+		s.bus.mu.Unlock()
+		close(s.ch)
+	})
+}
+
+// Handle runs fn for every event until the subscription is closed
+func (s *Subscription) Handle(fn func(Event)) {
+	go func() {
+		for e := range s.C {
+			fn(e)
+		}
+	}()
+}
@@ -0,0 +1,56 @@
+package events
+
+import "time"
+
+// Event is a typed signal published by a component. Name identifies the event
+// type to subscribers and in serialized streams.
+type Event interface {
+	Name() string
+}
+
+// BreakerStateChanged is published on every circuit breaker transition
+type BreakerStateChanged struct {
+	Breaker string    `json:"breaker"`
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	At      time.Time `json:"at"`
+}
+
+func (BreakerStateChanged) Name() string { return "breaker_state_changed" }
+
+// HealthChanged is published when the overall health status changes
+type HealthChanged struct {
+	From string    `json:"from"`
+	To   string    `json:"to"`
+	At   time.Time `json:"at"`
+}
+
+func (HealthChanged) Name() string { return "health_changed" }
+
+// ShutdownStarted is published once graceful shutdown begins. DrainDeadline is
+// when in-flight requests get force-closed; it is zero without a deadline.
+type ShutdownStarted struct {
+	At            time.Time `json:"at"`
+	DrainDeadline time.Time `json:"drain_deadline,omitempty"`
+}
+
+func (ShutdownStarted) Name() string { return "shutdown_started" }
+
+// FlagChanged is published when a feature flag is switched at runtime
+type FlagChanged struct {
+	Flag    string    `json:"flag"`
+	Enabled bool      `json:"enabled"`
+	At      time.Time `json:"at"`
+}
+
+func (FlagChanged) Name() string { return "flag_changed" }
+
+// ConfigReloaded is published when a reloaded configuration was applied.
+// Changed lists the keys whose values differ from the previous load.
+type ConfigReloaded struct {
+	Trigger string    `json:"trigger"`
+	Changed []string  `json:"changed"`
+	At      time.Time `json:"at"`
+}
+
+func (ConfigReloaded) Name() string { return "config_reloaded" }
@@ -0,0 +1,160 @@
+// Package fakedep is a small HTTP service with controllable latency and error
+// behavior. Demo clusters run it from the same image as a flaky downstream.
+package fakedep
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Behavior controls how the service answers requests
+type Behavior struct {
+	LatencyMs   int     `json:"latency_ms"`
+	JitterMs    int     `json:"jitter_ms"`
+	ErrorRate   float64 `json:"error_rate"`
+	ErrorStatus int     `json:"error_status"`
+	// MaxAgeS makes successful responses cacheable for this many seconds
+	MaxAgeS int `json:"max_age_s"`
+}
+
+func (b Behavior) validate() error {
+	if b.LatencyMs < 0 || b.JitterMs < 0 || b.MaxAgeS < 0 {
+		return errors.New("latency_ms, jitter_ms and max_age_s must not be negative")
+	}
+	if b.ErrorRate < 0 || b.ErrorRate > 1 {
+		return errors.New("error_rate must be between 0 and 1")
+	}
+	if b.ErrorStatus < 400 || b.ErrorStatus > 599 {
+		return errors.New("error_status must be a 4xx or 5xx status")
+	}
+	return nil
+}
+
+// delay picks the latency of one response
+func (b Behavior) delay() time.Duration {
+	delay := time.Duration(b.LatencyMs) * time.Millisecond
+	if b.JitterMs > 0 {
+		delay += time.Duration(rand.Intn(b.JitterMs+1)) * time.Millisecond
+	}
+	return delay
+}
+
+// Server answers every path except /control and /health according to the
+// current behavior, which GET and PUT /control read and change at runtime.
+// Responses carry a weak ETag of the behavior version, so conditional
+// requests get a 304 until the behavior changes.
+type Server struct {
+	logger *zap.Logger
+
+	mu       sync.RWMutex
+	behavior Behavior
+	version  int
+}
+
+func NewServer(logger *zap.Logger, behavior Behavior) (*Server, error) {
+	if err := behavior.validate(); err != nil {
+		return nil, err
+	}
+	return &Server{logger: logger, behavior: behavior}, nil
+}
+
+func (s *Server) Behavior() Behavior {
+	behavior, _ := s.current()
+	return behavior
+}
+
+func (s *Server) current() (Behavior, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.behavior, s.version
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/health":
+		writeJSON(w, http.StatusOK, map[string]string{"status": "healthy"})
+	case "/control":
+		s.control(w, r)
+	default:
+		s.serve(w, r)
+	}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	behavior, version := s.current()
+
+	timer := time.NewTimer(behavior.delay())
+	defer timer.Stop()
+	select {
+	case <-r.Context().Done():
+		return
+	case <-timer.C:
+	}
+
+	if rand.Float64() < behavior.ErrorRate {
+		writeJSON(w, behavior.ErrorStatus, map[string]string{
+			"error": http.StatusText(behavior.ErrorStatus),
+			"code":  "injected_failure",
+		})
+		return
+	}
+
+	etag := fmt.Sprintf(`W/"v%d"`, version)
+	w.Header().Set("ETag", etag)
+	if behavior.MaxAgeS > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", behavior.MaxAgeS))
+	}
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"service":   "fake-dependency",
+		"path":      r.URL.Path,
+		"version":   version,
+		"served_at": time.Now(),
+	})
+}
+
+// control reports the behavior on GET and replaces the fields given on PUT
+func (s *Server) control(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.Behavior())
+	case http.MethodPut:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		behavior := s.behavior
+		if err := json.NewDecoder(r.Body).Decode(&behavior); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+			return
+		}
+		if err := behavior.validate(); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		s.behavior = behavior
+		s.version++
+		s.logger.Info("Behavior changed", zap.Any("behavior", behavior))
+		writeJSON(w, http.StatusOK, behavior)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/demo/resilient-app/internal/backup"
+	"github.com/demo/resilient-app/internal/config"
+	"github.com/demo/resilient-app/internal/ctxkeys"
+	"github.com/demo/resilient-app/internal/database"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+const (
+	adminAuthNone = "none"
+
+	adminOperationTimeout = 10 * time.Minute
+	progressLogEvery      = 1000
+	maxTrackedOperations  = 50
+)
+
+// Claims of admin requests, for handlers and plugins that audit them
+var (
+	tokenAdmin     = ctxkeys.ClaimSet{Subject: "admin-token", Scopes: []string{"admin", config.DefaultRedactScope}}
+	anonymousAdmin = ctxkeys.ClaimSet{Subject: "anonymous", Scopes: []string{"admin", config.DefaultRedactScope}}
+)
+
+// AdminAuthMiddleware protects admin endpoints with the ADMIN_TOKEN bearer
+// token and records the caller's claims in the context. Without a configured
+// token the admin API is disabled entirely, unless ADMIN_AUTH=none turns
+// authentication off.
+func (h *Handler) AdminAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Relaxed auth for local development (the dev profile sets ADMIN_AUTH=none)
+		if h.adminAuth == adminAuthNone {
+			next.ServeHTTP(w, r.WithContext(ctxkeys.Claims.With(r.Context(), anonymousAdmin)))
+			return
+		}
+
+		if h.adminToken == "" {
+			h.writeErrorResponse(w, r, http.StatusForbidden, "admin_disabled",
+				"Admin API is disabled; set ADMIN_TOKEN to enable it", nil)
+			return
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.adminToken)) != 1 {
+			h.writeErrorResponse(w, r, http.StatusUnauthorized, "unauthorized",
+				"Valid admin token required", nil)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctxkeys.Claims.With(r.Context(), tokenAdmin)))
+	})
+}
+
+// Operation tracks the progress of a long-running admin operation
+type Operation struct {
+	ID         string     `json:"id"`
+	Kind       string     `json:"kind"`
+	Status     string     `json:"status"`
+	Rows       int        `json:"rows"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// operationTracker keeps the most recent admin operations in memory so their
+// progress can be polled while they run
+type operationTracker struct {
+	mu     sync.RWMutex
+	nextID int
+	ops    map[string]*Operation
+}
+
+func newOperationTracker() *operationTracker {
+	return &operationTracker{ops: make(map[string]*Operation)}
+}
+
+func (t *operationTracker) start(kind string) *Operation {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.ops) >= maxTrackedOperations {
+		t.evictOldest()
+	}
+
+	t.nextID++
+	op := &Operation{
+		ID:        fmt.Sprintf("%s-%d", kind, t.nextID),
+		Kind:      kind,
+		Status:    "running",
+		StartedAt: time.Now(),
+	}
+	t.ops[op.ID] = op
+	return op
+}
+
+func (t *operationTracker) progress(op *Operation, rows int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	op.Rows = rows
+}
+
+func (t *operationTracker) finish(op *Operation, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	op.FinishedAt = &now
+	op.Status = "completed"
+	if err != nil {
+		op.Status = "failed"
+		op.Error = err.Error()
+	}
+}
+
+func (t *operationTracker) list() []Operation {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	ops := make([]Operation, 0, len(t.ops))
+	for _, op := range t.ops {
+		ops = append(ops, *op)
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i].StartedAt.After(ops[j].StartedAt) })
+	return ops
+}
+
+func (t *operationTracker) get(id string) (Operation, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	op, ok := t.ops[id]
+	if !ok {
+		return Operation{}, false
+	}
+	return *op, true
+}
+
+func (t *operationTracker) evictOldest() {
+	var oldest *Operation
+	for _, op := range t.ops {
+		if op.FinishedAt != nil && (oldest == nil || op.StartedAt.Before(oldest.StartedAt)) {
+			oldest = op
+		}
+	}
+	if oldest != nil {
+		delete(t.ops, oldest.ID)
+	}
+}
+
+func (h *Handler) trackProgress(logger *zap.Logger, op *Operation) backup.Progress {
+	return func(rows int) {
+		h.operations.progress(op, rows)
+		if rows%progressLogEvery == 0 {
+			logger.Info("Admin operation progress",
+				zap.String("operation", op.ID),
+				zap.Int("rows", rows),
+			)
+		}
+	}
+}
+
+// List recent admin operations and their progress
+func (h *Handler) GetOperations(w http.ResponseWriter, r *http.Request) {
+	h.writeJSONResponse(w, r, http.StatusOK, h.operations.list())
+}
+
+// Get one admin operation; operations are tracked by the pod that runs them
+func (h *Handler) GetOperation(w http.ResponseWriter, r *http.Request) {
+	op, ok := h.operations.get(mux.Vars(r)["id"])
+	if !ok {
+		h.writeErrorResponse(w, r, http.StatusNotFound, "operation_not_found",
+			"Operation not found on this pod", nil)
+		return
+	}
+	h.writeJSONResponse(w, r, http.StatusOK, op)
+}
+
+// Stream the full dataset as checksummed NDJSON
+func (h *Handler) ExportData(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), adminOperationTimeout)
+	defer cancel()
+
+	op := h.operations.start("export")
+	h.log(r).Info("Starting data export", zap.String("operation", op.ID))
+
+	// Exports can run far longer than the server write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "resilient-app-"+time.Now().UTC().Format("20060102-150405")+".ndjson"))
+	w.Header().Set("X-Operation-ID", op.ID)
+
+	err := backup.Export(ctx, h.db, w, h.trackProgress(h.log(r), op))
+	h.operations.finish(op, err)
+	if err != nil {
+		// The body is already streaming; the missing footer tells the client
+		// (and any later import) that the export is incomplete
+		h.log(r).Error("Data export failed", zap.String("operation", op.ID), zap.Error(err))
+		return
+	}
+
+	h.log(r).Info("Data export completed", zap.String("operation", op.ID), zap.Int("rows", op.Rows))
+}
+
+// Restore an export; ?conflict=skip|overwrite|fail decides how existing rows are treated
+func (h *Handler) ImportData(w http.ResponseWriter, r *http.Request) {
+	policy := database.ConflictPolicy(r.URL.Query().Get("conflict"))
+	if policy == "" {
+		policy = database.ConflictSkip
+	}
+	if !policy.Valid() {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, "invalid_conflict_policy",
+			"Conflict policy must be one of skip, overwrite, fail", nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), adminOperationTimeout)
+	defer cancel()
+
+	http.NewResponseController(w).SetReadDeadline(time.Time{})
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	op := h.operations.start("import")
+	h.log(r).Info("Starting data import",
+		zap.String("operation", op.ID),
+		zap.String("conflict_policy", string(policy)))
+
+	result, err := backup.Import(ctx, h.db, r.Body, policy, h.trackProgress(h.log(r), op))
+	h.operations.finish(op, err)
+	w.Header().Set("X-Operation-ID", op.ID)
+
+	switch {
+	case errors.Is(err, backup.ErrMalformed), errors.Is(err, backup.ErrChecksumMismatch):
+		h.writeErrorResponse(w, r, http.StatusBadRequest, "invalid_backup",
+			"Backup is corrupt or incomplete; nothing was imported", err)
+	case errors.Is(err, database.ErrConflict):
+		h.writeErrorResponse(w, r, http.StatusConflict, "import_conflict",
+			"Backup conflicts with existing data; nothing was imported", err)
+	case err != nil:
+		h.log(r).Error("Data import failed", zap.String("operation", op.ID), zap.Error(err))
+		h.writeErrorResponse(w, r, http.StatusServiceUnavailable, "import_failed",
+			"Import failed; nothing was imported", err)
+	default:
+		h.log(r).Info("Data import completed", zap.String("operation", op.ID), zap.Int("rows", op.Rows))
+		h.writeJSONResponse(w, r, http.StatusOK, result)
+	}
+}
+
+// Bulk-load a CSV file into ?table=users|orders through the COPY protocol.
+// The first line names the columns. The load runs in one transaction, so a
+// bad row rolls back everything; only one bulk load runs at a time.
+func (h *Handler) ImportCSV(w http.ResponseWriter, r *http.Request) {
+	table := r.URL.Query().Get("table")
+	if table == "" {
+		table = "users"
+	}
+
+	if !h.background.bulk.CompareAndSwap(false, true) {
+		h.writeBulkInProgress(w, r)
+		return
+	}
+	defer h.background.bulk.Store(false)
+
+	ctx, cancel := context.WithTimeout(r.Context(), adminOperationTimeout)
+	defer cancel()
+
+	http.NewResponseController(w).SetReadDeadline(time.Time{})
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	op := h.operations.start("import-csv")
+	h.log(r).Info("Starting CSV import", zap.String("operation", op.ID), zap.String("table", table))
+
+	result, err := backup.ImportCSV(ctx, h.db, r.Body, table, h.trackProgress(h.log(r), op))
+	h.operations.finish(op, err)
+	w.Header().Set("X-Operation-ID", op.ID)
+
+	switch {
+	case errors.Is(err, backup.ErrMalformedCSV), errors.Is(err, database.ErrInvalidData):
+		h.writeErrorResponse(w, r, http.StatusBadRequest, "invalid_csv",
+			"CSV is malformed or holds invalid values; nothing was imported", err)
+	case errors.Is(err, database.ErrConflict), errors.Is(err, database.ErrInvalidReference):
+		h.writeErrorResponse(w, r, http.StatusConflict, "import_conflict",
+			"CSV conflicts with existing data; nothing was imported", err)
+	case err != nil:
+		h.log(r).Error("CSV import failed", zap.String("operation", op.ID), zap.Error(err))
+		h.writeErrorResponse(w, r, http.StatusServiceUnavailable, "import_failed",
+			"Import failed; nothing was imported", err)
+	default:
+		h.log(r).Info("CSV import completed", zap.String("operation", op.ID), zap.Int("rows", result.Rows))
+		h.writeJSONResponse(w, r, http.StatusOK, result)
+	}
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/demo/resilient-app/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// Results of checking a request's affinity cookie
+const (
+	// affinityNew is a request without a cookie
+	affinityNew = "new"
+	// affinityInvalid is a cookie that is malformed, expired or signed with
+	// another key
+	affinityInvalid = "invalid"
+	// affinitySticky is a cookie issued by this pod
+	affinitySticky = "sticky"
+	// affinityMoved is a valid cookie issued by another pod, so the client's
+	// previous pod is gone or the load balancer isn't sticky
+	affinityMoved = "moved"
+)
+
+var affinityRequestsTotal = metrics.NewCounterVec(
+	metrics.Opts{
+		Name: "affinity_requests_total",
+		Help: "Total number of API requests by how their affinity cookie matched the serving pod",
+	},
+	[]string{"result"},
+)
+
+// affinity signs and verifies the cookies naming the pod that served a client
+type affinity struct {
+	pod string
+	key []byte
+}
+
+func (h *Handler) newAffinity() *affinity {
+	pod, err := os.Hostname()
+	if err != nil {
+		pod = "unknown"
+	}
+	a := &affinity{pod: pod, key: []byte(h.startup.Affinity.Secret)}
+	if len(a.key) == 0 {
+		a.key = make([]byte, 32)
+		rand.Read(a.key)
+		if h.startup.FeatureEnabled("session_affinity") {
+			h.logger.Warn("AFFINITY_COOKIE_SECRET is not set, pods will not verify each other's affinity cookies")
+		}
+	}
+	return a
+}
+
+// AffinityCookie is a verified affinity cookie
+type AffinityCookie struct {
+	Pod      string    `json:"pod"`
+	IssuedAt time.Time `json:"issued_at"`
+}
+
+// issue returns the value of a cookie naming this pod: the pod, the issue
+// time in Unix seconds and their signature, dot-separated
+func (a *affinity) issue(now time.Time) string {
+	payload := a.pod + "." + strconv.FormatInt(now.Unix(), 10)
+	return payload + "." + a.sign(payload)
+}
+
+// verify parses value and checks its signature and age
+func (a *affinity) verify(value string, maxAge time.Duration, now time.Time) (AffinityCookie, bool) {
+	i := strings.LastIndexByte(value, '.')
+	if i < 0 {
+		return AffinityCookie{}, false
+	}
+	payload, signature := value[:i], value[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(a.sign(payload))) {
+		return AffinityCookie{}, false
+	}
+
+	// Pod names may contain dots, the issue time never does
+	j := strings.LastIndexByte(payload, '.')
+	if j < 0 {
+		return AffinityCookie{}, false
+	}
+	issued, err := strconv.ParseInt(payload[j+1:], 10, 64)
+	if err != nil {
+		return AffinityCookie{}, false
+	}
+	cookie := AffinityCookie{Pod: payload[:j], IssuedAt: time.Unix(issued, 0).UTC()}
+	if now.Sub(cookie.IssuedAt) > maxAge {
+		return AffinityCookie{}, false
+	}
+	return cookie, true
+}
+
+func (a *affinity) sign(payload string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// checkAffinity classifies the request's affinity cookie
+func (h *Handler) checkAffinity(r *http.Request, now time.Time) (AffinityCookie, string) {
+	settings := h.startup.Affinity
+	c, err := r.Cookie(settings.CookieName)
+	if err != nil {
+		return AffinityCookie{}, affinityNew
+	}
+	cookie, ok := h.affinity.verify(c.Value, settings.MaxAge, now)
+	switch {
+	case !ok:
+		return AffinityCookie{}, affinityInvalid
+	case cookie.Pod == h.affinity.pod:
+		return cookie, affinitySticky
+	default:
+		return cookie, affinityMoved
+	}
+}
+
+// Middleware that issues a signed cookie naming the serving pod when the
+// session_affinity feature is enabled. A request whose cookie names another
+// pod was moved: with a sticky load balancer that only happens when its pod
+// terminated, without one it happens on most requests. The cookie is reissued
+// for this pod whenever the request wasn't sticky.
+func (h *Handler) AffinityMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.cfg().FeatureEnabled("session_affinity") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		now := time.Now()
+		cookie, result := h.checkAffinity(r, now)
+		affinityRequestsTotal.WithLabelValues(result).Inc()
+		if result == affinityMoved {
+			h.log(r).Debug("Request moved from another pod", zap.String("from_pod", cookie.Pod))
+		}
+		if result != affinitySticky {
+			settings := h.startup.Affinity
+			http.SetCookie(w, &http.Cookie{
+				Name:     settings.CookieName,
+				Value:    h.affinity.issue(now),
+				Path:     "/",
+				MaxAge:   int(settings.MaxAge.Seconds()),
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AffinityResponse reports how the request's affinity cookie matched the pod
+// that served it
+type AffinityResponse struct {
+	ServedBy string `json:"served_by"`
+	Result   string `json:"result"`
+	Sticky   bool   `json:"sticky"`
+	// Cookie is the verified cookie the request carried, if any
+	Cookie *AffinityCookie `json:"cookie,omitempty"`
+}
+
+// Report which pod served the request and which pod the client's affinity
+// cookie names, for checking stickiness across pod terminations
+func (h *Handler) GetAffinity(w http.ResponseWriter, r *http.Request) {
+	if !h.cfg().FeatureEnabled("session_affinity") {
+		h.writeErrorResponse(w, r, http.StatusNotFound, "affinity_disabled",
+			"Session affinity cookies are disabled", nil)
+		return
+	}
+
+	cookie, result := h.checkAffinity(r, time.Now())
+	response := AffinityResponse{
+		ServedBy: h.affinity.pod,
+		Result:   result,
+		Sticky:   result == affinitySticky,
+	}
+	if result == affinitySticky || result == affinityMoved {
+		response.Cookie = &cookie
+	}
+	h.writeJSONResponse(w, r, http.StatusOK, response)
+}
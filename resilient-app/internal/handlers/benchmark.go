@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/demo/resilient-app/internal/benchmark"
+	"github.com/demo/resilient-app/internal/database"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultSeedUsers = 100000
+	maxSeedUsers     = 10000000
+	defaultSeedBatch = 10000
+	maxSeedBatch     = 100000
+
+	defaultBenchmarkPageSize = 50
+	maxBenchmarkPageSize     = 1000
+	defaultBenchmarkSamples  = 5
+	maxBenchmarkSamples      = 100
+)
+
+// seedNamePattern is the names seeds can be given; they become part of the
+// seeded users' emails
+var seedNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// backgroundWork runs admin operations that outlive their request, such as
+// seeding, and cancels them on shutdown
+type backgroundWork struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	// bulk is held by a seed or CSV import, so bulk loads never hold more
+	// than one pooled connection at a time
+	bulk atomic.Bool
+
+	mu            sync.Mutex
+	lastBenchmark *benchmark.Report
+}
+
+func newBackgroundWork() *backgroundWork {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &backgroundWork{ctx: ctx, cancel: cancel}
+}
+
+func (b *backgroundWork) run(fn func(ctx context.Context)) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		fn(b.ctx)
+	}()
+}
+
+// stop cancels running operations and waits for them to return
+func (b *backgroundWork) stop(ctx context.Context) error {
+	b.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Seed synthetic users through the COPY protocol, e.g.
+// /admin/seed/users?count=1000000&batch=10000&name=load-test. Seeding runs in
+// the background and responds 202 at once; poll /admin/operations for its
+// progress. A seed is resumed by running it again under its name, which pods
+// do on their own at startup for seeds left unfinished.
+func (h *Handler) SeedUsers(w http.ResponseWriter, r *http.Request) {
+	count, ok := h.queryInt(w, r, "count", defaultSeedUsers, maxSeedUsers)
+	if !ok {
+		return
+	}
+	batch, ok := h.queryInt(w, r, "batch", defaultSeedBatch, maxSeedBatch)
+	if !ok {
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = fmt.Sprintf("seed%d", time.Now().UnixNano())
+	}
+	if !seedNamePattern.MatchString(name) {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, "invalid_parameter",
+			"name must be 1 to 64 letters, digits, '-' or '_'", nil)
+		return
+	}
+
+	if !h.background.bulk.CompareAndSwap(false, true) {
+		h.writeBulkInProgress(w, r)
+		return
+	}
+
+	seed, err := h.db.StartSeed(r.Context(), database.Seed{Name: name, Count: count, BatchSize: batch})
+	if err != nil {
+		h.background.bulk.Store(false)
+		if errors.Is(err, database.ErrConflict) {
+			h.writeErrorResponse(w, r, http.StatusConflict, "seed_conflict", err.Error(), nil)
+			return
+		}
+		h.log(r).Error("Failed to start user seed", zap.String("seed", name), zap.Error(err))
+		h.writeErrorResponse(w, r, http.StatusServiceUnavailable, "database_error",
+			"Unable to start the seed", err)
+		return
+	}
+
+	op := h.operations.start("seed")
+	logger := h.log(r).With(zap.String("operation", op.ID), zap.String("seed", seed.Name))
+	logger.Info("Starting user seed", zap.Int("count", count), zap.Int("batch", batch))
+
+	h.background.run(func(ctx context.Context) {
+		defer h.background.bulk.Store(false)
+		h.seed(ctx, logger, op, *seed)
+	})
+
+	w.Header().Set("X-Operation-ID", op.ID)
+	h.writeJSONResponse(w, r, http.StatusAccepted, op)
+}
+
+// ResumeSeeds resumes, in the background, the seeds left unfinished when the
+// pod running them stopped, once the database is connected. Pods resuming
+// the same seed share its batches.
+func (h *Handler) ResumeSeeds() {
+	h.background.run(func(ctx context.Context) {
+		select {
+		case <-h.db.Connected():
+		case <-ctx.Done():
+			return
+		}
+
+		seeds, err := h.db.PendingSeeds(ctx)
+		if err != nil {
+			h.logger.Warn("Failed to look up unfinished seeds", zap.Error(err))
+			return
+		}
+		for _, seed := range seeds {
+			if !h.background.bulk.CompareAndSwap(false, true) {
+				h.logger.Info("Not resuming seed while another bulk load runs", zap.String("seed", seed.Name))
+				continue
+			}
+			op := h.operations.start("seed")
+			logger := h.logger.With(zap.String("operation", op.ID), zap.String("seed", seed.Name))
+			logger.Info("Resuming user seed", zap.Int("count", seed.Count), zap.Int("batch", seed.BatchSize))
+			h.seed(ctx, logger, op, seed)
+			h.background.bulk.Store(false)
+		}
+	})
+}
+
+func (h *Handler) seed(ctx context.Context, logger *zap.Logger, op *Operation, seed database.Seed) {
+	loaded, err := h.db.SeedUsers(ctx, seed, h.trackProgress(logger, op))
+	h.operations.finish(op, err)
+	if err != nil {
+		logger.Error("User seed failed", zap.Int("rows", loaded), zap.Error(err))
+		return
+	}
+	logger.Info("User seed completed", zap.Int("rows", loaded))
+}
+
+// Benchmark paginated reads of the users table at several depths with
+// LIMIT/OFFSET and keyset pagination, e.g.
+// /admin/benchmark/pagination?page_size=50&samples=5
+func (h *Handler) BenchmarkPagination(w http.ResponseWriter, r *http.Request) {
+	pageSize, ok := h.queryInt(w, r, "page_size", defaultBenchmarkPageSize, maxBenchmarkPageSize)
+	if !ok {
+		return
+	}
+	samples, ok := h.queryInt(w, r, "samples", defaultBenchmarkSamples, maxBenchmarkSamples)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), adminOperationTimeout)
+	defer cancel()
+
+	// Deep offset reads over millions of rows can outlast the write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	op := h.operations.start("benchmark")
+	w.Header().Set("X-Operation-ID", op.ID)
+
+	report, err := benchmark.Pagination(ctx, h.db, benchmark.Options{PageSize: pageSize, Samples: samples})
+	h.operations.finish(op, err)
+	switch {
+	case errors.Is(err, benchmark.ErrNoData):
+		h.writeErrorResponse(w, r, http.StatusConflict, "no_data", err.Error(), nil)
+	case err != nil:
+		h.log(r).Error("Pagination benchmark failed", zap.String("operation", op.ID), zap.Error(err))
+		h.writeErrorResponse(w, r, http.StatusServiceUnavailable, "benchmark_failed",
+			"Pagination benchmark failed", err)
+	default:
+		h.background.mu.Lock()
+		h.background.lastBenchmark = report
+		h.background.mu.Unlock()
+
+		h.log(r).Info("Pagination benchmark completed",
+			zap.String("operation", op.ID),
+			zap.Int("rows", report.Rows),
+			zap.Float64("duration_ms", report.DurationMS))
+		h.writeJSONResponse(w, r, http.StatusOK, report)
+	}
+}
+
+// Get the report of the latest pagination benchmark
+func (h *Handler) GetPaginationBenchmark(w http.ResponseWriter, r *http.Request) {
+	h.background.mu.Lock()
+	report := h.background.lastBenchmark
+	h.background.mu.Unlock()
+
+	if report == nil {
+		h.writeErrorResponse(w, r, http.StatusNotFound, "not_found",
+			"No pagination benchmark has run yet", nil)
+		return
+	}
+	h.writeJSONResponse(w, r, http.StatusOK, report)
+}
+
+func (h *Handler) writeBulkInProgress(w http.ResponseWriter, r *http.Request) {
+	h.writeErrorResponse(w, r, http.StatusConflict, "bulk_operation_in_progress",
+		"Another seed or bulk import is still running; see /admin/operations", nil)
+}
+
+// queryInt reads a positive integer query parameter up to max, writing a 400
+// response when it is invalid
+func (h *Handler) queryInt(w http.ResponseWriter, r *http.Request, name string, defaultValue, max int) (int, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, true
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > max {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, "invalid_parameter",
+			fmt.Sprintf("%s must be an integer between 1 and %d", name, max), nil)
+		return 0, false
+	}
+	return n, true
+}
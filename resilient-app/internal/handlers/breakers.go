@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/sony/gobreaker"
+	"go.uber.org/zap"
+)
+
+// breakerActions are the states POST /admin/circuit-breaker can force
+var breakerActions = map[string]gobreaker.State{
+	"open":      gobreaker.StateOpen,
+	"close":     gobreaker.StateClosed,
+	"half-open": gobreaker.StateHalfOpen,
+}
+
+// BreakerActionRequest is the body of POST /admin/circuit-breaker
+type BreakerActionRequest struct {
+	Action string `json:"action"`
+	// Breaker is "reads", "writes" or "init"; empty applies the action to
+	// reads and writes
+	Breaker string `json:"breaker,omitempty"`
+}
+
+// Get the state of the primary's read and write breakers
+func (h *Handler) GetCircuitBreakers(w http.ResponseWriter, r *http.Request) {
+	h.writeJSONResponse(w, r, http.StatusOK, map[string]interface{}{
+		"circuit_breakers": h.db.Breakers(),
+	})
+}
+
+// Open, close or half-open the database circuit breakers by hand during an
+// incident: open sheds all load from a struggling primary and holds until
+// the next action, close puts a recovered primary back into service at once,
+// and half-open lets trial calls through without waiting for the breaker's
+// timeout
+func (h *Handler) UpdateCircuitBreaker(w http.ResponseWriter, r *http.Request) {
+	var input BreakerActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, "invalid_json",
+			"Invalid JSON in request body", err)
+		return
+	}
+
+	state, ok := breakerActions[input.Action]
+	if !ok {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, "invalid_action",
+			"action must be one of open, close or half-open", nil)
+		return
+	}
+	// The only error is an unknown breaker
+	if err := h.db.ForceBreaker(input.Breaker, state); err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, "invalid_breaker",
+			"breaker must be reads, writes, init or omitted for reads and writes", err)
+		return
+	}
+
+	// Warn, so manual interventions stand out in the logs
+	h.log(r).Warn("Circuit breaker state forced",
+		zap.String("action", input.Action),
+		zap.String("breaker", input.Breaker),
+	)
+	h.writeJSONResponse(w, r, http.StatusOK, map[string]interface{}{
+		"circuit_breakers": h.db.Breakers(),
+	})
+}
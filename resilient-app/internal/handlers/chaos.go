@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"net/http"
+)
+
+// Trip the database circuit breaker with simulated failures to demonstrate
+// graceful degradation without touching Postgres
+func (h *Handler) InjectDatabaseFailure(w http.ResponseWriter, r *http.Request) {
+	h.db.SimulateFailure()
+	h.log(r).Warn("Injected simulated database failures")
+
+	h.writeJSONResponse(w, r, http.StatusOK, map[string]interface{}{
+		"circuit_breaker": h.db.GetState().String(),
+	})
+}
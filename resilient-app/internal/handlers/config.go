@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/demo/resilient-app/internal/config"
+	"github.com/demo/resilient-app/internal/configcheck"
+	"github.com/demo/resilient-app/internal/cputune"
+	"github.com/demo/resilient-app/internal/database"
+	"github.com/demo/resilient-app/internal/logging"
+	"github.com/demo/resilient-app/internal/plugin"
+	"github.com/demo/resilient-app/internal/shutdown"
+	"github.com/demo/resilient-app/internal/workers"
+)
+
+const secretUnset = "<unset>"
+
+// EffectiveConfig is everything a pod is actually running with, as logged at
+// startup and served at /admin/config. Settings that need a restart are
+// reported as the pod started with them, reloadable ones as currently in
+// effect. Secrets are reported only as set or unset.
+type EffectiveConfig struct {
+	Build           BuildInfo          `json:"build"`
+	Server          ServerConfig       `json:"server"`
+	ProfileDefaults []string           `json:"profile_defaults"`
+	Features        []string           `json:"features"`
+	Plugins         []string           `json:"plugins"`
+	Logging         LoggingConfig      `json:"logging"`
+	Database        database.Settings  `json:"database"`
+	Health          HealthConfig       `json:"health"`
+	Resilience      ResilienceConfig   `json:"resilience"`
+	RouteBreaker    RouteBreakerConfig `json:"route_breaker"`
+	Dedup           DedupConfig        `json:"dedup"`
+	Timeouts        TimeoutsConfig     `json:"request_timeouts"`
+	Redaction       map[string]string  `json:"response_redaction"`
+	Downstream      *DownstreamConfig  `json:"downstream,omitempty"`
+	Workers         WorkersConfig      `json:"workers"`
+	Secrets         map[string]string  `json:"secrets"`
+}
+
+type BuildInfo struct {
+	Version      string `json:"version"`
+	GoVersion    string `json:"go_version"`
+	Revision     string `json:"revision,omitempty"`
+	RevisionTime string `json:"revision_time,omitempty"`
+	Modified     bool   `json:"modified,omitempty"`
+}
+
+// VersionInfo is the build and the CPU the runtime was sized to
+type VersionInfo struct {
+	BuildInfo
+	CPU cputune.Settings `json:"cpu"`
+}
+
+// ServerConfig is the HTTP server configuration resolved in main
+type ServerConfig struct {
+	Profile           string            `json:"profile"`
+	Port              string            `json:"port"`
+	ReadTimeout       database.Duration `json:"read_timeout"`
+	WriteTimeout      database.Duration `json:"write_timeout"`
+	IdleTimeout       database.Duration `json:"idle_timeout"`
+	ReadHeaderTimeout database.Duration `json:"read_header_timeout"`
+	ShutdownTimeout   database.Duration `json:"shutdown_timeout"`
+	ShutdownBudget    shutdown.Budget   `json:"shutdown_budget"`
+	ValidateResponses bool              `json:"openapi_validate_responses"`
+	MetricsBackend    string            `json:"metrics_backend"`
+}
+
+type ResilienceConfig struct {
+	RateLimitRequests     int               `json:"rate_limit_requests"`
+	RateLimitWindow       database.Duration `json:"rate_limit_window"`
+	LookupMissLimit       int               `json:"lookup_miss_limit"`
+	LookupMissWindow      database.Duration `json:"lookup_miss_window"`
+	LookupMinResponseTime database.Duration `json:"lookup_min_response_time"`
+	ErrorVerbosity        string            `json:"error_verbosity"`
+	GracefulDegradation   bool              `json:"graceful_degradation"`
+	PolicyURL             string            `json:"policy_url,omitempty"`
+	PolicyInterval        database.Duration `json:"policy_interval"`
+	BreakerOpenDegraded   database.Duration `json:"breaker_open_degraded_after"`
+}
+
+// newResilienceConfig reports the rate limits, miss tracking and policy
+// engine from startup, which are fixed until a restart, and the rest from cfg
+func newResilienceConfig(startup, cfg *config.Config) ResilienceConfig {
+	return ResilienceConfig{
+		RateLimitRequests:     startup.Resilience.RateLimitRequests,
+		RateLimitWindow:       database.Duration{Duration: startup.Resilience.RateLimitWindow},
+		LookupMissLimit:       startup.Resilience.LookupMissLimit,
+		LookupMissWindow:      database.Duration{Duration: startup.Resilience.LookupMissWindow},
+		LookupMinResponseTime: database.Duration{Duration: cfg.Resilience.LookupMinResponseTime},
+		ErrorVerbosity:        cfg.Resilience.ErrorVerbosity,
+		PolicyURL:             startup.Policy.URL,
+		PolicyInterval:        database.Duration{Duration: startup.Policy.Interval},
+		BreakerOpenDegraded:   database.Duration{Duration: cfg.Health.BreakerOpenDegraded},
+	}
+}
+
+type LoggingConfig struct {
+	Level   string `json:"level"`
+	Format  string `json:"format"`
+	PIIMode string `json:"pii_mode"`
+}
+
+type HealthConfig struct {
+	CheckInterval    database.Duration `json:"check_interval"`
+	ReadinessTimeout database.Duration `json:"readiness_timeout"`
+}
+
+type RouteBreakerConfig struct {
+	Enabled     bool              `json:"enabled"`
+	ErrorRate   float64           `json:"error_rate"`
+	MinRequests int               `json:"min_requests"`
+	Window      database.Duration `json:"window"`
+	SlowCall    database.Duration `json:"slow_call"`
+	Cooldown    database.Duration `json:"cooldown"`
+}
+
+type TimeoutsConfig struct {
+	Default database.Duration            `json:"default"`
+	Routes  map[string]database.Duration `json:"routes"`
+}
+
+type DedupConfig struct {
+	Enabled bool                         `json:"enabled"`
+	Routes  map[string]database.Duration `json:"routes"`
+}
+
+// DownstreamConfig is reported only when a downstream is configured;
+// credentials in its URLs are redacted
+type DownstreamConfig struct {
+	Endpoints       []string          `json:"endpoints"`
+	Timeout         database.Duration `json:"timeout"`
+	OutlierFailures int               `json:"outlier_failures,omitempty"`
+	EjectionTime    database.Duration `json:"ejection_time"`
+	CacheEntries    int               `json:"cache_entries"`
+	StaleIfError    database.Duration `json:"stale_if_error"`
+	RateLimit       float64           `json:"rate_limit,omitempty"`
+	RateBurst       int               `json:"rate_burst"`
+	RateMaxWait     database.Duration `json:"rate_max_wait"`
+	DNSTTL          database.Duration `json:"dns_ttl"`
+	DNSStale        database.Duration `json:"dns_stale"`
+}
+
+type WorkersConfig struct {
+	workers.Stats
+	TaskTimeout database.Duration `json:"task_timeout"`
+}
+
+func newDownstreamConfig(cfg config.Downstream) *DownstreamConfig {
+	if len(cfg.URLs) == 0 {
+		return nil
+	}
+	endpoints := make([]string, len(cfg.URLs))
+	for i, endpoint := range cfg.URLs {
+		endpoints[i] = endpoint
+		if u, err := url.Parse(endpoint); err == nil {
+			endpoints[i] = u.Redacted()
+		}
+	}
+	return &DownstreamConfig{
+		Endpoints:       endpoints,
+		Timeout:         database.Duration{Duration: cfg.Timeout},
+		OutlierFailures: cfg.OutlierFailures,
+		EjectionTime:    database.Duration{Duration: cfg.EjectionTime},
+		CacheEntries:    cfg.CacheEntries,
+		StaleIfError:    database.Duration{Duration: cfg.StaleIfError},
+		RateLimit:       cfg.RateLimit,
+		RateBurst:       cfg.RateBurst,
+		RateMaxWait:     database.Duration{Duration: cfg.RateMaxWait},
+		DNSTTL:          database.Duration{Duration: cfg.DNSTTL},
+		DNSStale:        database.Duration{Duration: cfg.DNSStale},
+	}
+}
+
+// cfg returns the configuration in effect, which ApplyConfig swaps on reload
+func (h *Handler) cfg() *config.Config {
+	return h.config.Load()
+}
+
+// ApplyConfig adopts a reloaded configuration: feature flags, error
+// verbosity, lookup timing, readiness timeout, route breaker thresholds,
+// request timeouts, deduplicated routes and redacted response fields take
+// effect for the next request. Rate limits, admin credentials, the
+// policy engine and the downstream client keep their startup settings.
+func (h *Handler) ApplyConfig(cfg *config.Config) {
+	h.config.Store(cfg)
+	h.routeBreakers.SetConfig(routeBreakerConfig(cfg.RouteBreaker))
+}
+
+// SetServerConfig records the server settings main resolved, for the config dump
+func (h *Handler) SetServerConfig(config ServerConfig) {
+	h.serverConfig = config
+}
+
+// EffectiveConfig assembles the fully resolved configuration
+func (h *Handler) EffectiveConfig() EffectiveConfig {
+	cfg := h.cfg()
+	resilience := newResilienceConfig(h.startup, cfg)
+	resilience.GracefulDegradation = h.isGracefulDegradationEnabled()
+
+	dedupRoutes := make(map[string]database.Duration, len(cfg.Dedup.Routes))
+	for route, window := range cfg.Dedup.Routes {
+		dedupRoutes[route] = database.Duration{Duration: window}
+	}
+
+	routeTimeouts := make(map[string]database.Duration, len(cfg.Timeouts.Routes))
+	for route, timeout := range cfg.Timeouts.Routes {
+		routeTimeouts[route] = database.Duration{Duration: timeout}
+	}
+
+	return EffectiveConfig{
+		Build:           buildInfo(cfg.Version),
+		Server:          h.serverConfig,
+		ProfileDefaults: cfg.ProfileDefaults,
+		Features:        cfg.Features,
+		Plugins:         plugin.Names(),
+		Logging: LoggingConfig{
+			Level:   h.logLevel.String(),
+			Format:  h.startup.Logging.Format,
+			PIIMode: h.startup.Logging.PIIMode,
+		},
+		Database: h.db.Settings(),
+		Health: HealthConfig{
+			CheckInterval:    database.Duration{Duration: cfg.Health.CheckInterval},
+			ReadinessTimeout: database.Duration{Duration: cfg.Health.ReadinessTimeout},
+		},
+		Resilience: resilience,
+		RouteBreaker: RouteBreakerConfig{
+			Enabled:     cfg.FeatureEnabled("route_breaker"),
+			ErrorRate:   cfg.RouteBreaker.ErrorRate,
+			MinRequests: cfg.RouteBreaker.MinRequests,
+			Window:      database.Duration{Duration: cfg.RouteBreaker.Window},
+			SlowCall:    database.Duration{Duration: cfg.RouteBreaker.SlowCall},
+			Cooldown:    database.Duration{Duration: cfg.RouteBreaker.Cooldown},
+		},
+		Dedup: DedupConfig{
+			Enabled: cfg.FeatureEnabled("request_dedup"),
+			Routes:  dedupRoutes,
+		},
+		Timeouts: TimeoutsConfig{
+			Default: database.Duration{Duration: cfg.Timeouts.Default},
+			Routes:  routeTimeouts,
+		},
+		Redaction:  cfg.Redaction.Fields,
+		Downstream: newDownstreamConfig(h.startup.Downstream),
+		Workers: WorkersConfig{
+			Stats:       h.tasks.Stats(),
+			TaskTimeout: database.Duration{Duration: h.startup.Workers.TaskTimeout},
+		},
+		Secrets: map[string]string{
+			"DB_PASSWORD":  redact(cfg.Database.Password),
+			"DATABASE_URL": redact(cfg.Database.URL),
+			"ADMIN_TOKEN":  redact(h.adminToken),
+
+			"AFFINITY_COOKIE_SECRET": redact(h.startup.Affinity.Secret),
+			"HEALTH_TOKEN":           redact(cfg.Health.Token),
+		},
+	}
+}
+
+// Get the effective configuration of this pod
+func (h *Handler) GetConfig(w http.ResponseWriter, r *http.Request) {
+	h.writeJSONResponse(w, r, http.StatusOK, h.EffectiveConfig())
+}
+
+// Get the running build and GOMAXPROCS, so latency numbers can be read
+// against the CPU the process actually schedules on
+func (h *Handler) GetVersion(w http.ResponseWriter, r *http.Request) {
+	h.writeJSONResponse(w, r, http.StatusOK, VersionInfo{
+		BuildInfo: buildInfo(h.startup.Version),
+		CPU:       cputune.Current(),
+	})
+}
+
+// Validate the live configuration with proposed changes applied, e.g.
+// /admin/config/validate?RATE_LIMIT_REQUESTS=100, before rolling them out.
+// Responds 422 with the same body when the result is invalid.
+func (h *Handler) ValidateConfig(w http.ResponseWriter, r *http.Request) {
+	overrides := make(map[string]string)
+	for key, values := range r.URL.Query() {
+		if key == "pretty" || len(values) == 0 {
+			continue
+		}
+		overrides[key] = values[0]
+	}
+
+	result := configcheck.Validate(configcheck.Overlay(h.cfg().Lookup(), overrides))
+
+	status := http.StatusOK
+	if !result.Valid {
+		status = http.StatusUnprocessableEntity
+	}
+	h.writeJSONResponse(w, r, status, result)
+}
+
+func buildInfo(version string) BuildInfo {
+	info := BuildInfo{
+		Version:   version,
+		GoVersion: runtime.Version(),
+	}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, setting := range bi.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.time":
+			if t, err := time.Parse(time.RFC3339, setting.Value); err == nil {
+				info.RevisionTime = t.UTC().Format(time.RFC3339)
+			}
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return secretUnset
+	}
+	return logging.Redacted
+}
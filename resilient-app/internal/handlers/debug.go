@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/demo/resilient-app/internal/ctxkeys"
+)
+
+// Error verbosity modes (ERROR_VERBOSITY)
+const (
+	// verbosityTerse never exposes internals; the production default
+	verbosityTerse = "terse"
+	// verbosityNegotiate exposes internals to requests that ask for them
+	verbosityNegotiate = "negotiate"
+	// verbosityDebug exposes internals on every error response
+	verbosityDebug = "debug"
+)
+
+// ErrorDebugHeader lets a client opt into debug error bodies when
+// ERROR_VERBOSITY=negotiate
+const ErrorDebugHeader = "X-Error-Verbosity"
+
+// ErrorDebug carries troubleshooting details that would otherwise require log access
+type ErrorDebug struct {
+	ErrorChain     []string            `json:"error_chain,omitempty"`
+	CircuitBreaker *CircuitBreakerInfo `json:"circuit_breaker,omitempty"`
+	Retryable      bool                `json:"retryable"`
+	RetryHint      string              `json:"retry_hint"`
+	// Deadline is the request's timeout and where it came from
+	Deadline string `json:"deadline,omitempty"`
+}
+
+type CircuitBreakerInfo struct {
+	State         string `json:"state"`
+	Requests      uint32 `json:"requests"`
+	TotalFailures uint32 `json:"total_failures"`
+}
+
+func (h *Handler) wantsDebugErrors(r *http.Request) bool {
+	switch h.cfg().Resilience.ErrorVerbosity {
+	case verbosityDebug:
+		return true
+	case verbosityNegotiate:
+		return r != nil && strings.EqualFold(r.Header.Get(ErrorDebugHeader), "debug")
+	}
+	return false
+}
+
+func (h *Handler) newErrorDebug(w http.ResponseWriter, r *http.Request, statusCode int, cause error) *ErrorDebug {
+	debug := &ErrorDebug{
+		ErrorChain: errorChain(cause),
+	}
+	if r != nil {
+		if deadline, ok := ctxkeys.Deadline.Lookup(r.Context()); ok {
+			debug.Deadline = fmt.Sprintf("%s (%s timeout for %s)", deadline.Timeout, deadline.Source, deadline.Route)
+		}
+	}
+
+	if h.db != nil {
+		stats := h.db.GetStats()
+		debug.CircuitBreaker = &CircuitBreakerInfo{
+			State:         h.db.GetState().String(),
+			Requests:      stats.Requests,
+			TotalFailures: stats.TotalFailures,
+		}
+	}
+
+	retryAfter := w.Header().Get("Retry-After")
+	switch {
+	case retryAfter != "":
+		debug.Retryable = true
+		debug.RetryHint = "retry after " + retryAfter + "s"
+	case statusCode == http.StatusServiceUnavailable && debug.CircuitBreaker != nil && debug.CircuitBreaker.State == "open":
+		debug.Retryable = true
+		debug.RetryHint = "circuit breaker is open; retry after it half-opens"
+	case statusCode >= 500:
+		debug.Retryable = true
+		debug.RetryHint = "retry with exponential backoff"
+	default:
+		debug.RetryHint = "do not retry without changing the request"
+	}
+
+	return debug
+}
+
+// errorChain flattens err and everything it wraps, outermost first
+func errorChain(err error) []string {
+	var chain []string
+	queue := []error{err}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if current == nil {
+			continue
+		}
+		chain = append(chain, current.Error())
+
+		switch wrapped := current.(type) {
+		case interface{ Unwrap() []error }:
+			queue = append(queue, wrapped.Unwrap()...)
+		default:
+			queue = append(queue, errors.Unwrap(current))
+		}
+	}
+	return chain
+}
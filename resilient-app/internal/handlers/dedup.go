@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+
+	"github.com/demo/resilient-app/internal/dedup"
+	"github.com/demo/resilient-app/internal/metrics"
+	"go.uber.org/zap"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	deduplicatedHeader   = "X-Deduplicated"
+
+	// maxDedupBody bounds the request bodies fingerprinted and the responses
+	// kept for replay; larger ones are never coalesced
+	maxDedupBody = 1 << 20
+)
+
+var deduplicatedTotal = metrics.NewCounterVec(
+	metrics.Opts{
+		Name: "http_deduplicated_requests_total",
+		Help: "Total number of duplicate requests answered with the response of an identical earlier request",
+	},
+	[]string{"route"},
+)
+
+// Middleware that coalesces identical mutating requests sent without an
+// Idempotency-Key, typically retries from impatient clients. A duplicate of a
+// request still in flight, or finished within the route's window, gets the
+// original's response instead of creating the same user twice. Failed (5xx)
+// responses are not replayed, so a retry after a failure runs again.
+func (h *Handler) DedupMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := h.cfg()
+		if !cfg.FeatureEnabled("request_dedup") || r.Header.Get(idempotencyKeyHeader) != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		route := h.routeName(r)
+		window, ok := cfg.Dedup.Routes[route]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxDedupBody+1))
+		if err != nil {
+			h.writeErrorResponse(w, r, http.StatusBadRequest, "invalid_body", "Failed to read request body", err)
+			return
+		}
+		if len(body) > maxDedupBody {
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			next.ServeHTTP(w, r)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		key := fingerprint(r, route, body)
+		call, leader := h.duplicates.Join(key, window)
+		if !leader {
+			response, err := call.Wait(r.Context())
+			if err != nil {
+				return
+			}
+			if response == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			deduplicatedTotal.WithLabelValues(route).Inc()
+			h.log(r).Info("Answered duplicate request with the original's response", zap.String("route", route))
+			replayResponse(w, response)
+			return
+		}
+
+		recorder := &recordingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		var response *dedup.Response
+		defer func() { h.duplicates.Finish(key, call, response) }()
+
+		next.ServeHTTP(recorder, r)
+
+		if recorder.statusCode < http.StatusInternalServerError && !recorder.overflow {
+			response = &dedup.Response{
+				Status: recorder.statusCode,
+				Header: recorder.header,
+				Body:   recorder.body.Bytes(),
+			}
+		}
+	})
+}
+
+// fingerprint identifies a request by route, target, caller and payload
+func fingerprint(r *http.Request, route string, body []byte) string {
+	hash := sha256.New()
+	for _, part := range []string{
+		route,
+		r.URL.RequestURI(),
+		clientIP(r),
+		r.Header.Get("Authorization"),
+		r.Header.Get(tenantHeader),
+	} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// replayResponse writes a recorded response; headers the duplicate already
+// set (request ID, rate limit quota) are kept
+func replayResponse(w http.ResponseWriter, response *dedup.Response) {
+	for key, values := range response.Header {
+		if _, ok := w.Header()[key]; !ok {
+			w.Header()[key] = values
+		}
+	}
+	w.Header().Set(deduplicatedHeader, "true")
+	w.WriteHeader(response.Status)
+	w.Write(response.Body)
+}
+
+// Response writer that passes the response through while recording it for
+// replay, up to maxDedupBody
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	header      http.Header
+	body        bytes.Buffer
+	overflow    bool
+	wroteHeader bool
+}
+
+func (rw *recordingResponseWriter) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.wroteHeader = true
+		rw.statusCode = code
+		rw.header = rw.ResponseWriter.Header().Clone()
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recordingResponseWriter) Write(b []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if rw.body.Len()+len(b) > maxDedupBody {
+		rw.overflow = true
+	} else if !rw.overflow {
+		rw.body.Write(b)
+	}
+	return rw.ResponseWriter.Write(b)
+}
+
+func (rw *recordingResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
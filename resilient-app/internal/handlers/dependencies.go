@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/demo/resilient-app/internal/dependency"
+)
+
+// List every registered dependency with its breaker state, last check and
+// latency, so operators can see what each failure takes down. With
+// HEALTH_TOKEN set it is refused to callers without it, like the full health
+// report: it names every endpoint the app talks to.
+func (h *Handler) GetDependencies(w http.ResponseWriter, r *http.Request) {
+	if !h.verboseHealth(r) {
+		h.writeHealthTokenRequired(w, r)
+		return
+	}
+	h.writeJSONResponse(w, r, http.StatusOK, map[string]interface{}{
+		"dependencies": dependency.Default.Statuses(),
+	})
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/demo/resilient-app/internal/dependency"
+	"github.com/demo/resilient-app/internal/httpclient"
+	"go.uber.org/zap"
+)
+
+// newDownstreamClient builds the client for DOWNSTREAM_URL, a comma-separated
+// list of endpoints balanced client-side, or returns nil when no downstream is
+// configured
+func (h *Handler) newDownstreamClient() *httpclient.Client {
+	cfg := h.cfg().Downstream
+	if len(cfg.URLs) == 0 {
+		return nil
+	}
+
+	client, err := httpclient.New(httpclient.Config{
+		Name:            "downstream",
+		Endpoints:       cfg.URLs,
+		Timeout:         cfg.Timeout,
+		Criticality:     dependency.Optional,
+		OutlierFailures: cfg.OutlierFailures,
+		BaseEjection:    cfg.EjectionTime,
+		CacheEntries:    cfg.CacheEntries,
+		StaleIfError:    cfg.StaleIfError,
+		RateLimit:       cfg.RateLimit,
+		RateBurst:       cfg.RateBurst,
+		RateMaxWait:     cfg.RateMaxWait,
+		DNSTTL:          cfg.DNSTTL,
+		DNSStale:        cfg.DNSStale,
+	})
+	if err != nil {
+		h.logger.Error("Downstream client disabled", zap.Error(err))
+		return nil
+	}
+	return client
+}
+
+// Call the downstream service through the resilient client, falling back to a
+// placeholder while it is failing and degradation is allowed
+func (h *Handler) GetDownstream(w http.ResponseWriter, r *http.Request) {
+	if h.downstream == nil {
+		h.writeErrorResponse(w, r, http.StatusNotFound, "not_configured",
+			"No downstream service is configured", nil)
+		return
+	}
+
+	resp, err := h.downstream.Get(r.Context(), "/")
+	if err != nil {
+		h.log(r).Error("Downstream call failed", zap.Error(err))
+
+		if h.isGracefulDegradationEnabled() {
+			h.writeJSONResponse(w, r, http.StatusOK, map[string]interface{}{
+				"source":  "fallback",
+				"message": "Downstream unavailable, serving placeholder data",
+			})
+			return
+		}
+
+		code := "downstream_error"
+		switch {
+		case errors.Is(err, httpclient.ErrUnavailable):
+			code = "downstream_unavailable"
+		case errors.Is(err, httpclient.ErrThrottled):
+			code = "downstream_throttled"
+			w.Header().Set("Retry-After", "1")
+		}
+		h.writeErrorResponse(w, r, http.StatusServiceUnavailable, code,
+			"Downstream service is unavailable", err)
+		return
+	}
+
+	var data interface{} = string(resp.Body)
+	if json.Valid(resp.Body) {
+		data = json.RawMessage(resp.Body)
+	}
+	if resp.Cache != "" {
+		w.Header().Set("X-Cache", resp.Cache)
+	}
+	h.writeJSONResponse(w, r, http.StatusOK, map[string]interface{}{
+		"source": "downstream",
+		"status": resp.StatusCode,
+		"cache":  resp.Cache,
+		"data":   data,
+	})
+}
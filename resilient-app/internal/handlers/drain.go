@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/demo/resilient-app/internal/events"
+)
+
+const (
+	// drainRetryAfter tells stream clients to reconnect right away, which
+	// lands them on another instance
+	drainRetryAfter = "1"
+
+	// drainKeepAliveInterval is how often open streams are pinged while
+	// draining, so clients don't mistake the quiet for a dead connection
+	drainKeepAliveInterval = 2 * time.Second
+
+	// streamDrainMargin ends open streams this long before the drain deadline
+	// so they close cleanly instead of being force-closed
+	streamDrainMargin = 500 * time.Millisecond
+)
+
+// drainNotice tells clients a stream is ending because of a rollout drain,
+// not a failure
+type drainNotice struct {
+	Reason   string    `json:"reason"`
+	Deadline time.Time `json:"deadline,omitempty"`
+}
+
+// drainState remembers that shutdown started, for handlers of long-lived requests
+type drainState struct {
+	started atomic.Pointer[events.ShutdownStarted]
+}
+
+func (d *drainState) watch() {
+	events.Default.Subscribe(events.ShutdownStarted{}.Name()).Handle(func(e events.Event) {
+		started := e.(events.ShutdownStarted)
+		d.started.Store(&started)
+	})
+}
+
+// deadline returns when draining ends, or false if shutdown hasn't started
+func (d *drainState) deadline() (time.Time, bool) {
+	started := d.started.Load()
+	if started == nil {
+		return time.Time{}, false
+	}
+	return started.DrainDeadline, true
+}
+
+// rejectIfDraining answers new long-poll and stream requests with a 503 once
+// shutdown has started, so clients reconnect elsewhere instead of being cut off
+func (h *Handler) rejectIfDraining(w http.ResponseWriter, r *http.Request) bool {
+	if _, draining := h.drain.deadline(); !draining {
+		return false
+	}
+	w.Header().Set("Retry-After", drainRetryAfter)
+	h.writeErrorResponse(w, r, http.StatusServiceUnavailable, "draining",
+		"Server is draining for shutdown, reconnect to reach another instance", nil)
+	return true
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/demo/resilient-app/internal/dump"
+)
+
+// SetDumper hands the handler the dumper /admin/dump triggers. It must be
+// called before the handler serves requests.
+func (h *Handler) SetDumper(dumper *dump.Dumper) {
+	h.dumper = dumper
+}
+
+// Write heap, goroutine and mutex profiles to DUMP_DIR, like SIGUSR2 does,
+// and report the files; copy them off the pod with kubectl cp
+func (h *Handler) CreateDump(w http.ResponseWriter, r *http.Request) {
+	if h.dumper == nil {
+		h.writeErrorResponse(w, r, http.StatusNotFound, "dumps_disabled",
+			"Profile dumps are disabled; set DUMP_DIR", nil)
+		return
+	}
+
+	d, err := h.dumper.Dump(dump.TriggerAdmin)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, "dump_failed",
+			"Failed to write profile dump", err)
+		return
+	}
+	h.writeJSONResponse(w, r, http.StatusCreated, d)
+}
+
+// List the profile dumps kept in DUMP_DIR, newest first
+func (h *Handler) ListDumps(w http.ResponseWriter, r *http.Request) {
+	if h.dumper == nil {
+		h.writeErrorResponse(w, r, http.StatusNotFound, "dumps_disabled",
+			"Profile dumps are disabled; set DUMP_DIR", nil)
+		return
+	}
+
+	dumps, err := h.dumper.List()
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, "dump_list_failed",
+			"Failed to list profile dumps", err)
+		return
+	}
+	h.writeJSONResponse(w, r, http.StatusOK, map[string]interface{}{
+		"dumps": dumps,
+	})
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// fallbackErrorBody is sent when a response cannot be serialized; it is a
+// constant so producing it can't fail
+var fallbackErrorBody = []byte(`{"error":"Internal Server Error","code":"serialization_error","message":"Failed to encode response"}` + "\n")
+
+// maxPooledBufferSize caps the buffers kept for reuse, so one large export
+// doesn't pin its memory for the life of the process
+const maxPooledBufferSize = 64 << 10
+
+// jsonBuffer is a buffer with an encoder writing into it. Both are reused
+// across responses through jsonBuffers, which at high request rates removes
+// the buffer growth and encoder allocations from every response.
+type jsonBuffer struct {
+	bytes.Buffer
+	encoder *json.Encoder
+}
+
+var jsonBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := &jsonBuffer{}
+		buf.encoder = json.NewEncoder(&buf.Buffer)
+		return buf
+	},
+}
+
+// getJSONBuffer returns an empty buffer from the pool; release returns it
+func getJSONBuffer() *jsonBuffer {
+	buf := jsonBuffers.Get().(*jsonBuffer)
+	buf.Reset()
+	return buf
+}
+
+func (buf *jsonBuffer) release() {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	jsonBuffers.Put(buf)
+}
+
+// encode appends data as JSON followed by a newline
+func (buf *jsonBuffer) encode(data interface{}, pretty bool) error {
+	if pretty {
+		buf.encoder.SetIndent("", "  ")
+		defer buf.encoder.SetIndent("", "")
+	}
+	return buf.encoder.Encode(data)
+}
+
+// encodeJSON serializes data into a pooled buffer, converting encoder panics
+// into errors. The caller releases the buffer once the body is written.
+func encodeJSON(data interface{}, pretty bool) (buf *jsonBuffer, err error) {
+	buf = getJSONBuffer()
+	defer func() {
+		if p := recover(); p != nil {
+			// Dropped rather than pooled; the panic left it half written
+			buf = nil
+			err = fmt.Errorf("panic during JSON encoding: %v", p)
+		}
+	}()
+
+	if err := buf.encode(data, pretty); err != nil {
+		buf.release()
+		return nil, err
+	}
+	return buf, nil
+}
+
+// writeEvent writes one Server-Sent Event whose data is data encoded as JSON.
+// It only fails to encode; a write to a departed client surfaces at the
+// stream's next Flush.
+func writeEvent(w io.Writer, name string, data interface{}) error {
+	buf := getJSONBuffer()
+	defer buf.release()
+
+	buf.WriteString("event: ")
+	buf.WriteString(name)
+	buf.WriteString("\ndata: ")
+	if err := buf.encode(data, false); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	w.Write(buf.Bytes())
+	return nil
+}
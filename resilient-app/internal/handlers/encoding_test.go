@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/demo/resilient-app/internal/database"
+)
+
+// BenchmarkEncodeJSON compares the pooled encoder responses are written with
+// against a json.Encoder and buffer made per response, for a single user and
+// a page of them
+func BenchmarkEncodeJSON(b *testing.B) {
+	users := make([]database.User, 50)
+	for i := range users {
+		users[i] = database.User{
+			ID:        i + 1,
+			Name:      fmt.Sprintf("User %d", i+1),
+			Email:     fmt.Sprintf("user%d@example.com", i+1),
+			Verified:  i%2 == 0,
+			CreatedAt: time.Date(2024, 1, 15, 9, 0, i, 0, time.UTC),
+		}
+	}
+	payloads := []struct {
+		name string
+		data interface{}
+	}{
+		{"user", users[0]},
+		{"page", map[string]interface{}{"users": users, "next_cursor": "eyJpZCI6NTB9"}},
+	}
+
+	for _, payload := range payloads {
+		b.Run(payload.name+"/pooled", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buf, err := encodeJSON(payload.data, false)
+				if err != nil {
+					b.Fatal(err)
+				}
+				io.Discard.Write(buf.Bytes())
+				buf.release()
+			}
+		})
+		b.Run(payload.name+"/json.NewEncoder", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var buf bytes.Buffer
+				if err := json.NewEncoder(&buf).Encode(payload.data); err != nil {
+					b.Fatal(err)
+				}
+				io.Discard.Write(buf.Bytes())
+			}
+		})
+	}
+}
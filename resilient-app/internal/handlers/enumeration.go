@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"bytes"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/demo/resilient-app/internal/metrics"
+	"go.uber.org/zap"
+)
+
+var lookupThrottledTotal = metrics.NewCounterVec(
+	metrics.Opts{
+		Name: "lookup_throttled_total",
+		Help: "Total number of lookup requests rejected by anti-enumeration throttling",
+	},
+	[]string{"endpoint"},
+)
+
+// EnumerationGuard protects lookup endpoints against enumeration. Clients that
+// produce too many misses (404s) are throttled with 429, and every response is
+// padded to a minimum duration so hits and misses are indistinguishable by timing.
+// Database failures are not misses, so clients are never penalized for an outage.
+func (h *Handler) EnumerationGuard(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		client := clientIP(r)
+		endpoint := h.getEndpointLabel(r)
+
+		if allowed, retryAfter := h.lookupMisses.Allow(client); !allowed {
+			lookupThrottledTotal.WithLabelValues(endpoint).Inc()
+			h.log(r).Warn("Lookup throttled due to excessive misses",
+				zap.String("client", client),
+				zap.String("path", r.URL.Path),
+			)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			h.padResponseTime(r, start)
+			h.writeErrorResponse(w, r, http.StatusTooManyRequests, "too_many_misses",
+				"Too many failed lookups, please retry later", nil)
+			return
+		}
+
+		// Buffer the response so nothing reaches the client before padding
+		recorder := &bufferedResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next(recorder, r)
+
+		if recorder.statusCode == http.StatusNotFound {
+			h.lookupMisses.RecordMiss(client)
+		}
+
+		h.padResponseTime(r, start)
+		recorder.flush()
+	}
+}
+
+func (h *Handler) padResponseTime(r *http.Request, start time.Time) {
+	remaining := h.cfg().Resilience.LookupMinResponseTime - time.Since(start)
+	if remaining <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(remaining)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Response writer that holds status and body until flushed
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (bw *bufferedResponseWriter) WriteHeader(code int) {
+	bw.statusCode = code
+}
+
+func (bw *bufferedResponseWriter) Write(b []byte) (int, error) {
+	return bw.body.Write(b)
+}
+
+func (bw *bufferedResponseWriter) flush() {
+	bw.ResponseWriter.WriteHeader(bw.statusCode)
+	bw.ResponseWriter.Write(bw.body.Bytes())
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/demo/resilient-app/internal/events"
+	"go.uber.org/zap"
+)
+
+const eventsKeepAliveInterval = 15 * time.Second
+
+// Stream component events (breaker transitions, health changes, shutdown) as
+// Server-Sent Events; ?events=a,b restricts the stream to the named types.
+// When shutdown starts the client gets a "draining" event and keep-alive pings
+// until just before the drain deadline, when the stream ends.
+func (h *Handler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	if h.rejectIfDraining(w, r) {
+		return
+	}
+
+	shutdown := events.ShutdownStarted{}.Name()
+
+	var names []string
+	wanted := make(map[string]bool)
+	if value := r.URL.Query().Get("events"); value != "" {
+		for _, name := range strings.Split(value, ",") {
+			wanted[strings.TrimSpace(name)] = true
+			names = append(names, strings.TrimSpace(name))
+		}
+		names = append(names, shutdown)
+	}
+
+	sub := events.Default.Subscribe(names...)
+	defer sub.Close()
+
+	// The stream stays open until the client leaves or the server shuts down
+	controller := http.NewResponseController(w)
+	controller.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	controller.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	// Fires when a draining stream has to end; nil (blocks forever) until then
+	var drained <-chan time.Time
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-drained:
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if len(wanted) == 0 || wanted[e.Name()] {
+				if err := writeEvent(w, e.Name(), e); err != nil {
+					h.log(r).Error("Failed to encode event", zap.String("event", e.Name()), zap.Error(err))
+					continue
+				}
+			}
+			if started, ok := e.(events.ShutdownStarted); ok {
+				if started.DrainDeadline.IsZero() {
+					controller.Flush()
+					return
+				}
+				h.writeDrainNotice(w, r, started.DrainDeadline)
+				keepAlive.Reset(drainKeepAliveInterval)
+				drained = time.After(time.Until(started.DrainDeadline) - streamDrainMargin)
+			}
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeDrainNotice announces the end of the stream; the retry field makes
+// EventSource clients reconnect (to another instance) without backing off
+func (h *Handler) writeDrainNotice(w http.ResponseWriter, r *http.Request, deadline time.Time) {
+	data, err := json.Marshal(drainNotice{Reason: "server is draining for shutdown", Deadline: deadline})
+	if err != nil {
+		h.log(r).Error("Failed to encode drain notice", zap.Error(err))
+		return
+	}
+	fmt.Fprintf(w, "retry: 1000\nevent: draining\ndata: %s\n\n", data)
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/demo/resilient-app/internal/ctxkeys"
+	"github.com/demo/resilient-app/internal/database"
+	"github.com/demo/resilient-app/internal/metrics"
+	"github.com/gorilla/mux"
+	"github.com/graphql-go/graphql"
+	"go.uber.org/zap"
+)
+
+var graphqlRequestsTotal = metrics.NewCounterVec(
+	metrics.Opts{
+		Name: "graphql_requests_total",
+		Help: "Total number of GraphQL requests by result",
+	},
+	[]string{"result"},
+)
+
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+var loaderKey = ctxkeys.New[*userLoader]("graphql_user_loader")
+
+// RegisterGraphQL builds the schema and mounts the optional /graphql endpoint
+func (h *Handler) RegisterGraphQL(router *mux.Router) error {
+	schema, err := h.newGraphQLSchema()
+	if err != nil {
+		return fmt.Errorf("failed to build GraphQL schema: %w", err)
+	}
+	h.graphqlSchema = schema
+
+	router.Handle("/graphql", h.RateLimitMiddleware(h.TimeoutMiddleware(http.HandlerFunc(h.GraphQL)))).Methods("GET", "POST")
+	return nil
+}
+
+// GraphQL endpoint exposing users, orders and system status over the same
+// database layer, circuit breaker and degradation rules as the REST API
+func (h *Handler) GraphQL(w http.ResponseWriter, r *http.Request) {
+	var req GraphQLRequest
+	if r.Method == http.MethodGet {
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, "invalid_json",
+			"Invalid JSON in request body", err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// Each request gets its own loader so batching never leaks data across requests
+	ctx = loaderKey.With(ctx, newUserLoader(h.userStore))
+
+	result := graphql.Do(graphql.Params{
+		Schema:         h.graphqlSchema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        ctx,
+	})
+
+	if result.HasErrors() {
+		graphqlRequestsTotal.WithLabelValues("error").Inc()
+	} else {
+		graphqlRequestsTotal.WithLabelValues("success").Inc()
+	}
+
+	h.writeJSONResponse(w, r, http.StatusOK, result)
+}
+
+func (h *Handler) newGraphQLSchema() (graphql.Schema, error) {
+	userType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.Fields{
+			"id":        &graphql.Field{Type: graphql.Int},
+			"name":      &graphql.Field{Type: graphql.String},
+			"email":     &graphql.Field{Type: graphql.String},
+			"verified":  &graphql.Field{Type: graphql.Boolean},
+			"createdAt": &graphql.Field{Type: graphql.DateTime, Resolve: resolveField(func(u database.User) interface{} { return u.CreatedAt })},
+		},
+	})
+
+	orderType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Order",
+		Fields: graphql.Fields{
+			"id":        &graphql.Field{Type: graphql.Int},
+			"userId":    &graphql.Field{Type: graphql.Int, Resolve: resolveField(func(o database.Order) interface{} { return o.UserID })},
+			"product":   &graphql.Field{Type: graphql.String},
+			"quantity":  &graphql.Field{Type: graphql.Int},
+			"createdAt": &graphql.Field{Type: graphql.DateTime, Resolve: resolveField(func(o database.Order) interface{} { return o.CreatedAt })},
+			"user": &graphql.Field{
+				Type: userType,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					order := p.Source.(database.Order)
+					return loaderFromContext(p.Context).load(p.Context, order.UserID), nil
+				},
+			},
+		},
+	})
+
+	breakerType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "CircuitBreaker",
+		Fields: graphql.Fields{
+			"state":          &graphql.Field{Type: graphql.String},
+			"requests":       &graphql.Field{Type: graphql.Int},
+			"totalSuccesses": &graphql.Field{Type: graphql.Int},
+			"totalFailures":  &graphql.Field{Type: graphql.Int},
+		},
+	})
+
+	statusType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Status",
+		Fields: graphql.Fields{
+			"health":         &graphql.Field{Type: graphql.String},
+			"circuitBreaker": &graphql.Field{Type: breakerType},
+			"features":       &graphql.Field{Type: graphql.NewList(graphql.String)},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"users": &graphql.Field{
+				Type:    graphql.NewList(userType),
+				Resolve: h.resolveUsers,
+			},
+			"user": &graphql.Field{
+				Type: userType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return loaderFromContext(p.Context).load(p.Context, p.Args["id"].(int)), nil
+				},
+			},
+			"orders": &graphql.Field{
+				Type: graphql.NewList(orderType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return h.db.GetOrders(p.Context)
+				},
+			},
+			"status": &graphql.Field{
+				Type:    statusType,
+				Resolve: h.resolveStatus,
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query})
+}
+
+func (h *Handler) resolveUsers(p graphql.ResolveParams) (interface{}, error) {
+	users, err := h.userStore.GetUsers(p.Context)
+	if err != nil {
+		h.logCtx(p.Context).Error("Failed to resolve users", zap.Error(err))
+
+		// Graceful degradation, same as the REST endpoint
+		if h.isGracefulDegradationEnabled() {
+			return h.getFallbackUsers(), nil
+		}
+		return nil, err
+	}
+	return users, nil
+}
+
+func (h *Handler) resolveStatus(p graphql.ResolveParams) (interface{}, error) {
+	healthResponse := h.healthChecker.HealthCheck(p.Context)
+	stats := h.db.GetStats()
+
+	return map[string]interface{}{
+		"health": string(healthResponse.Status),
+		"circuitBreaker": map[string]interface{}{
+			"state":          h.db.GetState().String(),
+			"requests":       stats.Requests,
+			"totalSuccesses": stats.TotalSuccesses,
+			"totalFailures":  stats.TotalFailures,
+		},
+		"features": h.getEnabledFeatures(),
+	}, nil
+}
+
+// resolveField adapts a typed accessor to a resolver for fields whose GraphQL
+// name differs from the Go field or JSON tag
+func resolveField[T any](get func(T) interface{}) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		switch source := p.Source.(type) {
+		case T:
+			return get(source), nil
+		case *T:
+			return get(*source), nil
+		}
+		return nil, nil
+	}
+}
+
+// userLoader batches user lookups made while resolving one level of a query
+// (e.g. the user of every order) into a single database round trip
+type userLoader struct {
+	store   database.UserStore
+	mu      sync.Mutex
+	pending []int
+	users   map[int]*database.User
+	errs    map[int]error
+}
+
+func newUserLoader(store database.UserStore) *userLoader {
+	return &userLoader{
+		store: store,
+		users: make(map[int]*database.User),
+		errs:  make(map[int]error),
+	}
+}
+
+func loaderFromContext(ctx context.Context) *userLoader {
+	return loaderKey.Value(ctx)
+}
+
+// load queues the ID and returns a thunk; the executor resolves thunks after
+// visiting the whole level, so the first thunk fetches every queued ID at once
+func (l *userLoader) load(ctx context.Context, id int) func() (interface{}, error) {
+	l.mu.Lock()
+	if _, ok := l.users[id]; !ok {
+		l.pending = append(l.pending, id)
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if len(l.pending) > 0 {
+			l.fetch(ctx)
+		}
+
+		if err := l.errs[id]; err != nil {
+			return nil, err
+		}
+		if user := l.users[id]; user != nil {
+			return *user, nil
+		}
+		return nil, nil
+	}
+}
+
+func (l *userLoader) fetch(ctx context.Context) {
+	ids := l.pending
+	l.pending = nil
+
+	users, err := l.store.GetUsersByIDs(ctx, ids)
+	for _, id := range ids {
+		l.users[id] = nil
+		if err != nil {
+			l.errs[id] = err
+		}
+	}
+	for i := range users {
+		l.users[users[i].ID] = &users[i]
+	}
+}
@@ -1,32 +1,59 @@
 package handlers
 
 import (
-	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/demo/resilient-app/internal/cache"
+	"github.com/demo/resilient-app/internal/config"
+	"github.com/demo/resilient-app/internal/cputune"
 	"github.com/demo/resilient-app/internal/database"
+	"github.com/demo/resilient-app/internal/dedup"
+	"github.com/demo/resilient-app/internal/dependency"
+	"github.com/demo/resilient-app/internal/disconnect"
+	"github.com/demo/resilient-app/internal/dump"
 	"github.com/demo/resilient-app/internal/health"
+	"github.com/demo/resilient-app/internal/httpclient"
+	"github.com/demo/resilient-app/internal/i18n"
+	"github.com/demo/resilient-app/internal/journal"
+	"github.com/demo/resilient-app/internal/memtune"
+	"github.com/demo/resilient-app/internal/metrics"
+	"github.com/demo/resilient-app/internal/policy"
+	"github.com/demo/resilient-app/internal/ratelimit"
+	"github.com/demo/resilient-app/internal/routebreaker"
+	"github.com/demo/resilient-app/internal/timeline"
+	"github.com/demo/resilient-app/internal/validate"
+	"github.com/demo/resilient-app/internal/verification"
+	"github.com/demo/resilient-app/internal/workers"
 	"github.com/gorilla/mux"
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/graphql-go/graphql"
 	"go.uber.org/zap"
 )
 
 var (
-	httpRequestsTotal = promauto.NewCounterVec(
-		prometheus.CounterOpts{
+	httpRequestsTotal = metrics.NewCounterVec(
+		metrics.Opts{
 			Name: "http_requests_total",
 			Help: "Total number of HTTP requests",
 		},
 		[]string{"method", "endpoint", "status"},
 	)
 
-	httpRequestDuration = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
+	serializationErrorsTotal = metrics.NewCounterVec(
+		metrics.Opts{
+			Name: "http_response_serialization_errors_total",
+			Help: "Total number of responses that failed to encode as JSON",
+		},
+		[]string{"endpoint"},
+	)
+
+	httpRequestDuration = metrics.NewHistogramVec(
+		metrics.Opts{
 			Name: "http_request_duration_seconds",
 			Help: "HTTP request duration in seconds",
 		},
@@ -35,191 +62,151 @@ var (
 )
 
 type Handler struct {
-	logger        *zap.Logger
-	db            *database.DB
+	logger *zap.Logger
+	config atomic.Pointer[config.Config]
+	// startup is the configuration the handler was built with, which settings
+	// that need a restart keep following
+	startup *config.Config
+	db      *database.DB
+	// userStore serves the user routes; it is db unless SetUserStore
+	// replaced it
+	userStore     database.UserStore
 	healthChecker *health.Checker
+	verifier      *verification.Worker
+	tasks         *workers.Pool
+
+	lookupMisses  *ratelimit.MissTracker
+	rateLimiter   *ratelimit.Limiter
+	adminToken    string
+	adminAuth     string
+	serverConfig  ServerConfig
+	logLevel      zap.AtomicLevel
+	operations    *operationTracker
+	background    *backgroundWork
+	outcomes      requestOutcomes
+	policy        *policy.Engine
+	timeline      *timeline.Recorder
+	drain         drainState
+	downstream    *httpclient.Client
+	routeBreakers *routebreaker.Set
+	duplicates    *dedup.Window
+	affinity      *affinity
+	// journal records requests for post-mortems; nil when disabled
+	journal *journal.Journal
+	// dumper writes profile dumps; nil when disabled
+	dumper *dump.Dumper
+
+	users  *Resource[database.User, CreateUserRequest]
+	orders *Resource[database.Order, CreateOrderRequest]
+	// userCache holds users last read from the database for degraded responses
+	userCache *cache.Cache[database.User]
+
+	graphqlSchema graphql.Schema
 }
 
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Code    string `json:"code,omitempty"`
-	Message string `json:"message,omitempty"`
-}
+	Error   string   `json:"error"`
+	Code    string   `json:"code,omitempty"`
+	Message string   `json:"message,omitempty"`
+	Details []string `json:"details,omitempty"`
+
+	// Fields lists each invalid field of a request that failed validation
+	Fields validate.Errors `json:"fields,omitempty"`
 
-type CreateUserRequest struct {
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	Debug *ErrorDebug `json:"debug,omitempty"`
 }
 
-func NewHandler(logger *zap.Logger, db *database.DB, healthChecker *health.Checker) *Handler {
-	return &Handler{
+func NewHandler(logger *zap.Logger, cfg *config.Config, db *database.DB, healthChecker *health.Checker, verifier *verification.Worker, tasks *workers.Pool) *Handler {
+	h := &Handler{
 		logger:        logger,
 		db:            db,
+		userStore:     db,
 		healthChecker: healthChecker,
+		verifier:      verifier,
+		tasks:         tasks,
+		startup:       cfg,
+		lookupMisses: ratelimit.NewMissTracker(
+			cfg.Resilience.LookupMissLimit,
+			cfg.Resilience.LookupMissWindow,
+		),
+		adminToken: cfg.Admin.Token,
+		adminAuth:  cfg.Admin.Auth,
+		operations: newOperationTracker(),
+		background: newBackgroundWork(),
+		rateLimiter: ratelimit.NewLimiter(
+			cfg.Resilience.RateLimitRequests,
+			cfg.Resilience.RateLimitWindow,
+		),
 	}
+	h.config.Store(cfg)
+
+	h.drain.watch()
+	h.timeline = h.newTimelineRecorder()
+	h.policy = h.newPolicyEngine()
+	h.policy.Start()
+	h.downstream = h.newDownstreamClient()
+	h.routeBreakers = routebreaker.New(routeBreakerConfig(cfg.RouteBreaker))
+	dependency.Default.RegisterBreakers(h.routeBreakerStates)
+	h.duplicates = dedup.New()
+	h.affinity = h.newAffinity()
+	h.users = h.newUserResource()
+	h.orders = h.newOrderResource()
+
+	return h
 }
 
-// Health check endpoint for liveness probe
-func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
-	defer cancel()
-
-	response := h.healthChecker.HealthCheck(ctx)
-	
-	statusCode := http.StatusOK
-	if response.Status == health.StatusUnhealthy {
-		statusCode = http.StatusServiceUnavailable
-	} else if response.Status == health.StatusDegraded {
-		statusCode = http.StatusOK // Still healthy enough for liveness
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(response)
+// RegisterResources mounts the routes of every entity resource on the router
+func (h *Handler) RegisterResources(router *mux.Router) {
+	h.users.Register(router)
+	h.orders.Register(router)
 }
 
-// Readiness check endpoint for readiness probe
-func (h *Handler) ReadinessCheck(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-	defer cancel()
-
-	ready := h.healthChecker.ReadinessCheck(ctx)
-	
-	if ready {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	} else {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		w.Write([]byte("Not Ready"))
-	}
-}
-
-// Startup check endpoint for startup probe
-func (h *Handler) StartupCheck(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-	defer cancel()
-
-	started := h.healthChecker.StartupCheck(ctx)
-	
-	if started {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("Started"))
-	} else {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		w.Write([]byte("Starting"))
+// Complete email verification with a token issued by the verification worker
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, "missing_token",
+			"Verification token is required", nil)
+		return
 	}
-}
 
-// Get all users with graceful degradation
-func (h *Handler) GetUsers(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
-	defer cancel()
+	ctx := r.Context()
 
-	users, err := h.db.GetUsers(ctx)
+	user, err := h.userStore.VerifyEmail(ctx, token)
 	if err != nil {
-		h.logger.Error("Failed to get users", zap.Error(err))
-		
-		// Graceful degradation: return cached or minimal data
-		if h.isGracefulDegradationEnabled() {
-			h.logger.Info("Database unavailable, returning fallback user data")
-			fallbackUsers := h.getFallbackUsers()
-			h.writeJSONResponse(w, http.StatusOK, fallbackUsers)
+		if errors.Is(err, database.ErrInvalidToken) {
+			h.writeErrorResponse(w, r, http.StatusNotFound, "invalid_token",
+				"Verification token is invalid or expired", nil)
 			return
 		}
-		
-		h.writeErrorResponse(w, http.StatusInternalServerError, "database_error", 
-			"Unable to retrieve users")
-		return
-	}
 
-	h.writeJSONResponse(w, http.StatusOK, users)
-}
-
-// Get single user by ID
-func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	idStr := vars["id"]
-	
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		h.writeErrorResponse(w, http.StatusBadRequest, "invalid_id", 
-			"User ID must be a valid number")
+		h.log(r).Error("Failed to verify email", zap.Error(err))
+		h.writeErrorResponse(w, r, http.StatusServiceUnavailable, "verification_unavailable",
+			"Email verification temporarily unavailable, please retry", err)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
-	defer cancel()
-
-	user, err := h.db.GetUser(ctx, id)
-	if err != nil {
-		h.logger.Error("Failed to get user", zap.Int("id", id), zap.Error(err))
-		
-		// Graceful degradation
-		if h.isGracefulDegradationEnabled() {
-			fallbackUser := h.getFallbackUser(id)
-			if fallbackUser != nil {
-				h.logger.Info("Database unavailable, returning fallback user data", 
-					zap.Int("id", id))
-				h.writeJSONResponse(w, http.StatusOK, fallbackUser)
-				return
-			}
-		}
-		
-		h.writeErrorResponse(w, http.StatusNotFound, "user_not_found", 
-			"User not found")
-		return
-	}
-
-	h.writeJSONResponse(w, http.StatusOK, user)
+	h.writeJSONResponse(w, r, http.StatusOK, user)
 }
 
-// Create new user
-func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
-	var req CreateUserRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeErrorResponse(w, http.StatusBadRequest, "invalid_json", 
-			"Invalid JSON in request body")
-		return
-	}
+// Get system status including circuit breaker state, as JSON or, for
+// Prometheus scrapers, as gauges. With HEALTH_TOKEN set, callers without it
+// only get the overall health, as from /health.
+func (h *Handler) GetSystemStatus(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 
-	// Validate input
-	if req.Name == "" || req.Email == "" {
-		h.writeErrorResponse(w, http.StatusBadRequest, "missing_fields", 
-			"Name and email are required")
+	healthResponse := h.healthChecker.HealthCheck(ctx)
+	verbose := h.verboseHealth(r)
+	if wantsStatusMetrics(r) {
+		h.writeStatusMetrics(w, r, healthResponse, verbose)
 		return
 	}
-
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
-	defer cancel()
-
-	user, err := h.db.CreateUser(ctx, req.Name, req.Email)
-	if err != nil {
-		h.logger.Error("Failed to create user", 
-			zap.String("name", req.Name), 
-			zap.String("email", req.Email), 
-			zap.Error(err))
-		
-		// In degraded mode, we might not be able to create users
-		if h.isGracefulDegradationEnabled() {
-			h.writeErrorResponse(w, http.StatusServiceUnavailable, "degraded_mode", 
-				"Service is in degraded mode, user creation temporarily unavailable")
-			return
-		}
-		
-		h.writeErrorResponse(w, http.StatusInternalServerError, "creation_failed", 
-			"Failed to create user")
+	if !verbose {
+		h.writeJSONResponse(w, r, http.StatusOK, map[string]interface{}{
+			"health": map[string]health.Status{"status": healthResponse.Status},
+		})
 		return
 	}
-
-	h.writeJSONResponse(w, http.StatusCreated, user)
-}
-
-// Get system status including circuit breaker state
-func (h *Handler) GetSystemStatus(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-	defer cancel()
-
-	healthResponse := h.healthChecker.HealthCheck(ctx)
 	circuitBreakerStats := h.db.GetStats()
 	circuitBreakerState := h.db.GetState()
 	
@@ -231,10 +218,26 @@ func (h *Handler) GetSystemStatus(w http.ResponseWriter, r *http.Request) {
 			"total_successes": circuitBreakerStats.TotalSuccesses,
 			"total_failures":  circuitBreakerStats.TotalFailures,
 		},
-		"features": h.getEnabledFeatures(),
+		// circuit_breaker sums up the read and write breakers
+		"circuit_breakers":  h.db.Breakers(),
+		"database_pools":    h.db.PoolStats(),
+		"database_bulkhead": h.db.BulkheadStats(),
+		"features":          h.getEnabledFeatures(),
+		"policy":            h.policy.Decision(),
+		"memory":            memtune.Current(),
+		"cpu":               cputune.Current(),
+	}
+	if probe, ok := h.db.LastProbe(); ok {
+		status["database_probe"] = probe
+	}
+	if cluster := h.startup.Cluster; cluster != (config.Cluster{}) {
+		status["cluster"] = map[string]string{"name": cluster.Name, "region": cluster.Region}
+	}
+	if h.cfg().FeatureEnabled("route_breaker") {
+		status["route_breakers"] = h.routeBreakers.Statuses()
 	}
 
-	h.writeJSONResponse(w, http.StatusOK, status)
+	h.writeJSONResponse(w, r, http.StatusOK, status)
 }
 
 // Middleware for logging requests
@@ -249,13 +252,22 @@ func (h *Handler) LoggingMiddleware(next http.Handler) http.Handler {
 		
 		duration := time.Since(start)
 		
-		h.logger.Info("HTTP request",
-			zap.String("method", r.Method),
-			zap.String("path", r.URL.Path),
-			zap.String("remote_addr", r.RemoteAddr),
-			zap.Int("status", wrapper.statusCode),
-			zap.Duration("duration", duration),
-		)
+		// Probes arrive every few seconds from every kubelet; they are only
+		// logged at debug, and their fields only built when that is enabled
+		level := zap.InfoLevel
+		if probeRoutes[r.URL.Path] {
+			level = zap.DebugLevel
+		}
+		if entry := h.log(r).Check(level, "HTTP request"); entry != nil {
+			entry.Write(
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.String("query", r.URL.RawQuery),
+				zap.String("remote_addr", r.RemoteAddr),
+				zap.Int("status", servedStatus(r, wrapper.statusCode)),
+				zap.Duration("duration", duration),
+			)
+		}
 	})
 }
 
@@ -267,28 +279,47 @@ func (h *Handler) MetricsMiddleware(next http.Handler) http.Handler {
 		
 		next.ServeHTTP(wrapper, r)
 		
-		duration := time.Since(start).Seconds()
-		endpoint := h.getEndpointLabel(r.URL.Path)
+		elapsed := time.Since(start)
+		duration := elapsed.Seconds()
+		endpoint := h.getEndpointLabel(r)
+		status := servedStatus(r, wrapper.statusCode)
+		h.timeline.ObserveLatency(elapsed)
+		h.outcomes.observe(status)
+		disconnect.Record(r.Context(), endpoint)
 		
 		httpRequestsTotal.WithLabelValues(r.Method, endpoint, 
-			strconv.Itoa(wrapper.statusCode)).Inc()
+			strconv.Itoa(status)).Inc()
 		httpRequestDuration.WithLabelValues(r.Method, endpoint).Observe(duration)
 	})
 }
 
+// statusClientClosedRequest is nginx's status for a request whose client
+// disconnected before the response was written
+const statusClientClosedRequest = 499
+
+// servedStatus is the status a request is recorded with. An abandoned request
+// counts as 499 whatever the handler wrote after its work was canceled, so a
+// client hanging up is not taken for a server error.
+func servedStatus(r *http.Request, statusCode int) int {
+	if disconnect.Abandoned(r.Context()) {
+		return statusClientClosedRequest
+	}
+	return statusCode
+}
+
 // Middleware for panic recovery
 func (h *Handler) RecoveryMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				h.logger.Error("Panic recovered",
+				h.log(r).Error("Panic recovered",
 					zap.Any("error", err),
 					zap.String("path", r.URL.Path),
 					zap.String("method", r.Method),
 				)
-				
-				h.writeErrorResponse(w, http.StatusInternalServerError, "internal_error", 
-					"Internal server error")
+
+				h.writeErrorResponse(w, r, http.StatusInternalServerError, "internal_error",
+					"Internal server error", fmt.Errorf("panic: %v", err))
 			}
 		}()
 		
@@ -298,69 +329,109 @@ func (h *Handler) RecoveryMiddleware(next http.Handler) http.Handler {
 
 // Helper functions
 
-func (h *Handler) writeJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
+// writeJSONResponse encodes into a buffer before sending anything, so an
+// encoding failure (or a panicking MarshalJSON) becomes a clean 500 instead of
+// a truncated body behind an already-sent success status
+func (h *Handler) writeJSONResponse(w http.ResponseWriter, r *http.Request, statusCode int, data interface{}) {
+	// Parsing the query allocates, so it's skipped when there is none
+	pretty := r != nil && r.URL.RawQuery != "" && r.URL.Query().Get("pretty") == "true"
+
+	var body []byte
+	buf, err := encodeJSON(data, pretty)
+	if err == nil {
+		defer buf.release()
+		// A response that can't be redacted isn't sent at all
+		body, err = h.redactResponse(r, buf.Bytes(), pretty)
+	}
+	if err != nil {
+		serializationErrorsTotal.WithLabelValues(h.getEndpointLabel(r)).Inc()
+		h.log(r).Error("Failed to encode JSON response", zap.Error(err))
+
+		body = fallbackErrorBody
+		statusCode = http.StatusInternalServerError
+	} else {
+		body = withServiceNotice(r, body)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
-	if err := json.NewEncoder(w).Encode(data); err != nil {
-		h.logger.Error("Failed to encode JSON response", zap.Error(err))
-	}
+	w.Write(body)
 }
 
-func (h *Handler) writeErrorResponse(w http.ResponseWriter, statusCode int, code, message string) {
+// writeErrorResponse writes the terse error body; cause, breaker state and
+// retry hints are only attached when the request negotiated debug verbosity
+func (h *Handler) writeErrorResponse(w http.ResponseWriter, r *http.Request, statusCode int, code, message string, cause error) {
 	response := ErrorResponse{
 		Error:   http.StatusText(statusCode),
 		Code:    code,
-		Message: message,
+		Message: localizedMessage(w, r, code, message),
+	}
+	if h.wantsDebugErrors(r) {
+		response.Debug = h.newErrorDebug(w, r, statusCode, cause)
 	}
-	h.writeJSONResponse(w, statusCode, response)
+	h.writeJSONResponse(w, r, statusCode, response)
 }
 
-func (h *Handler) isGracefulDegradationEnabled() bool {
-	features := h.getEnabledFeatures()
-	for _, feature := range features {
-		if feature == "graceful_degradation" {
-			return true
-		}
+// writeValidationError answers 400 validation_failed for input err rejected,
+// listing each invalid field when err is a validate.Errors
+func (h *Handler) writeValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	response := ErrorResponse{
+		Error:   http.StatusText(http.StatusBadRequest),
+		Code:    "validation_failed",
+		Message: localizedMessage(w, r, "validation_failed", err.Error()),
+	}
+	errors.As(err, &response.Fields)
+	if h.wantsDebugErrors(r) {
+		response.Debug = h.newErrorDebug(w, r, http.StatusBadRequest, nil)
 	}
-	return false
+	h.writeJSONResponse(w, r, http.StatusBadRequest, response)
 }
 
-func (h *Handler) getEnabledFeatures() []string {
-	// This would typically come from a feature flag service
-	// For demo purposes, we'll use environment variables
-	features := []string{"graceful_degradation", "circuit_breaker", "metrics"}
-	return features
+// localizedMessage returns the catalog's translation of the error code when
+// the request prefers a language other than English, and message, the
+// handler's own English one, otherwise
+func localizedMessage(w http.ResponseWriter, r *http.Request, code, message string) string {
+	if r == nil || r.Header.Get("Accept-Language") == "" {
+		return message
+	}
+	translated, locale, ok := i18n.Lookup("error."+code, r.Header.Get("Accept-Language"))
+	if !ok || locale == i18n.DefaultLocale {
+		return message
+	}
+	w.Header().Set("Content-Language", locale)
+	return translated
 }
 
-func (h *Handler) getFallbackUsers() []database.User {
-	// Return cached or static fallback data
-	return []database.User{
-		{
-			ID:        1,
-			Name:      "Fallback User",
-			Email:     "fallback@example.com",
-			CreatedAt: time.Now().Add(-24 * time.Hour),
-		},
-	}
+// isGracefulDegradationEnabled reports whether the resilience policy currently
+// allows serving fallback data
+func (h *Handler) isGracefulDegradationEnabled() bool {
+	return h.policy.Decision().AllowFallback
 }
 
-func (h *Handler) getFallbackUser(id int) *database.User {
-	// Return cached or static fallback data for specific user
-	if id == 1 {
-		return &database.User{
-			ID:        1,
-			Name:      "Fallback User",
-			Email:     "fallback@example.com",
-			CreatedAt: time.Now().Add(-24 * time.Hour),
+// getEnabledFeatures returns FEATURE_FLAGS as currently configured; check a
+// single flag with h.cfg().FeatureEnabled
+func (h *Handler) getEnabledFeatures() []string {
+	return append([]string{}, h.cfg().Features...)
+}
+
+// getEndpointLabel names the endpoint of r for metrics by the path template of
+// its route, e.g. "/api/users/{id}/export" for it and its /api/v1 alias, so
+// ids never become label values
+func (h *Handler) getEndpointLabel(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return unversionedPath(template)
 		}
 	}
-	return nil
-}
 
-func (h *Handler) getEndpointLabel(path string) string {
-	// Normalize paths for metrics
-	if strings.HasPrefix(path, "/api/users/") {
-		return "/api/users/{id}"
+	// Unrouted paths are normalized: /api/{resource}/{id}
+	path := unversionedPath(r.URL.Path)
+	parts := strings.Split(path, "/")
+	if len(parts) == 4 && parts[1] == "api" && parts[3] != "" {
+		return "/api/" + parts[2] + "/{id}"
 	}
 	return path
 }
@@ -374,4 +445,9 @@ type responseWriterWrapper struct {
 func (rw *responseWriterWrapper) WriteHeader(code int) {
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController (flushing, deadlines)
+func (rw *responseWriterWrapper) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
 } 
\ No newline at end of file
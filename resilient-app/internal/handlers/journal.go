@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/demo/resilient-app/internal/ctxkeys"
+	"github.com/demo/resilient-app/internal/journal"
+)
+
+// SetJournal hands the handler the request journal JournalMiddleware records
+// to. It must be called before the handler serves requests.
+func (h *Handler) SetJournal(j *journal.Journal) {
+	h.journal = j
+}
+
+// Middleware that records each request in the on-disk journal when it starts
+// and again when it is served, so a crash leaves behind what the process was
+// serving, in-flight requests included. Probes would crowd everything else
+// out of the ring and aren't recorded.
+func (h *Handler) JournalMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.journal == nil || probeRoutes[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		requestID, _ := ctxkeys.RequestID.Lookup(r.Context())
+		entry := h.journal.Begin(journal.Entry{
+			Start:     time.Now(),
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			RequestID: requestID,
+		})
+		wrapper := &responseWriterWrapper{ResponseWriter: w, statusCode: http.StatusOK}
+
+		next.ServeHTTP(wrapper, r)
+
+		entry.Status = servedStatus(r, wrapper.statusCode)
+		entry.Duration = time.Since(entry.Start)
+		h.journal.Finish(entry)
+	})
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// runtimeLogLevels are the levels operators may switch to at runtime
+var runtimeLogLevels = []zapcore.Level{zapcore.DebugLevel, zapcore.InfoLevel, zapcore.WarnLevel}
+
+// LogLevelRequest is the body of PUT /admin/loglevel
+type LogLevelRequest struct {
+	Level string `json:"level"`
+}
+
+// SetLogLevel hands the handler the logger's level so /admin/loglevel can
+// change it
+func (h *Handler) SetLogLevel(level zap.AtomicLevel) {
+	h.logLevel = level
+}
+
+// Get the current log level
+func (h *Handler) GetLogLevel(w http.ResponseWriter, r *http.Request) {
+	h.writeJSONResponse(w, r, http.StatusOK, map[string]string{"level": h.logLevel.String()})
+}
+
+// Switch the log level between debug, info and warn without a redeploy, e.g.
+// to get debug logs during an incident. The level holds until LOG_LEVEL
+// changes in a configuration reload or the pod restarts.
+func (h *Handler) UpdateLogLevel(w http.ResponseWriter, r *http.Request) {
+	var input LogLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, "invalid_json",
+			"Invalid JSON in request body", err)
+		return
+	}
+
+	level, err := zapcore.ParseLevel(input.Level)
+	if err != nil || !allowedRuntimeLevel(level) {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, "invalid_level",
+			"level must be one of debug, info or warn", nil)
+		return
+	}
+
+	previous := h.logLevel.Level()
+	h.logLevel.SetLevel(level)
+	// Warn, so the change is logged whatever the new level
+	h.log(r).Warn("Log level changed",
+		zap.Stringer("from", previous),
+		zap.Stringer("to", level),
+	)
+	h.writeJSONResponse(w, r, http.StatusOK, map[string]string{
+		"level":    level.String(),
+		"previous": previous.String(),
+	})
+}
+
+func allowedRuntimeLevel(level zapcore.Level) bool {
+	for _, allowed := range runtimeLogLevels {
+		if level == allowed {
+			return true
+		}
+	}
+	return false
+}
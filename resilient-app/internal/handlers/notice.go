@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/demo/resilient-app/internal/ctxkeys"
+	"github.com/demo/resilient-app/internal/notice"
+)
+
+const serviceNoticeHeader = "X-Service-Notice"
+
+// serviceNoticeKey carries the notice for the request's responses
+var serviceNoticeKey = ctxkeys.New[notice.Notice]("service_notice")
+
+// currentNoticeCode is the notice the resilience policy asks for. Shedding
+// load tells users so when the policy doesn't say anything itself.
+func (h *Handler) currentNoticeCode() string {
+	decision := h.policy.Decision()
+	if decision.Notice == "" && decision.ShedFraction > 0 {
+		return notice.HighLoad
+	}
+	return decision.Notice
+}
+
+// Middleware that attaches the resilience policy's notice to API responses,
+// so frontends can tell users the service is degraded without knowing why.
+// Every response then names the notice's code in X-Service-Notice, and JSON
+// objects gain a service_notice field with the message in the language of
+// the request's Accept-Language. Lists are arrays and only get the header.
+func (h *Handler) ServiceNoticeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code := h.currentNoticeCode()
+		if code == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set(serviceNoticeHeader, code)
+		w.Header().Add("Vary", "Accept-Language")
+		n := notice.Localize(code, r.Header.Get("Accept-Language"))
+		next.ServeHTTP(w, r.WithContext(serviceNoticeKey.With(r.Context(), n)))
+	})
+}
+
+// withServiceNotice returns body, a JSON response, with the request's notice
+// added as its first field when it is an object
+func withServiceNotice(r *http.Request, body []byte) []byte {
+	if r == nil || len(body) == 0 || body[0] != '{' {
+		return body
+	}
+	n, ok := serviceNoticeKey.Lookup(r.Context())
+	if !ok {
+		return body
+	}
+	field, err := json.Marshal(n)
+	if err != nil {
+		return body
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(body) + len(field) + 20)
+	buf.WriteString(`{"service_notice":`)
+	buf.Write(field)
+	if rest := bytes.TrimLeft(body[1:], " \t\r\n"); len(rest) == 0 || rest[0] != '}' {
+		buf.WriteByte(',')
+	}
+	buf.Write(body[1:])
+	return buf.Bytes()
+}
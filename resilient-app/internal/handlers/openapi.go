@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+
+	"github.com/demo/resilient-app/internal/metrics"
+	"github.com/demo/resilient-app/internal/openapi"
+	"go.uber.org/zap"
+)
+
+var openapiViolationsTotal = metrics.NewCounterVec(
+	metrics.Opts{
+		Name: "openapi_violations_total",
+		Help: "Total number of payloads that did not match the OpenAPI spec",
+	},
+	[]string{"endpoint", "direction"},
+)
+
+// Serve the OpenAPI document the API is validated against
+func (h *Handler) OpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openapi.Spec)
+}
+
+// OpenAPIValidationMiddleware rejects requests that don't match the spec with
+// a detailed 422. When validateResponses is set (dev mode), responses are also
+// checked and contract drift is logged and counted; the response itself is
+// still delivered unchanged so the check can't break clients.
+func (h *Handler) OpenAPIValidationMiddleware(validator *openapi.Validator, validateResponses bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			endpoint := h.getEndpointLabel(r)
+
+			input, err := validator.ValidateRequest(r.Context(), r)
+			if errors.Is(err, openapi.ErrUnknownRoute) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err != nil {
+				openapiViolationsTotal.WithLabelValues(endpoint, "request").Inc()
+				h.writeJSONResponse(w, r, http.StatusUnprocessableEntity, ErrorResponse{
+					Error:   http.StatusText(http.StatusUnprocessableEntity),
+					Code:    "validation_failed",
+					Message: localizedMessage(w, r, "validation_failed", "Request does not match the API specification"),
+					Details: openapi.Details(err),
+				})
+				return
+			}
+
+			if !validateResponses {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			recorder := &teeResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+
+			err = validator.ValidateResponse(r.Context(), input, recorder.statusCode, w.Header(), recorder.body.Bytes())
+			if err != nil {
+				openapiViolationsTotal.WithLabelValues(endpoint, "response").Inc()
+				h.log(r).Warn("Response does not match the API specification",
+					zap.String("method", r.Method),
+					zap.String("path", r.URL.Path),
+					zap.Int("status", recorder.statusCode),
+					zap.Strings("details", openapi.Details(err)),
+				)
+			}
+		})
+	}
+}
+
+// Response writer that passes everything through while keeping a copy of the body
+type teeResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (tw *teeResponseWriter) WriteHeader(code int) {
+	tw.statusCode = code
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *teeResponseWriter) Write(b []byte) (int, error) {
+	tw.body.Write(b)
+	return tw.ResponseWriter.Write(b)
+}
+
+func (tw *teeResponseWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/demo/resilient-app/internal/database"
+	"github.com/demo/resilient-app/internal/logging"
+	"github.com/demo/resilient-app/internal/saga"
+	"github.com/demo/resilient-app/internal/validate"
+	"go.uber.org/zap"
+)
+
+type CreateOrderRequest struct {
+	UserID   int    `json:"user_id" validate:"required,min=1"`
+	Product  string `json:"product" validate:"required,max=255"`
+	Quantity int    `json:"quantity" validate:"required,min=1"`
+}
+
+// orderStore adapts the database order operations to the Store contract
+type orderStore struct {
+	logger *zap.Logger
+	db     *database.DB
+}
+
+func (s orderStore) List(ctx context.Context) ([]database.Order, error) {
+	return s.db.GetOrders(ctx)
+}
+
+func (s orderStore) Get(ctx context.Context, id int) (*database.Order, error) {
+	return s.db.GetOrder(ctx, id)
+}
+
+func (s orderStore) Stream(ctx context.Context, limit int, fn func(database.Order) error) error {
+	return s.db.StreamOrders(ctx, limit, fn)
+}
+
+// Create places an order as a saga: the order is written first, then the
+// user's quota is consumed. If consuming the quota fails, the order is deleted.
+func (s orderStore) Create(ctx context.Context, req CreateOrderRequest) (*database.Order, error) {
+	var order *database.Order
+
+	placeOrder := saga.New(logging.FromContext(ctx, s.logger), s.db, "place_order",
+		saga.Step{
+			Name: "create_order",
+			Action: func(ctx context.Context) error {
+				var err error
+				order, err = s.db.CreateOrder(ctx, req.UserID, req.Product, req.Quantity)
+				return err
+			},
+			Compensate: func(ctx context.Context) error {
+				return s.db.DeleteOrder(ctx, order.ID)
+			},
+		},
+		saga.Step{
+			Name: "consume_quota",
+			Action: func(ctx context.Context) error {
+				return s.db.ConsumeOrderQuota(ctx, req.UserID, req.Quantity)
+			},
+			Compensate: func(ctx context.Context) error {
+				return s.db.RestoreOrderQuota(ctx, req.UserID, req.Quantity)
+			},
+		},
+	)
+
+	if err := placeOrder.Execute(ctx); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+func (h *Handler) newOrderResource() *Resource[database.Order, CreateOrderRequest] {
+	orders := NewResource[database.Order, CreateOrderRequest](h, "orders", "order",
+		orderStore{logger: h.logger, db: h.db})
+	orders.Validate = validateCreateOrder
+	orders.ClientErrors = []ClientError{
+		{
+			Err:     database.ErrQuotaExceeded,
+			Status:  http.StatusConflict,
+			Code:    "quota_exceeded",
+			Message: "User has no order quota left",
+		},
+	}
+	return orders
+}
+
+// List recent sagas so failed or stuck multi-step operations can be inspected
+func (h *Handler) GetSagas(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	states, err := h.db.GetSagaStates(ctx, r.URL.Query().Get("status"))
+	if err != nil {
+		h.log(r).Error("Failed to get sagas", zap.Error(err))
+		h.writeErrorResponse(w, r, http.StatusServiceUnavailable, "database_error",
+			"Unable to retrieve sagas", err)
+		return
+	}
+
+	h.writeJSONResponse(w, r, http.StatusOK, states)
+}
+
+func validateCreateOrder(req CreateOrderRequest) error {
+	return validate.Struct(req)
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/demo/resilient-app/internal/metrics"
+	"github.com/demo/resilient-app/internal/policy"
+)
+
+var loadShedTotal = metrics.NewCounterVec(
+	metrics.Opts{
+		Name: "http_load_shed_total",
+		Help: "Total number of requests rejected by the load-shedding policy",
+	},
+	[]string{"endpoint"},
+)
+
+// requestOutcomes counts responses between policy evaluations
+type requestOutcomes struct {
+	total  atomic.Uint64
+	errors atomic.Uint64
+}
+
+func (o *requestOutcomes) observe(statusCode int) {
+	o.total.Add(1)
+	if statusCode >= http.StatusInternalServerError {
+		o.errors.Add(1)
+	}
+}
+
+// drain returns the counts since the last call and resets them
+func (o *requestOutcomes) drain() (total, errors uint64) {
+	return o.total.Swap(0), o.errors.Swap(0)
+}
+
+// newPolicyEngine evaluates the resilience policy at POLICY_URL (an OPA Data
+// API endpoint) when configured, and the builtin policy otherwise
+func (h *Handler) newPolicyEngine() *policy.Engine {
+	cfg := h.cfg().Policy
+
+	var external policy.Evaluator
+	if cfg.URL != "" {
+		external = policy.OPA{URL: cfg.URL, Client: &http.Client{Timeout: cfg.Timeout}}
+	}
+
+	builtin := policy.Builtin{GracefulDegradation: func() bool {
+		return h.cfg().FeatureEnabled("graceful_degradation")
+	}}
+
+	return policy.NewEngine(h.logger, external, builtin, h.policyInput, cfg.Interval, cfg.Timeout)
+}
+
+func (h *Handler) policyInput() policy.Input {
+	stats := h.db.GetStats()
+	total, errors := h.outcomes.drain()
+
+	input := policy.Input{
+		Health:          string(h.healthChecker.LastStatus()),
+		BreakerState:    h.db.GetState().String(),
+		BreakerRequests: stats.Requests,
+		BreakerFailures: stats.TotalFailures,
+		Requests:        total,
+	}
+	if total > 0 {
+		input.ErrorRate = float64(errors) / float64(total)
+	}
+	return input
+}
+
+// Middleware that rejects the fraction of API requests the policy asks to shed,
+// before they consume a rate-limit slot or a database connection
+func (h *Handler) LoadSheddingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if shed := h.policy.Decision().ShedFraction; shed > 0 && rand.Float64() < shed {
+			loadShedTotal.WithLabelValues(h.getEndpointLabel(r)).Inc()
+			w.Header().Set("Retry-After", "1")
+			h.writeErrorResponse(w, r, http.StatusServiceUnavailable, "load_shed",
+				"Service is shedding load, please retry shortly", nil)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Stop halts the handler's background work
+func (h *Handler) Stop(ctx context.Context) error {
+	return errors.Join(h.background.stop(ctx), h.policy.Stop(ctx))
+}
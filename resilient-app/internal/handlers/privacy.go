@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/demo/resilient-app/internal/database"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// Export everything stored about a user, e.g. for a GDPR access request: the
+// user, a soft-deleted one included, its orders and its verification tokens,
+// without their values. It is an admin endpoint, as the export holds
+// everything stored about the person. Fields RESPONSE_REDACT_FIELDS hides stay
+// hidden.
+func (h *Handler) ExportUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, "invalid_id",
+			"User ID must be a valid number", nil)
+		return
+	}
+
+	data, err := h.db.ExportUserData(r.Context(), id)
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		h.writeErrorResponse(w, r, http.StatusNotFound, "user_not_found", "User not found", nil)
+		return
+	case err != nil:
+		h.log(r).Error("Failed to export user data", zap.Int("id", id), zap.Error(err))
+		h.writeErrorResponse(w, r, http.StatusServiceUnavailable, "database_error",
+			"Unable to export user data", err)
+		return
+	}
+
+	h.writeJSONResponse(w, r, http.StatusOK, data)
+}
+
+// Erase a user and everything stored about it, e.g. for a GDPR erasure
+// request. Unlike DELETE /api/users/{id} nothing is kept: its orders and
+// verification tokens go too, and the fallback cache of every pod forgets it
+// (see PurgeErasedUsers). The erasure runs in the background and responds 202
+// at once; poll /admin/operations/{id} for its result.
+func (h *Handler) EraseUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, "invalid_id",
+			"User ID must be a valid number", nil)
+		return
+	}
+
+	op := h.operations.start("user-erasure")
+	accepted := *op
+	logger := h.log(r).With(zap.String("operation", op.ID), zap.Int("user_id", id))
+	logger.Info("Starting user erasure")
+
+	h.background.run(func(ctx context.Context) {
+		ctx, cancel := context.WithTimeout(ctx, adminOperationTimeout)
+		defer cancel()
+
+		rows, err := h.db.EraseUser(ctx, id)
+		if err == nil {
+			// Reads no longer find the user, so nothing puts it back. Other
+			// pods hear of it through PurgeErasedUsers.
+			h.userCache.Delete(strconv.Itoa(id))
+			h.operations.progress(op, rows)
+		}
+		h.operations.finish(op, err)
+		if err != nil {
+			logger.Error("User erasure failed", zap.Error(err))
+			return
+		}
+		logger.Info("User erasure completed", zap.Int("rows", rows))
+	})
+
+	w.Header().Set("X-Operation-ID", accepted.ID)
+	h.writeJSONResponse(w, r, http.StatusAccepted, accepted)
+}
+
+// PurgeErasedUsers drops users erased by any pod from this pod's fallback
+// cache, in the background once the database is connected, so no pod keeps
+// serving an erased user's data when the database is degraded
+func (h *Handler) PurgeErasedUsers() {
+	h.background.run(func(ctx context.Context) {
+		select {
+		case <-h.db.Connected():
+		case <-ctx.Done():
+			return
+		}
+
+		h.db.ListenUserErasures(ctx, func(id int) {
+			h.userCache.Delete(strconv.Itoa(id))
+			h.logger.Debug("Erased user purged from the fallback cache", zap.Int("user_id", id))
+		})
+	})
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/demo/resilient-app/internal/health"
+)
+
+// Probe responses are built once. Kubelets probe every replica every few
+// seconds, so at hundreds of replicas these handlers run more than any other;
+// the header values and bodies are shared, read-only, across requests.
+var (
+	probeJSONContentType = []string{"application/json"}
+	probeTextContentType = []string{"text/plain; charset=utf-8"}
+
+	probeOK       = []byte("OK")
+	probeNotReady = []byte("Not Ready")
+	probeStarted  = []byte("Started")
+	probeStarting = []byte("Starting")
+)
+
+// healthTokenHeader carries HEALTH_TOKEN from monitors trusted with the full
+// health report
+const healthTokenHeader = "X-Health-Token"
+
+// minimalHealth are the /health bodies of callers without the health token:
+// the status alone, without dependency endpoints, breaker counts or errors
+var minimalHealth = map[health.Status][]byte{
+	health.StatusHealthy:   []byte(`{"status":"healthy"}` + "\n"),
+	health.StatusDegraded:  []byte(`{"status":"degraded"}` + "\n"),
+	health.StatusUnhealthy: []byte(`{"status":"unhealthy"}` + "\n"),
+}
+
+// verboseHealth reports whether r may see the full health report: anyone may
+// while HEALTH_TOKEN is unset, otherwise only a caller sending it
+func (h *Handler) verboseHealth(r *http.Request) bool {
+	token := h.cfg().Health.Token
+	if token == "" {
+		return true
+	}
+	sent := r.Header.Get(healthTokenHeader)
+	return subtle.ConstantTimeCompare([]byte(sent), []byte(token)) == 1
+}
+
+func (h *Handler) writeHealthTokenRequired(w http.ResponseWriter, r *http.Request) {
+	h.writeErrorResponse(w, r, http.StatusUnauthorized, "health_token_required",
+		"Send HEALTH_TOKEN in "+healthTokenHeader+" to see this", nil)
+}
+
+// probeRoutes are the paths kubelets poll; their requests are logged at debug
+var probeRoutes = map[string]bool{
+	"/health":  true,
+	"/ready":   true,
+	"/startup": true,
+}
+
+// Health check endpoint for liveness probe. It serves the background health
+// check's result, serialized when it was taken, and only runs the checks
+// itself when that result is stale or the request has a query, such as
+// ?pretty=true. With HEALTH_TOKEN set, callers without it, kubelets
+// included, only get the status, so dependency internals aren't exposed to
+// anyone who can reach the pod IP.
+func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
+	verbose := h.verboseHealth(r)
+	if snapshot, ok := h.healthChecker.Latest(); ok && (r.URL.RawQuery == "" || !verbose) {
+		body := snapshot.Body
+		if !verbose {
+			body = minimalHealth[snapshot.Status]
+		}
+		writeProbe(w, livenessStatus(snapshot.Status), probeJSONContentType, body)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	response := h.healthChecker.HealthCheck(ctx)
+	if !verbose {
+		writeProbe(w, livenessStatus(response.Status), probeJSONContentType, minimalHealth[response.Status])
+		return
+	}
+	h.writeJSONResponse(w, r, livenessStatus(response.Status), response)
+}
+
+// Degraded is still healthy enough for liveness
+func livenessStatus(status health.Status) int {
+	if status == health.StatusUnhealthy {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
+
+// Readiness check endpoint for readiness probe. It is answered from the
+// background health check, so it neither waits on nor loads the database.
+func (h *Handler) ReadinessCheck(w http.ResponseWriter, r *http.Request) {
+	if h.healthChecker.ReadinessCheck() {
+		writeProbe(w, http.StatusOK, probeTextContentType, probeOK)
+	} else {
+		writeProbe(w, http.StatusServiceUnavailable, probeTextContentType, probeNotReady)
+	}
+}
+
+// Startup check endpoint for startup probe
+func (h *Handler) StartupCheck(w http.ResponseWriter, r *http.Request) {
+	if h.healthChecker.StartupCheck() {
+		writeProbe(w, http.StatusOK, probeTextContentType, probeStarted)
+	} else {
+		writeProbe(w, http.StatusServiceUnavailable, probeTextContentType, probeStarting)
+	}
+}
+
+// writeProbe writes a prebuilt response. Assigning the header slice, unlike
+// Header().Set, doesn't allocate.
+func writeProbe(w http.ResponseWriter, statusCode int, contentType []string, body []byte) {
+	w.Header()["Content-Type"] = contentType
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
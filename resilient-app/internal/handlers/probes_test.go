@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/demo/resilient-app/internal/config"
+	"github.com/demo/resilient-app/internal/database"
+	"github.com/demo/resilient-app/internal/health"
+	"go.uber.org/zap"
+)
+
+// probeWriter is a ResponseWriter reused across iterations, so benchmarks
+// count the handler's allocations rather than a recorder's
+type probeWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *probeWriter) Header() http.Header         { return w.header }
+func (w *probeWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *probeWriter) WriteHeader(status int)      { w.status = status }
+
+// probeChecker is a health checker whose database can't be reached, so
+// probes are answered without Postgres: liveness from the background check's
+// snapshot, readiness and startup from the startup gate, which never opens.
+// The started paths are benchmarked on the checker in internal/health. The
+// database registers itself process-wide, so there is one for every
+// benchmark and test.
+var probeChecker = sync.OnceValues(func() (*health.Checker, error) {
+	cfg, err := probeConfig(nil)
+	if err != nil {
+		return nil, err
+	}
+	logger := zap.NewNop()
+	db, err := database.NewConnection(context.Background(), logger, cfg.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	checker := health.NewChecker(logger, db, cfg)
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, ok := checker.Latest(); ok {
+			return checker, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.New("no background health check to serve")
+		}
+	}
+})
+
+// probeConfig is the default configuration with env set, and a database
+// that refuses connections
+func probeConfig(env map[string]string) (*config.Config, error) {
+	return config.Load(func(key string) (string, bool) {
+		switch key {
+		case "DB_HOST":
+			return "127.0.0.1", true
+		case "DB_PORT":
+			return "1", true
+		}
+		value, ok := env[key]
+		return value, ok
+	})
+}
+
+func newProbeHandler(tb testing.TB, env map[string]string) *Handler {
+	tb.Helper()
+	checker, err := probeChecker()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	cfg, err := probeConfig(env)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	h := &Handler{logger: zap.NewNop(), healthChecker: checker}
+	h.config.Store(cfg)
+	return h
+}
+
+func BenchmarkLiveness(b *testing.B) {
+	benchmarks := []struct {
+		name  string
+		env   map[string]string
+		token string
+	}{
+		{name: "report", env: map[string]string{}},
+		{name: "status only", env: map[string]string{"HEALTH_TOKEN": "secret"}},
+		{name: "report with token", env: map[string]string{"HEALTH_TOKEN": "secret"}, token: "secret"},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			h := newProbeHandler(b, bm.env)
+			r := httptest.NewRequest("GET", "/health", nil)
+			if bm.token != "" {
+				r.Header.Set(healthTokenHeader, bm.token)
+			}
+			w := &probeWriter{header: http.Header{}}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				h.HealthCheck(w, r)
+			}
+		})
+	}
+}
+
+func BenchmarkReadiness(b *testing.B) {
+	h := newProbeHandler(b, map[string]string{})
+	r := httptest.NewRequest("GET", "/ready", nil)
+	w := &probeWriter{header: http.Header{}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.ReadinessCheck(w, r)
+	}
+}
+
+func BenchmarkStartup(b *testing.B) {
+	h := newProbeHandler(b, map[string]string{})
+	r := httptest.NewRequest("GET", "/startup", nil)
+	w := &probeWriter{header: http.Header{}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.StartupCheck(w, r)
+	}
+}
+
+// Kubelets probe readiness and startup on every replica every few seconds,
+// so answering them must not allocate
+func TestProbesDontAllocate(t *testing.T) {
+	h := newProbeHandler(t, map[string]string{})
+	probes := map[string]http.HandlerFunc{
+		"/ready":   h.ReadinessCheck,
+		"/startup": h.StartupCheck,
+	}
+	for path, probe := range probes {
+		r := httptest.NewRequest("GET", path, nil)
+		w := &probeWriter{header: http.Header{}}
+		if allocs := testing.AllocsPerRun(100, func() { probe(w, r) }); allocs != 0 {
+			t.Errorf("%s allocates %v times per request, want 0", path, allocs)
+		}
+	}
+}
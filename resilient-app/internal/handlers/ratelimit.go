@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/demo/resilient-app/internal/metrics"
+)
+
+var rateLimitedTotal = metrics.NewCounterVec(
+	metrics.Opts{
+		Name: "http_rate_limited_total",
+		Help: "Total number of requests rejected by the inbound rate limiter",
+	},
+	[]string{"endpoint"},
+)
+
+// Middleware that enforces the per-client request quota and advertises it via
+// the draft IETF RateLimit-Limit/Remaining/Reset headers on every response, so
+// clients can slow down before they are rejected with 429
+func (h *Handler) RateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.rateLimiter.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		quota := h.rateLimiter.Take(clientIP(r))
+		reset := strconv.Itoa(int(math.Ceil(quota.Reset.Seconds())))
+
+		// A saturated database bulkhead lowers what's left, so clients back
+		// off before their queries are turned away
+		remaining := quota.Remaining
+		if bulkhead := h.db.BulkheadStats(); bulkhead.MaxConcurrent > 0 {
+			remaining = min(remaining, bulkhead.Free())
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(quota.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("RateLimit-Reset", reset)
+
+		if !quota.Allowed {
+			rateLimitedTotal.WithLabelValues(h.getEndpointLabel(r)).Inc()
+			w.Header().Set("Retry-After", reset)
+			h.writeErrorResponse(w, r, http.StatusTooManyRequests, "rate_limited",
+				"Request quota exceeded, please slow down", nil)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
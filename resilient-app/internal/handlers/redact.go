@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/demo/resilient-app/internal/ctxkeys"
+	"github.com/demo/resilient-app/internal/logging"
+	"github.com/demo/resilient-app/internal/metrics"
+)
+
+var redactedFieldsTotal = metrics.NewCounterVec(
+	metrics.Opts{
+		Name: "response_fields_redacted_total",
+		Help: "Total number of response field values redacted for callers lacking the scope to see them, by field",
+	},
+	[]string{"field"},
+)
+
+// Middleware that records the claims of API callers sending the ADMIN_TOKEN
+// bearer, so they see the fields RESPONSE_REDACT_FIELDS hides from everyone
+// else. No caller is turned away; the API stays public, and claims an auth
+// plugin already recorded are kept.
+func (h *Handler) APIClaimsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := ctxkeys.Claims.Lookup(r.Context()); ok || h.adminToken == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if found && subtle.ConstantTimeCompare([]byte(token), []byte(h.adminToken)) == 1 {
+			r = r.WithContext(ctxkeys.Claims.With(r.Context(), tokenAdmin))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// hiddenFields returns the fields of RESPONSE_REDACT_FIELDS in body whose
+// scope the caller's claims don't grant, nil if there are none
+func (h *Handler) hiddenFields(r *http.Request, body []byte) map[string]bool {
+	fields := h.cfg().Redaction.Fields
+	if len(fields) == 0 {
+		return nil
+	}
+	var claims ctxkeys.ClaimSet
+	if r != nil {
+		claims, _ = ctxkeys.Claims.Lookup(r.Context())
+	}
+
+	var hidden map[string]bool
+	for field, scope := range fields {
+		// A cheap scan skips decoding responses without the field
+		if claims.Has(scope) || !bytes.Contains(body, []byte(`"`+field+`"`)) {
+			continue
+		}
+		if hidden == nil {
+			hidden = make(map[string]bool)
+		}
+		hidden[field] = true
+	}
+	return hidden
+}
+
+// redactResponse returns body, a JSON response, with the values of the
+// fields the caller may not see replaced, at any depth. The fields keep their
+// place, so the response keeps its shape.
+func (h *Handler) redactResponse(r *http.Request, body []byte, pretty bool) ([]byte, error) {
+	hidden := h.hiddenFields(r, body)
+	if hidden == nil {
+		return body, nil
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(body))
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	redacted := make(map[string]int)
+	if err := redactValue(dec, &out, hidden, redacted); err != nil {
+		return nil, fmt.Errorf("redacting response: %w", err)
+	}
+	if len(redacted) == 0 {
+		return body, nil
+	}
+	for field, n := range redacted {
+		redactedFieldsTotal.WithLabelValues(field).Add(float64(n))
+	}
+
+	if pretty {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, out.Bytes(), "", "  "); err != nil {
+			return nil, fmt.Errorf("redacting response: %w", err)
+		}
+		out = indented
+	}
+	// Like the encoder's output, the body ends in a newline
+	if bytes.HasSuffix(body, []byte("\n")) {
+		out.WriteByte('\n')
+	}
+	return out.Bytes(), nil
+}
+
+// redactValue copies the next JSON value from dec to out in compact form,
+// replacing the values of hidden fields and counting them in redacted
+func redactValue(dec *json.Decoder, out *bytes.Buffer, hidden map[string]bool, redacted map[string]int) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		out.WriteByte('{')
+		for first := true; dec.More(); first = false {
+			if !first {
+				out.WriteByte(',')
+			}
+			key, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			if err := writeJSONToken(out, key); err != nil {
+				return err
+			}
+			out.WriteByte(':')
+
+			name, _ := key.(string)
+			if !hidden[name] {
+				if err := redactValue(dec, out, hidden, redacted); err != nil {
+					return err
+				}
+				continue
+			}
+			var skipped json.RawMessage
+			if err := dec.Decode(&skipped); err != nil {
+				return err
+			}
+			if err := writeJSONToken(out, logging.Redacted); err != nil {
+				return err
+			}
+			redacted[name]++
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		out.WriteByte('}')
+	case json.Delim('['):
+		out.WriteByte('[')
+		for first := true; dec.More(); first = false {
+			if !first {
+				out.WriteByte(',')
+			}
+			if err := redactValue(dec, out, hidden, redacted); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		out.WriteByte(']')
+	default:
+		return writeJSONToken(out, token)
+	}
+	return nil
+}
+
+// writeJSONToken writes a scalar token as JSON; numbers were decoded as
+// json.Number, so they are written as they came
+func writeJSONToken(out *bytes.Buffer, token json.Token) error {
+	value, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	out.Write(value)
+	return nil
+}
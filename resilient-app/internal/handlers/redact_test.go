@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/demo/resilient-app/internal/config"
+	"github.com/demo/resilient-app/internal/ctxkeys"
+)
+
+// escapeHTML writes "<" and ">" in want as encoding/json does, like the
+// response encoder
+func escapeHTML(want string) string {
+	return strings.NewReplacer("<", `\u003c`, ">", `\u003e`).Replace(want)
+}
+
+func TestRedactResponse(t *testing.T) {
+	h := &Handler{}
+	h.config.Store(&config.Config{Redaction: config.Redaction{Fields: map[string]string{
+		"email": config.DefaultRedactScope,
+		"notes": "notes:read",
+	}}})
+
+	body := []byte(`{"users":[{"id":1,"email":"jane@example.com","score":1.50}],"notes":{"text":"vip"}}` + "\n")
+	tests := []struct {
+		name   string
+		claims *ctxkeys.ClaimSet
+		want   string
+	}{
+		{
+			name: "no claims",
+			want: `{"users":[{"id":1,"email":"<redacted>","score":1.50}],"notes":"<redacted>"}` + "\n",
+		},
+		{
+			name:   "without the scope",
+			claims: &ctxkeys.ClaimSet{Subject: "reader", Scopes: []string{"users:read"}},
+			want:   `{"users":[{"id":1,"email":"<redacted>","score":1.50}],"notes":"<redacted>"}` + "\n",
+		},
+		{
+			name:   "with one field's scope",
+			claims: &ctxkeys.ClaimSet{Subject: "support", Scopes: []string{config.DefaultRedactScope}},
+			want:   `{"users":[{"id":1,"email":"jane@example.com","score":1.50}],"notes":"<redacted>"}` + "\n",
+		},
+		{
+			name:   "with every scope",
+			claims: &ctxkeys.ClaimSet{Subject: "auditor", Scopes: []string{config.DefaultRedactScope, "notes:read"}},
+			want:   string(body),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/v1/users", nil)
+			if tt.claims != nil {
+				r = r.WithContext(ctxkeys.Claims.With(r.Context(), *tt.claims))
+			}
+
+			got, err := h.redactResponse(r, body, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := escapeHTML(tt.want); string(got) != want {
+				t.Errorf("redactResponse =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestRedactResponsePretty(t *testing.T) {
+	h := &Handler{}
+	h.config.Store(&config.Config{Redaction: config.Redaction{Fields: map[string]string{
+		"email": config.DefaultRedactScope,
+	}}})
+
+	body := []byte("{\n  \"id\": 1,\n  \"email\": \"jane@example.com\"\n}\n")
+	got, err := h.redactResponse(httptest.NewRequest("GET", "/api/v1/users/1", nil), body, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := escapeHTML("{\n  \"id\": 1,\n  \"email\": \"<redacted>\"\n}\n"); string(got) != want {
+		t.Errorf("redactResponse =\n%s\nwant\n%s", got, want)
+	}
+}
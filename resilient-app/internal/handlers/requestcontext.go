@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/demo/resilient-app/internal/ctxkeys"
+	"github.com/demo/resilient-app/internal/disconnect"
+	"github.com/demo/resilient-app/internal/logging"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+const (
+	requestIDHeader   = "X-Request-ID"
+	tenantHeader      = "X-Tenant-ID"
+	traceparentHeader = "traceparent"
+	clusterHeader     = "X-Cluster-Name"
+	regionHeader      = "X-Region"
+
+	maxCorrelationIDLength = 128
+)
+
+// RequestContextMiddleware attaches the request ID, the tenant and a logger
+// carrying them with the route and trace ID to the request context. A valid incoming X-Request-ID is
+// kept so IDs correlate across services; otherwise a new one is generated.
+// The context is canceled with disconnect.ErrClientGone when the client
+// disconnects, so the queries and calls made for it stop too. Probes are
+// passed through untouched: kubelets send no correlation IDs, and building a
+// request logger for every probe would cost more than the probe itself.
+// Every response, probes' too, names the cluster and region that served it
+// when CLUSTER_NAME and REGION are set.
+func (h *Handler) RequestContextMiddleware(next http.Handler) http.Handler {
+	cluster := h.startup.Cluster
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cluster.Name != "" {
+			w.Header().Set(clusterHeader, cluster.Name)
+		}
+		if cluster.Region != "" {
+			w.Header().Set(regionHeader, cluster.Region)
+		}
+		if probeRoutes[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, stop := disconnect.Context(r.Context())
+		defer stop()
+
+		requestID := r.Header.Get(requestIDHeader)
+		if !validCorrelationID(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+		ctx = ctxkeys.RequestID.With(ctx, requestID)
+
+		fields := []zap.Field{zap.String("request_id", requestID)}
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				fields = append(fields, zap.String("route", template))
+			}
+		}
+		if tenant := r.Header.Get(tenantHeader); validCorrelationID(tenant) {
+			ctx = ctxkeys.Tenant.With(ctx, tenant)
+			fields = append(fields, zap.String("tenant", tenant))
+		}
+		if traceID := traceIDFromTraceparent(r.Header.Get(traceparentHeader)); traceID != "" {
+			fields = append(fields, zap.String("trace_id", traceID))
+		}
+
+		ctx = logging.WithLogger(ctx, h.logger.With(fields...))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// log returns the logger for the request, with its correlation fields attached
+func (h *Handler) log(r *http.Request) *zap.Logger {
+	if r == nil {
+		return h.logger
+	}
+	return h.logCtx(r.Context())
+}
+
+func (h *Handler) logCtx(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, h.logger)
+}
+
+// traceIDFromTraceparent extracts the trace ID from a W3C traceparent header
+// (version-traceid-parentid-flags)
+func traceIDFromTraceparent(header string) string {
+	parts := strings.Split(header, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 {
+		return ""
+	}
+	if _, err := hex.DecodeString(parts[1]); err != nil || parts[1] == strings.Repeat("0", 32) {
+		return ""
+	}
+	return parts[1]
+}
+
+// validCorrelationID rejects IDs that would bloat or corrupt log lines
+func validCorrelationID(id string) bool {
+	if id == "" || len(id) > maxCorrelationIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/demo/resilient-app/internal/database"
+	"github.com/demo/resilient-app/internal/metrics"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+var resourceOperationsTotal = metrics.NewCounterVec(
+	metrics.Opts{
+		Name: "resource_operations_total",
+		Help: "Total number of resource operations by outcome",
+	},
+	[]string{"resource", "operation", "result"},
+)
+
+// Store is the persistence contract a resource needs to be served by Resource
+type Store[T any, C any] interface {
+	List(ctx context.Context) ([]T, error)
+	Get(ctx context.Context, id int) (*T, error)
+	Create(ctx context.Context, input C) (*T, error)
+}
+
+// Resource serves list/get/create routes for any entity backed by a Store, with
+// the shared validation, timeouts, graceful degradation and metrics applied.
+// Adding an entity only requires a store, a create request type and a validator.
+type Resource[T any, C any] struct {
+	h        *Handler
+	name     string
+	singular string
+	store    Store[T, C]
+
+	// Validate rejects create input before it reaches the store, and the
+	// input of a replace (PUT). A validate.Errors it returns is listed field
+	// by field in the response.
+	Validate func(C) error
+	// ValidatePatch rejects the input of a patch (PATCH)
+	ValidatePatch func(C) error
+	// ListFallback and GetFallback serve degraded responses when the store fails
+	ListFallback func() []T
+	GetFallback  func(id int) *T
+	// AfterCreate runs on the background task pool once the entity has been
+	// persisted, so a slow or failing hook never delays the response
+	AfterCreate func(ctx context.Context, item *T) error
+	// GetGuard wraps the single-entity lookup route (e.g. enumeration protection)
+	GetGuard func(http.HandlerFunc) http.HandlerFunc
+	// ClientErrors maps resource-specific store errors to client responses
+	ClientErrors []ClientError
+	// LogFields describe the input of a failed write in its log entry;
+	// personal data goes in logging.PII fields
+	LogFields func(C) []zap.Field
+}
+
+// ClientError describes the response for a store error caused by the request
+type ClientError struct {
+	Err     error
+	Status  int
+	Code    string
+	Message string
+}
+
+func NewResource[T any, C any](h *Handler, name, singular string, store Store[T, C]) *Resource[T, C] {
+	return &Resource[T, C]{
+		h:        h,
+		name:     name,
+		singular: singular,
+		store:    store,
+	}
+}
+
+// Register mounts /{name} and /{name}/{id} on the router, with PUT and PATCH
+// when the store is an Updater and DELETE when it is a Deleter
+func (res *Resource[T, C]) Register(router *mux.Router) {
+	get := res.Get
+	if res.GetGuard != nil {
+		get = res.GetGuard(get)
+	}
+
+	router.HandleFunc("/"+res.name, res.List).Methods("GET")
+	router.HandleFunc("/"+res.name, res.Create).Methods("POST")
+	router.HandleFunc("/"+res.name+"/{id}", get).Methods("GET")
+	if _, ok := res.store.(Updater[T, C]); ok {
+		router.HandleFunc("/"+res.name+"/{id}", res.Replace).Methods("PUT")
+		router.HandleFunc("/"+res.name+"/{id}", res.Patch).Methods("PATCH")
+	}
+	if _, ok := res.store.(Deleter); ok {
+		router.HandleFunc("/"+res.name+"/{id}", res.Delete).Methods("DELETE")
+	}
+}
+
+// List all entities with graceful degradation. With ?stream=true the listing
+// is streamed incrementally when the store supports it.
+func (res *Resource[T, C]) List(w http.ResponseWriter, r *http.Request) {
+	h := res.h
+	if r.URL.Query().Get("stream") == "true" {
+		if streamer, ok := res.store.(Streamer[T]); ok {
+			res.stream(w, r, streamer)
+			return
+		}
+	}
+
+	ctx := r.Context()
+
+	items, err := res.store.List(ctx)
+	if err != nil {
+		h.log(r).Error("Failed to list "+res.name, zap.Error(err))
+
+		// Graceful degradation: return cached or minimal data
+		if res.ListFallback != nil && h.isGracefulDegradationEnabled() {
+			h.log(r).Info("Database unavailable, returning fallback data", zap.String("resource", res.name))
+			res.observe("list", "fallback")
+			h.writeJSONResponse(w, r, http.StatusOK, res.ListFallback())
+			return
+		}
+
+		res.observe("list", "error")
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, "database_error",
+			fmt.Sprintf("Unable to retrieve %s", res.name), err)
+		return
+	}
+
+	if items == nil {
+		items = []T{}
+	}
+
+	res.observe("list", "success")
+	h.writeJSONResponse(w, r, http.StatusOK, items)
+}
+
+// Get a single entity by ID
+func (res *Resource[T, C]) Get(w http.ResponseWriter, r *http.Request) {
+	h := res.h
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		res.observe("get", "invalid")
+		h.writeErrorResponse(w, r, http.StatusBadRequest, "invalid_id",
+			fmt.Sprintf("%s ID must be a valid number", res.title()), nil)
+		return
+	}
+
+	ctx := r.Context()
+
+	item, err := res.store.Get(ctx, id)
+	if errors.Is(err, database.ErrNotFound) {
+		res.observe("get", "not_found")
+		h.writeErrorResponse(w, r, http.StatusNotFound, res.singular+"_not_found",
+			fmt.Sprintf("%s not found", res.title()), nil)
+		return
+	}
+	if err != nil {
+		h.log(r).Error("Failed to get "+res.singular, zap.Int("id", id), zap.Error(err))
+
+		// Graceful degradation
+		if res.GetFallback != nil && h.isGracefulDegradationEnabled() {
+			if fallback := res.GetFallback(id); fallback != nil {
+				h.log(r).Info("Database unavailable, returning fallback data",
+					zap.String("resource", res.name), zap.Int("id", id))
+				res.observe("get", "fallback")
+				h.writeJSONResponse(w, r, http.StatusOK, fallback)
+				return
+			}
+		}
+
+		// A database failure is not a miss; reporting it as 404 would make
+		// clients (and the enumeration guard) treat an outage as bad input
+		res.observe("get", "error")
+		h.writeErrorResponse(w, r, http.StatusServiceUnavailable, "database_error",
+			fmt.Sprintf("Unable to retrieve %s", res.singular), err)
+		return
+	}
+
+	res.observe("get", "success")
+	h.writeJSONResponse(w, r, http.StatusOK, item)
+}
+
+// Create a new entity
+func (res *Resource[T, C]) Create(w http.ResponseWriter, r *http.Request) {
+	h := res.h
+	var input C
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		res.observe("create", "invalid")
+		h.writeErrorResponse(w, r, http.StatusBadRequest, "invalid_json",
+			"Invalid JSON in request body", err)
+		return
+	}
+
+	if res.Validate != nil {
+		if err := res.Validate(input); err != nil {
+			res.observe("create", "invalid")
+			h.writeValidationError(w, r, err)
+			return
+		}
+	}
+
+	ctx := r.Context()
+
+	// Kubernetes-style dry run: everything runs, the transaction is rolled back
+	dryRun := isDryRun(r)
+	if dryRun {
+		ctx = database.WithDryRun(ctx)
+		w.Header().Set("X-Dry-Run", "true")
+	}
+
+	item, err := res.store.Create(ctx, input)
+	for _, ce := range res.ClientErrors {
+		if errors.Is(err, ce.Err) {
+			res.observe("create", "rejected")
+			h.writeErrorResponse(w, r, ce.Status, ce.Code, ce.Message, err)
+			return
+		}
+	}
+
+	switch {
+	case errors.Is(err, database.ErrConflict):
+		res.observe("create", "conflict")
+		h.writeErrorResponse(w, r, http.StatusConflict, res.singular+"_exists",
+			fmt.Sprintf("%s already exists", res.title()), err)
+		return
+	case errors.Is(err, database.ErrInvalidReference):
+		res.observe("create", "invalid")
+		h.writeErrorResponse(w, r, http.StatusUnprocessableEntity, "invalid_reference",
+			fmt.Sprintf("%s references an entity that does not exist", res.title()), err)
+		return
+	case err != nil:
+		h.log(r).Error("Failed to create "+res.singular, res.logFields(input, zap.Error(err))...)
+		res.observe("create", "error")
+
+		// In degraded mode, we might not be able to create entities
+		if h.isGracefulDegradationEnabled() {
+			h.writeErrorResponse(w, r, http.StatusServiceUnavailable, "degraded_mode",
+				fmt.Sprintf("Service is in degraded mode, %s creation temporarily unavailable", res.singular), err)
+			return
+		}
+
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, "creation_failed",
+			fmt.Sprintf("Failed to create %s", res.singular), err)
+		return
+	}
+
+	if dryRun {
+		res.observe("create", "dry_run")
+		h.writeJSONResponse(w, r, http.StatusCreated, item)
+		return
+	}
+
+	if res.AfterCreate != nil {
+		err := h.tasks.Submit(res.singular+"_after_create", func(ctx context.Context) error {
+			return res.AfterCreate(ctx, item)
+		})
+		if err != nil {
+			h.log(r).Warn("Skipped after-create hook", zap.String("resource", res.name), zap.Error(err))
+		}
+	}
+
+	res.observe("create", "success")
+	h.writeJSONResponse(w, r, http.StatusCreated, item)
+}
+
+func (res *Resource[T, C]) observe(operation, result string) {
+	resourceOperationsTotal.WithLabelValues(res.name, operation, result).Inc()
+}
+
+func (res *Resource[T, C]) title() string {
+	if res.singular == "" {
+		return res.singular
+	}
+	return strings.ToUpper(res.singular[:1]) + res.singular[1:]
+}
+
+// isDryRun reports whether the request asks for a dry run (?dryRun=true)
+func isDryRun(r *http.Request) bool {
+	return r.URL.Query().Get("dryRun") == "true"
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/demo/resilient-app/internal/config"
+	"github.com/demo/resilient-app/internal/dependency"
+	"github.com/demo/resilient-app/internal/metrics"
+	"github.com/demo/resilient-app/internal/routebreaker"
+)
+
+var routeBreakerRejectedTotal = metrics.NewCounterVec(
+	metrics.Opts{
+		Name: "http_route_breaker_rejected_total",
+		Help: "Total number of requests rejected because their route's breaker is open",
+	},
+	[]string{"route"},
+)
+
+func routeBreakerConfig(cfg config.RouteBreaker) routebreaker.Config {
+	return routebreaker.Config{
+		ErrorRate:   cfg.ErrorRate,
+		MinRequests: cfg.MinRequests,
+		Window:      cfg.Window,
+		Cooldown:    cfg.Cooldown,
+	}
+}
+
+// routeBreakerStates lists the route breakers for the dependency registry,
+// under the names their events and metrics use
+func (h *Handler) routeBreakerStates() []dependency.Breaker {
+	statuses := h.routeBreakers.Statuses()
+	breakers := make([]dependency.Breaker, 0, len(statuses))
+	for _, status := range statuses {
+		breakers = append(breakers, dependency.Breaker{
+			Name:  routebreaker.BreakerName(status.Route),
+			State: status.State,
+			Since: status.Since,
+		})
+	}
+	return breakers
+}
+
+// Middleware that fails fast with 503 on a route whose recent requests mostly
+// failed (5xx) or were slow, so one misbehaving handler doesn't tie up the
+// pod while other routes keep serving
+func (h *Handler) RouteBreakerMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := h.cfg()
+		if !cfg.FeatureEnabled("route_breaker") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route := h.routeName(r)
+		done, ok := h.routeBreakers.Allow(route)
+		if !ok {
+			routeBreakerRejectedTotal.WithLabelValues(route).Inc()
+			dependency.BreakerRejected(routebreaker.BreakerName(route))
+			retryAfter := int(math.Ceil(cfg.RouteBreaker.Cooldown.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			h.writeErrorResponse(w, r, http.StatusServiceUnavailable, "route_unavailable",
+				"This endpoint is failing and temporarily disabled, please retry later", nil)
+			return
+		}
+
+		start := time.Now()
+		wrapper := &responseWriterWrapper{ResponseWriter: w, statusCode: http.StatusOK}
+		defer func() {
+			if err := recover(); err != nil {
+				done(true)
+				panic(err)
+			}
+		}()
+
+		next.ServeHTTP(wrapper, r)
+
+		// Event streams are long-lived by design and never count as slow
+		slowCall := cfg.RouteBreaker.SlowCall
+		slow := slowCall > 0 && time.Since(start) > slowCall &&
+			wrapper.Header().Get("Content-Type") != "text/event-stream"
+		done(wrapper.statusCode >= http.StatusInternalServerError || slow)
+	})
+}
+
+// routeName identifies the route by method and path template, e.g.
+// "GET /api/users/{id}" for it and its /api/v1 alias
+func (h *Handler) routeName(r *http.Request) string {
+	return fmt.Sprintf("%s %s", r.Method, h.getEndpointLabel(r))
+}
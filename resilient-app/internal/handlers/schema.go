@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/demo/resilient-app/internal/database"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultBackfillBatch = 1000
+	maxBackfillBatch     = 100000
+)
+
+// Backfill users.full_name from name in batches, e.g.
+// /admin/schema/backfill?batch=1000, the step between the dual_write and
+// dual_read schema phases. It only runs in dual_write, where every write sets
+// both columns, so rows it has passed stay in sync. The backfill runs in the
+// background and responds 202 at once; poll /admin/operations for its
+// progress.
+func (h *Handler) BackfillSchema(w http.ResponseWriter, r *http.Request) {
+	batch, ok := h.queryInt(w, r, "batch", defaultBackfillBatch, maxBackfillBatch)
+	if !ok {
+		return
+	}
+
+	if phase := h.db.Settings().SchemaPhase; phase != database.SchemaDualWrite {
+		h.writeErrorResponse(w, r, http.StatusConflict, "wrong_schema_phase",
+			"Backfill runs only in the dual_write schema phase; DB_SCHEMA_PHASE is "+phase, nil)
+		return
+	}
+
+	op := h.operations.start("backfill")
+	logger := h.log(r).With(zap.String("operation", op.ID))
+	logger.Info("Starting schema backfill", zap.Int("batch", batch))
+
+	h.background.run(func(ctx context.Context) {
+		rows, err := h.db.BackfillUserNames(ctx, batch, h.trackProgress(logger, op))
+		h.operations.finish(op, err)
+		if err != nil {
+			logger.Error("Schema backfill failed", zap.Int("rows", rows), zap.Error(err))
+			return
+		}
+		logger.Info("Schema backfill completed", zap.Int("rows", rows))
+	})
+
+	w.Header().Set("X-Operation-ID", op.ID)
+	h.writeJSONResponse(w, r, http.StatusAccepted, op)
+}
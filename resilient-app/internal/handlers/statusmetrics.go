@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/demo/resilient-app/internal/configcheck"
+	"github.com/demo/resilient-app/internal/health"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sony/gobreaker"
+)
+
+// wantsStatusMetrics reports whether a status request asked for the
+// Prometheus exposition rather than JSON: with ?format=prometheus, or with
+// the Accept header a Prometheus scraper sends
+func wantsStatusMetrics(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "prometheus" {
+		return true
+	}
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/openmetrics-text") ||
+		strings.Contains(accept, "version=0.0.4")
+}
+
+// writeStatusMetrics renders the system status as gauges, for blackbox
+// monitors that only speak Prometheus. The gauges live in a registry of their
+// own built per request, so they never show up in /metrics. States are
+// exposed one series per possible value, set to 1 for the current one.
+// Unless verbose, only the overall health is.
+func (h *Handler) writeStatusMetrics(w http.ResponseWriter, r *http.Request, healthResponse *health.HealthResponse, verbose bool) {
+	registry := prometheus.NewRegistry()
+	gauge := func(name, help string, labels ...string) *prometheus.GaugeVec {
+		g := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labels)
+		registry.MustRegister(g)
+		return g
+	}
+	flag := func(on bool) float64 {
+		if on {
+			return 1
+		}
+		return 0
+	}
+
+	statuses := []health.Status{health.StatusHealthy, health.StatusDegraded, health.StatusUnhealthy}
+	healthStatus := gauge("app_health_status", "Overall health, 1 for the current status", "status")
+	for _, status := range statuses {
+		healthStatus.WithLabelValues(string(status)).Set(flag(healthResponse.Status == status))
+	}
+	if !verbose {
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+		return
+	}
+
+	checkStatus := gauge("app_health_check_status", "Status of each health check, 1 for the current status", "check", "status")
+	for _, status := range statuses {
+		for name, check := range healthResponse.Checks {
+			checkStatus.WithLabelValues(name, string(status)).Set(flag(check.Status == status))
+		}
+	}
+	gauge("app_uptime_seconds", "Time since the process started").WithLabelValues().Set(healthResponse.Uptime.Seconds())
+	gauge("app_info", "Build and placement information, always 1", "version", "cluster", "region").
+		WithLabelValues(healthResponse.Version, h.startup.Cluster.Name, h.startup.Cluster.Region).Set(1)
+
+	breakerState := gauge("app_circuit_breaker_state", "State of the database read and write breakers, 1 for the current state", "breaker", "state")
+	breakerRequests := gauge("app_circuit_breaker_requests", "Requests counted in the breaker's current interval", "breaker")
+	breakerFailures := gauge("app_circuit_breaker_failures", "Failures counted in the breaker's current interval", "breaker")
+	for _, breaker := range h.db.Breakers() {
+		for _, s := range []gobreaker.State{gobreaker.StateClosed, gobreaker.StateHalfOpen, gobreaker.StateOpen} {
+			breakerState.WithLabelValues(breaker.Name, s.String()).Set(flag(breaker.State == s.String()))
+		}
+		breakerRequests.WithLabelValues(breaker.Name).Set(float64(breaker.Requests))
+		breakerFailures.WithLabelValues(breaker.Name).Set(float64(breaker.TotalFailures))
+	}
+
+	decision := h.policy.Decision()
+	gauge("app_fallback_allowed", "1 when degraded responses may be served from fallback data").
+		WithLabelValues().Set(flag(decision.AllowFallback))
+	gauge("app_shed_fraction", "Fraction of API requests shed up front").WithLabelValues().Set(decision.ShedFraction)
+	_, draining := h.drain.deadline()
+	gauge("app_draining", "1 once shutdown has started").WithLabelValues().Set(flag(draining))
+
+	cfg := h.cfg()
+	features := gauge("app_feature_enabled", "1 for each enabled feature flag", "feature")
+	for _, feature := range configcheck.KnownFeatures {
+		features.WithLabelValues(feature).Set(flag(cfg.FeatureEnabled(feature)))
+	}
+
+	if probe, ok := h.db.LastProbe(); ok {
+		gauge("app_database_probe_ok", "1 when the latest background probe reached the database").
+			WithLabelValues().Set(flag(probe.OK()))
+	}
+	if cfg.FeatureEnabled("route_breaker") {
+		routeState := gauge("app_route_breaker_state", "State of each route's breaker, 1 for the current state", "route", "state")
+		for _, status := range h.routeBreakers.Statuses() {
+			for _, s := range []gobreaker.State{gobreaker.StateClosed, gobreaker.StateHalfOpen, gobreaker.StateOpen} {
+				routeState.WithLabelValues(status.Route, s.String()).Set(flag(status.State == s.String()))
+			}
+		}
+	}
+
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/demo/resilient-app/internal/metrics"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultStreamLimit   = 100
+	maxStreamLimit       = 100000
+	streamTimeout        = 2 * time.Minute
+	streamFlushEvery     = 100
+	streamFlushInterval  = 500 * time.Millisecond
+	streamWriteExtension = 10 * time.Second
+)
+
+var streamsTotal = metrics.NewCounterVec(
+	metrics.Opts{
+		Name: "http_streams_total",
+		Help: "Total number of streamed listings by outcome",
+	},
+	[]string{"resource", "result"},
+)
+
+// Streamer is implemented by stores that can iterate a listing without
+// loading it into memory
+type Streamer[T any] interface {
+	Stream(ctx context.Context, limit int, fn func(T) error) error
+}
+
+// stream writes the listing as a JSON array incrementally, flushing every few
+// items so slow consumers receive data as it is read instead of the whole
+// result set being held in memory. The request context is passed down to the
+// query, so a client disconnect cancels the database cursor.
+func (res *Resource[T, C]) stream(w http.ResponseWriter, r *http.Request, streamer Streamer[T]) {
+	h := res.h
+	limit := defaultStreamLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > maxStreamLimit {
+			h.writeErrorResponse(w, r, http.StatusBadRequest, "invalid_limit",
+				"Limit must be between 1 and "+strconv.Itoa(maxStreamLimit), err)
+			return
+		}
+		limit = parsed
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), streamTimeout)
+	defer cancel()
+
+	controller := http.NewResponseController(w)
+	started := false
+	count := 0
+	lastFlush := time.Now()
+
+	// One pooled buffer encodes every item of the stream
+	buf := getJSONBuffer()
+	defer buf.release()
+
+	err := streamer.Stream(ctx, limit, func(item T) error {
+		buf.Reset()
+		if started {
+			buf.WriteByte(',')
+		} else {
+			buf.WriteByte('[')
+		}
+		if err := buf.encode(item, false); err != nil {
+			return err
+		}
+		// Drop the encoder's newline to keep the array compact
+		buf.Truncate(buf.Len() - 1)
+		// Fields the caller may not see are redacted item by item
+		redacted, err := h.redactResponse(r, buf.Bytes()[1:], false)
+		if err != nil {
+			return err
+		}
+		buf.Truncate(1)
+		buf.Write(redacted)
+
+		if !started {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return err
+		}
+
+		count++
+		if count%streamFlushEvery == 0 || time.Since(lastFlush) >= streamFlushInterval {
+			// Each flush proves the client is keeping up, so push the write
+			// deadline out instead of letting the server WriteTimeout cut the stream
+			controller.SetWriteDeadline(time.Now().Add(streamWriteExtension))
+			if err := controller.Flush(); err != nil {
+				return err
+			}
+			lastFlush = time.Now()
+		}
+		return nil
+	})
+
+	if err != nil {
+		result := "error"
+		if errors.Is(r.Context().Err(), context.Canceled) {
+			result = "client_gone"
+		}
+		streamsTotal.WithLabelValues(res.name, result).Inc()
+		h.log(r).Warn("Streaming listing aborted",
+			zap.String("resource", res.name),
+			zap.Int("items_sent", count),
+			zap.String("reason", result),
+			zap.Error(err),
+		)
+
+		if !started {
+			h.writeErrorResponse(w, r, http.StatusServiceUnavailable, "database_error",
+				"Unable to stream "+res.name, err)
+		}
+		// Once the array has started, the status line is gone; leaving the
+		// array unterminated makes the failure detectable by the client
+		return
+	}
+
+	if !started {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("[]\n"))
+	} else {
+		w.Write([]byte("]\n"))
+	}
+	streamsTotal.WithLabelValues(res.name, "success").Inc()
+}
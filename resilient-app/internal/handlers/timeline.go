@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/demo/resilient-app/internal/timeline"
+	"go.uber.org/zap"
+)
+
+const (
+	minReplaySpeed = 0.1
+	maxReplaySpeed = 100.0
+)
+
+func (h *Handler) newTimelineRecorder() *timeline.Recorder {
+	return timeline.NewRecorder(func() timeline.Sample {
+		return timeline.Sample{
+			Health:       string(h.healthChecker.LastStatus()),
+			BreakerState: h.db.GetState().String(),
+			BreakerFails: h.db.GetStats().TotalFailures,
+		}
+	})
+}
+
+// Start recording the resilience timeline (e.g. at the beginning of a chaos run)
+func (h *Handler) StartTimelineRecording(w http.ResponseWriter, r *http.Request) {
+	if !h.timeline.Start() {
+		h.writeErrorResponse(w, r, http.StatusConflict, "already_recording",
+			"A timeline recording is already in progress", nil)
+		return
+	}
+	h.log(r).Info("Timeline recording started")
+	h.writeJSONResponse(w, r, http.StatusOK, map[string]interface{}{"recording": true})
+}
+
+// Stop recording; the samples are kept until the next recording starts
+func (h *Handler) StopTimelineRecording(w http.ResponseWriter, r *http.Request) {
+	if !h.timeline.Stop() {
+		h.writeErrorResponse(w, r, http.StatusConflict, "not_recording",
+			"No timeline recording is in progress", nil)
+		return
+	}
+	samples := len(h.timeline.Samples())
+	h.log(r).Info("Timeline recording stopped", zap.Int("samples", samples))
+	h.writeJSONResponse(w, r, http.StatusOK, map[string]interface{}{"recording": false, "samples": samples})
+}
+
+// Get the recorded timeline
+func (h *Handler) GetTimeline(w http.ResponseWriter, r *http.Request) {
+	h.writeJSONResponse(w, r, http.StatusOK, map[string]interface{}{
+		"recording": h.timeline.Recording(),
+		"samples":   h.timeline.Samples(),
+	})
+}
+
+// Replay the recorded timeline as Server-Sent Events, preserving the original
+// spacing between samples divided by ?speed= (default 1)
+func (h *Handler) ReplayTimeline(w http.ResponseWriter, r *http.Request) {
+	if h.rejectIfDraining(w, r) {
+		return
+	}
+
+	speed := 1.0
+	if value := r.URL.Query().Get("speed"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < minReplaySpeed || parsed > maxReplaySpeed {
+			h.writeErrorResponse(w, r, http.StatusBadRequest, "invalid_speed",
+				fmt.Sprintf("Speed must be between %g and %g", minReplaySpeed, maxReplaySpeed), err)
+			return
+		}
+		speed = parsed
+	}
+
+	samples := h.timeline.Samples()
+	if len(samples) == 0 {
+		h.writeErrorResponse(w, r, http.StatusNotFound, "no_timeline",
+			"No timeline has been recorded", nil)
+		return
+	}
+
+	controller := http.NewResponseController(w)
+	controller.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	for i, sample := range samples {
+		if i > 0 {
+			delay := time.Duration(float64(sample.Time.Sub(samples[i-1].Time)) / speed)
+			timer := time.NewTimer(delay)
+			select {
+			case <-r.Context().Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+
+		if err := writeEvent(w, "sample", sample); err != nil {
+			h.log(r).Error("Failed to encode timeline sample", zap.Error(err))
+			return
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+
+	fmt.Fprint(w, "event: end\ndata: {}\n\n")
+	controller.Flush()
+}
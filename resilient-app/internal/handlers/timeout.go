@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/demo/resilient-app/internal/ctxkeys"
+)
+
+// streamingRoutes hold their connection open for as long as the client
+// listens and bound their own lifetime
+var streamingRoutes = map[string]bool{
+	"GET /api/events":          true,
+	"GET /api/timeline/replay": true,
+}
+
+// Middleware that bounds the work of a request with the route's timeout from
+// ROUTE_TIMEOUTS, or REQUEST_TIMEOUT, so operators can give GET /api/users
+// and POST /api/users different budgets without a rebuild. The deadline
+// reaches every query and downstream call made with the request context.
+// Streaming responses manage their own lifetime and are left alone.
+func (h *Handler) TimeoutMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := h.routeName(r)
+		timeouts := h.cfg().Timeouts
+		timeout := timeouts.Route(route)
+		if timeout <= 0 || streamingRoutes[route] || r.URL.Query().Get("stream") == "true" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		source := "default"
+		if _, ok := timeouts.Routes[route]; ok {
+			source = "route"
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		ctx = ctxkeys.Deadline.With(ctx, ctxkeys.DeadlineInfo{Route: route, Timeout: timeout, Source: source})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
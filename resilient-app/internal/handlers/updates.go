@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/demo/resilient-app/internal/database"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// Updater is implemented by stores whose entities can be changed. Update
+// takes the create input; fields left at their zero value keep their current
+// value.
+type Updater[T any, C any] interface {
+	Update(ctx context.Context, id int, input C) (*T, error)
+}
+
+// Deleter is implemented by stores whose entities can be deleted
+type Deleter interface {
+	Delete(ctx context.Context, id int) error
+}
+
+// Replace an entity; the input is validated like a create, so every field is
+// given
+func (res *Resource[T, C]) Replace(w http.ResponseWriter, r *http.Request) {
+	res.update(w, r, "replace", res.Validate)
+}
+
+// Patch an entity; only the fields given change
+func (res *Resource[T, C]) Patch(w http.ResponseWriter, r *http.Request) {
+	res.update(w, r, "patch", res.ValidatePatch)
+}
+
+func (res *Resource[T, C]) update(w http.ResponseWriter, r *http.Request, operation string, validate func(C) error) {
+	h := res.h
+	updater, ok := res.store.(Updater[T, C])
+	if !ok {
+		h.writeErrorResponse(w, r, http.StatusMethodNotAllowed, "method_not_allowed",
+			fmt.Sprintf("%s cannot be changed", res.title()), nil)
+		return
+	}
+	id, ok := res.parseID(w, r, operation)
+	if !ok {
+		return
+	}
+
+	var input C
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		res.observe(operation, "invalid")
+		h.writeErrorResponse(w, r, http.StatusBadRequest, "invalid_json",
+			"Invalid JSON in request body", err)
+		return
+	}
+	if validate != nil {
+		if err := validate(input); err != nil {
+			res.observe(operation, "invalid")
+			h.writeValidationError(w, r, err)
+			return
+		}
+	}
+
+	ctx := res.dryRunContext(w, r)
+	item, err := updater.Update(ctx, id, input)
+	for _, ce := range res.ClientErrors {
+		if errors.Is(err, ce.Err) {
+			res.observe(operation, "rejected")
+			h.writeErrorResponse(w, r, ce.Status, ce.Code, ce.Message, err)
+			return
+		}
+	}
+
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		res.observe(operation, "not_found")
+		h.writeErrorResponse(w, r, http.StatusNotFound, res.singular+"_not_found",
+			fmt.Sprintf("%s not found", res.title()), nil)
+		return
+	case errors.Is(err, database.ErrConflict):
+		res.observe(operation, "conflict")
+		h.writeErrorResponse(w, r, http.StatusConflict, res.singular+"_exists",
+			fmt.Sprintf("%s already exists", res.title()), err)
+		return
+	case errors.Is(err, database.ErrInvalidReference):
+		res.observe(operation, "invalid")
+		h.writeErrorResponse(w, r, http.StatusUnprocessableEntity, "invalid_reference",
+			fmt.Sprintf("%s references an entity that does not exist", res.title()), err)
+		return
+	case err != nil:
+		h.log(r).Error("Failed to update "+res.singular, res.logFields(input, zap.Int("id", id), zap.Error(err))...)
+		res.observe(operation, "error")
+		res.writeWriteFailure(w, r, "update", "update", err)
+		return
+	}
+
+	res.observe(operation, res.result(ctx))
+	h.writeJSONResponse(w, r, http.StatusOK, item)
+}
+
+// Delete an entity
+func (res *Resource[T, C]) Delete(w http.ResponseWriter, r *http.Request) {
+	h := res.h
+	deleter, ok := res.store.(Deleter)
+	if !ok {
+		h.writeErrorResponse(w, r, http.StatusMethodNotAllowed, "method_not_allowed",
+			fmt.Sprintf("%s cannot be deleted", res.title()), nil)
+		return
+	}
+	id, ok := res.parseID(w, r, "delete")
+	if !ok {
+		return
+	}
+
+	ctx := res.dryRunContext(w, r)
+	err := deleter.Delete(ctx, id)
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		res.observe("delete", "not_found")
+		h.writeErrorResponse(w, r, http.StatusNotFound, res.singular+"_not_found",
+			fmt.Sprintf("%s not found", res.title()), nil)
+		return
+	case err != nil:
+		h.log(r).Error("Failed to delete "+res.singular, zap.Int("id", id), zap.Error(err))
+		res.observe("delete", "error")
+		res.writeWriteFailure(w, r, "deletion", "delete", err)
+		return
+	}
+
+	res.observe("delete", res.result(ctx))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// logFields returns fields followed by those LogFields gives for input
+func (res *Resource[T, C]) logFields(input C, fields ...zap.Field) []zap.Field {
+	if res.LogFields == nil {
+		return fields
+	}
+	return append(fields, res.LogFields(input)...)
+}
+
+// parseID reads the {id} route variable, answering 400 when it isn't a
+// number
+func (res *Resource[T, C]) parseID(w http.ResponseWriter, r *http.Request, operation string) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		res.observe(operation, "invalid")
+		res.h.writeErrorResponse(w, r, http.StatusBadRequest, "invalid_id",
+			fmt.Sprintf("%s ID must be a valid number", res.title()), nil)
+		return 0, false
+	}
+	return id, true
+}
+
+// dryRunContext marks the request's context for a dry run when it asks for
+// one, like a create
+func (res *Resource[T, C]) dryRunContext(w http.ResponseWriter, r *http.Request) context.Context {
+	if !isDryRun(r) {
+		return r.Context()
+	}
+	w.Header().Set("X-Dry-Run", "true")
+	return database.WithDryRun(r.Context())
+}
+
+func (res *Resource[T, C]) result(ctx context.Context) string {
+	if database.IsDryRun(ctx) {
+		return "dry_run"
+	}
+	return "success"
+}
+
+// writeWriteFailure answers a write the store failed, action naming it and
+// verb what it did; in degraded mode the failure is reported as temporary,
+// like a failed create
+func (res *Resource[T, C]) writeWriteFailure(w http.ResponseWriter, r *http.Request, action, verb string, err error) {
+	h := res.h
+	if h.isGracefulDegradationEnabled() {
+		h.writeErrorResponse(w, r, http.StatusServiceUnavailable, "degraded_mode",
+			fmt.Sprintf("Service is in degraded mode, %s %s temporarily unavailable", res.singular, action), err)
+		return
+	}
+	h.writeErrorResponse(w, r, http.StatusInternalServerError, action+"_failed",
+		fmt.Sprintf("Failed to %s %s", verb, res.singular), err)
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/demo/resilient-app/internal/cache"
+	"github.com/demo/resilient-app/internal/database"
+	"github.com/demo/resilient-app/internal/logging"
+	"github.com/demo/resilient-app/internal/validate"
+	"go.uber.org/zap"
+)
+
+// maxFallbackUsers matches the page size of a user listing
+const maxFallbackUsers = 100
+
+type CreateUserRequest struct {
+	Name  string `json:"name" validate:"required,max=255"`
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+// userStore adapts a database.UserStore to the Store contract. Every user it
+// reads or creates is kept in cache for degraded responses.
+type userStore struct {
+	users database.UserStore
+	cache *cache.Cache[database.User]
+}
+
+func (s userStore) List(ctx context.Context) ([]database.User, error) {
+	users, err := s.users.GetUsers(ctx)
+	for _, user := range users {
+		s.cache.Set(strconv.Itoa(user.ID), user)
+	}
+	return users, err
+}
+
+func (s userStore) Get(ctx context.Context, id int) (*database.User, error) {
+	user, err := s.users.GetUser(ctx, id)
+	if err == nil {
+		s.cache.Set(strconv.Itoa(id), *user)
+	}
+	return user, err
+}
+
+func (s userStore) Stream(ctx context.Context, limit int, fn func(database.User) error) error {
+	return s.users.StreamUsers(ctx, limit, fn)
+}
+
+func (s userStore) Create(ctx context.Context, req CreateUserRequest) (*database.User, error) {
+	user, err := s.users.CreateUser(ctx, req.Name, req.Email)
+	if err == nil && !database.IsDryRun(ctx) {
+		s.cache.Set(strconv.Itoa(user.ID), *user)
+	}
+	return user, err
+}
+
+// Update changes the user; a changed email is verified again, by the
+// verification sweeper
+func (s userStore) Update(ctx context.Context, id int, req CreateUserRequest) (*database.User, error) {
+	user, err := s.users.UpdateUser(ctx, id, req.Name, req.Email)
+	if err == nil && !database.IsDryRun(ctx) {
+		s.cache.Set(strconv.Itoa(id), *user)
+	}
+	return user, err
+}
+
+// Delete soft-deletes the user and drops it from the fallback cache, so
+// degraded responses don't bring it back
+func (s userStore) Delete(ctx context.Context, id int) error {
+	err := s.users.DeleteUser(ctx, id)
+	if (err == nil || errors.Is(err, database.ErrNotFound)) && !database.IsDryRun(ctx) {
+		s.cache.Delete(strconv.Itoa(id))
+	}
+	return err
+}
+
+func (h *Handler) newUserResource() *Resource[database.User, CreateUserRequest] {
+	resilience := h.startup.Resilience
+	h.userCache = cache.New[database.User]("users",
+		resilience.FallbackCacheEntries, resilience.FallbackCacheShards, resilience.FallbackCacheTTL)
+
+	users := NewResource[database.User, CreateUserRequest](h, "users", "user", userStore{users: h.userStore, cache: h.userCache})
+	users.Validate = validateCreateUser
+	users.ValidatePatch = validatePatchUser
+	users.LogFields = userLogFields
+	users.ListFallback = h.getFallbackUsers
+	users.GetFallback = h.getFallbackUser
+	users.GetGuard = h.EnumerationGuard
+
+	// Verification email is sent asynchronously so a slow mail path never
+	// delays or fails user creation; a skipped hook is caught by the sweeper
+	users.AfterCreate = func(ctx context.Context, user *database.User) error {
+		h.verifier.Enqueue(user.ID)
+		return nil
+	}
+
+	return users
+}
+
+// SetUserStore serves the user routes, GraphQL user lookups and email
+// verification from store instead of the database, e.g. a fake in tests. It
+// must be called before the handler serves requests.
+func (h *Handler) SetUserStore(store database.UserStore) {
+	h.userStore = store
+	h.users.store = userStore{users: store, cache: h.userCache}
+}
+
+// getFallbackUsers returns the most recently created of the users last read
+// from the database, or a placeholder when none are cached
+func (h *Handler) getFallbackUsers() []database.User {
+	users := h.userCache.Values()
+	if len(users) == 0 {
+		return []database.User{placeholderUser()}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].CreatedAt.After(users[j].CreatedAt) })
+	if len(users) > maxFallbackUsers {
+		users = users[:maxFallbackUsers]
+	}
+	return users
+}
+
+// getFallbackUser returns the user as last read from the database
+func (h *Handler) getFallbackUser(id int) *database.User {
+	if user, ok := h.userCache.Get(strconv.Itoa(id)); ok {
+		return &user
+	}
+	if id == 1 {
+		user := placeholderUser()
+		return &user
+	}
+	return nil
+}
+
+func placeholderUser() database.User {
+	return database.User{
+		ID:        1,
+		Name:      "Fallback User",
+		Email:     "fallback@example.com",
+		CreatedAt: time.Now().Add(-24 * time.Hour),
+	}
+}
+
+// userLogFields name the user a failed write was for, sanitized as
+// LOG_PII_MODE says
+func userLogFields(req CreateUserRequest) []zap.Field {
+	return []zap.Field{logging.PII("name", req.Name), logging.PII("email", req.Email)}
+}
+
+func validateCreateUser(req CreateUserRequest) error {
+	return validate.Struct(req)
+}
+
+func validatePatchUser(req CreateUserRequest) error {
+	if req.Name == "" && req.Email == "" {
+		return errors.New("name or email is required")
+	}
+	return validate.Partial(req)
+}
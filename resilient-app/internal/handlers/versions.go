@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// DefaultAPIVersion is the version unversioned /api paths serve, so clients
+// from before versioning keep working
+const DefaultAPIVersion = "v1"
+
+const apiVersionHeader = "API-Version"
+
+// APIVersionMiddleware names the API version that served the response, so a
+// client on an unversioned path can tell which one it got
+func APIVersionMiddleware(version string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(apiVersionHeader, version)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// unversionedPath maps a path of the default version onto its unversioned
+// alias, e.g. /api/v1/users onto /api/users. Both then share a breaker, a
+// timeout and metric labels, and keep the route names configured before
+// versioning. Other versions keep their own, e.g. /api/v2/users.
+func unversionedPath(path string) string {
+	prefix := "/api/" + DefaultAPIVersion
+	if rest, ok := strings.CutPrefix(path, prefix); ok && (rest == "" || rest[0] == '/') {
+		return "/api" + rest
+	}
+	return path
+}
@@ -0,0 +1,120 @@
+package health
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/demo/resilient-app/internal/dependency"
+	"github.com/demo/resilient-app/internal/events"
+	"github.com/demo/resilient-app/internal/metrics"
+)
+
+// The breaker gauges are read from the breakers on every scrape. Transitions
+// published on the event bus can be dropped, so they only feed the counter.
+var breakerOpenSeconds = metrics.NewGaugeFunc(
+	metrics.Opts{
+		Name: "circuit_breaker_open_seconds",
+		Help: "How long each circuit breaker has been open, 0 while closed or half-open",
+	},
+	[]string{"breaker"},
+	func(emit func(value float64, labelValues ...string)) {
+		for _, status := range breakerStatuses() {
+			open := 0.0
+			if status.State == "open" {
+				open = status.TimeInState.Seconds()
+			}
+			emit(open, status.Name)
+		}
+	},
+)
+
+var breakerState = metrics.NewGaugeFunc(
+	metrics.Opts{
+		Name: "circuit_breaker_state",
+		Help: "State of each circuit breaker, 1 for the current state",
+	},
+	[]string{"breaker", "state"},
+	func(emit func(value float64, labelValues ...string)) {
+		for _, breaker := range dependency.Default.Breakers() {
+			for _, state := range breakerStates {
+				value := 0.0
+				if state == breaker.State {
+					value = 1
+				}
+				emit(value, breaker.Name, state)
+			}
+		}
+	},
+)
+
+var breakerTransitionsTotal = metrics.NewCounterVec(
+	metrics.Opts{
+		Name: "circuit_breaker_transitions_total",
+		Help: "Total number of circuit breaker state transitions",
+	},
+	[]string{"breaker", "from", "to"},
+)
+
+// breakerStates are the values of the state label
+var breakerStates = []string{"closed", "half-open", "open"}
+
+// BreakerStatus is the state of one circuit breaker and how long it has been in it
+type BreakerStatus struct {
+	Name        string        `json:"name"`
+	State       string        `json:"state"`
+	Since       time.Time     `json:"since"`
+	TimeInState time.Duration `json:"time_in_state"`
+}
+
+// countBreakerTransitions counts the transitions published on the event bus
+func countBreakerTransitions() {
+	events.Default.Subscribe(events.BreakerStateChanged{}.Name()).Handle(func(e events.Event) {
+		changed := e.(events.BreakerStateChanged)
+		breakerTransitionsTotal.WithLabelValues(changed.Breaker, changed.From, changed.To).Inc()
+	})
+}
+
+// breakerStatuses returns every breaker as it is now, sorted by name
+func breakerStatuses() []BreakerStatus {
+	now := time.Now()
+	breakers := dependency.Default.Breakers()
+	statuses := make([]BreakerStatus, 0, len(breakers))
+	for _, breaker := range breakers {
+		statuses = append(statuses, BreakerStatus{
+			Name:        breaker.Name,
+			State:       breaker.State,
+			Since:       breaker.Since,
+			TimeInState: now.Sub(breaker.Since),
+		})
+	}
+	return statuses
+}
+
+func (c *Checker) checkBreakers() *Check {
+	start := time.Now()
+	check := &Check{
+		Name:      "circuit_breakers",
+		Timestamp: start,
+		Status:    StatusHealthy,
+	}
+
+	statuses := breakerStatuses()
+	var stuck []string
+	for _, status := range statuses {
+		if status.State == "open" && status.TimeInState > c.breakerOpenThreshold {
+			stuck = append(stuck, fmt.Sprintf("%s (open for %s)", status.Name, status.TimeInState.Round(time.Second)))
+		}
+	}
+
+	check.Details = statuses
+	check.Duration = time.Since(start)
+	if len(stuck) > 0 {
+		check.Status = StatusDegraded
+		check.Message = fmt.Sprintf("Breakers open longer than %s: %s", c.breakerOpenThreshold, strings.Join(stuck, ", "))
+	} else {
+		check.Message = fmt.Sprintf("No breaker open longer than %s", c.breakerOpenThreshold)
+	}
+
+	return check
+}
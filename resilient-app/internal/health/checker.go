@@ -2,13 +2,17 @@ package health
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/demo/resilient-app/internal/config"
 	"github.com/demo/resilient-app/internal/database"
+	"github.com/demo/resilient-app/internal/events"
 	"go.uber.org/zap"
 )
 
@@ -26,6 +30,7 @@ type Check struct {
 	Message   string        `json:"message,omitempty"`
 	Duration  time.Duration `json:"duration"`
 	Timestamp time.Time     `json:"timestamp"`
+	Details   interface{}   `json:"details,omitempty"`
 }
 
 type HealthResponse struct {
@@ -41,28 +46,67 @@ type Checker struct {
 	db        *database.DB
 	startTime time.Time
 	mu        sync.RWMutex
-	ready     bool
-	startup   bool
+	ready     atomic.Bool
+	startup   atomic.Bool
+
+	version       string
+	features      []string
+	checkInterval time.Duration
+
+	// breakerOpenThreshold is how long a breaker may stay open before the
+	// pod reports itself degraded
+	breakerOpenThreshold time.Duration
+
+	// dbSlowPing and dbPingTimeout grade the database check by ping latency
+	dbSlowPing    time.Duration
+	dbPingTimeout time.Duration
+
+	// lastStatus caches the outcome of the most recent full health check
+	lastStatus atomic.Value
+	// latest is the most recent full health check, serialized for the
+	// liveness probe
+	latest atomic.Pointer[Snapshot]
 }
 
-func NewChecker(logger *zap.Logger, db *database.DB) *Checker {
+// Snapshot is a health check response serialized once, so liveness probes
+// can be answered without running the checks or encoding JSON per request
+type Snapshot struct {
+	Status Status
+	// Body is the JSON response, newline-terminated like other responses
+	Body []byte
+	At   time.Time
+	// Ready is whether the checks leave the pod fit for traffic, so
+	// readiness probes are answered without checking again
+	Ready bool
+}
+
+func NewChecker(logger *zap.Logger, db *database.DB, cfg *config.Config) *Checker {
 	checker := &Checker{
 		logger:    logger,
 		db:        db,
 		startTime: time.Now(),
-		ready:     false,
-		startup:   false,
+
+		version:       cfg.Version,
+		features:      cfg.Features,
+		checkInterval: cfg.Health.CheckInterval,
+
+		breakerOpenThreshold: cfg.Health.BreakerOpenDegraded,
+		dbSlowPing:           cfg.Health.DBSlowPing,
+		dbPingTimeout:        cfg.Health.DBPingTimeout,
 	}
 
+	countBreakerTransitions()
+
 	// Start background health monitoring
 	go checker.backgroundHealthCheck()
 	
-	// Mark as started up after a brief delay (simulating app initialization)
+	// Mark as started up after a brief delay (simulating app initialization),
+	// and once the database is connected, so the startup probe reports starting
+	// while Postgres is still coming up instead of the pod crash-looping
 	go func() {
 		time.Sleep(5 * time.Second)
-		checker.mu.Lock()
-		checker.startup = true
-		checker.mu.Unlock()
+		<-db.Connected()
+		checker.startup.Store(true)
 		logger.Info("Application startup completed")
 	}()
 
@@ -77,7 +121,7 @@ func (c *Checker) HealthCheck(ctx context.Context) *HealthResponse {
 		Status:    StatusHealthy,
 		Timestamp: time.Now(),
 		Uptime:    time.Since(c.startTime),
-		Version:   getEnvOrDefault("APP_VERSION", "1.0.0"),
+		Version:   c.version,
 		Checks:    make(map[string]*Check),
 	}
 
@@ -93,24 +137,53 @@ func (c *Checker) HealthCheck(ctx context.Context) *HealthResponse {
 	featuresCheck := c.checkFeatures()
 	response.Checks["features"] = featuresCheck
 
+	// Circuit breakers stuck open
+	response.Checks["circuit_breakers"] = c.checkBreakers()
+
 	// Determine overall status
 	response.Status = c.determineOverallStatus(response.Checks)
+	if body, err := json.Marshal(response); err == nil {
+		c.latest.Store(&Snapshot{
+			Status: response.Status,
+			Body:   append(body, '\n'),
+			At:     response.Timestamp,
+			Ready:  c.readyFor(response.Checks),
+		})
+	}
+	if previous := c.lastStatus.Swap(response.Status); previous != nil && previous.(Status) != response.Status {
+		events.Publish(events.HealthChanged{
+			From: string(previous.(Status)),
+			To:   string(response.Status),
+			At:   response.Timestamp,
+		})
+	}
 
 	return response
 }
 
-func (c *Checker) ReadinessCheck(ctx context.Context) bool {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	// Check if startup is complete
-	if !c.startup {
+// ReadinessCheck reports whether the pod should receive traffic: once
+// started up, by the most recent health check. Kubelets probe readiness more
+// often than anything else, so it reads flags and the snapshot rather than
+// checking the database per probe.
+func (c *Checker) ReadinessCheck() bool {
+	if !c.startup.Load() {
+		return false
+	}
+	snapshot := c.latest.Load()
+	if snapshot == nil || !snapshot.Ready {
 		return false
 	}
+	if !c.ready.Load() {
+		c.ready.Store(true)
+	}
+	return true
+}
 
-	// Check database connectivity
-	dbCheck := c.checkDatabase(ctx)
-	if dbCheck.Status == StatusUnhealthy {
+// readyFor grades checks for readiness. An unhealthy database or a breaker
+// stuck open costs the pod its readiness unless graceful degradation is
+// enabled.
+func (c *Checker) readyFor(checks map[string]*Check) bool {
+	if checks["database"].Status == StatusUnhealthy {
 		// If database is down, we can still serve in degraded mode
 		// but we need to check if graceful degradation is enabled
 		if c.isGracefulDegradationEnabled() {
@@ -120,22 +193,48 @@ func (c *Checker) ReadinessCheck(ctx context.Context) bool {
 		return false
 	}
 
-	c.ready = true
+	// A breaker stuck open means a dependency is effectively down
+	if breakers := checks["circuit_breakers"]; breakers.Status != StatusHealthy && !c.isGracefulDegradationEnabled() {
+		c.logger.Warn("Circuit breaker open too long and graceful degradation disabled - not ready",
+			zap.String("breakers", breakers.Message))
+		return false
+	}
 	return true
 }
 
-func (c *Checker) StartupCheck(ctx context.Context) bool {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return c.startup
+func (c *Checker) StartupCheck() bool {
+	return c.startup.Load()
+}
+
+// Latest returns the most recent health check, whether from the background
+// loop or a caller, unless it is older than two check intervals, e.g.
+// because the loop is stuck on a check
+func (c *Checker) Latest() (*Snapshot, bool) {
+	snapshot := c.latest.Load()
+	if snapshot == nil || time.Since(snapshot.At) > 2*c.interval() {
+		return nil, false
+	}
+	return snapshot, true
+}
+
+// LastStatus returns the status of the most recent health check without
+// running a new one; it is cheap enough for high-frequency sampling
+func (c *Checker) LastStatus() Status {
+	if status, ok := c.lastStatus.Load().(Status); ok {
+		return status
+	}
+	return StatusHealthy
 }
 
 func (c *Checker) IsReady() bool {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return c.ready
+	return c.ready.Load()
 }
 
+// checkDatabase grades the database by the latency of the background probe,
+// or of a ping when there is no recent probe: healthy, degraded when slower
+// than HEALTH_DB_SLOW_PING, and unhealthy when it fails or takes
+// HEALTH_DB_PING_TIMEOUT. A slow database still serves, so it doesn't cost
+// the pod its readiness.
 func (c *Checker) checkDatabase(ctx context.Context) *Check {
 	start := time.Now()
 	check := &Check{
@@ -143,18 +242,29 @@ func (c *Checker) checkDatabase(ctx context.Context) *Check {
 		Timestamp: start,
 	}
 
-	// Create a timeout context for the database check
-	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
-
-	err := c.db.Ping(dbCtx)
+	latency, timedOut, err := c.measureDatabase(ctx)
 	check.Duration = time.Since(start)
 
-	if err != nil {
+	switch {
+	case timedOut:
+		check.Status = StatusUnhealthy
+		check.Message = "Database ping timed out"
+		c.logger.Warn("Database health check timed out", zap.Error(err))
+	case err == nil && latency >= c.dbPingTimeout:
+		check.Status = StatusUnhealthy
+		check.Message = fmt.Sprintf("Database is too slow: ping took %s, over %s",
+			latency.Round(time.Millisecond), c.dbPingTimeout)
+		c.logger.Warn("Database health check is too slow", zap.Duration("duration", latency))
+	case err != nil:
 		check.Status = StatusUnhealthy
 		check.Message = fmt.Sprintf("Database connection failed: %v", err)
 		c.logger.Warn("Database health check failed", zap.Error(err))
-	} else {
+	case latency > c.dbSlowPing:
+		check.Status = StatusDegraded
+		check.Message = fmt.Sprintf("Database is slow: ping took %s, over %s",
+			latency.Round(time.Millisecond), c.dbSlowPing)
+		c.logger.Warn("Database health check is slow", zap.Duration("duration", latency))
+	default:
 		check.Status = StatusHealthy
 		check.Message = "Database connection successful"
 	}
@@ -162,6 +272,27 @@ func (c *Checker) checkDatabase(ctx context.Context) *Check {
 	return check
 }
 
+// measureDatabase returns the latest probe's query latency and outcome. The
+// probe runs on its own connection, so request load neither slows it nor
+// leaves it without a connection. Without a recent probe the primary is
+// pinged through the pool instead.
+func (c *Checker) measureDatabase(ctx context.Context) (latency time.Duration, timedOut bool, err error) {
+	if probe, ok := c.db.LastProbe(); ok {
+		if !probe.OK() {
+			err = errors.New(probe.Error)
+		}
+		return probe.Query.Duration, probe.TimedOut, err
+	}
+
+	dbCtx, cancel := context.WithTimeout(ctx, c.dbPingTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err = c.db.Ping(dbCtx)
+	timedOut = err != nil && dbCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil
+	return time.Since(start), timedOut, err
+}
+
 func (c *Checker) checkMemory() *Check {
 	start := time.Now()
 	check := &Check{
@@ -220,27 +351,58 @@ func (c *Checker) determineOverallStatus(checks map[string]*Check) Status {
 }
 
 func (c *Checker) backgroundHealthCheck() {
-	ticker := time.NewTicker(30 * time.Second)
+	interval := c.interval()
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
+	// Check once right away, so liveness probes have a result to serve
+	c.runBackgroundCheck()
 	for {
 		select {
 		case <-ticker.C:
-			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-			response := c.HealthCheck(ctx)
-			
-			if response.Status != StatusHealthy {
-				c.logger.Warn("Background health check detected issues",
-					zap.String("status", string(response.Status)),
-					zap.Int("failed_checks", c.countFailedChecks(response.Checks)),
-				)
+			// A reloaded interval takes effect from the next tick
+			if current := c.interval(); current != interval {
+				interval = current
+				ticker.Reset(interval)
 			}
-			
-			cancel()
+			c.runBackgroundCheck()
 		}
 	}
 }
 
+func (c *Checker) runBackgroundCheck() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	response := c.HealthCheck(ctx)
+	if response.Status != StatusHealthy {
+		c.logger.Warn("Background health check detected issues",
+			zap.String("status", string(response.Status)),
+			zap.Int("failed_checks", c.countFailedChecks(response.Checks)),
+		)
+	}
+}
+
+func (c *Checker) interval() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.checkInterval
+}
+
+// ApplyConfig adopts the feature flags, check interval, breaker threshold and
+// ping thresholds of a reloaded configuration
+func (c *Checker) ApplyConfig(cfg *config.Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.version = cfg.Version
+	c.features = cfg.Features
+	c.checkInterval = cfg.Health.CheckInterval
+	c.breakerOpenThreshold = cfg.Health.BreakerOpenDegraded
+	c.dbSlowPing = cfg.Health.DBSlowPing
+	c.dbPingTimeout = cfg.Health.DBPingTimeout
+}
+
 func (c *Checker) countFailedChecks(checks map[string]*Check) int {
 	count := 0
 	for _, check := range checks {
@@ -262,22 +424,5 @@ func (c *Checker) isGracefulDegradationEnabled() bool {
 }
 
 func (c *Checker) getEnabledFeatures() []string {
-	featureFlags := getEnvOrDefault("FEATURE_FLAGS", "graceful_degradation,circuit_breaker")
-	if featureFlags == "" {
-		return []string{}
-	}
-	
-	features := strings.Split(featureFlags, ",")
-	for i, feature := range features {
-		features[i] = strings.TrimSpace(feature)
-	}
-	
-	return features
+	return c.features
 }
-
-func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-} 
\ No newline at end of file
@@ -0,0 +1,117 @@
+package health
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// newStartedChecker is a checker past startup whose latest health check is
+// snapshot, as the background loop leaves it
+func newStartedChecker(snapshot *Snapshot) *Checker {
+	c := &Checker{logger: zap.NewNop(), checkInterval: time.Minute}
+	c.startup.Store(true)
+	c.latest.Store(snapshot)
+	return c
+}
+
+func TestReadinessCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		started  bool
+		snapshot *Snapshot
+		want     bool
+	}{
+		{name: "starting", snapshot: &Snapshot{Status: StatusHealthy, Ready: true}},
+		{name: "no health check yet", started: true},
+		{name: "ready", started: true, snapshot: &Snapshot{Status: StatusHealthy, Ready: true}, want: true},
+		{name: "degraded but ready", started: true, snapshot: &Snapshot{Status: StatusDegraded, Ready: true}, want: true},
+		{name: "not ready", started: true, snapshot: &Snapshot{Status: StatusUnhealthy}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Checker{logger: zap.NewNop()}
+			c.startup.Store(tt.started)
+			if tt.snapshot != nil {
+				c.latest.Store(tt.snapshot)
+			}
+
+			if got := c.ReadinessCheck(); got != tt.want {
+				t.Errorf("ReadinessCheck = %v, want %v", got, tt.want)
+			}
+			if c.IsReady() != tt.want {
+				t.Errorf("IsReady = %v after ReadinessCheck returned %v", c.IsReady(), tt.want)
+			}
+		})
+	}
+}
+
+func TestReadyFor(t *testing.T) {
+	healthy := &Check{Status: StatusHealthy}
+	unhealthy := &Check{Status: StatusUnhealthy, Message: "down"}
+	tests := []struct {
+		name     string
+		database *Check
+		breakers *Check
+		features []string
+		want     bool
+	}{
+		{name: "healthy", database: healthy, breakers: healthy, want: true},
+		{name: "slow database", database: &Check{Status: StatusDegraded}, breakers: healthy, want: true},
+		{name: "database down", database: unhealthy, breakers: healthy},
+		{name: "database down, degrading", database: unhealthy, breakers: healthy, features: []string{"graceful_degradation"}, want: true},
+		{name: "breaker stuck open", database: healthy, breakers: &Check{Status: StatusDegraded}},
+		{name: "breaker stuck open, degrading", database: healthy, breakers: &Check{Status: StatusDegraded}, features: []string{"graceful_degradation"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Checker{logger: zap.NewNop(), features: tt.features}
+			checks := map[string]*Check{"database": tt.database, "circuit_breakers": tt.breakers}
+			if got := c.readyFor(checks); got != tt.want {
+				t.Errorf("readyFor = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Probes run on every replica every few seconds, so answering one must not
+// allocate
+func TestProbesDontAllocate(t *testing.T) {
+	c := newStartedChecker(&Snapshot{Status: StatusHealthy, Ready: true, At: time.Now()})
+	probes := map[string]func() bool{
+		"ReadinessCheck": c.ReadinessCheck,
+		"StartupCheck":   c.StartupCheck,
+	}
+	for name, probe := range probes {
+		if allocs := testing.AllocsPerRun(100, func() { probe() }); allocs != 0 {
+			t.Errorf("%s allocates %v times per call, want 0", name, allocs)
+		}
+	}
+}
+
+func BenchmarkReadinessCheck(b *testing.B) {
+	snapshots := map[string]*Snapshot{
+		"ready":     {Status: StatusHealthy, Ready: true, At: time.Now()},
+		"not ready": {Status: StatusUnhealthy, At: time.Now()},
+	}
+	for name, snapshot := range snapshots {
+		b.Run(name, func(b *testing.B) {
+			c := newStartedChecker(snapshot)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				c.ReadinessCheck()
+			}
+		})
+	}
+}
+
+func BenchmarkStartupCheck(b *testing.B) {
+	c := newStartedChecker(&Snapshot{Status: StatusHealthy, Ready: true, At: time.Now()})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c.StartupCheck()
+	}
+}
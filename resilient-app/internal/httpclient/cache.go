@@ -0,0 +1,164 @@
+package httpclient
+
+import (
+	"container/list"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache results reported in Response.Cache and the cache metric
+const (
+	CacheMiss        = "miss"
+	CacheHit         = "hit"
+	CacheRevalidated = "revalidated"
+	CacheStale       = "stale"
+)
+
+// cacheEntry is a stored GET response with its freshness lifetime
+type cacheEntry struct {
+	key          string
+	response     *Response
+	storedAt     time.Time
+	maxAge       time.Duration
+	staleIfError time.Duration
+}
+
+func (e *cacheEntry) fresh(now time.Time) bool {
+	return now.Sub(e.storedAt) < e.maxAge
+}
+
+// usableOnError reports whether the entry may stand in for a failed call
+func (e *cacheEntry) usableOnError(now time.Time) bool {
+	return now.Sub(e.storedAt) < e.maxAge+e.staleIfError
+}
+
+// revalidate adds conditional headers so an unchanged response comes back as 304
+func (e *cacheEntry) revalidate(req *http.Request) {
+	if etag := e.response.Header.Get("ETag"); etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if modified := e.response.Header.Get("Last-Modified"); modified != "" {
+		req.Header.Set("If-Modified-Since", modified)
+	}
+}
+
+// cache is a small LRU of downstream GET responses honoring Cache-Control
+type cache struct {
+	maxEntries   int
+	staleIfError time.Duration
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func newCache(maxEntries int, staleIfError time.Duration) *cache {
+	return &cache{
+		maxEntries:   maxEntries,
+		staleIfError: staleIfError,
+		order:        list.New(),
+		entries:      make(map[string]*list.Element),
+	}
+}
+
+// cacheKey returns the key of a cacheable request, or "" if it must bypass the
+// cache. Requests carrying credentials are never cached since the client is
+// shared by all callers.
+func cacheKey(req *http.Request) string {
+	if req.Method != http.MethodGet || req.Header.Get("Authorization") != "" {
+		return ""
+	}
+	return req.URL.RequestURI()
+}
+
+func (c *cache) get(key string) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*cacheEntry)
+}
+
+// store keeps a successful response unless Cache-Control forbids it
+func (c *cache) store(key string, resp *Response) {
+	directives := parseCacheControl(resp.Header.Get("Cache-Control"))
+	if _, noStore := directives["no-store"]; noStore || resp.StatusCode != http.StatusOK {
+		return
+	}
+
+	entry := &cacheEntry{
+		key:          key,
+		response:     resp,
+		storedAt:     time.Now(),
+		maxAge:       directives.seconds("s-maxage", directives.seconds("max-age", 0)),
+		staleIfError: directives.seconds("stale-if-error", c.staleIfError),
+	}
+	if _, noCache := directives["no-cache"]; noCache {
+		entry.maxAge = 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// refresh restarts the freshness lifetime of an entry the downstream confirmed
+// with a 304, taking updated caching headers from it
+func (c *cache) refresh(entry *cacheEntry, notModified *Response) *Response {
+	merged := &Response{
+		StatusCode: entry.response.StatusCode,
+		Header:     entry.response.Header.Clone(),
+		Body:       entry.response.Body,
+	}
+	for _, name := range []string{"Cache-Control", "ETag", "Expires", "Last-Modified", "Date"} {
+		if value := notModified.Header.Get(name); value != "" {
+			merged.Header.Set(name, value)
+		}
+	}
+	c.store(entry.key, merged)
+	return merged
+}
+
+type cacheControl map[string]string
+
+func parseCacheControl(header string) cacheControl {
+	directives := make(cacheControl)
+	for _, part := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if name != "" {
+			directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+		}
+	}
+	return directives
+}
+
+// seconds returns a delta-seconds directive as a duration, or fallback
+func (d cacheControl) seconds(name string, fallback time.Duration) time.Duration {
+	value, ok := d[name]
+	if !ok {
+		return fallback
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return fallback
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,437 @@
+// Package httpclient is the resilient client for downstream HTTP services.
+// Calls are spread round robin over the downstream's endpoints, skipping ones
+// whose breaker is open or that were ejected as outliers; every call is
+// bounded by a timeout, and each downstream is registered as a dependency.
+// Idempotent GETs are cached according to Cache-Control, and a cached
+// response stands in for a failed call within its stale-if-error window.
+// Calls to each host can be shaped to its published quota with a token bucket.
+// Host lookups are cached, and a cached address outlives a failed DNS lookup
+// for a grace period.
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/demo/resilient-app/internal/dependency"
+	"github.com/demo/resilient-app/internal/disconnect"
+	"github.com/demo/resilient-app/internal/metrics"
+	"github.com/demo/resilient-app/internal/ratelimit"
+	"github.com/sony/gobreaker"
+)
+
+const (
+	// maxBodySize bounds how much of a downstream response is read
+	maxBodySize = 1 << 20
+
+	defaultOutlierFailures = 5
+	defaultBaseEjection    = 30 * time.Second
+	maxEjection            = 5 * time.Minute
+)
+
+var (
+	requestsTotal = metrics.NewCounterVec(
+		metrics.Opts{
+			Name: "http_client_requests_total",
+			Help: "Total number of outbound HTTP requests by dependency, endpoint and outcome",
+		},
+		[]string{"dependency", "endpoint", "outcome"},
+	)
+
+	cacheTotal = metrics.NewCounterVec(
+		metrics.Opts{
+			Name: "http_client_cache_total",
+			Help: "Total number of cacheable outbound requests by dependency and cache result",
+		},
+		[]string{"dependency", "result"},
+	)
+
+	shapingWait = metrics.NewHistogramVec(
+		metrics.Opts{
+			Name:    "http_client_shaping_wait_seconds",
+			Help:    "Time outbound requests queued for a rate-limit token",
+			Buckets: []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1},
+		},
+		[]string{"dependency", "endpoint"},
+	)
+
+	dnsLookups = metrics.NewCounterVec(
+		metrics.Opts{
+			Name: "http_client_dns_lookups_total",
+			Help: "Total number of downstream host resolutions by dependency and result",
+		},
+		[]string{"dependency", "result"},
+	)
+
+	ejectionsTotal = metrics.NewCounterVec(
+		metrics.Opts{
+			Name: "http_client_ejections_total",
+			Help: "Total number of times an endpoint was ejected from rotation as an outlier",
+		},
+		[]string{"dependency", "endpoint"},
+	)
+)
+
+// ErrUnavailable is returned without calling the downstream when no endpoint
+// is in rotation
+var ErrUnavailable = errors.New("downstream unavailable")
+
+// ErrThrottled is returned without calling the downstream when a request
+// would queue longer than RateMaxWait for the host's quota
+var ErrThrottled = errors.New("downstream rate limit exceeded")
+
+// StatusError is returned for 5xx responses, which count as downstream failures
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("downstream responded %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Config describes one downstream service
+type Config struct {
+	Name        string
+	Endpoints   []string
+	Timeout     time.Duration
+	Criticality dependency.Criticality
+
+	// OutlierFailures consecutive failures eject an endpoint for
+	// BaseEjection times the number of ejections in a row (capped at 5m)
+	OutlierFailures int
+	BaseEjection    time.Duration
+
+	// CacheEntries bounds the response cache; 0 disables caching. StaleIfError
+	// applies when a cached response doesn't carry its own stale-if-error.
+	CacheEntries int
+	StaleIfError time.Duration
+
+	// RateLimit shapes calls to each host to this many per second (0 disables)
+	// with bursts of RateBurst; calls queue for up to RateMaxWait before
+	// failing with ErrThrottled
+	RateLimit   float64
+	RateBurst   int
+	RateMaxWait time.Duration
+
+	// DNSTTL caches host lookups (0 resolves on every new connection); for
+	// DNSStale after expiry the last addresses are used if a lookup fails
+	DNSTTL   time.Duration
+	DNSStale time.Duration
+}
+
+// Response is a fully read downstream response
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// Cache is the cache result for cacheable requests (CacheHit etc.)
+	Cache string
+}
+
+type Client struct {
+	name            string
+	http            *http.Client
+	endpoints       []*endpoint
+	next            atomic.Uint64
+	outlierFailures int
+	baseEjection    time.Duration
+	cache           *cache
+	buckets         map[string]*ratelimit.TokenBucket
+	rateMaxWait     time.Duration
+	dependency      *dependency.Dependency
+
+	// mu guards the outlier-ejection state of the endpoints
+	mu sync.Mutex
+}
+
+func New(config Config) (*Client, error) {
+	if len(config.Endpoints) == 0 {
+		return nil, fmt.Errorf("no endpoints configured for %s", config.Name)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.DNSTTL > 0 {
+		transport.DialContext = newResolver(config.Name, config.DNSTTL, config.DNSStale).DialContext
+	}
+
+	c := &Client{
+		name:            config.Name,
+		http:            &http.Client{Timeout: config.Timeout, Transport: transport},
+		outlierFailures: config.OutlierFailures,
+		baseEjection:    config.BaseEjection,
+	}
+	if c.outlierFailures <= 0 {
+		c.outlierFailures = defaultOutlierFailures
+	}
+	if c.baseEjection <= 0 {
+		c.baseEjection = defaultBaseEjection
+	}
+	if config.CacheEntries > 0 {
+		c.cache = newCache(config.CacheEntries, config.StaleIfError)
+	}
+	if config.RateLimit > 0 {
+		c.buckets = make(map[string]*ratelimit.TokenBucket)
+		c.rateMaxWait = config.RateMaxWait
+	}
+
+	urls := make([]string, 0, len(config.Endpoints))
+	for _, raw := range config.Endpoints {
+		base, err := url.Parse(strings.TrimSuffix(strings.TrimSpace(raw), "/"))
+		if err != nil || base.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint %q for %s", raw, config.Name)
+		}
+		c.endpoints = append(c.endpoints, newEndpoint(config.Name, base))
+		urls = append(urls, base.String())
+		if c.buckets != nil && c.buckets[base.Host] == nil {
+			c.buckets[base.Host] = ratelimit.NewTokenBucket(config.RateLimit, config.RateBurst)
+		}
+	}
+
+	c.dependency = dependency.Register(&dependency.Dependency{
+		Name:        config.Name,
+		Type:        "http",
+		Endpoint:    strings.Join(urls, ","),
+		Criticality: config.Criticality,
+		Breaker:     c.breakerSummary,
+		Endpoints:   c.endpointStatuses,
+	})
+	return c, nil
+}
+
+// Get fetches path from the next endpoint in rotation
+func (c *Client) Get(ctx context.Context, path string) (*Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// Do sends a request whose URL is relative (path and query) to the downstream,
+// answering cacheable requests from the cache while fresh and revalidating
+// them once stale. Transport errors and 5xx responses count as failures; for
+// a 5xx both the response and a *StatusError are returned, unless a cached
+// response may be served instead.
+func (c *Client) Do(req *http.Request) (*Response, error) {
+	key := ""
+	if c.cache != nil {
+		key = cacheKey(req)
+	}
+	if key == "" {
+		return c.call(req)
+	}
+
+	now := time.Now()
+	entry := c.cache.get(key)
+	if entry != nil && entry.fresh(now) {
+		return c.fromCache(entry.response, CacheHit), nil
+	}
+	if entry != nil {
+		req = req.Clone(req.Context())
+		entry.revalidate(req)
+	}
+
+	resp, err := c.call(req)
+	switch {
+	case err == nil && entry != nil && resp.StatusCode == http.StatusNotModified:
+		return c.fromCache(c.cache.refresh(entry, resp), CacheRevalidated), nil
+	case err == nil:
+		c.cache.store(key, resp)
+		resp.Cache = CacheMiss
+		cacheTotal.WithLabelValues(c.name, CacheMiss).Inc()
+		return resp, nil
+	case entry != nil && entry.usableOnError(now):
+		return c.fromCache(entry.response, CacheStale), nil
+	}
+	return resp, err
+}
+
+// fromCache returns a copy of a cached response marked with the cache result
+func (c *Client) fromCache(cached *Response, result string) *Response {
+	cacheTotal.WithLabelValues(c.name, result).Inc()
+	resp := *cached
+	resp.Cache = result
+	return &resp
+}
+
+// call sends the request to the next endpoint in rotation, through that
+// endpoint's breaker
+func (c *Client) call(req *http.Request) (*Response, error) {
+	ep := c.pick()
+	if ep == nil {
+		requestsTotal.WithLabelValues(c.name, "", "rejected").Inc()
+		return nil, fmt.Errorf("%s: %w", c.name, ErrUnavailable)
+	}
+
+	if bucket := c.buckets[ep.base.Host]; bucket != nil {
+		wait, err := bucket.Wait(req.Context(), c.rateMaxWait)
+		if err != nil {
+			requestsTotal.WithLabelValues(c.name, ep.base.Host, "throttled").Inc()
+			if errors.Is(err, ratelimit.ErrWaitExceeded) {
+				return nil, fmt.Errorf("%s: %w", c.name, ErrThrottled)
+			}
+			return nil, err
+		}
+		shapingWait.WithLabelValues(c.name, ep.base.Host).Observe(wait.Seconds())
+	}
+
+	target := *ep.base
+	target.Path = ep.base.Path + "/" + strings.TrimPrefix(req.URL.Path, "/")
+	target.RawQuery = req.URL.RawQuery
+	out := req.Clone(req.Context())
+	out.URL = &target
+	out.Host = ""
+
+	var resp *Response
+	_, err := ep.breaker.Execute(func() (interface{}, error) {
+		start := time.Now()
+		var err error
+		resp, err = c.send(out)
+		err = disconnect.Canceled(out.Context(), disconnect.KindDownstream, c.name, err)
+		c.dependency.ObserveCall(time.Since(start), err != nil && !errors.Is(err, context.Canceled))
+		return nil, err
+	})
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		// The caller gave up; that says nothing about the endpoint
+		requestsTotal.WithLabelValues(c.name, ep.base.Host, "canceled").Inc()
+		return nil, err
+	case errors.Is(err, gobreaker.ErrOpenState), errors.Is(err, gobreaker.ErrTooManyRequests):
+		requestsTotal.WithLabelValues(c.name, ep.base.Host, "rejected").Inc()
+		dependency.BreakerRejected(ep.breaker.Name())
+		return nil, fmt.Errorf("%s: %w", c.name, ErrUnavailable)
+	case err != nil:
+		c.record(ep, true)
+		requestsTotal.WithLabelValues(c.name, ep.base.Host, "failure").Inc()
+		return resp, err
+	}
+	c.record(ep, false)
+	requestsTotal.WithLabelValues(c.name, ep.base.Host, "success").Inc()
+	return resp, nil
+}
+
+func (c *Client) send(req *http.Request) (*Response, error) {
+	httpResp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(httpResp.Body, maxBodySize))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &Response{StatusCode: httpResp.StatusCode, Header: httpResp.Header, Body: body}
+	if httpResp.StatusCode >= 500 {
+		return resp, &StatusError{StatusCode: httpResp.StatusCode}
+	}
+	return resp, nil
+}
+
+// pick returns the next endpoint in rotation, or nil if none is available
+func (c *Client) pick() *endpoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	start := c.next.Add(1)
+	for i := range c.endpoints {
+		ep := c.endpoints[(start+uint64(i))%uint64(len(c.endpoints))]
+		if ep.available(now) {
+			return ep
+		}
+	}
+	return nil
+}
+
+// record updates outlier detection after a call. An endpoint is only ejected
+// while another one stays in rotation, so ejection can't take the whole
+// downstream out by itself.
+func (c *Client) record(ep *endpoint, failed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !failed {
+		ep.consecutiveFailures = 0
+		ep.ejections = 0
+		return
+	}
+
+	ep.consecutiveFailures++
+	if ep.consecutiveFailures < c.outlierFailures || !c.othersAvailable(ep) {
+		return
+	}
+
+	ep.consecutiveFailures = 0
+	ep.ejections++
+	ejection := c.baseEjection * time.Duration(ep.ejections)
+	if ejection > maxEjection {
+		ejection = maxEjection
+	}
+	ep.ejectedUntil = time.Now().Add(ejection)
+	ejectionsTotal.WithLabelValues(c.name, ep.base.Host).Inc()
+}
+
+func (c *Client) othersAvailable(ep *endpoint) bool {
+	now := time.Now()
+	for _, other := range c.endpoints {
+		if other != ep && other.available(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// breakerSummary is "closed" when every endpoint is in rotation, "open" when
+// none is, and "partial" otherwise
+func (c *Client) breakerSummary() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	available := 0
+	for _, ep := range c.endpoints {
+		if ep.available(now) {
+			available++
+		}
+	}
+
+	switch available {
+	case len(c.endpoints):
+		return "closed"
+	case 0:
+		return "open"
+	default:
+		return "partial"
+	}
+}
+
+func (c *Client) endpointStatuses() []dependency.EndpointStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	statuses := make([]dependency.EndpointStatus, 0, len(c.endpoints))
+	for _, ep := range c.endpoints {
+		status := dependency.EndpointStatus{
+			URL:          ep.base.String(),
+			Breaker:      ep.breaker.Name(),
+			BreakerState: ep.breaker.State().String(),
+		}
+		if now.Before(ep.ejectedUntil) {
+			status.EjectedUntil = &ep.ejectedUntil
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
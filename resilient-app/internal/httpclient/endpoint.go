@@ -0,0 +1,57 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/demo/resilient-app/internal/dependency"
+	"github.com/demo/resilient-app/internal/events"
+	"github.com/sony/gobreaker"
+)
+
+// endpoint is one instance of the downstream with its own breaker and
+// outlier-ejection state (guarded by the client's mutex)
+type endpoint struct {
+	base    *url.URL
+	breaker *gobreaker.CircuitBreaker
+
+	consecutiveFailures int
+	ejections           int
+	ejectedUntil        time.Time
+}
+
+func newEndpoint(name string, base *url.URL) *endpoint {
+	return &endpoint{
+		base: base,
+		breaker: gobreaker.NewCircuitBreaker(gobreaker.Settings{
+			Name:        name + "@" + base.Host,
+			MaxRequests: 1,
+			Interval:    10 * time.Second,
+			Timeout:     15 * time.Second,
+			ReadyToTrip: func(counts gobreaker.Counts) bool {
+				return counts.Requests >= 5 && float64(counts.TotalFailures)/float64(counts.Requests) >= 0.5
+			},
+			IsSuccessful: func(err error) bool {
+				return err == nil || errors.Is(err, context.Canceled)
+			},
+			OnStateChange: func(name string, from gobreaker.State, to gobreaker.State) {
+				now := time.Now()
+				dependency.BreakerChanged(name, now)
+				events.Publish(events.BreakerStateChanged{
+					Breaker: name,
+					From:    from.String(),
+					To:      to.String(),
+					At:      now,
+				})
+			},
+		}),
+	}
+}
+
+// available reports whether the endpoint is in rotation: not ejected and its
+// breaker not open
+func (e *endpoint) available(now time.Time) bool {
+	return !now.Before(e.ejectedUntil) && e.breaker.State() != gobreaker.StateOpen
+}
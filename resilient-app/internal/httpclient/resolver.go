@@ -0,0 +1,205 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// DNS results reported by the resolver metric
+const (
+	dnsHit       = "hit"
+	dnsMiss      = "miss"
+	dnsRefreshed = "refreshed"
+	dnsStale     = "stale"
+	dnsError     = "error"
+)
+
+const (
+	// refreshJitter spreads background refreshes over the last part of the
+	// TTL so replicas don't query CoreDNS in lockstep
+	refreshJitter = 0.2
+
+	// lookupTimeout bounds a background refresh, which has no caller context
+	lookupTimeout = 2 * time.Second
+
+	// staleRetryInterval is how long stale addresses are served after a
+	// failed lookup before DNS is asked again, so an outage doesn't add a
+	// lookup to every call
+	staleRetryInterval = 5 * time.Second
+)
+
+// resolved is a cached lookup. Past refreshAt the addresses are still served
+// while a refresh runs in the background; past expires a lookup is made
+// inline, and the addresses only stand in for it if it fails before staleUntil.
+type resolved struct {
+	addrs      []string
+	refreshAt  time.Time
+	expires    time.Time
+	staleUntil time.Time
+	refreshing bool
+}
+
+// lookup is an in-flight resolution shared by concurrent callers
+type lookup struct {
+	done  chan struct{}
+	addrs []string
+	err   error
+}
+
+// resolver caches downstream host lookups so transient DNS failures don't
+// fail calls to hosts that were resolved recently
+type resolver struct {
+	name       string
+	ttl        time.Duration
+	stale      time.Duration
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+	dialer     *net.Dialer
+
+	mu      sync.Mutex
+	entries map[string]*resolved
+	pending map[string]*lookup
+}
+
+func newResolver(name string, ttl, stale time.Duration) *resolver {
+	return &resolver{
+		name:       name,
+		ttl:        ttl,
+		stale:      stale,
+		lookupHost: net.DefaultResolver.LookupHost,
+		dialer:     &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		entries:    make(map[string]*resolved),
+		pending:    make(map[string]*lookup),
+	}
+}
+
+// DialContext resolves the host through the cache and dials its addresses in
+// turn until one connects
+func (r *resolver) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) != nil {
+		return r.dialer.DialContext(ctx, network, address)
+	}
+
+	addrs, err := r.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialErr error
+	for _, addr := range addrs {
+		conn, err := r.dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+		if err == nil {
+			return conn, nil
+		}
+		dialErr = errors.Join(dialErr, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, dialErr
+}
+
+func (r *resolver) resolve(ctx context.Context, host string) ([]string, error) {
+	now := time.Now()
+
+	r.mu.Lock()
+	entry := r.entries[host]
+	if entry != nil && now.Before(entry.expires) {
+		if !now.Before(entry.refreshAt) && !entry.refreshing {
+			entry.refreshing = true
+			go r.refresh(host)
+		}
+		r.mu.Unlock()
+		dnsLookups.WithLabelValues(r.name, dnsHit).Inc()
+		return entry.addrs, nil
+	}
+	r.mu.Unlock()
+
+	addrs, err := r.lookup(ctx, host)
+	if err == nil {
+		dnsLookups.WithLabelValues(r.name, dnsMiss).Inc()
+		return addrs, nil
+	}
+
+	r.mu.Lock()
+	entry = r.entries[host]
+	if entry != nil && time.Now().Before(entry.staleUntil) {
+		retry := time.Now().Add(staleRetryInterval)
+		if retry.After(entry.staleUntil) {
+			retry = entry.staleUntil
+		}
+		entry.expires, entry.refreshAt = retry, retry
+		r.mu.Unlock()
+		dnsLookups.WithLabelValues(r.name, dnsStale).Inc()
+		return entry.addrs, nil
+	}
+	r.mu.Unlock()
+	dnsLookups.WithLabelValues(r.name, dnsError).Inc()
+	return nil, err
+}
+
+// refresh re-resolves a host ahead of its expiry; a failure leaves the cached
+// addresses in place
+func (r *resolver) refresh(host string) {
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+
+	_, err := r.lookup(ctx, host)
+
+	r.mu.Lock()
+	if entry := r.entries[host]; entry != nil {
+		entry.refreshing = false
+	}
+	r.mu.Unlock()
+
+	if err != nil {
+		dnsLookups.WithLabelValues(r.name, dnsError).Inc()
+		return
+	}
+	dnsLookups.WithLabelValues(r.name, dnsRefreshed).Inc()
+}
+
+// lookup resolves a host, sharing one query between concurrent callers, and
+// caches a successful result
+func (r *resolver) lookup(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	l := r.pending[host]
+	if l == nil {
+		l = &lookup{done: make(chan struct{})}
+		r.pending[host] = l
+		r.mu.Unlock()
+
+		l.addrs, l.err = r.lookupHost(ctx, host)
+		if l.err == nil && len(l.addrs) == 0 {
+			l.err = &net.DNSError{Err: "no addresses", Name: host}
+		}
+
+		r.mu.Lock()
+		delete(r.pending, host)
+		if l.err == nil {
+			now := time.Now()
+			expires := now.Add(r.ttl)
+			r.entries[host] = &resolved{
+				addrs:      l.addrs,
+				refreshAt:  expires.Add(-time.Duration(rand.Float64() * refreshJitter * float64(r.ttl))),
+				expires:    expires,
+				staleUntil: expires.Add(r.stale),
+			}
+		}
+		r.mu.Unlock()
+		close(l.done)
+		return l.addrs, l.err
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-l.done:
+		return l.addrs, l.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,106 @@
+// Package i18n resolves user-facing strings, service notices and error
+// messages, in the language a request's Accept-Language prefers
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLocale is used when the client accepts none of the catalog's
+// locales, and for keys missing from the one it prefers
+const DefaultLocale = "en"
+
+// catalogFiles holds one file per locale, catalog/<locale>.json, mapping keys
+// to messages. A language is added by adding its file. English error
+// messages are the handlers' own, so en.json only has the notices.
+//
+//go:embed catalog/*.json
+var catalogFiles embed.FS
+
+// catalog maps locale to key to message
+var catalog = func() map[string]map[string]string {
+	entries, err := catalogFiles.ReadDir("catalog")
+	if err != nil {
+		panic("i18n: " + err.Error())
+	}
+	messages := make(map[string]map[string]string, len(entries))
+	for _, entry := range entries {
+		data, err := catalogFiles.ReadFile(path.Join("catalog", entry.Name()))
+		if err != nil {
+			panic("i18n: " + err.Error())
+		}
+		var locale map[string]string
+		if err := json.Unmarshal(data, &locale); err != nil {
+			panic("i18n: invalid " + entry.Name() + ": " + err.Error())
+		}
+		messages[strings.TrimSuffix(entry.Name(), ".json")] = locale
+	}
+	if messages[DefaultLocale] == nil {
+		panic("i18n: no catalog for " + DefaultLocale)
+	}
+	return messages
+}()
+
+// Lookup returns the message for key in the language acceptLanguage prefers,
+// falling back to DefaultLocale, with the locale it is in. Locales the client
+// likes less than DefaultLocale aren't tried. ok is false when none of the
+// locales tried has key.
+func Lookup(key, acceptLanguage string) (message, locale string, ok bool) {
+	for _, locale := range preferred(acceptLanguage) {
+		if locale == DefaultLocale {
+			break
+		}
+		if message, ok := catalog[locale][key]; ok {
+			return message, locale, true
+		}
+	}
+	message, ok = catalog[DefaultLocale][key]
+	if !ok {
+		return "", "", false
+	}
+	return message, DefaultLocale, true
+}
+
+// preferred lists the catalog locales acceptLanguage asks for, most preferred
+// first. A regional tag such as "de-AT" falls back to "de".
+func preferred(acceptLanguage string) []string {
+	if acceptLanguage == "" {
+		return nil
+	}
+
+	type weighted struct {
+		locale string
+		q      float64
+	}
+	var accepted []weighted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil || parsed <= 0 {
+				continue
+			}
+			q = parsed
+		}
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		for _, locale := range []string{tag, strings.SplitN(tag, "-", 2)[0]} {
+			if _, ok := catalog[locale]; ok {
+				accepted = append(accepted, weighted{locale, q})
+				break
+			}
+		}
+	}
+	sort.SliceStable(accepted, func(i, j int) bool { return accepted[i].q > accepted[j].q })
+
+	locales := make([]string, len(accepted))
+	for i, a := range accepted {
+		locales[i] = a.locale
+	}
+	return locales
+}
@@ -0,0 +1,281 @@
+// Package journal keeps the last requests a process served in a fixed-size
+// ring file, so after a crash the post-mortem subcommand can show what it was
+// doing right before it died, in-flight requests included, without a log
+// pipeline. Entries are written by a background goroutine; a write reaches
+// the page cache and survives the process being killed, though not the node
+// crashing.
+package journal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/demo/resilient-app/internal/metrics"
+)
+
+// PreviousSuffix is appended to the journal of the previous process when a
+// new one opens the path
+const PreviousSuffix = ".previous"
+
+// The file is a header, the magic then the slot count, PID, start and clean
+// stop times, followed by the slots. Entry n is in slot (n-1) mod slots.
+const (
+	magic      = "RAJRNL01"
+	headerSize = 64
+	slotSize   = 512
+
+	// Fixed part of a slot: seq, start, duration, status and field lengths
+	slotFixed  = 32
+	maxMethod  = 16
+	maxRequest = 128
+	maxPath    = slotSize - slotFixed - maxMethod - maxRequest
+
+	// queueSize bounds the entries waiting to be written; more are dropped
+	// rather than slow the requests down
+	queueSize = 1024
+)
+
+var droppedTotal = metrics.NewCounterVec(
+	metrics.Opts{
+		Name: "request_journal_dropped_total",
+		Help: "Total number of request journal writes dropped because the writer fell behind",
+	},
+	[]string{},
+)
+
+var byteOrder = binary.LittleEndian
+
+// Entry is one request. Method, path and request ID are truncated to fit the
+// journal's fixed-size slots.
+type Entry struct {
+	Seq       uint64    `json:"seq"`
+	Start     time.Time `json:"start"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	RequestID string    `json:"request_id,omitempty"`
+	// Status is 0 while the request is in flight
+	Status   int           `json:"status"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// InFlight reports whether the request hadn't finished when the entry was
+// last written
+func (e Entry) InFlight() bool {
+	return e.Status == 0
+}
+
+// Journal is the ring file of the running process
+type Journal struct {
+	file  *os.File
+	slots int
+	seq   atomic.Uint64
+
+	// mu guards closing pending, so no entry is sent after Close
+	mu      sync.RWMutex
+	closed  bool
+	pending chan Entry
+	done    chan struct{}
+
+	// written is the seq each slot holds; only the writer uses it
+	written []uint64
+}
+
+// Open starts a journal of the last entries requests at path. A journal
+// already there, the previous process's, is kept at path+PreviousSuffix.
+func Open(path string, entries int) (*Journal, error) {
+	if entries <= 0 {
+		return nil, fmt.Errorf("journal needs at least one entry, got %d", entries)
+	}
+	if err := os.Rename(path, path+PreviousSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("keeping the previous journal: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Truncate(headerSize + int64(entries)*slotSize); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	byteOrder.PutUint32(header[8:], uint32(entries))
+	byteOrder.PutUint32(header[12:], uint32(os.Getpid()))
+	byteOrder.PutUint64(header[16:], uint64(time.Now().UnixNano()))
+	if _, err := file.WriteAt(header, 0); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	j := &Journal{
+		file:    file,
+		slots:   entries,
+		pending: make(chan Entry, queueSize),
+		done:    make(chan struct{}),
+		written: make([]uint64, entries),
+	}
+	go j.write()
+	return j, nil
+}
+
+// Begin records a request that started, numbering it; the entry returned is
+// passed to Finish once it is served
+func (j *Journal) Begin(e Entry) Entry {
+	e.Seq = j.seq.Add(1)
+	e.Status, e.Duration = 0, 0
+	j.queue(e)
+	return e
+}
+
+// Finish records the status and duration of a request Begin recorded
+func (j *Journal) Finish(e Entry) {
+	j.queue(e)
+}
+
+func (j *Journal) queue(e Entry) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	if j.closed {
+		return
+	}
+	select {
+	case j.pending <- e:
+	default:
+		droppedTotal.WithLabelValues().Inc()
+	}
+}
+
+func (j *Journal) write() {
+	defer close(j.done)
+	slot := make([]byte, slotSize)
+	for e := range j.pending {
+		i := int((e.Seq - 1) % uint64(j.slots))
+		// A request that outlived a full turn of the ring no longer owns its
+		// slot
+		if j.written[i] > e.Seq {
+			continue
+		}
+		encode(slot, e)
+		if _, err := j.file.WriteAt(slot, headerSize+int64(i)*slotSize); err != nil {
+			droppedTotal.WithLabelValues().Inc()
+			continue
+		}
+		j.written[i] = e.Seq
+	}
+}
+
+// Close writes the pending entries and marks the journal as shut down
+// cleanly
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	if j.closed {
+		j.mu.Unlock()
+		return nil
+	}
+	j.closed = true
+	close(j.pending)
+	j.mu.Unlock()
+	<-j.done
+
+	stopped := make([]byte, 8)
+	byteOrder.PutUint64(stopped, uint64(time.Now().UnixNano()))
+	_, err := j.file.WriteAt(stopped, 24)
+	return errors.Join(err, j.file.Sync(), j.file.Close())
+}
+
+func encode(slot []byte, e Entry) {
+	clear(slot)
+	method, requestID, path := truncate(e.Method, maxMethod), truncate(e.RequestID, maxRequest), truncate(e.Path, maxPath)
+	byteOrder.PutUint64(slot[0:], e.Seq)
+	byteOrder.PutUint64(slot[8:], uint64(e.Start.UnixNano()))
+	byteOrder.PutUint64(slot[16:], uint64(e.Duration))
+	byteOrder.PutUint16(slot[24:], uint16(e.Status))
+	slot[26] = byte(len(method))
+	slot[27] = byte(len(requestID))
+	byteOrder.PutUint16(slot[28:], uint16(len(path)))
+	copy(slot[slotFixed:], method)
+	copy(slot[slotFixed+maxMethod:], requestID)
+	copy(slot[slotFixed+maxMethod+maxRequest:], path)
+}
+
+func decode(slot []byte) Entry {
+	methodLen := min(int(slot[26]), maxMethod)
+	requestLen := min(int(slot[27]), maxRequest)
+	pathLen := min(int(byteOrder.Uint16(slot[28:])), maxPath)
+	return Entry{
+		Seq:       byteOrder.Uint64(slot[0:]),
+		Start:     time.Unix(0, int64(byteOrder.Uint64(slot[8:]))),
+		Duration:  time.Duration(byteOrder.Uint64(slot[16:])),
+		Status:    int(byteOrder.Uint16(slot[24:])),
+		Method:    string(slot[slotFixed : slotFixed+methodLen]),
+		RequestID: string(slot[slotFixed+maxMethod : slotFixed+maxMethod+requestLen]),
+		Path:      string(slot[slotFixed+maxMethod+maxRequest : slotFixed+maxMethod+maxRequest+pathLen]),
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// Run is a journal read back from its file
+type Run struct {
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
+	// Stopped is nil when the process didn't shut down cleanly
+	Stopped *time.Time `json:"stopped,omitempty"`
+	// Entries are the requests the journal held, oldest first
+	Entries []Entry `json:"entries"`
+}
+
+// Clean reports whether the process closed the journal on shutdown
+func (r Run) Clean() bool {
+	return r.Stopped != nil
+}
+
+// Read reads the journal at path, usually one a process left behind
+func Read(path string) (Run, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Run{}, err
+	}
+	defer file.Close()
+
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(file, header); err != nil || string(header[:8]) != magic {
+		return Run{}, fmt.Errorf("%s is not a request journal", path)
+	}
+	run := Run{
+		PID:     int(byteOrder.Uint32(header[12:])),
+		Started: time.Unix(0, int64(byteOrder.Uint64(header[16:]))),
+	}
+	if stopped := int64(byteOrder.Uint64(header[24:])); stopped != 0 {
+		t := time.Unix(0, stopped)
+		run.Stopped = &t
+	}
+
+	slots := int(byteOrder.Uint32(header[8:]))
+	run.Entries = make([]Entry, 0, slots)
+	slot := make([]byte, slotSize)
+	for i := 0; i < slots; i++ {
+		if _, err := io.ReadFull(file, slot); err != nil {
+			return Run{}, fmt.Errorf("reading %s: %w", path, err)
+		}
+		// Unused slots are zero
+		if e := decode(slot); e.Seq != 0 {
+			run.Entries = append(run.Entries, e)
+		}
+	}
+	sort.Slice(run.Entries, func(i, k int) bool { return run.Entries[i].Seq < run.Entries[k].Seq })
+	return run, nil
+}
@@ -0,0 +1,23 @@
+package logging
+
+import (
+	"context"
+
+	"github.com/demo/resilient-app/internal/ctxkeys"
+	"go.uber.org/zap"
+)
+
+// WithLogger attaches a request-scoped logger carrying correlation fields
+func WithLogger(ctx context.Context, logger *zap.Logger) context.Context {
+	return ctxkeys.Logger.With(ctx, logger)
+}
+
+// FromContext returns the request-scoped logger, or fallback outside a request
+func FromContext(ctx context.Context, fallback *zap.Logger) *zap.Logger {
+	if ctx != nil {
+		if logger, ok := ctxkeys.Logger.Lookup(ctx); ok && logger != nil {
+			return logger
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,100 @@
+package logging
+
+import (
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestPIIModes(t *testing.T) {
+	tests := []struct {
+		mode string
+		// name, email and message are what the log shows for "Jane Doe",
+		// "jane@example.com" and a message quoting that email; hashes are
+		// the first 6 bytes of the SHA-256
+		name    string
+		email   string
+		message string
+	}{
+		{
+			mode:    PIIHash,
+			name:    "sha256:01332c876518",
+			email:   "sha256:8c87b489ce35",
+			message: "lookup failed for sha256:8c87b489ce35",
+		},
+		{
+			mode:    PIITruncate,
+			name:    "J***",
+			email:   "j***@example.com",
+			message: "lookup failed for j***@example.com",
+		},
+		{
+			mode:    PIIRedact,
+			name:    Redacted,
+			email:   Redacted,
+			message: "lookup failed for " + Redacted,
+		},
+		{
+			mode:    PIIPlain,
+			name:    "Jane Doe",
+			email:   "jane@example.com",
+			message: "lookup failed for jane@example.com",
+		},
+		{
+			// An unknown mode fails closed
+			mode:    "mask",
+			name:    Redacted,
+			email:   Redacted,
+			message: "lookup failed for " + Redacted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			core, logs := observer.New(zapcore.DebugLevel)
+			logger := zap.New(NewRedactingCore(core, NewRedactor(DefaultSensitiveKeys, tt.mode)))
+
+			logger.Info("lookup failed for jane@example.com",
+				PII("name", "Jane Doe"),
+				PII("email", "jane@example.com"),
+				PII("empty", ""),
+			)
+
+			entry := logs.All()[0]
+			if entry.Message != tt.message {
+				t.Errorf("message = %q, want %q", entry.Message, tt.message)
+			}
+			fields := entry.ContextMap()
+			for key, want := range map[string]string{"name": tt.name, "email": tt.email, "empty": ""} {
+				if got := fields[key]; got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPIIHashCorrelates(t *testing.T) {
+	first := sanitizePII(PIIHash, "jane@example.com")
+	if again := sanitizePII(PIIHash, "jane@example.com"); again != first {
+		t.Errorf("hashing the same value gave %q and %q", first, again)
+	}
+	if other := sanitizePII(PIIHash, "john@example.com"); other == first {
+		t.Errorf("different values hash to the same %q", first)
+	}
+	if strings.Contains(first, "jane") {
+		t.Errorf("hash %q shows the value", first)
+	}
+}
+
+func TestPIIWithoutRedactingCore(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	zap.New(core).Info("created", PII("email", "jane@example.com"))
+
+	if got := logs.All()[0].ContextMap()["email"]; got != Redacted {
+		t.Errorf("email = %q without a redacting core, want %q", got, Redacted)
+	}
+}
@@ -0,0 +1,141 @@
+// Package memtune sizes the garbage collector to the container. Go doesn't
+// know about the cgroup memory limit, so by default a bursty heap grows until
+// the kernel OOM-kills the pod; a soft memory limit just below the container
+// limit makes the collector work harder as the heap approaches it instead.
+// GOGC and GOMEMLIMIT set in the environment always win, since the runtime
+// has already applied them.
+package memtune
+
+import (
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Sources of the memory limit
+const (
+	SourceEnv    = "GOMEMLIMIT"
+	SourceCgroup = "cgroup"
+	SourceNone   = "none"
+)
+
+// cgroupFiles hold the container memory limit under cgroup v2 and v1
+var cgroupFiles = []string{
+	"/sys/fs/cgroup/memory.max",
+	"/sys/fs/cgroup/memory/memory.limit_in_bytes",
+}
+
+// unlimited is the smallest value cgroup v1 reports for no limit
+const unlimited = 1 << 62
+
+// Config for tuning the collector
+type Config struct {
+	// GCPercent is GOGC; 0 keeps the runtime default
+	GCPercent int
+	// LimitRatio is the share of the container memory limit set as the soft
+	// memory limit; 0 leaves the runtime without one
+	LimitRatio float64
+	// BallastBytes are allocated once and never touched, raising the heap
+	// size GOGC grows from without using physical memory
+	BallastBytes int64
+}
+
+// Settings are the values in effect after Apply
+type Settings struct {
+	GCPercent      int    `json:"gc_percent"`
+	MemoryLimit    int64  `json:"memory_limit_bytes,omitempty"`
+	LimitSource    string `json:"memory_limit_source"`
+	ContainerLimit int64  `json:"container_limit_bytes,omitempty"`
+	BallastBytes   int64  `json:"ballast_bytes"`
+}
+
+// Status is the applied settings with the current heap
+type Status struct {
+	Settings
+	HeapAllocBytes uint64  `json:"heap_alloc_bytes"`
+	NextGCBytes    uint64  `json:"next_gc_bytes"`
+	NumGC          uint32  `json:"num_gc"`
+	GCPauseTotalMS float64 `json:"gc_pause_total_ms"`
+}
+
+var (
+	applied atomic.Pointer[Settings]
+	// ballast is kept reachable for the life of the process
+	ballast []byte
+)
+
+// Apply sets GOGC, the soft memory limit and the ballast from cfg, unless
+// the environment already set them
+func Apply(cfg Config) Settings {
+	settings := Settings{LimitSource: SourceNone}
+
+	if _, ok := os.LookupEnv("GOGC"); !ok && cfg.GCPercent > 0 {
+		debug.SetGCPercent(cfg.GCPercent)
+	}
+	// SetGCPercent reports the previous value, the only way to read it
+	settings.GCPercent = debug.SetGCPercent(-1)
+	debug.SetGCPercent(settings.GCPercent)
+
+	settings.ContainerLimit = containerLimit()
+	switch {
+	case os.Getenv("GOMEMLIMIT") != "":
+		settings.LimitSource = SourceEnv
+		// GOMEMLIMIT=off leaves the limit at math.MaxInt64, reported as none
+		if limit := debug.SetMemoryLimit(-1); limit != math.MaxInt64 {
+			settings.MemoryLimit = limit
+		}
+	case settings.ContainerLimit > 0 && cfg.LimitRatio > 0:
+		settings.LimitSource = SourceCgroup
+		settings.MemoryLimit = int64(float64(settings.ContainerLimit) * cfg.LimitRatio)
+		debug.SetMemoryLimit(settings.MemoryLimit)
+	}
+
+	if cfg.BallastBytes > 0 && ballast == nil {
+		ballast = make([]byte, cfg.BallastBytes)
+		settings.BallastBytes = cfg.BallastBytes
+	}
+
+	applied.Store(&settings)
+	return settings
+}
+
+// Current returns the applied settings and the heap's current state
+func Current() Status {
+	var status Status
+	if settings := applied.Load(); settings != nil {
+		status.Settings = *settings
+	}
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	status.HeapAllocBytes = stats.HeapAlloc
+	status.NextGCBytes = stats.NextGC
+	status.NumGC = stats.NumGC
+	status.GCPauseTotalMS = float64(stats.PauseTotalNs) / float64(time.Millisecond)
+	return status
+}
+
+// containerLimit reads the cgroup memory limit, or 0 when there is none
+func containerLimit() int64 {
+	for _, path := range cgroupFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		value := strings.TrimSpace(string(data))
+		if value == "max" {
+			return 0
+		}
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || limit <= 0 || limit >= unlimited {
+			return 0
+		}
+		return limit
+	}
+	return 0
+}
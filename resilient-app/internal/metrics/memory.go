@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+)
+
+// Memory keeps metrics in memory so tests can assert on what was emitted
+// without scraping the text exposition
+type Memory struct {
+	mu           sync.Mutex
+	values       map[string]float64
+	observations map[string][]float64
+	gaugeFuncs   map[string]CollectFunc
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		values:       make(map[string]float64),
+		observations: make(map[string][]float64),
+		gaugeFuncs:   make(map[string]CollectFunc),
+	}
+}
+
+// Value returns the current counter or gauge value for the label values. A
+// gauge declared with NewGaugeFunc is read from its CollectFunc.
+func (m *Memory) Value(name string, labelValues ...string) float64 {
+	m.mu.Lock()
+	collect, ok := m.gaugeFuncs[name]
+	value := m.values[memoryKey(name, labelValues)]
+	m.mu.Unlock()
+	if !ok {
+		return value
+	}
+
+	key := memoryKey(name, labelValues)
+	value = 0
+	collect(func(v float64, values ...string) {
+		if memoryKey(name, values) == key {
+			value = v
+		}
+	})
+	return value
+}
+
+// Observations returns every histogram observation for the label values
+func (m *Memory) Observations(name string, labelValues ...string) []float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]float64(nil), m.observations[memoryKey(name, labelValues)]...)
+}
+
+// Reset clears everything recorded so far
+func (m *Memory) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values = make(map[string]float64)
+	m.observations = make(map[string][]float64)
+}
+
+func (m *Memory) Counter(desc Desc) CounterBackend {
+	return memoryInstrument{m: m, name: desc.Name}
+}
+
+func (m *Memory) Gauge(desc Desc) GaugeBackend {
+	return memoryInstrument{m: m, name: desc.Name}
+}
+
+func (m *Memory) Histogram(desc Desc) HistogramBackend {
+	return memoryInstrument{m: m, name: desc.Name}
+}
+
+func (m *Memory) GaugeFunc(desc Desc, collect CollectFunc) {
+	m.mu.Lock()
+	m.gaugeFuncs[desc.Name] = collect
+	m.mu.Unlock()
+}
+
+type memoryInstrument struct {
+	m    *Memory
+	name string
+}
+
+func (i memoryInstrument) Add(labelValues []string, delta float64) {
+	i.m.mu.Lock()
+	i.m.values[memoryKey(i.name, labelValues)] += delta
+	i.m.mu.Unlock()
+}
+
+func (i memoryInstrument) Set(labelValues []string, value float64) {
+	i.m.mu.Lock()
+	i.m.values[memoryKey(i.name, labelValues)] = value
+	i.m.mu.Unlock()
+}
+
+func (i memoryInstrument) Observe(labelValues []string, value float64) {
+	i.m.mu.Lock()
+	key := memoryKey(i.name, labelValues)
+	i.m.observations[key] = append(i.m.observations[key], value)
+	i.m.mu.Unlock()
+}
+
+func memoryKey(name string, labelValues []string) string {
+	return name + "{" + strings.Join(labelValues, ",") + "}"
+}
@@ -0,0 +1,268 @@
+package metrics
+
+import (
+	"sync"
+)
+
+// Opts describes a metric independently of the backend that records it
+type Opts struct {
+	Name string
+	Help string
+
+	// Buckets for histograms; nil uses the backend's defaults
+	Buckets []float64
+}
+
+// Desc is a fully declared metric as handed to backends
+type Desc struct {
+	Opts
+	Labels []string
+}
+
+// Backend records metrics in a concrete system (Prometheus, statsd, memory).
+// Label values are passed in the order of Desc.Labels.
+type Backend interface {
+	Counter(desc Desc) CounterBackend
+	Gauge(desc Desc) GaugeBackend
+	Histogram(desc Desc) HistogramBackend
+	// GaugeFunc reads the gauge from collect whenever the backend exports it
+	GaugeFunc(desc Desc, collect CollectFunc)
+}
+
+type CounterBackend interface {
+	Add(labelValues []string, delta float64)
+}
+
+type GaugeBackend interface {
+	Set(labelValues []string, value float64)
+	Add(labelValues []string, delta float64)
+}
+
+type HistogramBackend interface {
+	Observe(labelValues []string, value float64)
+}
+
+// CollectFunc emits the current value of a gauge for every set of label
+// values it has. It is called when the gauge is exported, e.g. on every
+// scrape, so it must be cheap and safe for concurrent use.
+type CollectFunc func(emit func(value float64, labelValues ...string))
+
+// Registry holds every declared metric and fans emissions out to the attached
+// backends. Metrics can be declared (e.g. in package-level vars) before any
+// backend is attached; emissions made before that are dropped.
+type Registry struct {
+	mu         sync.Mutex
+	backends   []Backend
+	counters   map[string]*CounterVec
+	gauges     map[string]*GaugeVec
+	histograms map[string]*HistogramVec
+	gaugeFuncs map[string]*GaugeFunc
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		counters:   make(map[string]*CounterVec),
+		gauges:     make(map[string]*GaugeVec),
+		histograms: make(map[string]*HistogramVec),
+		gaugeFuncs: make(map[string]*GaugeFunc),
+	}
+}
+
+// Default is the registry used by the package-level constructors
+var Default = NewRegistry()
+
+// AddBackend binds every declared and future metric to the backend
+func (r *Registry) AddBackend(backend Backend) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.backends = append(r.backends, backend)
+	for _, v := range r.counters {
+		v.bind(backend.Counter(v.desc))
+	}
+	for _, v := range r.gauges {
+		v.bind(backend.Gauge(v.desc))
+	}
+	for _, v := range r.histograms {
+		v.bind(backend.Histogram(v.desc))
+	}
+	for _, g := range r.gaugeFuncs {
+		backend.GaugeFunc(g.desc, g.collect)
+	}
+}
+
+// NewCounterVec declares a counter; declaring the same name again returns the existing one
+func (r *Registry) NewCounterVec(opts Opts, labels []string) *CounterVec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if v, ok := r.counters[opts.Name]; ok {
+		return v
+	}
+	v := &CounterVec{vec: vec[CounterBackend]{desc: Desc{Opts: opts, Labels: labels}}}
+	for _, backend := range r.backends {
+		v.bind(backend.Counter(v.desc))
+	}
+	r.counters[opts.Name] = v
+	return v
+}
+
+// NewGaugeVec declares a gauge; declaring the same name again returns the existing one
+func (r *Registry) NewGaugeVec(opts Opts, labels []string) *GaugeVec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if v, ok := r.gauges[opts.Name]; ok {
+		return v
+	}
+	v := &GaugeVec{vec: vec[GaugeBackend]{desc: Desc{Opts: opts, Labels: labels}}}
+	for _, backend := range r.backends {
+		v.bind(backend.Gauge(v.desc))
+	}
+	r.gauges[opts.Name] = v
+	return v
+}
+
+// NewHistogramVec declares a histogram; declaring the same name again returns the existing one
+func (r *Registry) NewHistogramVec(opts Opts, labels []string) *HistogramVec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if v, ok := r.histograms[opts.Name]; ok {
+		return v
+	}
+	v := &HistogramVec{vec: vec[HistogramBackend]{desc: Desc{Opts: opts, Labels: labels}}}
+	for _, backend := range r.backends {
+		v.bind(backend.Histogram(v.desc))
+	}
+	r.histograms[opts.Name] = v
+	return v
+}
+
+// NewGaugeFunc declares a gauge read from collect when exported rather than
+// set as things change, for state that is authoritative elsewhere; declaring
+// the same name again returns the existing one
+func (r *Registry) NewGaugeFunc(opts Opts, labels []string, collect CollectFunc) *GaugeFunc {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if g, ok := r.gaugeFuncs[opts.Name]; ok {
+		return g
+	}
+	g := &GaugeFunc{desc: Desc{Opts: opts, Labels: labels}, collect: collect}
+	for _, backend := range r.backends {
+		backend.GaugeFunc(g.desc, g.collect)
+	}
+	r.gaugeFuncs[opts.Name] = g
+	return g
+}
+
+func NewCounterVec(opts Opts, labels []string) *CounterVec {
+	return Default.NewCounterVec(opts, labels)
+}
+
+func NewGaugeVec(opts Opts, labels []string) *GaugeVec {
+	return Default.NewGaugeVec(opts, labels)
+}
+
+func NewHistogramVec(opts Opts, labels []string) *HistogramVec {
+	return Default.NewHistogramVec(opts, labels)
+}
+
+func NewGaugeFunc(opts Opts, labels []string, collect CollectFunc) *GaugeFunc {
+	return Default.NewGaugeFunc(opts, labels, collect)
+}
+
+// vec holds the per-backend instruments of one metric
+type vec[B any] struct {
+	desc     Desc
+	mu       sync.RWMutex
+	backends []B
+}
+
+func (v *vec[B]) bind(backend B) {
+	v.mu.Lock()
+	v.backends = append(v.backends, backend)
+	v.mu.Unlock()
+}
+
+func (v *vec[B]) each(fn func(B)) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	for _, backend := range v.backends {
+		fn(backend)
+	}
+}
+
+type CounterVec struct {
+	vec[CounterBackend]
+}
+
+func (v *CounterVec) WithLabelValues(values ...string) Counter {
+	return Counter{vec: v, labels: values}
+}
+
+type Counter struct {
+	vec    *CounterVec
+	labels []string
+}
+
+func (c Counter) Inc() {
+	c.Add(1)
+}
+
+func (c Counter) Add(delta float64) {
+	c.vec.each(func(b CounterBackend) { b.Add(c.labels, delta) })
+}
+
+type GaugeVec struct {
+	vec[GaugeBackend]
+}
+
+func (v *GaugeVec) WithLabelValues(values ...string) Gauge {
+	return Gauge{vec: v, labels: values}
+}
+
+type Gauge struct {
+	vec    *GaugeVec
+	labels []string
+}
+
+func (g Gauge) Set(value float64) {
+	g.vec.each(func(b GaugeBackend) { b.Set(g.labels, value) })
+}
+
+func (g Gauge) Add(delta float64) {
+	g.vec.each(func(b GaugeBackend) { b.Add(g.labels, delta) })
+}
+
+func (g Gauge) Inc() {
+	g.Add(1)
+}
+
+func (g Gauge) Dec() {
+	g.Add(-1)
+}
+
+type HistogramVec struct {
+	vec[HistogramBackend]
+}
+
+func (v *HistogramVec) WithLabelValues(values ...string) Histogram {
+	return Histogram{vec: v, labels: values}
+}
+
+type Histogram struct {
+	vec    *HistogramVec
+	labels []string
+}
+
+func (h Histogram) Observe(value float64) {
+	h.vec.each(func(b HistogramBackend) { b.Observe(h.labels, value) })
+}
+
+// GaugeFunc is a gauge declared with NewGaugeFunc; there is nothing to set
+type GaugeFunc struct {
+	desc    Desc
+	collect CollectFunc
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Prometheus registers metrics with a Prometheus registerer for /metrics scraping
+type Prometheus struct {
+	registerer prometheus.Registerer
+}
+
+func NewPrometheus(registerer prometheus.Registerer) *Prometheus {
+	return &Prometheus{registerer: registerer}
+}
+
+func (p *Prometheus) Counter(desc Desc) CounterBackend {
+	v := prometheus.NewCounterVec(prometheus.CounterOpts{Name: desc.Name, Help: desc.Help}, desc.Labels)
+	p.registerer.MustRegister(v)
+	return promCounter{v}
+}
+
+func (p *Prometheus) Gauge(desc Desc) GaugeBackend {
+	v := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: desc.Name, Help: desc.Help}, desc.Labels)
+	p.registerer.MustRegister(v)
+	return promGauge{v}
+}
+
+func (p *Prometheus) Histogram(desc Desc) HistogramBackend {
+	v := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    desc.Name,
+		Help:    desc.Help,
+		Buckets: desc.Buckets,
+	}, desc.Labels)
+	p.registerer.MustRegister(v)
+	return promHistogram{v}
+}
+
+func (p *Prometheus) GaugeFunc(desc Desc, collect CollectFunc) {
+	p.registerer.MustRegister(promGaugeFunc{
+		desc:    prometheus.NewDesc(desc.Name, desc.Help, desc.Labels, nil),
+		collect: collect,
+	})
+}
+
+type promCounter struct{ vec *prometheus.CounterVec }
+
+func (c promCounter) Add(labelValues []string, delta float64) {
+	c.vec.WithLabelValues(labelValues...).Add(delta)
+}
+
+type promGauge struct{ vec *prometheus.GaugeVec }
+
+func (g promGauge) Set(labelValues []string, value float64) {
+	g.vec.WithLabelValues(labelValues...).Set(value)
+}
+
+func (g promGauge) Add(labelValues []string, delta float64) {
+	g.vec.WithLabelValues(labelValues...).Add(delta)
+}
+
+type promHistogram struct{ vec *prometheus.HistogramVec }
+
+func (h promHistogram) Observe(labelValues []string, value float64) {
+	h.vec.WithLabelValues(labelValues...).Observe(value)
+}
+
+// promGaugeFunc is a collector reading the gauge on every scrape
+type promGaugeFunc struct {
+	desc    *prometheus.Desc
+	collect CollectFunc
+}
+
+func (g promGaugeFunc) Describe(ch chan<- *prometheus.Desc) {
+	ch <- g.desc
+}
+
+func (g promGaugeFunc) Collect(ch chan<- prometheus.Metric) {
+	g.collect(func(value float64, labelValues ...string) {
+		ch <- prometheus.MustNewConstMetric(g.desc, prometheus.GaugeValue, value, labelValues...)
+	})
+}
@@ -0,0 +1,18 @@
+package metrics
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// Push sends a snapshot of everything gathered to a Prometheus Pushgateway,
+// grouped by instance. Terminating pods use it because scrapes usually miss
+// their last seconds.
+func Push(ctx context.Context, url, job, instance string, gatherer prometheus.Gatherer) error {
+	return push.New(url, job).
+		Gatherer(gatherer).
+		Grouping("instance", instance).
+		PushContext(ctx)
+}
@@ -0,0 +1,235 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Stay under common MTUs so datagrams are never fragmented
+	statsdMaxPacketSize = 1432
+	statsdFlushInterval = time.Second
+)
+
+var statsdTagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_", " ", "_")
+
+// StatsD emits metrics as DogStatsD datagrams over UDP. Labels become tags
+// (label:value), so dashboards can slice by the same dimensions as in Prometheus.
+// Lines are batched into packets and flushed every second or when a packet is full.
+type StatsD struct {
+	conn   net.Conn
+	prefix string
+	tags   []string
+
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	gauges map[string]float64
+	// gaugeFuncs are read and sent on every flush
+	gaugeFuncs []statsdGaugeFunc
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// NewStatsD sends to addr (host:port of the agent); prefix is prepended to every
+// metric name and tags are added to every line
+func NewStatsD(addr, prefix string, tags []string) (*StatsD, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &StatsD{
+		conn:   conn,
+		prefix: prefix,
+		gauges: make(map[string]float64),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			s.tags = append(s.tags, statsdTagReplacer.Replace(tag))
+		}
+	}
+
+	go s.flushLoop()
+	return s, nil
+}
+
+// Close flushes pending lines and closes the connection
+func (s *StatsD) Close(ctx context.Context) error {
+	s.once.Do(func() { close(s.stop) })
+
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	s.mu.Lock()
+	s.flushLocked()
+	s.mu.Unlock()
+	return s.conn.Close()
+}
+
+func (s *StatsD) Counter(desc Desc) CounterBackend {
+	return statsdInstrument{s: s, desc: desc}
+}
+
+func (s *StatsD) Gauge(desc Desc) GaugeBackend {
+	return statsdGauge{s: s, desc: desc}
+}
+
+func (s *StatsD) Histogram(desc Desc) HistogramBackend {
+	return statsdInstrument{s: s, desc: desc}
+}
+
+func (s *StatsD) GaugeFunc(desc Desc, collect CollectFunc) {
+	s.mu.Lock()
+	s.gaugeFuncs = append(s.gaugeFuncs, statsdGaugeFunc{desc: desc, collect: collect})
+	s.mu.Unlock()
+}
+
+type statsdInstrument struct {
+	s    *StatsD
+	desc Desc
+}
+
+func (i statsdInstrument) Add(labelValues []string, delta float64) {
+	i.s.write(i.desc, labelValues, delta, "c")
+}
+
+func (i statsdInstrument) Observe(labelValues []string, value float64) {
+	i.s.write(i.desc, labelValues, value, "h")
+}
+
+// statsdGauge tracks values locally because DogStatsD gauges are absolute
+type statsdGauge struct {
+	s    *StatsD
+	desc Desc
+}
+
+func (g statsdGauge) Set(labelValues []string, value float64) {
+	g.s.updateGauge(g.desc, labelValues, func(float64) float64 { return value })
+}
+
+func (g statsdGauge) Add(labelValues []string, delta float64) {
+	g.s.updateGauge(g.desc, labelValues, func(current float64) float64 { return current + delta })
+}
+
+func (s *StatsD) updateGauge(desc Desc, labelValues []string, update func(float64) float64) {
+	key := desc.Name + "{" + strings.Join(labelValues, ",") + "}"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value := update(s.gauges[key])
+	s.gauges[key] = value
+	s.appendLocked(s.line(desc, labelValues, value, "g"))
+}
+
+type statsdGaugeFunc struct {
+	desc    Desc
+	collect CollectFunc
+}
+
+// collectGauges reads every gauge declared with NewGaugeFunc into the pending
+// packet. The gauges are read without the lock held, since they may take
+// locks of their own.
+func (s *StatsD) collectGauges() {
+	s.mu.Lock()
+	gaugeFuncs := s.gaugeFuncs
+	s.mu.Unlock()
+
+	var lines [][]byte
+	for _, g := range gaugeFuncs {
+		g.collect(func(value float64, labelValues ...string) {
+			lines = append(lines, s.line(g.desc, labelValues, value, "g"))
+		})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, line := range lines {
+		s.appendLocked(line)
+	}
+}
+
+func (s *StatsD) write(desc Desc, labelValues []string, value float64, kind string) {
+	line := s.line(desc, labelValues, value, kind)
+
+	s.mu.Lock()
+	s.appendLocked(line)
+	s.mu.Unlock()
+}
+
+// line formats name:value|type|#tag:value,...
+func (s *StatsD) line(desc Desc, labelValues []string, value float64, kind string) []byte {
+	var b bytes.Buffer
+	b.WriteString(s.prefix)
+	b.WriteString(desc.Name)
+	b.WriteByte(':')
+	b.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	b.WriteByte('|')
+	b.WriteString(kind)
+
+	if len(s.tags) > 0 || len(labelValues) > 0 {
+		b.WriteString("|#")
+		b.WriteString(strings.Join(s.tags, ","))
+		for i, value := range labelValues {
+			if i > 0 || len(s.tags) > 0 {
+				b.WriteByte(',')
+			}
+			if i < len(desc.Labels) {
+				b.WriteString(desc.Labels[i])
+				b.WriteByte(':')
+			}
+			b.WriteString(statsdTagReplacer.Replace(value))
+		}
+	}
+	return b.Bytes()
+}
+
+func (s *StatsD) appendLocked(line []byte) {
+	if s.buf.Len() > 0 && s.buf.Len()+1+len(line) > statsdMaxPacketSize {
+		s.flushLocked()
+	}
+	if s.buf.Len() > 0 {
+		s.buf.WriteByte('\n')
+	}
+	s.buf.Write(line)
+}
+
+// flushLocked sends the pending packet; UDP errors (no agent listening) are
+// ignored because metrics must never affect request handling
+func (s *StatsD) flushLocked() {
+	if s.buf.Len() == 0 {
+		return
+	}
+	s.conn.Write(s.buf.Bytes())
+	s.buf.Reset()
+}
+
+func (s *StatsD) flushLoop() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(statsdFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.collectGauges()
+			s.mu.Lock()
+			s.flushLocked()
+			s.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,32 @@
+// Package notice turns the resilience policy's notice codes into messages
+// for the users of a degraded service, in their language
+package notice
+
+import "github.com/demo/resilient-app/internal/i18n"
+
+// Codes the builtin policy and the load shedder use; an external policy may
+// use any code in the catalog, as the key "notice.<code>"
+const (
+	Degraded  = "degraded"
+	StaleData = "stale_data"
+	ReadOnly  = "read_only"
+	HighLoad  = "high_load"
+)
+
+// Notice is a message about the service's state for the user
+type Notice struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Locale  string `json:"locale"`
+}
+
+// Localize returns the notice for code in the language the Accept-Language
+// header acceptLanguage prefers. A code missing from the catalog gets the
+// generic degraded message, so a policy can't leave users without one.
+func Localize(code, acceptLanguage string) Notice {
+	message, locale, ok := i18n.Lookup("notice."+code, acceptLanguage)
+	if !ok {
+		message, locale, _ = i18n.Lookup("notice."+Degraded, acceptLanguage)
+	}
+	return Notice{Code: code, Message: message, Locale: locale}
+}
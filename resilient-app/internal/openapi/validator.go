@@ -0,0 +1,123 @@
+package openapi
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+// Spec is the OpenAPI document served by the application
+//
+//go:embed openapi.yaml
+var Spec []byte
+
+// ErrUnknownRoute is returned for requests the spec doesn't describe
+var ErrUnknownRoute = errors.New("route not described by the OpenAPI spec")
+
+// Validator checks requests and responses against the embedded spec
+type Validator struct {
+	router routers.Router
+}
+
+func NewValidator() (*Validator, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(Spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load OpenAPI spec: %w", err)
+	}
+	if err := doc.Validate(loader.Context); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI spec: %w", err)
+	}
+
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build OpenAPI router: %w", err)
+	}
+
+	return &Validator{router: router}, nil
+}
+
+// ValidateRequest validates parameters and body of r. The body is restored so
+// handlers can still read it. The returned input is needed to validate the response.
+func (v *Validator) ValidateRequest(ctx context.Context, r *http.Request) (*openapi3filter.RequestValidationInput, error) {
+	route, pathParams, err := v.router.FindRoute(r)
+	if err != nil {
+		return nil, ErrUnknownRoute
+	}
+
+	input := &openapi3filter.RequestValidationInput{
+		Request:    r,
+		PathParams: pathParams,
+		Route:      route,
+		Options: &openapi3filter.Options{
+			MultiError:         true,
+			AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		},
+	}
+
+	return input, openapi3filter.ValidateRequest(ctx, input)
+}
+
+// ValidateResponse validates a captured response for a previously validated request
+func (v *Validator) ValidateResponse(ctx context.Context, input *openapi3filter.RequestValidationInput, status int, header http.Header, body []byte) error {
+	return openapi3filter.ValidateResponse(ctx, &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 status,
+		Header:                 header,
+		Body:                   io.NopCloser(bytes.NewReader(body)),
+		Options: &openapi3filter.Options{
+			MultiError:            true,
+			IncludeResponseStatus: true,
+		},
+	})
+}
+
+// Details flattens a validation error into human-readable messages
+func Details(err error) []string {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		details := make([]string, 0, len(e))
+		for _, inner := range e {
+			details = append(details, Details(inner)...)
+		}
+		return details
+	case *openapi3filter.RequestError:
+		if e.Parameter != nil {
+			return prefix(fmt.Sprintf("parameter %q", e.Parameter.Name), Details(e.Err))
+		}
+		if e.Err != nil {
+			return prefix("request body", Details(e.Err))
+		}
+		return []string{e.Reason}
+	case *openapi3filter.ResponseError:
+		if e.Err != nil {
+			return prefix("response", Details(e.Err))
+		}
+		return []string{e.Reason}
+	case *openapi3.SchemaError:
+		if pointer := e.JSONPointer(); len(pointer) > 0 {
+			return []string{fmt.Sprintf("field %q: %s", strings.Join(pointer, "."), e.Reason)}
+		}
+		return []string{e.Reason}
+	case nil:
+		return nil
+	}
+	return []string{err.Error()}
+}
+
+func prefix(p string, details []string) []string {
+	for i, d := range details {
+		details[i] = p + ": " + d
+	}
+	return details
+}
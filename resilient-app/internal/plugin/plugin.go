@@ -0,0 +1,103 @@
+// Package plugin defines the extension points forks of this application can
+// hook into without patching core files. A plugin implements Plugin plus any
+// of the hook interfaces and registers itself from an init function; it is
+// compiled in with a blank import in package main:
+//
+//	import _ "example.com/fork/plugins/vendortracing"
+//
+// Hooks run in registration order.
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Plugin is the unit of registration
+type Plugin interface {
+	Name() string
+}
+
+// RequestInterceptor wraps inbound HTTP handling (custom auth, tracing, masking).
+// It runs inside the recovery middleware and after routing, with the request
+// ID, tenant and request-scoped logger already in the context (see ctxkeys).
+type RequestInterceptor interface {
+	Plugin
+	InterceptRequest(next http.Handler) http.Handler
+}
+
+// QueryInterceptor wraps every database operation, outside the circuit
+// breaker so rejections by an open breaker are visible too. op is a stable
+// operation name such as "get_user".
+type QueryInterceptor interface {
+	Plugin
+	InterceptQuery(ctx context.Context, op string, next func(context.Context) error) error
+}
+
+// ShutdownParticipant is called during graceful shutdown, after the HTTP
+// server has drained and before the database is closed
+type ShutdownParticipant interface {
+	Plugin
+	Shutdown(ctx context.Context) error
+}
+
+var (
+	mu      sync.RWMutex
+	plugins []Plugin
+)
+
+// Register makes a plugin available. Like database/sql.Register it panics on
+// a nil plugin or a duplicate name, since both are programming errors.
+func Register(p Plugin) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if p == nil {
+		panic("plugin: Register plugin is nil")
+	}
+	for _, existing := range plugins {
+		if existing.Name() == p.Name() {
+			panic(fmt.Sprintf("plugin: Register called twice for %q", p.Name()))
+		}
+	}
+	plugins = append(plugins, p)
+}
+
+// Names lists the registered plugins
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, len(plugins))
+	for i, p := range plugins {
+		names[i] = p.Name()
+	}
+	return names
+}
+
+func RequestInterceptors() []RequestInterceptor {
+	return collect[RequestInterceptor]()
+}
+
+func QueryInterceptors() []QueryInterceptor {
+	return collect[QueryInterceptor]()
+}
+
+func ShutdownParticipants() []ShutdownParticipant {
+	return collect[ShutdownParticipant]()
+}
+
+func collect[T Plugin]() []T {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	var hooks []T
+	for _, p := range plugins {
+		if hook, ok := p.(T); ok {
+			hooks = append(hooks, hook)
+		}
+	}
+	return hooks
+}
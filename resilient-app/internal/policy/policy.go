@@ -0,0 +1,224 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/demo/resilient-app/internal/metrics"
+	"github.com/demo/resilient-app/internal/notice"
+	"go.uber.org/zap"
+)
+
+var policyEvaluationsTotal = metrics.NewCounterVec(
+	metrics.Opts{
+		Name: "policy_evaluations_total",
+		Help: "Total number of resilience policy evaluations by source and result",
+	},
+	[]string{"source", "result"},
+)
+
+// Input is the current resilience state handed to the policy
+type Input struct {
+	Health          string  `json:"health"`
+	BreakerState    string  `json:"breaker_state"`
+	BreakerRequests uint32  `json:"breaker_requests"`
+	BreakerFailures uint32  `json:"breaker_failures"`
+	Requests        uint64  `json:"requests"`
+	ErrorRate       float64 `json:"error_rate"`
+}
+
+// Decision is what the application does about it
+type Decision struct {
+	// AllowFallback lets handlers serve fallback data when the database fails
+	AllowFallback bool `json:"allow_fallback"`
+	// ShedFraction of API requests (0..1) are rejected up front with 503
+	ShedFraction float64 `json:"shed_fraction"`
+	// Notice is the catalog code of the message shown to users (see package
+	// notice), empty when there is nothing to tell them
+	Notice string `json:"notice,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// Source is "builtin" or "opa", filled in by the engine
+	Source string `json:"source"`
+}
+
+// Evaluator turns an input into a decision
+type Evaluator interface {
+	Evaluate(ctx context.Context, input Input) (Decision, error)
+}
+
+// Builtin is the compiled-in policy used without POLICY_URL and whenever the
+// external policy can't be evaluated
+type Builtin struct {
+	// GracefulDegradation reports whether fallback data may be served; it is
+	// asked on every evaluation, so a reloaded feature flag applies
+	GracefulDegradation func() bool
+}
+
+func (b Builtin) Evaluate(ctx context.Context, input Input) (Decision, error) {
+	degrade := b.GracefulDegradation != nil && b.GracefulDegradation()
+	decision := Decision{AllowFallback: degrade, Reason: "builtin policy"}
+	// While the database is failing users are told that what they see may be
+	// fallback data, or that parts of the service are unavailable
+	if input.BreakerState != "closed" || input.Health == "unhealthy" {
+		decision.Notice = notice.Degraded
+		if degrade {
+			decision.Notice = notice.StaleData
+		}
+	}
+	return decision, nil
+}
+
+// OPA evaluates a policy served by an Open Policy Agent sidecar through its
+// Data API, e.g. http://localhost:8181/v1/data/resilience/decision. The policy
+// may be Rego or a compiled WASM bundle; the app only sees the decision.
+type OPA struct {
+	URL    string
+	Client *http.Client
+}
+
+func (o OPA) Evaluate(ctx context.Context, input Input) (Decision, error) {
+	body, err := json.Marshal(map[string]interface{}{"input": input})
+	if err != nil {
+		return Decision{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.URL, bytes.NewReader(body))
+	if err != nil {
+		return Decision{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.Client.Do(req)
+	if err != nil {
+		return Decision{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Decision{}, fmt.Errorf("policy server returned %s", resp.Status)
+	}
+
+	var result struct {
+		Result *Decision `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Decision{}, fmt.Errorf("invalid policy response: %w", err)
+	}
+	if result.Result == nil {
+		return Decision{}, fmt.Errorf("policy is undefined at %s", o.URL)
+	}
+	if result.Result.ShedFraction < 0 || result.Result.ShedFraction > 1 {
+		return Decision{}, fmt.Errorf("shed_fraction %g out of range", result.Result.ShedFraction)
+	}
+	return *result.Result, nil
+}
+
+// Engine re-evaluates the policy on an interval, off the request path, so a
+// slow or unavailable policy server never adds latency to requests
+type Engine struct {
+	logger   *zap.Logger
+	external Evaluator
+	builtin  Evaluator
+	inputs   func() Input
+	interval time.Duration
+	timeout  time.Duration
+
+	current atomic.Pointer[Decision]
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewEngine evaluates external (may be nil) and falls back to builtin
+func NewEngine(logger *zap.Logger, external, builtin Evaluator, inputs func() Input, interval, timeout time.Duration) *Engine {
+	e := &Engine{
+		logger:   logger,
+		external: external,
+		builtin:  builtin,
+		inputs:   inputs,
+		interval: interval,
+		timeout:  timeout,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	e.evaluate()
+	return e
+}
+
+// Decision returns the most recent decision
+func (e *Engine) Decision() Decision {
+	return *e.current.Load()
+}
+
+func (e *Engine) Start() {
+	go e.run()
+}
+
+func (e *Engine) Stop(ctx context.Context) error {
+	e.once.Do(func() { close(e.stop) })
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *Engine) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-ticker.C:
+			e.evaluate()
+		}
+	}
+}
+
+func (e *Engine) evaluate() {
+	input := e.inputs()
+
+	if e.external != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+		decision, err := e.external.Evaluate(ctx, input)
+		cancel()
+		if err == nil {
+			policyEvaluationsTotal.WithLabelValues("opa", "success").Inc()
+			decision.Source = "opa"
+			e.set(decision)
+			return
+		}
+		policyEvaluationsTotal.WithLabelValues("opa", "error").Inc()
+		e.logger.Warn("External policy evaluation failed, using builtin policy", zap.Error(err))
+	}
+
+	decision, _ := e.builtin.Evaluate(context.Background(), input)
+	policyEvaluationsTotal.WithLabelValues("builtin", "success").Inc()
+	decision.Source = "builtin"
+	e.set(decision)
+}
+
+func (e *Engine) set(decision Decision) {
+	if previous := e.current.Swap(&decision); previous != nil &&
+		(previous.AllowFallback != decision.AllowFallback || previous.ShedFraction != decision.ShedFraction ||
+			previous.Notice != decision.Notice) {
+		e.logger.Info("Resilience policy decision changed",
+			zap.Bool("allow_fallback", decision.AllowFallback),
+			zap.Float64("shed_fraction", decision.ShedFraction),
+			zap.String("notice", decision.Notice),
+			zap.String("reason", decision.Reason),
+			zap.String("source", decision.Source),
+		)
+	}
+}
@@ -0,0 +1,68 @@
+package profile
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	Dev  = "dev"
+	Demo = "demo"
+	Prod = "prod"
+
+	// Default keeps the behavior the demo has always had
+	Default = Demo
+)
+
+// defaults bundled per profile. They only fill in keys that are not set, so
+// any environment variable or config file value still wins.
+var defaults = map[string]map[string]string{
+	Dev: {
+		"LOG_LEVEL":            "debug",
+		"LOG_FORMAT":           "console",
+		"ERROR_VERBOSITY":      "debug",
+		"ADMIN_AUTH":           "none",
+		"CHAOS_ENDPOINTS":      "true",
+		"SERVER_READ_TIMEOUT":  "30s",
+		"SERVER_WRITE_TIMEOUT": "60s",
+		"SERVER_IDLE_TIMEOUT":  "120s",
+	},
+	Demo: {
+		"LOG_LEVEL":       "info",
+		"LOG_FORMAT":      "json",
+		"ERROR_VERBOSITY": "terse",
+		"ADMIN_AUTH":      "required",
+		"CHAOS_ENDPOINTS": "true",
+	},
+	Prod: {
+		"LOG_LEVEL":                  "info",
+		"LOG_FORMAT":                 "json",
+		"ERROR_VERBOSITY":            "terse",
+		"ADMIN_AUTH":                 "required",
+		"CHAOS_ENDPOINTS":            "false",
+		"SERVER_READ_TIMEOUT":        "5s",
+		"SERVER_WRITE_TIMEOUT":       "10s",
+		"SERVER_IDLE_TIMEOUT":        "30s",
+		"SERVER_READ_HEADER_TIMEOUT": "2s",
+		"POLICY_TIMEOUT":             "500ms",
+	},
+}
+
+// Names lists the available profiles
+func Names() []string {
+	names := make([]string, 0, len(defaults))
+	for name := range defaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Defaults returns the bundled defaults of a profile
+func Defaults(name string) (map[string]string, error) {
+	values, ok := defaults[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q (want one of %v)", name, Names())
+	}
+	return values, nil
+}
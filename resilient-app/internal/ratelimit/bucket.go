@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrWaitExceeded is returned when a call would have to queue longer than allowed
+var ErrWaitExceeded = errors.New("rate limit wait exceeds the maximum")
+
+// TokenBucket shapes calls to a steady rate with bursts up to its size. Calls
+// beyond the burst queue for their token instead of being rejected outright.
+type TokenBucket struct {
+	rate  float64 // tokens per second
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64 // negative while calls are queued for future tokens
+	last   time.Time
+}
+
+// NewTokenBucket returns a bucket refilling rate tokens per second and holding
+// at most burst (at least 1); it starts full
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes a token and returns how long until it is available. If that
+// is longer than maxWait nothing is taken.
+func (b *TokenBucket) reserve(maxWait time.Duration) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	tokens := b.tokens - 1
+	var wait time.Duration
+	if tokens < 0 {
+		wait = time.Duration(-tokens / b.rate * float64(time.Second))
+	}
+	if wait > maxWait {
+		return wait, false
+	}
+	b.tokens = tokens
+	return wait, true
+}
+
+// cancel returns a reserved token that wasn't used
+func (b *TokenBucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens++
+}
+
+// Wait blocks until a token is available and returns how long it waited. It
+// fails fast with ErrWaitExceeded when the queue is longer than maxWait.
+func (b *TokenBucket) Wait(ctx context.Context, maxWait time.Duration) (time.Duration, error) {
+	wait, ok := b.reserve(maxWait)
+	if !ok {
+		return 0, ErrWaitExceeded
+	}
+	if wait == 0 {
+		return 0, nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return wait, nil
+	case <-ctx.Done():
+		b.cancel()
+		return 0, ctx.Err()
+	}
+}
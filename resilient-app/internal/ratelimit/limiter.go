@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"time"
+)
+
+// Quota is the state of a client's allowance after a request
+type Quota struct {
+	Limit     int
+	Remaining int
+	Reset     time.Duration
+	Allowed   bool
+}
+
+// Limiter enforces a per-client request quota over fixed windows
+type Limiter struct {
+	limit  int
+	counts *windowCounter
+}
+
+// NewLimiter returns a limiter allowing limit requests per client per window.
+// A non-positive limit disables limiting.
+func NewLimiter(limit int, window time.Duration) *Limiter {
+	return &Limiter{
+		limit:  limit,
+		counts: newWindowCounter(window),
+	}
+}
+
+func (l *Limiter) Enabled() bool {
+	return l.limit > 0
+}
+
+// Take consumes one request from the client's quota
+func (l *Limiter) Take(client string) Quota {
+	count, reset := l.counts.add(client)
+
+	remaining := l.limit - count
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return Quota{
+		Limit:     l.limit,
+		Remaining: remaining,
+		Reset:     reset,
+		Allowed:   count <= l.limit,
+	}
+}
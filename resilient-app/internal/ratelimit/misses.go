@@ -0,0 +1,35 @@
+package ratelimit
+
+import (
+	"time"
+)
+
+// MissTracker counts lookup misses (e.g. 404s) per client in a fixed window and
+// blocks clients that exceed the limit until their window expires. It protects
+// lookup endpoints against enumeration without affecting well-behaved callers.
+type MissTracker struct {
+	limit  int
+	counts *windowCounter
+}
+
+func NewMissTracker(limit int, window time.Duration) *MissTracker {
+	return &MissTracker{
+		limit:  limit,
+		counts: newWindowCounter(window),
+	}
+}
+
+// Allow reports whether the client may perform another lookup and, if not,
+// how long until it may retry
+func (t *MissTracker) Allow(client string) (bool, time.Duration) {
+	count, reset := t.counts.peek(client)
+	if count >= t.limit {
+		return false, reset
+	}
+	return true, 0
+}
+
+// RecordMiss registers a failed lookup for the client
+func (t *MissTracker) RecordMiss(client string) {
+	t.counts.add(client)
+}
@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// maxTrackedClients bounds memory used by a counter; expired windows are
+// pruned once the map grows past it
+const maxTrackedClients = 10000
+
+// windowCounter counts events per client in fixed windows
+type windowCounter struct {
+	mu      sync.Mutex
+	window  time.Duration
+	clients map[string]*clientWindow
+}
+
+type clientWindow struct {
+	start time.Time
+	count int
+}
+
+func newWindowCounter(window time.Duration) *windowCounter {
+	return &windowCounter{
+		window:  window,
+		clients: make(map[string]*clientWindow),
+	}
+}
+
+// peek returns the client's count in the current window and the time until it resets
+func (c *windowCounter) peek(client string) (int, time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	w, ok := c.clients[client]
+	if !ok || now.Sub(w.start) >= c.window {
+		return 0, c.window
+	}
+	return w.count, w.start.Add(c.window).Sub(now)
+}
+
+// add increments the client's count, starting a new window if needed, and
+// returns the new count and the time until the window resets
+func (c *windowCounter) add(client string) (int, time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	w, ok := c.clients[client]
+	if !ok || now.Sub(w.start) >= c.window {
+		if len(c.clients) >= maxTrackedClients {
+			c.prune(now)
+		}
+		w = &clientWindow{start: now}
+		c.clients[client] = w
+	}
+	w.count++
+	return w.count, w.start.Add(c.window).Sub(now)
+}
+
+func (c *windowCounter) prune(now time.Time) {
+	for client, w := range c.clients {
+		if now.Sub(w.start) >= c.window {
+			delete(c.clients, client)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+// Package routebreaker trips a circuit breaker per inbound route, so a route
+// whose error rate explodes fails fast while the rest of the API keeps
+// serving. Each route keeps rolling statistics over a sliding window; once
+// enough requests in the window failed the route opens, and after a cooldown
+// a single probe request decides whether it closes again.
+package routebreaker
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/demo/resilient-app/internal/events"
+)
+
+// States reported in Status and breaker events, matching gobreaker's names
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half-open"
+)
+
+// numBuckets is the resolution of the sliding window
+const numBuckets = 10
+
+// Config decides when a route trips
+type Config struct {
+	// ErrorRate of failed requests in Window that opens the route, once at
+	// least MinRequests were seen
+	ErrorRate   float64
+	MinRequests int
+	Window      time.Duration
+	// Cooldown is how long a route stays open before a probe is let through
+	Cooldown time.Duration
+}
+
+// Status is the state of one route's breaker with its rolling counts
+type Status struct {
+	Route    string    `json:"route"`
+	State    string    `json:"state"`
+	Since    time.Time `json:"since"`
+	Requests int       `json:"requests"`
+	Failures int       `json:"failures"`
+}
+
+type bucket struct {
+	start    time.Time
+	total    int
+	failures int
+}
+
+// rollingStats counts requests over the last numBuckets bucket widths
+type rollingStats struct {
+	width   time.Duration
+	buckets [numBuckets]bucket
+}
+
+func (s *rollingStats) add(now time.Time, failed bool) {
+	start := now.Truncate(s.width)
+	b := &s.buckets[(start.UnixNano()/int64(s.width))%numBuckets]
+	if !b.start.Equal(start) {
+		*b = bucket{start: start}
+	}
+	b.total++
+	if failed {
+		b.failures++
+	}
+}
+
+func (s *rollingStats) counts(now time.Time) (total, failures int) {
+	for _, b := range s.buckets {
+		if now.Sub(b.start) < s.width*numBuckets {
+			total += b.total
+			failures += b.failures
+		}
+	}
+	return total, failures
+}
+
+func (s *rollingStats) reset() {
+	s.buckets = [numBuckets]bucket{}
+}
+
+type route struct {
+	state   string
+	since   time.Time
+	probing bool
+	stats   rollingStats
+}
+
+// Set holds the breakers of every route seen so far
+type Set struct {
+	config Config
+
+	mu     sync.Mutex
+	routes map[string]*route
+}
+
+func New(config Config) *Set {
+	return &Set{config: config, routes: make(map[string]*route)}
+}
+
+// Allow reports whether a request to the route may proceed. When it may, done
+// must be called exactly once with the request's outcome.
+func (s *Set) Allow(name string) (done func(failed bool), ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	r := s.routes[name]
+	if r == nil {
+		r = &route{state: StateClosed, since: now, stats: rollingStats{width: s.bucketWidth()}}
+		s.routes[name] = r
+	}
+
+	switch r.state {
+	case StateOpen:
+		if now.Sub(r.since) < s.config.Cooldown {
+			return nil, false
+		}
+		s.transition(name, r, StateHalfOpen, now)
+		fallthrough
+	case StateHalfOpen:
+		if r.probing {
+			return nil, false
+		}
+		r.probing = true
+	}
+
+	probe := r.state == StateHalfOpen
+	var once sync.Once
+	return func(failed bool) {
+		once.Do(func() { s.record(name, r, probe, failed) })
+	}, true
+}
+
+// SetConfig changes the thresholds; a new window restarts every route's stats
+func (s *Set) SetConfig(config Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	windowChanged := config.Window != s.config.Window
+	s.config = config
+	if windowChanged {
+		for _, r := range s.routes {
+			r.stats = rollingStats{width: s.bucketWidth()}
+		}
+	}
+}
+
+func (s *Set) bucketWidth() time.Duration {
+	if width := s.config.Window / numBuckets; width >= time.Millisecond {
+		return width
+	}
+	return time.Millisecond
+}
+
+// record counts a finished request; the outcome of a probe closes or reopens
+// the route, while requests admitted before it opened only add to the stats
+func (s *Set) record(name string, r *route, probe, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if probe {
+		r.probing = false
+		if failed {
+			s.transition(name, r, StateOpen, now)
+		} else {
+			r.stats.reset()
+			s.transition(name, r, StateClosed, now)
+		}
+		return
+	}
+
+	r.stats.add(now, failed)
+	if r.state != StateClosed || !failed {
+		return
+	}
+	total, failures := r.stats.counts(now)
+	if total >= s.config.MinRequests && float64(failures)/float64(total) >= s.config.ErrorRate {
+		s.transition(name, r, StateOpen, now)
+	}
+}
+
+func (s *Set) transition(name string, r *route, to string, now time.Time) {
+	from := r.state
+	r.state, r.since = to, now
+	events.Publish(events.BreakerStateChanged{
+		Breaker: BreakerName(name),
+		From:    from,
+		To:      to,
+		At:      now,
+	})
+}
+
+// BreakerName is the name route's breaker goes by in events and metrics
+func BreakerName(route string) string {
+	return "route " + route
+}
+
+// Statuses returns every route's breaker sorted by route
+func (s *Set) Statuses() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	statuses := make([]Status, 0, len(s.routes))
+	for name, r := range s.routes {
+		total, failures := r.stats.counts(now)
+		statuses = append(statuses, Status{
+			Route:    name,
+			State:    r.state,
+			Since:    r.since,
+			Requests: total,
+			Failures: failures,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Route < statuses[j].Route })
+	return statuses
+}
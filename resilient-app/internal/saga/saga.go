@@ -0,0 +1,172 @@
+package saga
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/demo/resilient-app/internal/metrics"
+	"go.uber.org/zap"
+)
+
+type Status string
+
+const (
+	StatusRunning      Status = "running"
+	StatusCompleted    Status = "completed"
+	StatusCompensating Status = "compensating"
+	StatusCompensated  Status = "compensated"
+	StatusFailed       Status = "failed"
+)
+
+// compensationTimeout bounds compensation, which runs detached from the
+// request's cancellation so a canceled request can't leave the saga half-applied
+const compensationTimeout = 10 * time.Second
+
+var sagasTotal = metrics.NewCounterVec(
+	metrics.Opts{
+		Name: "sagas_total",
+		Help: "Total number of sagas by name and final status",
+	},
+	[]string{"saga", "status"},
+)
+
+// ErrCompensationFailed is returned when a step failed and at least one
+// compensation could not be applied; the saga needs manual attention
+var ErrCompensationFailed = errors.New("saga compensation failed")
+
+// Step is a unit of work with the action that undoes it
+type Step struct {
+	Name       string
+	Action     func(ctx context.Context) error
+	Compensate func(ctx context.Context) error
+}
+
+// State is the persisted progress of a saga
+type State struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Status    Status    `json:"status"`
+	Step      string    `json:"step"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Store persists saga state so in-flight and failed sagas can be inspected
+type Store interface {
+	SaveSagaState(ctx context.Context, state State) error
+}
+
+type Saga struct {
+	logger *zap.Logger
+	store  Store
+	state  State
+	steps  []Step
+}
+
+func New(logger *zap.Logger, store Store, name string, steps ...Step) *Saga {
+	return &Saga{
+		logger: logger,
+		store:  store,
+		state: State{
+			ID:   newID(),
+			Name: name,
+		},
+		steps: steps,
+	}
+}
+
+func (s *Saga) ID() string {
+	return s.state.ID
+}
+
+// Execute runs each step in order. If a step fails, the completed steps are
+// compensated in reverse order and the step error is returned.
+func (s *Saga) Execute(ctx context.Context) error {
+	s.save(ctx, StatusRunning, "", nil)
+
+	for i, step := range s.steps {
+		s.save(ctx, StatusRunning, step.Name, nil)
+
+		if err := step.Action(ctx); err != nil {
+			s.logger.Warn("Saga step failed, compensating",
+				zap.String("saga", s.state.Name),
+				zap.String("saga_id", s.state.ID),
+				zap.String("step", step.Name),
+				zap.Error(err),
+			)
+			return s.compensate(ctx, i, err)
+		}
+	}
+
+	s.save(ctx, StatusCompleted, "", nil)
+	sagasTotal.WithLabelValues(s.state.Name, string(StatusCompleted)).Inc()
+	return nil
+}
+
+func (s *Saga) compensate(parent context.Context, failed int, cause error) error {
+	// Keep request-scoped values (e.g. dry-run) but not the request's cancellation
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(parent), compensationTimeout)
+	defer cancel()
+
+	s.save(ctx, StatusCompensating, s.steps[failed].Name, cause)
+
+	var compensationErr error
+	for i := failed - 1; i >= 0; i-- {
+		step := s.steps[i]
+		if step.Compensate == nil {
+			continue
+		}
+
+		if err := step.Compensate(ctx); err != nil {
+			s.logger.Error("Saga compensation failed",
+				zap.String("saga", s.state.Name),
+				zap.String("saga_id", s.state.ID),
+				zap.String("step", step.Name),
+				zap.Error(err),
+			)
+			compensationErr = errors.Join(compensationErr, fmt.Errorf("%s: %w", step.Name, err))
+		}
+	}
+
+	if compensationErr != nil {
+		s.save(ctx, StatusFailed, s.steps[failed].Name, compensationErr)
+		sagasTotal.WithLabelValues(s.state.Name, string(StatusFailed)).Inc()
+		return fmt.Errorf("%w: %v (cause: %v)", ErrCompensationFailed, compensationErr, cause)
+	}
+
+	s.save(ctx, StatusCompensated, s.steps[failed].Name, cause)
+	sagasTotal.WithLabelValues(s.state.Name, string(StatusCompensated)).Inc()
+	return cause
+}
+
+// save persists the saga state on a best-effort basis; a failure to record
+// progress must not abort or mask the business outcome
+func (s *Saga) save(ctx context.Context, status Status, step string, err error) {
+	s.state.Status = status
+	s.state.Step = step
+	s.state.Error = ""
+	if err != nil {
+		s.state.Error = err.Error()
+	}
+	s.state.UpdatedAt = time.Now()
+
+	if saveErr := s.store.SaveSagaState(ctx, s.state); saveErr != nil {
+		s.logger.Warn("Failed to persist saga state",
+			zap.String("saga_id", s.state.ID),
+			zap.String("status", string(status)),
+			zap.Error(saveErr),
+		)
+	}
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
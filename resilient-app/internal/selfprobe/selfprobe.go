@@ -0,0 +1,185 @@
+package selfprobe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/demo/resilient-app/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// UserAgent marks the prober's requests in access logs
+const UserAgent = "resilient-app-self-probe"
+
+var (
+	selfProbeRequestsTotal = metrics.NewCounterVec(
+		metrics.Opts{
+			Name: "self_probe_requests_total",
+			Help: "Total number of requests to the app's own public URLs by target and result (success, status, timeout or error)",
+		},
+		[]string{"target", "result"},
+	)
+	selfProbeDuration = metrics.NewHistogramVec(
+		metrics.Opts{
+			Name:    "self_probe_duration_seconds",
+			Help:    "Latency of requests to the app's own public URLs, as seen from outside the pod",
+			Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		},
+		[]string{"target"},
+	)
+	selfProbeUp = metrics.NewGaugeVec(
+		metrics.Opts{
+			Name: "self_probe_up",
+			Help: "1 when the latest request to the target succeeded, 0 otherwise",
+		},
+		[]string{"target"},
+	)
+)
+
+// Prober requests the app's public URLs, e.g. the Service or the ingress, on
+// an interval. The requests leave the pod and come back through the load
+// balancer, usually to another pod, so they see what clients see: DNS,
+// kube-proxy, ingress and network policy failures that a pod's own health
+// checks can't.
+type Prober struct {
+	logger   *zap.Logger
+	client   *http.Client
+	targets  []string
+	interval time.Duration
+
+	// failing holds the targets whose latest request failed, so only
+	// changes are logged
+	failing map[string]bool
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// New probes each of targets every interval, each request bounded by timeout
+func New(logger *zap.Logger, targets []string, interval, timeout time.Duration) *Prober {
+	return &Prober{
+		logger: logger,
+		// Keep-alives are off so every probe makes a new connection through
+		// the load balancer, instead of sticking to the pod that answered first
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: &http.Transport{DisableKeepAlives: true, Proxy: http.ProxyFromEnvironment},
+		},
+		targets:  targets,
+		interval: interval,
+		failing:  make(map[string]bool),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (p *Prober) Start() {
+	go p.run()
+}
+
+func (p *Prober) Stop(ctx context.Context) error {
+	p.once.Do(func() { close(p.stop) })
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run waits an interval before the first round, giving the Service time to
+// list this pod once it turns ready
+func (p *Prober) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			for _, target := range p.targets {
+				p.probe(target)
+			}
+		}
+	}
+}
+
+func (p *Prober) probe(target string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-p.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	start := time.Now()
+	status, err := p.get(ctx, target)
+	elapsed := time.Since(start)
+
+	// A probe cut short by shutdown says nothing about the path
+	if ctx.Err() == context.Canceled {
+		return
+	}
+
+	var netErr net.Error
+	result := "success"
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		result = "timeout"
+	case err != nil:
+		result = "error"
+	case status < 200 || status > 299:
+		result = "status"
+		err = fmt.Errorf("unexpected status %d", status)
+	}
+	selfProbeRequestsTotal.WithLabelValues(target, result).Inc()
+	selfProbeDuration.WithLabelValues(target).Observe(elapsed.Seconds())
+
+	if err == nil {
+		selfProbeUp.WithLabelValues(target).Set(1)
+		if p.failing[target] {
+			p.logger.Info("Self probe succeeded again", zap.String("target", target))
+		}
+		delete(p.failing, target)
+		return
+	}
+	selfProbeUp.WithLabelValues(target).Set(0)
+	if !p.failing[target] {
+		p.logger.Warn("Self probe failed", zap.String("target", target), zap.String("result", result),
+			zap.Duration("duration", elapsed), zap.Error(err))
+	}
+	p.failing[target] = true
+}
+
+// get requests target and returns the status code, reading the body so the
+// duration covers the whole response
+func (p *Prober) get(ctx context.Context, target string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return resp.StatusCode, err
+	}
+	return resp.StatusCode, nil
+}
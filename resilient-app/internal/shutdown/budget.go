@@ -0,0 +1,50 @@
+package shutdown
+
+import (
+	"context"
+	"time"
+)
+
+// Budget splits the shutdown timeout across phases as fractions of the whole
+type Budget struct {
+	Drain float64 `json:"drain"`
+	Hooks float64 `json:"hooks"`
+	Close float64 `json:"close"`
+}
+
+// DefaultBudget gives most of the time to draining requests while always
+// leaving hooks and the database close a share of their own
+var DefaultBudget = Budget{Drain: 0.6, Hooks: 0.3, Close: 0.1}
+
+// normalized scales the shares to sum to 1, falling back to the default for
+// unusable values
+func (b Budget) normalized() Budget {
+	if b.Drain <= 0 || b.Hooks <= 0 || b.Close <= 0 {
+		return DefaultBudget
+	}
+	sum := b.Drain + b.Hooks + b.Close
+	return Budget{Drain: b.Drain / sum, Hooks: b.Hooks / sum, Close: b.Close / sum}
+}
+
+type phaseDeadlines struct {
+	drain time.Time
+	hooks time.Time
+}
+
+// deadlines are cumulative, so time a phase doesn't use carries over to the
+// next one, while an overrunning phase can never eat into later shares
+func (b Budget) deadlines(ctx context.Context) phaseDeadlines {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		// Without an overall deadline phases are only bounded by ctx itself
+		far := time.Now().Add(24 * time.Hour)
+		return phaseDeadlines{drain: far, hooks: far}
+	}
+
+	start := time.Now()
+	total := deadline.Sub(start)
+	return phaseDeadlines{
+		drain: start.Add(time.Duration(float64(total) * b.Drain)),
+		hooks: start.Add(time.Duration(float64(total) * (b.Drain + b.Hooks))),
+	}
+}
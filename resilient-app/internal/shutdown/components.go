@@ -0,0 +1,167 @@
+package shutdown
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Server is anything that drains gracefully and can be forced to stop.
+// *http.Server satisfies it; a gRPC server needs a small adapter around
+// GracefulStop and Stop.
+type Server interface {
+	Shutdown(ctx context.Context) error
+	Close() error
+}
+
+type server struct {
+	name     string
+	srv      Server
+	timeout  time.Duration
+	inflight *inflight // only for HTTP servers
+}
+
+type closer struct {
+	name    string
+	closer  io.Closer
+	timeout time.Duration
+}
+
+// AddHTTPServer registers an HTTP server to drain during shutdown. Its handler
+// is wrapped to track in-flight requests, so the ones cut off by a force-close
+// can be reported; call it before the server starts serving. A non-zero
+// timeout caps the server's drain below the drain phase budget.
+func (m *Manager) AddHTTPServer(name string, srv *http.Server, timeout time.Duration) {
+	tracker := newInflight()
+	srv.Handler = tracker.track(srv.Handler)
+	m.addServer(server{name: name, srv: srv, timeout: timeout, inflight: tracker})
+}
+
+// AddServer registers any other server to drain during shutdown
+func (m *Manager) AddServer(name string, srv Server, timeout time.Duration) {
+	m.addServer(server{name: name, srv: srv, timeout: timeout})
+}
+
+func (m *Manager) addServer(s server) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.servers = append(m.servers, s)
+}
+
+// AddCloser registers a resource to close after the shutdown hooks have run,
+// such as the database. Closers run in registration order; a non-zero timeout
+// stops waiting for a Close that hangs.
+func (m *Manager) AddCloser(name string, c io.Closer, timeout time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closers = append(m.closers, closer{name: name, closer: c, timeout: timeout})
+}
+
+// drainServers shuts all servers down concurrently; they share the drain phase
+func (m *Manager) drainServers(ctx context.Context) []error {
+	m.mu.RLock()
+	servers := append([]server(nil), m.servers...)
+	m.mu.RUnlock()
+
+	errs := make([]error, len(servers))
+	var wg sync.WaitGroup
+	for i, s := range servers {
+		wg.Add(1)
+		go func(i int, s server) {
+			defer wg.Done()
+			errs[i] = m.drainServer(ctx, s)
+		}(i, s)
+	}
+	wg.Wait()
+	return errs
+}
+
+func (m *Manager) drainServer(ctx context.Context, s server) error {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	m.logger.Info("Stopping server...", zap.String("server", s.name), zap.Duration("budget", budgetOf(ctx)))
+	if err := s.srv.Shutdown(ctx); err != nil {
+		m.logger.Error("Server drain exceeded its budget, force-closing",
+			zap.String("server", s.name),
+			zap.Error(err))
+		m.forceClose(s)
+		return fmt.Errorf("server %s shutdown failed: %w", s.name, err)
+	}
+	m.logger.Info("Server stopped successfully", zap.String("server", s.name))
+	return nil
+}
+
+// forceClose closes all remaining connections of a server and reports the
+// requests that were cut off
+func (m *Manager) forceClose(s server) {
+	if s.inflight != nil {
+		now := time.Now()
+		for _, req := range s.inflight.snapshot() {
+			m.logger.Warn("Force-terminating in-flight request",
+				zap.String("server", s.name),
+				zap.String("method", req.method),
+				zap.String("path", req.path),
+				zap.Duration("age", now.Sub(req.started)))
+			forceClosedRequests.WithLabelValues(s.name, req.method).Inc()
+		}
+	}
+
+	if err := s.srv.Close(); err != nil {
+		m.logger.Error("Server force-close failed", zap.String("server", s.name), zap.Error(err))
+	}
+}
+
+// closeAll closes the registered resources in order, each bounded by its own
+// timeout and by ctx
+func (m *Manager) closeAll(ctx context.Context) []error {
+	m.mu.RLock()
+	closers := append([]closer(nil), m.closers...)
+	m.mu.RUnlock()
+
+	var errs []error
+	for _, c := range closers {
+		m.logger.Info("Closing...", zap.String("component", c.name))
+		if err := closeWithin(ctx, c); err != nil {
+			m.logger.Error("Close failed", zap.String("component", c.name), zap.Error(err))
+			errs = append(errs, fmt.Errorf("closing %s failed: %w", c.name, err))
+			continue
+		}
+		m.logger.Info("Closed successfully", zap.String("component", c.name))
+	}
+	return errs
+}
+
+func closeWithin(ctx context.Context, c closer) error {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- c.closer.Close() }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// budgetOf reports the time left on ctx for logging, or zero without a deadline
+func budgetOf(ctx context.Context) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		return time.Until(deadline)
+	}
+	return 0
+}
@@ -0,0 +1,54 @@
+package shutdown
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// inflightRequest is what gets reported when a request is force-terminated
+type inflightRequest struct {
+	method  string
+	path    string
+	started time.Time
+}
+
+// inflight tracks requests the server is still handling
+type inflight struct {
+	mu       sync.Mutex
+	next     uint64
+	requests map[uint64]inflightRequest
+}
+
+func newInflight() *inflight {
+	return &inflight{requests: make(map[uint64]inflightRequest)}
+}
+
+func (t *inflight) track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.mu.Lock()
+		t.next++
+		id := t.next
+		t.requests[id] = inflightRequest{method: r.Method, path: r.URL.Path, started: time.Now()}
+		t.mu.Unlock()
+
+		defer func() {
+			t.mu.Lock()
+			delete(t.requests, id)
+			t.mu.Unlock()
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (t *inflight) snapshot() []inflightRequest {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	requests := make([]inflightRequest, 0, len(t.requests))
+	for _, req := range t.requests {
+		requests = append(requests, req)
+	}
+	return requests
+}
@@ -2,42 +2,106 @@ package shutdown
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net/http"
+	"sort"
 	"sync"
 	"time"
 
-	"github.com/demo/resilient-app/internal/database"
+	"github.com/demo/resilient-app/internal/events"
+	"github.com/demo/resilient-app/internal/metrics"
 	"go.uber.org/zap"
 )
 
+var forceClosedRequests = metrics.NewCounterVec(
+	metrics.Opts{
+		Name: "shutdown_force_closed_requests_total",
+		Help: "Requests still in flight when the drain budget ran out and the server was force-closed",
+	},
+	[]string{"server", "method"},
+)
+
+var phaseDuration = metrics.NewGaugeVec(
+	metrics.Opts{
+		Name: "shutdown_phase_duration_seconds",
+		Help: "How long each shutdown phase took",
+	},
+	[]string{"phase"},
+)
+
+// HookGroup orders shutdown hooks: groups run in ascending order, and all of
+// them have finished before the closers (such as the database) run
+type HookGroup int
+
+const (
+	// GroupConsumers stops background work that writes to the database (queue
+	// consumers, schedulers, outbox dispatchers) so offsets and acks are
+	// committed while the connection is still open
+	GroupConsumers HookGroup = iota
+	// GroupDefault is for everything else
+	GroupDefault
+)
+
+func (g HookGroup) String() string {
+	switch g {
+	case GroupConsumers:
+		return "consumers"
+	case GroupDefault:
+		return "default"
+	default:
+		return fmt.Sprintf("group-%d", int(g))
+	}
+}
+
+type hook struct {
+	group HookGroup
+	fn    func(context.Context) error
+}
+
+// Manager shuts the application down in three phases: drain the servers,
+// run the shutdown hooks, then close resources such as the database
 type Manager struct {
 	logger     *zap.Logger
-	server     *http.Server
-	db         *database.DB
-	shutdownFn []func(context.Context) error
+	servers    []server
+	closers    []closer
+	hooks      []hook
+	budget     Budget
 	mu         sync.RWMutex
 	isShutdown bool
 }
 
-func NewManager(logger *zap.Logger, server *http.Server, db *database.DB) *Manager {
+func NewManager(logger *zap.Logger) *Manager {
 	return &Manager{
 		logger:     logger,
-		server:     server,
-		db:         db,
-		shutdownFn: make([]func(context.Context) error, 0),
+		hooks:      make([]hook, 0),
+		budget:     DefaultBudget,
 		isShutdown: false,
 	}
 }
 
+// SetBudget changes how the shutdown timeout is split across phases
+func (m *Manager) SetBudget(budget Budget) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.budget = budget.normalized()
+}
+
 // AddShutdownHook adds a function to be called during shutdown
 func (m *Manager) AddShutdownHook(fn func(context.Context) error) {
+	m.AddGroupHook(GroupDefault, fn)
+}
+
+// AddGroupHook adds a shutdown function to a group; within a group hooks run
+// in the order they were added
+func (m *Manager) AddGroupHook(group HookGroup, fn func(context.Context) error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.shutdownFn = append(m.shutdownFn, fn)
+	m.hooks = append(m.hooks, hook{group: group, fn: fn})
 }
 
-// Shutdown performs graceful shutdown of all components
+// Shutdown performs graceful shutdown of all components. The deadline of ctx
+// is partitioned across the drain, hooks and close phases according to the
+// budget; every phase runs even if an earlier one overran or failed.
 func (m *Manager) Shutdown(ctx context.Context) error {
 	m.mu.Lock()
 	if m.isShutdown {
@@ -49,48 +113,60 @@ func (m *Manager) Shutdown(ctx context.Context) error {
 
 	m.logger.Info("Initiating graceful shutdown")
 
+	phases := m.budget.deadlines(ctx)
+	started := events.ShutdownStarted{At: time.Now()}
+	if _, ok := ctx.Deadline(); ok {
+		started.DrainDeadline = phases.drain
+	}
+	events.Publish(started)
+
 	// Create a channel to track shutdown completion
 	done := make(chan error, 1)
 	
 	go func() {
 		defer close(done)
-		
-		// Step 1: Stop accepting new connections
-		m.logger.Info("Stopping HTTP server...")
-		if err := m.server.Shutdown(ctx); err != nil {
-			m.logger.Error("HTTP server shutdown failed", zap.Error(err))
-			done <- fmt.Errorf("HTTP server shutdown failed: %w", err)
-			return
-		}
-		m.logger.Info("HTTP server stopped successfully")
+		var errs []error
+
+		// Step 1: Stop accepting new connections and drain in-flight requests
+		// on every server at once
+		phaseStart := time.Now()
+		drainCtx, cancel := context.WithDeadline(ctx, phases.drain)
+		errs = append(errs, m.drainServers(drainCtx)...)
+		cancel()
+		phaseStart = observePhase("drain", phaseStart)
 
 		// Step 2: Execute custom shutdown hooks
-		m.logger.Info("Executing shutdown hooks...")
-		for i, fn := range m.shutdownFn {
-			m.logger.Info("Executing shutdown hook", zap.Int("hook", i+1))
-			if err := fn(ctx); err != nil {
+		hooksCtx, cancel := context.WithDeadline(ctx, phases.hooks)
+		m.logger.Info("Executing shutdown hooks...", zap.Duration("budget", time.Until(phases.hooks)))
+		consumersStopped := true
+		for i, h := range m.orderedHooks() {
+			m.logger.Info("Executing shutdown hook", zap.Int("hook", i+1), zap.Stringer("group", h.group))
+			if err := h.fn(hooksCtx); err != nil {
 				m.logger.Error("Shutdown hook failed", 
 					zap.Int("hook", i+1), 
+					zap.Stringer("group", h.group),
 					zap.Error(err))
-				done <- fmt.Errorf("shutdown hook %d failed: %w", i+1, err)
-				return
+				errs = append(errs, fmt.Errorf("shutdown hook %d (%s) failed: %w", i+1, h.group, err))
+				if h.group == GroupConsumers {
+					consumersStopped = false
+				}
 			}
 		}
+		cancel()
+		phaseStart = observePhase("hooks", phaseStart)
 
-		// Step 3: Close database connections
-		m.logger.Info("Closing database connections...")
-		if err := m.db.Close(); err != nil {
-			m.logger.Error("Database close failed", zap.Error(err))
-			done <- fmt.Errorf("database close failed: %w", err)
-			return
+		// Step 3: Close resources (database connections and the like)
+		if !consumersStopped {
+			m.logger.Warn("Closing resources while background consumers may still be running")
 		}
-		m.logger.Info("Database connections closed successfully")
+		errs = append(errs, m.closeAll(ctx)...)
+		observePhase("close", phaseStart)
 
 		// Step 4: Final cleanup
 		m.logger.Info("Performing final cleanup...")
 		time.Sleep(100 * time.Millisecond) // Brief pause for any remaining operations
 		
-		done <- nil
+		done <- errors.Join(errs...)
 	}()
 
 	// Wait for shutdown completion or timeout
@@ -107,6 +183,24 @@ func (m *Manager) Shutdown(ctx context.Context) error {
 	}
 }
 
+// orderedHooks returns the hooks sorted by group, keeping registration order
+// within a group
+func (m *Manager) orderedHooks() []hook {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	hooks := append([]hook(nil), m.hooks...)
+	sort.SliceStable(hooks, func(i, j int) bool { return hooks[i].group < hooks[j].group })
+	return hooks
+}
+
+// observePhase records the duration of a phase and returns the start of the next
+func observePhase(phase string, start time.Time) time.Time {
+	now := time.Now()
+	phaseDuration.WithLabelValues(phase).Set(now.Sub(start).Seconds())
+	return now
+}
+
 // IsShutdown returns true if shutdown has been initiated
 func (m *Manager) IsShutdown() bool {
 	m.mu.RLock()
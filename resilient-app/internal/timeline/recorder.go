@@ -0,0 +1,150 @@
+package timeline
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultInterval = time.Second
+	// maxSamples keeps an hour of history at the default interval
+	maxSamples = 3600
+)
+
+// Sample is one point of the recorded resilience timeline
+type Sample struct {
+	Time         time.Time `json:"time"`
+	Health       string    `json:"health"`
+	BreakerState string    `json:"breaker_state"`
+	BreakerFails uint32    `json:"breaker_failures"`
+	Requests     int       `json:"requests"`
+	AvgLatencyMs float64   `json:"avg_latency_ms"`
+	MaxLatencyMs float64   `json:"max_latency_ms"`
+}
+
+// Snapshot captures the non-latency part of a sample
+type Snapshot func() Sample
+
+// Recorder periodically samples health, breaker and request latency while
+// recording is active, so an interesting failure can be replayed later
+// without breaking the system again
+type Recorder struct {
+	snapshot Snapshot
+	interval time.Duration
+
+	mu        sync.Mutex
+	recording bool
+	stop      chan struct{}
+	samples   []Sample
+
+	latencyMu    sync.Mutex
+	latencySum   time.Duration
+	latencyMax   time.Duration
+	latencyCount int
+}
+
+func NewRecorder(snapshot Snapshot) *Recorder {
+	return &Recorder{
+		snapshot: snapshot,
+		interval: defaultInterval,
+	}
+}
+
+// Start begins a new recording, discarding the previous one
+func (r *Recorder) Start() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.recording {
+		return false
+	}
+	r.recording = true
+	r.samples = nil
+	r.stop = make(chan struct{})
+
+	r.latencyMu.Lock()
+	r.resetLatency()
+	r.latencyMu.Unlock()
+
+	go r.run(r.stop)
+	return true
+}
+
+// Stop ends the current recording; the samples are kept for replay
+func (r *Recorder) Stop() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.recording {
+		return false
+	}
+	r.recording = false
+	close(r.stop)
+	return true
+}
+
+func (r *Recorder) Recording() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.recording
+}
+
+// Samples returns a copy of the recorded timeline
+func (r *Recorder) Samples() []Sample {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	samples := make([]Sample, len(r.samples))
+	copy(samples, r.samples)
+	return samples
+}
+
+// ObserveLatency feeds a served request's duration into the current sample
+func (r *Recorder) ObserveLatency(d time.Duration) {
+	r.latencyMu.Lock()
+	defer r.latencyMu.Unlock()
+
+	r.latencySum += d
+	r.latencyCount++
+	if d > r.latencyMax {
+		r.latencyMax = d
+	}
+}
+
+func (r *Recorder) run(stop chan struct{}) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			sample := r.snapshot()
+			sample.Time = now
+
+			r.latencyMu.Lock()
+			sample.Requests = r.latencyCount
+			if r.latencyCount > 0 {
+				sample.AvgLatencyMs = float64(r.latencySum.Microseconds()) / 1000 / float64(r.latencyCount)
+				sample.MaxLatencyMs = float64(r.latencyMax.Microseconds()) / 1000
+			}
+			r.resetLatency()
+			r.latencyMu.Unlock()
+
+			r.mu.Lock()
+			if len(r.samples) >= maxSamples {
+				r.samples = r.samples[1:]
+			}
+			r.samples = append(r.samples, sample)
+			r.mu.Unlock()
+		}
+	}
+}
+
+// resetLatency must be called with latencyMu held
+func (r *Recorder) resetLatency() {
+	r.latencySum = 0
+	r.latencyMax = 0
+	r.latencyCount = 0
+}
@@ -0,0 +1,215 @@
+// Package validate checks request structs against rules declared in their
+// `validate` struct tags and reports every invalid field, not just the first,
+// so a client can fix a request in one round trip:
+//
+//	type CreateUserRequest struct {
+//		Name  string `json:"name" validate:"required,max=255"`
+//		Email string `json:"email" validate:"required,email,max=255"`
+//	}
+//
+// Rules are comma-separated:
+//   - required: the field isn't its zero value, or a string of spaces
+//   - min=N, max=N: a string's length in characters, or a number's value
+//   - email: a string is an email address
+//
+// Fields are named in errors by their JSON name.
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// FieldError is one rule a field broke
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Errors lists every invalid field of a request, in field order
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, fe := range e {
+		messages[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Struct checks every field of v, a struct or a pointer to one, and returns
+// Errors when any is invalid
+func Struct(v any) error {
+	return check(v, false)
+}
+
+// Partial checks v like Struct, for a partial update: fields left at their
+// zero value are skipped, so required only rejects blank values given
+func Partial(v any) error {
+	return check(v, true)
+}
+
+// rule is one parsed rule of a field's tag
+type rule struct {
+	name  string
+	limit int64
+}
+
+type field struct {
+	index int
+	name  string
+	rules []rule
+}
+
+// fieldCache holds the parsed rules of each struct type, so tags are parsed
+// once rather than on every request
+var fieldCache sync.Map // reflect.Type -> []field
+
+func check(v any, partial bool) error {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var errs Errors
+	for _, f := range fields(value.Type()) {
+		fv := value.Field(f.index)
+		if partial && fv.IsZero() {
+			continue
+		}
+		if blank(fv) {
+			if f.has("required") {
+				errs = append(errs, FieldError{Field: f.name, Rule: "required", Message: "is required"})
+			}
+			// Other rules apply to values given
+			continue
+		}
+		for _, r := range f.rules {
+			if message := r.check(fv); message != "" {
+				errs = append(errs, FieldError{Field: f.name, Rule: r.name, Message: message})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func fields(t reflect.Type) []field {
+	if cached, ok := fieldCache.Load(t); ok {
+		return cached.([]field)
+	}
+
+	var parsed []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("validate")
+		if !ok || !sf.IsExported() {
+			continue
+		}
+		f := field{index: i, name: jsonName(sf)}
+		for _, spec := range strings.Split(tag, ",") {
+			if spec = strings.TrimSpace(spec); spec != "" {
+				f.rules = append(f.rules, parseRule(t, sf, spec))
+			}
+		}
+		parsed = append(parsed, f)
+	}
+	fieldCache.Store(t, parsed)
+	return parsed
+}
+
+// parseRule panics on a malformed tag, a programming error that surfaces on
+// the first request validated
+func parseRule(t reflect.Type, sf reflect.StructField, spec string) rule {
+	name, param, _ := strings.Cut(spec, "=")
+	r := rule{name: name}
+	switch name {
+	case "required", "email":
+	case "min", "max":
+		limit, err := strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			panic(fmt.Sprintf("validate: %s.%s: %s needs a number", t.Name(), sf.Name, name))
+		}
+		r.limit = limit
+	default:
+		panic(fmt.Sprintf("validate: %s.%s: unknown rule %q", t.Name(), sf.Name, name))
+	}
+	return r
+}
+
+func jsonName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return sf.Name
+	}
+	return name
+}
+
+func blank(v reflect.Value) bool {
+	if v.Kind() == reflect.String {
+		return strings.TrimSpace(v.String()) == ""
+	}
+	return v.IsZero()
+}
+
+func (f field) has(name string) bool {
+	for _, r := range f.rules {
+		if r.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns why v breaks the rule, or "" when it doesn't
+func (r rule) check(v reflect.Value) string {
+	switch r.name {
+	case "min", "max":
+		n, unit, ok := measure(v)
+		if !ok {
+			return ""
+		}
+		if r.name == "min" && n < r.limit {
+			return fmt.Sprintf("must be at least %d%s", r.limit, unit)
+		}
+		if r.name == "max" && n > r.limit {
+			return fmt.Sprintf("must be at most %d%s", r.limit, unit)
+		}
+	case "email":
+		if v.Kind() == reflect.String && !isEmail(v.String()) {
+			return "must be a valid email address"
+		}
+	}
+	return ""
+}
+
+// measure returns a string's length or an integer's value, with the unit
+// messages give it
+func measure(v reflect.Value) (int64, string, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return int64(utf8.RuneCountInString(v.String())), " characters", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), "", true
+	}
+	return 0, "", false
+}
+
+// isEmail accepts a bare address, such as "ada@example.com", whose domain has
+// a dot; net/mail alone also takes display names and dotless hosts
+func isEmail(s string) bool {
+	address, err := mail.ParseAddress(s)
+	if err != nil || address.Address != s {
+		return false
+	}
+	_, domain, _ := strings.Cut(s, "@")
+	return strings.Contains(domain, ".") && !strings.HasPrefix(domain, ".") && !strings.HasSuffix(domain, ".")
+}
@@ -0,0 +1,190 @@
+package verification
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/demo/resilient-app/internal/database"
+	"github.com/demo/resilient-app/internal/metrics"
+	"go.uber.org/zap"
+)
+
+const (
+	queueSize     = 100
+	tokenTTL      = 24 * time.Hour
+	sweepInterval = 30 * time.Second
+	maxAttempts   = 5
+	retryBackoff  = 2 * time.Second
+)
+
+var verificationJobsTotal = metrics.NewCounterVec(
+	metrics.Opts{
+		Name: "verification_jobs_total",
+		Help: "Total number of email verification jobs by result",
+	},
+	[]string{"result"},
+)
+
+// Worker generates verification tokens and "sends" them asynchronously so
+// that user creation never waits on the mail path
+type Worker struct {
+	logger *zap.Logger
+	db     *database.DB
+	queue  chan int
+	stop   chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+func NewWorker(logger *zap.Logger, db *database.DB) *Worker {
+	return &Worker{
+		logger: logger,
+		db:     db,
+		queue:  make(chan int, queueSize),
+		stop:   make(chan struct{}),
+	}
+}
+
+// Start launches the job consumer and the sweeper that re-enqueues users
+// whose jobs were dropped or lost
+func (w *Worker) Start() {
+	w.wg.Add(2)
+	go w.consume()
+	go w.sweep()
+}
+
+// Enqueue schedules a verification email without blocking the caller.
+// When the queue is full the job is dropped; the sweeper will pick it up later.
+func (w *Worker) Enqueue(userID int) {
+	select {
+	case w.queue <- userID:
+		verificationJobsTotal.WithLabelValues("enqueued").Inc()
+	default:
+		verificationJobsTotal.WithLabelValues("dropped").Inc()
+		w.logger.Warn("Verification queue full, deferring to sweeper", zap.Int("user_id", userID))
+	}
+}
+
+// Stop signals the background goroutines to exit and waits for the in-flight job
+func (w *Worker) Stop(ctx context.Context) error {
+	w.once.Do(func() { close(w.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		w.logger.Info("Verification worker stopped")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *Worker) consume() {
+	defer w.wg.Done()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case userID := <-w.queue:
+			w.process(userID)
+		}
+	}
+}
+
+func (w *Worker) sweep() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			ids, err := w.db.GetPendingVerifications(ctx, queueSize)
+			cancel()
+			if err != nil {
+				w.logger.Warn("Failed to load pending verifications", zap.Error(err))
+				continue
+			}
+			for _, id := range ids {
+				w.Enqueue(id)
+			}
+		}
+	}
+}
+
+func (w *Worker) process(userID int) {
+	token, err := generateToken()
+	if err != nil {
+		w.logger.Error("Failed to generate verification token", zap.Error(err))
+		verificationJobsTotal.WithLabelValues("failed").Inc()
+		return
+	}
+
+	// Retry with linear backoff; the circuit breaker fails fast while the
+	// database is down so these attempts stay cheap
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err = w.deliver(ctx, userID, token)
+		cancel()
+		if err == nil {
+			verificationJobsTotal.WithLabelValues("sent").Inc()
+			return
+		}
+		// The user was erased while the job was queued
+		if errors.Is(err, database.ErrInvalidReference) {
+			verificationJobsTotal.WithLabelValues("skipped").Inc()
+			return
+		}
+
+		w.logger.Warn("Verification job attempt failed",
+			zap.Int("user_id", userID),
+			zap.Int("attempt", attempt),
+			zap.Error(err),
+		)
+
+		select {
+		case <-w.stop:
+			verificationJobsTotal.WithLabelValues("abandoned").Inc()
+			return
+		case <-time.After(time.Duration(attempt) * retryBackoff):
+		}
+	}
+
+	verificationJobsTotal.WithLabelValues("failed").Inc()
+}
+
+func (w *Worker) deliver(ctx context.Context, userID int, token string) error {
+	if err := w.db.CreateVerificationToken(ctx, userID, token, tokenTTL); err != nil {
+		return err
+	}
+
+	// Simulated email delivery
+	w.logger.Info("Sending verification email",
+		zap.Int("user_id", userID),
+		zap.String("verify_url", "/api/v1/verify?token="+token),
+	)
+
+	return w.db.MarkVerificationSent(ctx, token)
+}
+
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,212 @@
+// Package workers runs fire-and-forget tasks spawned by handlers, such as
+// post-create hooks, on a fixed set of goroutines behind a bounded queue. A
+// burst of requests can't pile up unbounded goroutines, a panicking task
+// doesn't take the process down, and tasks still queued at termination run
+// before the database closes instead of vanishing with the pod.
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/demo/resilient-app/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// Task results reported in worker_tasks_total
+const (
+	ResultCompleted = "completed"
+	ResultFailed    = "failed"
+	ResultPanicked  = "panicked"
+	ResultRejected  = "rejected"
+	ResultDropped   = "dropped"
+)
+
+var (
+	// ErrQueueFull is returned by Submit when every worker is busy and the
+	// queue is at its limit
+	ErrQueueFull = errors.New("worker queue is full")
+	// ErrStopped is returned by Submit once the pool is shutting down
+	ErrStopped = errors.New("worker pool is stopped")
+)
+
+var (
+	tasksTotal = metrics.NewCounterVec(
+		metrics.Opts{
+			Name: "worker_tasks_total",
+			Help: "Total number of background tasks by name and result",
+		},
+		[]string{"task", "result"},
+	)
+
+	tasksQueued = metrics.NewGaugeVec(
+		metrics.Opts{
+			Name: "worker_tasks_queued",
+			Help: "Background tasks waiting for a worker",
+		},
+		[]string{},
+	)
+
+	taskDuration = metrics.NewHistogramVec(
+		metrics.Opts{
+			Name: "worker_task_duration_seconds",
+			Help: "How long background tasks ran",
+		},
+		[]string{"task"},
+	)
+)
+
+// Task is a unit of background work. Its context is canceled when the task
+// runs past the pool's task timeout or the shutdown deadline.
+type Task func(ctx context.Context) error
+
+type task struct {
+	name string
+	fn   Task
+}
+
+// Config sizes the pool
+type Config struct {
+	Workers   int
+	QueueSize int
+	// TaskTimeout bounds each task's run
+	TaskTimeout time.Duration
+}
+
+// Stats is a snapshot of the pool
+type Stats struct {
+	Workers   int `json:"workers"`
+	QueueSize int `json:"queue_size"`
+	Queued    int `json:"queued"`
+}
+
+// Pool runs submitted tasks on a fixed number of workers
+type Pool struct {
+	logger *zap.Logger
+	cfg    Config
+	queue  chan task
+
+	// ctx is canceled when Stop's deadline passes, aborting running tasks
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.RWMutex
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+// New starts a pool with cfg.Workers workers
+func New(logger *zap.Logger, cfg Config) *Pool {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{
+		logger: logger,
+		cfg:    cfg,
+		queue:  make(chan task, cfg.QueueSize),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	p.wg.Add(cfg.Workers)
+	for i := 0; i < cfg.Workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// Submit queues a task without blocking the caller. name labels the task in
+// logs and metrics. A full queue rejects the task rather than making the
+// request wait; callers decide whether that matters.
+func (p *Pool) Submit(name string, fn Task) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.stopped {
+		tasksTotal.WithLabelValues(name, ResultRejected).Inc()
+		return fmt.Errorf("%s: %w", name, ErrStopped)
+	}
+	select {
+	case p.queue <- task{name: name, fn: fn}:
+		tasksQueued.WithLabelValues().Set(float64(len(p.queue)))
+		return nil
+	default:
+		tasksTotal.WithLabelValues(name, ResultRejected).Inc()
+		return fmt.Errorf("%s: %w", name, ErrQueueFull)
+	}
+}
+
+// Stats returns the pool's size and current backlog
+func (p *Pool) Stats() Stats {
+	return Stats{Workers: p.cfg.Workers, QueueSize: p.cfg.QueueSize, Queued: len(p.queue)}
+}
+
+// Stop stops accepting tasks and waits for the queued and running ones to
+// finish. When ctx expires first, running tasks are canceled and the ones
+// still queued are dropped.
+func (p *Pool) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.stopped {
+		p.stopped = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.cancel()
+		p.logger.Info("Worker pool drained")
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+
+	for t := range p.queue {
+		tasksQueued.WithLabelValues().Set(float64(len(p.queue)))
+		if p.ctx.Err() != nil {
+			tasksTotal.WithLabelValues(t.name, ResultDropped).Inc()
+			p.logger.Warn("Dropped background task at shutdown", zap.String("task", t.name))
+			continue
+		}
+		p.run(t)
+	}
+}
+
+// run executes one task, recovering a panic so one bad task can't take the
+// worker, or the process, with it
+func (p *Pool) run(t task) {
+	ctx, cancel := context.WithTimeout(p.ctx, p.cfg.TaskTimeout)
+	defer cancel()
+
+	start := time.Now()
+	result := ResultCompleted
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			result = ResultPanicked
+			p.logger.Error("Background task panicked",
+				zap.String("task", t.name),
+				zap.Any("panic", recovered),
+				zap.Stack("stack"),
+			)
+		}
+		taskDuration.WithLabelValues(t.name).Observe(time.Since(start).Seconds())
+		tasksTotal.WithLabelValues(t.name, result).Inc()
+	}()
+
+	if err := t.fn(ctx); err != nil {
+		result = ResultFailed
+		p.logger.Warn("Background task failed", zap.String("task", t.name), zap.Error(err))
+	}
+}
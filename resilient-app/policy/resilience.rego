@@ -0,0 +1,38 @@
+# Example resilience policy for the OPA sidecar. Serve it with
+#   opa run --server policy/resilience.rego
+# and point the app at it with
+#   POLICY_URL=http://localhost:8181/v1/data/resilience/decision
+#
+# input:  health, breaker_state, breaker_requests, breaker_failures,
+#         requests, error_rate (share of 5xx since the last evaluation)
+# output: allow_fallback, shed_fraction (0..1), reason
+package resilience
+
+import rego.v1
+
+default decision := {
+	"allow_fallback": true,
+	"shed_fraction": 0,
+	"reason": "nominal",
+}
+
+# Shed a quarter of the traffic while the database breaker is open so the
+# remaining requests get fallback data quickly
+decision := {
+	"allow_fallback": true,
+	"shed_fraction": 0.25,
+	"reason": "circuit breaker open",
+} if {
+	input.breaker_state == "open"
+}
+
+# Heavy error rates on a busy pod: shed harder until it recovers
+decision := {
+	"allow_fallback": true,
+	"shed_fraction": 0.5,
+	"reason": "error rate above 50%",
+} if {
+	input.breaker_state != "open"
+	input.requests >= 20
+	input.error_rate > 0.5
+}
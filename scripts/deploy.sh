@@ -53,6 +53,9 @@ kubectl apply -f k8s/postgres.yaml
 echo -e "${BLUE}  ⏳ Waiting for database to be ready...${NC}"
 kubectl wait --for=condition=Available deployment/postgres -n resilient-demo --timeout=300s
 
+echo -e "${BLUE}  🎲 Deploying fake dependency...${NC}"
+kubectl apply -f k8s/fake-dependency.yaml
+
 echo -e "${BLUE}  🚀 Deploying application...${NC}"
 kubectl apply -f k8s/deployment.yaml
 